@@ -0,0 +1,213 @@
+// Package migrate converts AnalysisTemplates using other metric providers into metric-ai configurations
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// pluginName is the metric provider plugin key of metric-ai
+const pluginName = "argoproj-labs/metric-ai"
+
+// Options controls how templates are migrated
+type Options struct {
+	// Model is the Gemini model set in the generated configurations
+	Model string
+	// Replace drops the migrated metrics instead of keeping them next to the generated AI metrics
+	Replace bool
+}
+
+// documentSeparator splits multi-document YAML streams
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// sourceProviders are the metric providers whose metrics are migrated
+var sourceProviders = []string{"prometheus", "datadog"}
+
+// providerTitles are the display names of the source providers
+var providerTitles = map[string]string{"prometheus": "Prometheus", "datadog": "Datadog"}
+
+// Migrate reads AnalysisTemplate and ClusterAnalysisTemplate documents and adds, for each metric using
+// a Prometheus or Datadog provider, a metric-ai metric whose prompt includes the text of the original
+// query and conditions. The queries are not run: the AI metric only analyzes the logs. Other documents
+// are returned unchanged. The returned warnings list the conditions that were not carried over.
+func Migrate(in []byte, opts Options) ([]byte, []string, error) {
+	var out [][]byte
+	var warnings []string
+	migrated := 0
+	for _, doc := range documentSeparator.Split(string(in), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse document: %v", err)
+		}
+		kind, _ := obj["kind"].(string)
+		if kind != "AnalysisTemplate" && kind != "ClusterAnalysisTemplate" {
+			out = append(out, []byte(strings.TrimSpace(doc)+"\n"))
+			continue
+		}
+		n, templateWarnings, err := migrateTemplate(obj, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate %s %v: %v", kind, nestedString(obj, "metadata", "name"), err)
+		}
+		migrated += n
+		warnings = append(warnings, templateWarnings...)
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, b)
+	}
+	if migrated == 0 {
+		return nil, nil, fmt.Errorf("no Prometheus or Datadog metrics found to migrate")
+	}
+	return bytes.Join(out, []byte("---\n")), warnings, nil
+}
+
+// migrateTemplate adds metric-ai metrics for the supported metrics of a template and returns how many were
+// migrated, with a warning for every condition that was not carried over
+func migrateTemplate(obj map[string]interface{}, opts Options) (int, []string, error) {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return 0, nil, fmt.Errorf("missing spec")
+	}
+	metrics, _ := spec["metrics"].([]interface{})
+
+	var result []interface{}
+	var warnings []string
+	migrated := 0
+	for _, m := range metrics {
+		metric, ok := m.(map[string]interface{})
+		if !ok {
+			result = append(result, m)
+			continue
+		}
+		aiMetric, ok, err := migrateMetric(metric, opts)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !ok {
+			result = append(result, metric)
+			continue
+		}
+		migrated++
+		// The conditions evaluate the query result, which the AI metric doesn't have
+		for _, field := range []string{"successCondition", "failureCondition"} {
+			if c, ok := metric[field].(string); ok && c != "" {
+				warnings = append(warnings, fmt.Sprintf("%s: %s %q of metric %q was not carried over to %q, it is only described in the extraPrompt",
+					nestedString(obj, "metadata", "name"), field, c, metric["name"], aiMetric["name"]))
+			}
+		}
+		if !opts.Replace {
+			result = append(result, metric)
+		}
+		result = append(result, aiMetric)
+	}
+	spec["metrics"] = result
+	return migrated, warnings, nil
+}
+
+// migrateMetric builds the metric-ai metric equivalent to a Prometheus or Datadog metric
+func migrateMetric(metric map[string]interface{}, opts Options) (map[string]interface{}, bool, error) {
+	provider, _ := metric["provider"].(map[string]interface{})
+	var providerName string
+	var providerCfg map[string]interface{}
+	for _, name := range sourceProviders {
+		if cfg, ok := provider[name].(map[string]interface{}); ok {
+			providerName, providerCfg = name, cfg
+			break
+		}
+	}
+	if providerCfg == nil {
+		return nil, false, nil
+	}
+
+	name, _ := metric["name"].(string)
+	queries := providerQueries(providerName, providerCfg)
+	if len(queries) == 0 {
+		return nil, false, fmt.Errorf("metric %q has no %s query", name, providerName)
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "This check replaces the %s metric %q.", providerTitles[providerName], name)
+	for _, q := range queries {
+		fmt.Fprintf(&prompt, " %s query: %s.", q.name, q.query)
+	}
+	if c, ok := metric["successCondition"].(string); ok && c != "" {
+		fmt.Fprintf(&prompt, " It succeeded when: %s.", c)
+	}
+	if c, ok := metric["failureCondition"].(string); ok && c != "" {
+		fmt.Fprintf(&prompt, " It failed when: %s.", c)
+	}
+	prompt.WriteString(" Consider whether the canary logs show the behavior this query measures.")
+
+	aiMetric := map[string]interface{}{
+		"name": name + "-ai",
+		"provider": map[string]interface{}{
+			"plugin": map[string]interface{}{
+				pluginName: map[string]interface{}{
+					"model":       opts.Model,
+					"extraPrompt": prompt.String(),
+				},
+			},
+		},
+	}
+	// Keep the scheduling and tolerance of the original metric
+	for _, field := range []string{"interval", "initialDelay", "count", "failureLimit", "inconclusiveLimit", "consecutiveErrorLimit"} {
+		if v, ok := metric[field]; ok {
+			aiMetric[field] = v
+		}
+	}
+	return aiMetric, true, nil
+}
+
+// namedQuery is a provider query with a display name
+type namedQuery struct {
+	name  string
+	query string
+}
+
+// providerQueries extracts the queries of a Prometheus or Datadog provider configuration
+func providerQueries(providerName string, cfg map[string]interface{}) []namedQuery {
+	var queries []namedQuery
+	if q, ok := cfg["query"].(string); ok && q != "" {
+		queries = append(queries, namedQuery{name: providerTitles[providerName], query: strings.TrimSpace(q)})
+	}
+	// Datadog v2 metrics use named queries combined by a formula
+	if named, ok := cfg["queries"].(map[string]interface{}); ok {
+		keys := make([]string, 0, len(named))
+		for k := range named {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if q, ok := named[k].(string); ok && q != "" {
+				queries = append(queries, namedQuery{name: "Datadog " + k, query: strings.TrimSpace(q)})
+			}
+		}
+		if f, ok := cfg["formula"].(string); ok && f != "" {
+			queries = append(queries, namedQuery{name: "Datadog formula", query: f})
+		}
+	}
+	return queries
+}
+
+// nestedString returns the string at the path of a decoded object, or an empty string
+func nestedString(obj map[string]interface{}, path ...string) string {
+	var cur interface{} = obj
+	for _, p := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		cur = m[p]
+	}
+	s, _ := cur.(string)
+	return s
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+const prometheusTemplate = `apiVersion: argoproj.io/v1alpha1
+kind: AnalysisTemplate
+metadata:
+  name: success-rate
+spec:
+  args:
+    - name: service-name
+  metrics:
+    - name: success-rate
+      interval: 1m
+      count: 5
+      failureLimit: 1
+      successCondition: result[0] >= 0.95
+      provider:
+        prometheus:
+          address: http://prometheus:9090
+          query: sum(rate(http_requests_total{service="{{args.service-name}}",code!~"5.."}[5m]))
+    - name: job
+      provider:
+        job:
+          spec: {}
+`
+
+func TestMigrate(t *testing.T) {
+	out, warnings, err := Migrate([]byte(prometheusTemplate), Options{Model: "gemini-2.0-flash"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `successCondition "result[0] >= 0.95" of metric "success-rate" was not carried over`) {
+		t.Errorf("expected a warning for the dropped successCondition, got %q", warnings)
+	}
+
+	var template struct {
+		Spec struct {
+			Metrics []map[string]interface{} `json:"metrics"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal(out, &template); err != nil {
+		t.Fatalf("failed to parse output: %v", err)
+	}
+	metrics := template.Spec.Metrics
+	if len(metrics) != 3 {
+		t.Fatalf("expected the original metrics plus one AI metric, got %d metrics", len(metrics))
+	}
+	ai := metrics[1]
+	if ai["name"] != "success-rate-ai" || ai["interval"] != "1m" || ai["failureLimit"] != float64(1) {
+		t.Fatalf("unexpected AI metric %v", ai)
+	}
+	cfg := ai["provider"].(map[string]interface{})["plugin"].(map[string]interface{})[pluginName].(map[string]interface{})
+	prompt := cfg["extraPrompt"].(string)
+	if _, ok := ai["successCondition"]; ok {
+		t.Errorf("expected the successCondition of the query result not to be set on the AI metric, got %v", ai)
+	}
+	for _, want := range []string{"Prometheus query: sum(rate(http_requests_total", "{{args.service-name}}", "result[0] >= 0.95"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected extraPrompt to contain %q, got %q", want, prompt)
+		}
+	}
+
+	out, _, err = Migrate([]byte(prometheusTemplate), Options{Model: "gemini-2.0-flash", Replace: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(out), "prometheus:") {
+		t.Errorf("expected the Prometheus metric to be replaced, got:\n%s", out)
+	}
+
+	if _, _, err := Migrate([]byte("kind: ConfigMap\n"), Options{}); err == nil {
+		t.Error("expected an error when there is nothing to migrate")
+	}
+}
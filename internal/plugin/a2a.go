@@ -2,19 +2,69 @@ package plugin
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// Kubernetes Agent defaults, overridden by the K8S_AGENT_URL environment variable and the agentUrl and
+// agentPath metric fields
+const (
+	defaultAgentURL  = "http://kubernetes-agent.argo-rollouts.svc.cluster.local:8080"
+	defaultAgentPath = "/a2a/analyze"
+	// defaultAgentTimeout bounds an agent analysis, including the health check and retries, unless
+	// agentTimeout is set
+	defaultAgentTimeout = 5 * time.Minute
+)
+
+// Limits of retrying failed agent requests. Responses asking to wait longer are not retried.
+var (
+	agentMaxRetries   = 3
+	agentMaxRetryWait = 60 * time.Second
+)
+
+// AgentCompressionGzip compresses agent requests with gzip. HTTP requests are streamed with chunked
+// transfer encoding, so multi-MB logs are neither buffered whole nor sent as a single huge body.
+const AgentCompressionGzip = "gzip"
+
+// maxAgentAnalysisLength bounds the analysis text of the agent, longer answers are junk rather than
+// an analysis
+const maxAgentAnalysisLength = 50000
+
+// Polling of asynchronous agent jobs by resumed measurements
+const (
+	agentJobPollInterval = 30 * time.Second
+	agentJobTimeout      = 30 * time.Minute
 )
 
 // A2AClient handles communication with the Kubernetes Agent via A2A protocol
 type A2AClient struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL string
+	// protocol is the A2A protocol or the legacy analysis endpoint
+	protocol string
+	// analyzePath is the path of the legacy analysis endpoint
+	analyzePath string
+	// compression is the compression of requests, none when empty
+	compression string
+	httpClient  *http.Client
+	// card is the discovered agent card of the A2A protocol
+	cardMu sync.Mutex
+	card   *a2aAgentCard
+	// grpcConn is the connection of the gRPC protocol, created on first use
+	grpcMu   sync.Mutex
+	grpcConn *grpc.ClientConn
 }
 
 // A2ARequest represents a request to the Kubernetes Agent
@@ -22,6 +72,41 @@ type A2ARequest struct {
 	UserID  string                 `json:"userId"`
 	Prompt  string                 `json:"prompt"`
 	Context map[string]interface{} `json:"context"`
+	// Async asks the agent to return a job polled until the analysis is done
+	Async bool `json:"async,omitempty"`
+}
+
+// A2ARolloutContext describes the rollout of an analysis, so the agent decides with the same
+// information as default mode
+type A2ARolloutContext struct {
+	RolloutName string
+	Revision    string
+	CanaryImage string
+	StableImage string
+	// ExtraPrompt holds the additional instructions of the metric
+	ExtraPrompt string
+	// Model is the configured model, a preference the agent may ignore
+	Model string
+	// NoPullRequests asks the agent not to open pull requests with fixes, see allowAgentPRs
+	NoPullRequests bool
+}
+
+// Agent job statuses
+const (
+	A2AJobPending   = "pending"
+	A2AJobRunning   = "running"
+	A2AJobCompleted = "completed"
+	A2AJobFailed    = "failed"
+)
+
+// A2AJob is an asynchronous analysis of the Kubernetes Agent
+type A2AJob struct {
+	ID     string `json:"jobId"`
+	Status string `json:"status"`
+	// Result is set once the job is completed
+	Result *A2AResponse `json:"result,omitempty"`
+	// Error explains why the job failed
+	Error string `json:"error,omitempty"`
 }
 
 // A2AResponse represents the response from the Kubernetes Agent
@@ -32,31 +117,132 @@ type A2AResponse struct {
 	PRLink      string `json:"prLink,omitempty"`
 	Promote     bool   `json:"promote"`
 	Confidence  int    `json:"confidence"`
+	// Findings are the intermediate findings of the agent investigation, when it reports them
+	Findings []string `json:"findings,omitempty"`
 }
 
 // NewA2AClient creates a new A2A client
 func NewA2AClient(baseURL string) *A2AClient {
 	return &A2AClient{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Minute, // Agent analysis may take time
-		},
+		baseURL:     baseURL,
+		protocol:    AgentProtocolLegacy,
+		analyzePath: defaultAgentPath,
+		// Requests are bounded by the agentTimeout of each analysis instead of a client timeout
+		httpClient: &http.Client{Transport: outboundTransport},
 	}
 }
 
-// AnalyzeWithAgent sends analysis request to Kubernetes Agent
-func (c *A2AClient) AnalyzeWithAgent(namespace, podName, stableLogs, canaryLogs string) (*A2AResponse, error) {
-	log.WithFields(log.Fields{
+// AnalyzeWithAgent sends analysis request to Kubernetes Agent, authenticated with the bearer token when set
+func (c *A2AClient) AnalyzeWithAgent(ctx context.Context, namespace, podName, stableLogs, canaryLogs string, rollout A2ARolloutContext, token string) (*A2AResponse, error) {
+	log.WithContext(ctx).WithFields(log.Fields{
 		"namespace": namespace,
 		"podName":   podName,
 	}).Info("Sending analysis request to Kubernetes Agent")
 
+	switch c.protocol {
+	case AgentProtocolGRPC:
+		return c.analyzeGRPC(ctx, namespace, podName, stableLogs, canaryLogs, rollout, token)
+	case AgentProtocolLegacy:
+	default:
+		return c.analyzeTask(ctx, namespace, podName, stableLogs, canaryLogs, rollout, token)
+	}
+	resp, err := c.send(ctx, http.MethodPost, c.analyzePath, newA2ARequest(namespace, podName, stableLogs, canaryLogs, rollout), token)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returned status %d", resp.StatusCode)
+	}
+	return decodeA2AResponse(resp.Body)
+}
+
+// SubmitAnalysis submits an asynchronous analysis to the Kubernetes Agent. Agents without jobs
+// answer right away, their analysis is returned as a completed job.
+func (c *A2AClient) SubmitAnalysis(ctx context.Context, namespace, podName, stableLogs, canaryLogs string, rollout A2ARolloutContext, token string) (*A2AJob, error) {
+	log.WithContext(ctx).WithFields(log.Fields{
+		"namespace": namespace,
+		"podName":   podName,
+	}).Info("Submitting analysis job to Kubernetes Agent")
+
+	switch c.protocol {
+	case AgentProtocolGRPC:
+		// The gRPC transport has no jobs
+		result, err := c.analyzeGRPC(ctx, namespace, podName, stableLogs, canaryLogs, rollout, token)
+		if err != nil {
+			return nil, err
+		}
+		return &A2AJob{Status: A2AJobCompleted, Result: result}, nil
+	case AgentProtocolLegacy:
+	default:
+		task, err := c.sendTask(ctx, namespace, podName, stableLogs, canaryLogs, rollout, token, false)
+		if err != nil {
+			return nil, err
+		}
+		return a2aTaskJob(task)
+	}
+	req := newA2ARequest(namespace, podName, stableLogs, canaryLogs, rollout)
+	req.Async = true
+	resp, err := c.send(ctx, http.MethodPost, c.analyzePath, req, token)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		result, err := decodeA2AResponse(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &A2AJob{Status: A2AJobCompleted, Result: result}, nil
+	case http.StatusAccepted:
+		return decodeA2AJob(resp.Body)
+	default:
+		return nil, fmt.Errorf("agent returned status %d", resp.StatusCode)
+	}
+}
+
+// GetJob returns the status of an analysis job, and its analysis once completed
+func (c *A2AClient) GetJob(ctx context.Context, jobID, token string) (*A2AJob, error) {
+	if c.protocol == AgentProtocolGRPC {
+		return nil, fmt.Errorf("agent jobs are not supported by the %s protocol", AgentProtocolGRPC)
+	}
+	if c.protocol != AgentProtocolLegacy {
+		task, err := c.getTask(ctx, jobID, token)
+		if err != nil {
+			return nil, err
+		}
+		return a2aTaskJob(task)
+	}
+	resp, err := c.send(ctx, http.MethodGet, c.analyzePath+"/"+url.PathEscape(jobID), nil, token)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returned status %d for job %s", resp.StatusCode, jobID)
+	}
+	return decodeA2AJob(resp.Body)
+}
+
+// newA2ARequest returns the analysis request of a canary
+func newA2ARequest(namespace, podName, stableLogs, canaryLogs string, rollout A2ARolloutContext) A2ARequest {
+	prompt := fmt.Sprintf(
+		"Analyze canary deployment issue. Namespace: %s, Pod: %s. Compare stable vs canary behavior and determine if canary should be promoted.",
+		namespace, podName,
+	)
+	if rollout.NoPullRequests {
+		prompt += " Do not open pull requests."
+	}
+	if rollout.ExtraPrompt != "" {
+		prompt += " Additional instructions: " + rollout.ExtraPrompt
+	}
 	req := A2ARequest{
 		UserID: "argo-rollouts",
-		Prompt: fmt.Sprintf(
-			"Analyze canary deployment issue. Namespace: %s, Pod: %s. Compare stable vs canary behavior and determine if canary should be promoted.",
-			namespace, podName,
-		),
+		Prompt: prompt,
 		Context: map[string]interface{}{
 			"namespace":  namespace,
 			"podName":    podName,
@@ -64,28 +250,112 @@ func (c *A2AClient) AnalyzeWithAgent(namespace, podName, stableLogs, canaryLogs
 			"canaryLogs": canaryLogs,
 		},
 	}
-
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	// Only the known values are sent, agents tell them apart from empty ones
+	for key, value := range map[string]string{
+		"rolloutName": rollout.RolloutName,
+		"revision":    rollout.Revision,
+		"canaryImage": rollout.CanaryImage,
+		"stableImage": rollout.StableImage,
+		"extraPrompt": rollout.ExtraPrompt,
+		"model":       rollout.Model,
+	} {
+		if value != "" {
+			req.Context[key] = value
+		}
 	}
+	if rollout.NoPullRequests {
+		req.Context["allowPullRequests"] = false
+	}
+	return req
+}
 
-	resp, err := c.httpClient.Post(
-		c.baseURL+"/a2a/analyze",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
+// send sends a request to a path of the agent
+func (c *A2AClient) send(ctx context.Context, method, path string, payload interface{}, token string) (*http.Response, error) {
+	return c.sendURL(ctx, method, c.baseURL+path, payload, token)
+}
+
+// sendURL sends a request to the agent, with the JSON of the payload as body when not nil,
+// authenticated with the bearer token when set
+func (c *A2AClient) sendURL(ctx context.Context, method, target string, payload interface{}, token string) (*http.Response, error) {
+	compress := payload != nil && c.compression == AgentCompressionGzip
+	var body []byte
+	if payload != nil && !compress {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
 	}
-	defer resp.Body.Close()
+	return c.doWithRetry(ctx, func() (*http.Request, error) {
+		var reader io.Reader
+		if compress {
+			reader = gzipJSON(payload)
+		} else if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, method, target, reader)
+		if err != nil {
+			return nil, err
+		}
+		if payload != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+		if compress {
+			httpReq.Header.Set("Content-Encoding", "gzip")
+		}
+		if token != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+		return httpReq, nil
+	})
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("agent returned status %d", resp.StatusCode)
+// gzipJSON streams the gzipped JSON of a payload. The size of the body is unknown, so it is sent with
+// chunked transfer encoding. The transport closes the body when the request fails, which stops the
+// encoding.
+func gzipJSON(payload interface{}) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(w)
+		err := json.NewEncoder(zw).Encode(payload)
+		if err == nil {
+			err = zw.Close()
+		}
+		w.CloseWithError(err)
+	}()
+	return r
+}
+
+// decodeA2AJob decodes an analysis job
+func decodeA2AJob(body io.Reader) (*A2AJob, error) {
+	// The result is validated like synchronous analyses
+	var decoded struct {
+		A2AJob
+		Result json.RawMessage `json:"result,omitempty"`
 	}
+	if err := json.NewDecoder(body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %v", err)
+	}
+	job := decoded.A2AJob
+	if job.Status == A2AJobCompleted {
+		if len(decoded.Result) == 0 || string(decoded.Result) == "null" {
+			return nil, fmt.Errorf("agent job %s completed without result", job.ID)
+		}
+		result, err := parseA2AResponse(decoded.Result)
+		if err != nil {
+			return nil, fmt.Errorf("agent job %s: %w", job.ID, err)
+		}
+		job.Result = result
+	}
+	if job.Status != A2AJobCompleted && job.ID == "" {
+		return nil, fmt.Errorf("agent job has no jobId")
+	}
+	return &job, nil
+}
 
+// decodeA2AResponse decodes the analysis of the agent
+func decodeA2AResponse(body io.Reader) (*A2AResponse, error) {
 	// Read the response body
-	bodyBytes, err := io.ReadAll(resp.Body)
+	bodyBytes, err := io.ReadAll(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %v", err)
 	}
@@ -93,9 +363,9 @@ func (c *A2AClient) AnalyzeWithAgent(namespace, podName, stableLogs, canaryLogs
 	// Log the full JSON response
 	log.WithField("response", string(bodyBytes)).Info("Response from Kubernetes Agent")
 
-	var result A2AResponse
-	if err := json.Unmarshal(bodyBytes, &result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
+	result, err := parseA2AResponse(bodyBytes)
+	if err != nil {
+		return nil, err
 	}
 
 	log.WithFields(log.Fields{
@@ -107,24 +377,156 @@ func (c *A2AClient) AnalyzeWithAgent(namespace, podName, stableLogs, canaryLogs
 		"prLink":      result.PRLink,
 	}).Info("Received analysis from Kubernetes Agent")
 
+	return result, nil
+}
+
+// invalidAgentResponseError is an agent answer that is not a usable analysis, with the raw answer for
+// troubleshooting
+type invalidAgentResponseError struct {
+	err error
+	raw string
+}
+
+func (e *invalidAgentResponseError) Error() string {
+	return fmt.Sprintf("invalid agent response: %v", e.err)
+}
+
+func (e *invalidAgentResponseError) Unwrap() error { return e.err }
+
+// agentRawResponse returns the raw answer of an invalid agent response error, if any
+func agentRawResponse(err error) string {
+	var invalid *invalidAgentResponseError
+	if errors.As(err, &invalid) {
+		return invalid.raw
+	}
+	return ""
+}
+
+// parseA2AResponse decodes the analysis of the agent, which must have a boolean promote, an integer
+// confidence within 0-100 and an analysis text of at most maxAgentAnalysisLength characters. A default
+// promote: false result would look like a legitimate rejection.
+func parseA2AResponse(raw []byte) (*A2AResponse, error) {
+	invalid := func(err error) error {
+		return &invalidAgentResponseError{err: err, raw: string(raw)}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, invalid(err)
+	}
+	if promote := string(fields["promote"]); promote != "true" && promote != "false" {
+		return nil, invalid(fmt.Errorf("promote is not a boolean"))
+	}
+	if _, ok := fields["confidence"]; !ok {
+		return nil, invalid(fmt.Errorf("missing confidence"))
+	}
+	var result A2AResponse
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, invalid(err)
+	}
+	if err := validateA2AResponse(&result); err != nil {
+		return nil, invalid(err)
+	}
 	return &result, nil
 }
 
-// HealthCheck checks if the Kubernetes Agent is available
-// Returns nil if the agent responds (even with 404), as long as it's reachable
-func (c *A2AClient) HealthCheck() error {
-	resp, err := c.httpClient.Get(c.baseURL + "/")
+// validateA2AResponse checks the confidence and analysis text of a decoded agent analysis
+func validateA2AResponse(result *A2AResponse) error {
+	if result.Confidence < 0 || result.Confidence > 100 {
+		return fmt.Errorf("confidence %d is not between 0 and 100", result.Confidence)
+	}
+	if strings.TrimSpace(result.Analysis) == "" {
+		return fmt.Errorf("empty analysis")
+	}
+	if len(result.Analysis) > maxAgentAnalysisLength {
+		return fmt.Errorf("analysis of %d characters exceeds %d", len(result.Analysis), maxAgentAnalysisLength)
+	}
+	return nil
+}
+
+// HealthCheck checks if the Kubernetes Agent is available. With a health path the agent must answer it
+// with a 2xx status, otherwise any response of the agent root, even 404, means it is reachable.
+func (c *A2AClient) HealthCheck(ctx context.Context, healthPath string) error {
+	if c.protocol == AgentProtocolGRPC {
+		return c.grpcHealthCheck(ctx, healthPath)
+	}
+	path := healthPath
+	if path == "" {
+		path = "/"
+	}
+	resp, err := c.doWithRetry(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	})
 	if err != nil {
 		return fmt.Errorf("health check failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// Accept any response from the agent (even 404) as it means the service is reachable
+	if healthPath != "" && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Errorf("health check failed: agent returned status %d for %s", resp.StatusCode, healthPath)
+	}
+	// Without a health path any response means the service is reachable
 	// A 404 just means the health endpoint doesn't exist, but the agent is running
-	log.WithField("statusCode", resp.StatusCode).Debug("Kubernetes Agent responded to health check")
+	log.WithContext(ctx).WithField("statusCode", resp.StatusCode).Debug("Kubernetes Agent responded to health check")
 	return nil
 }
 
+// doWithRetry sends a request built by newRequest, retrying connection errors and the transient
+// 429, 502, 503 and 504 statuses with exponential backoff or after the Retry-After of the agent.
+// Other errors are not retried as the agent may have acted on the request, e.g. opened a PR.
+func (c *A2AClient) doWithRetry(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var resp *http.Response
+	attempt := 0
+	err := retryWithBackoff(ctx, func() error {
+		attempt++
+		req, err := newRequest()
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+		r, err := c.httpClient.Do(req)
+		if err != nil {
+			err = fmt.Errorf("failed to send request: %v", err)
+			if attempt > agentMaxRetries || ctx.Err() != nil {
+				return err
+			}
+			return &retryableError{err: err, retryAfter: -1}
+		}
+		switch r.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			wait := parseRetryAfter(r.Header.Get("Retry-After"), time.Now())
+			if attempt > agentMaxRetries || wait > agentMaxRetryWait {
+				break
+			}
+			_, _ = io.Copy(io.Discard, r.Body)
+			r.Body.Close()
+			return &retryableError{err: fmt.Errorf("agent returned status %d", r.StatusCode), retryAfter: wait}
+		}
+		resp = r
+		return nil
+	}, agentMaxRetries)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// parseRetryAfter returns the wait of a Retry-After header in seconds or as an HTTP date, or a
+// negative duration when it is not set
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return -1
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return -1
+}
+
 // splitLogs splits the combined logs context into stable and canary logs
 func splitLogs(logsContext string) (string, string) {
 	// The logsContext format: "--- STABLE LOGS ---\n...\n--- CANARY LOGS ---\n..."
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeWithAgentToken(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewEncoder(w).Encode(A2AResponse{Analysis: "ok", Promote: true, Confidence: 90})
+	}))
+	defer server.Close()
+
+	client := NewA2AClient(server.URL)
+	client.protocol = AgentProtocolLegacy
+	if _, err := client.AnalyzeWithAgent(context.Background(), "shop", "checkout", "", "", A2ARolloutContext{}, "team-token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth != "Bearer team-token" {
+		t.Errorf("expected the agent token, got %q", auth)
+	}
+	if _, err := client.AnalyzeWithAgent(context.Background(), "shop", "checkout", "", "", A2ARolloutContext{}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth != "" {
+		t.Errorf("expected no authorization without token, got %q", auth)
+	}
+}
+
+func TestAnalyzeWithAgentRetries(t *testing.T) {
+	var calls int
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(A2AResponse{Analysis: "ok", Promote: true, Confidence: 90})
+	}))
+	defer server.Close()
+
+	client := NewA2AClient(server.URL)
+	client.protocol = AgentProtocolLegacy
+	resp, err := client.AnalyzeWithAgent(context.Background(), "shop", "checkout", "", "", A2ARolloutContext{}, "")
+	if err != nil || !resp.Promote {
+		t.Fatalf("expected the transient errors to be retried, got %+v, error: %v", resp, err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 requests, got %d", calls)
+	}
+
+	// The agent may have acted on requests failing with other statuses
+	calls, status = 0, http.StatusInternalServerError
+	if _, err := client.AnalyzeWithAgent(context.Background(), "shop", "checkout", "", "", A2ARolloutContext{}, ""); err == nil {
+		t.Error("expected an error for an internal server error")
+	}
+	if calls != 1 {
+		t.Errorf("expected no retry of an internal server error, got %d requests", calls)
+	}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"":                              -1,
+		"30":                            30 * time.Second,
+		"Thu, 01 Jan 2026 12:00:10 GMT": 10 * time.Second,
+		"Thu, 01 Jan 2026 11:00:00 GMT": 0,
+		"soon":                          -1,
+	} {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestNewA2ARequestRolloutContext(t *testing.T) {
+	req := newA2ARequest("shop", "checkout-abc", "stable", "canary", A2ARolloutContext{})
+	for _, key := range []string{"rolloutName", "revision", "canaryImage", "stableImage", "extraPrompt", "model"} {
+		if _, ok := req.Context[key]; ok {
+			t.Errorf("expected no %s without a rollout context", key)
+		}
+	}
+
+	req = newA2ARequest("shop", "checkout-abc", "stable", "canary", A2ARolloutContext{
+		RolloutName: "checkout",
+		Revision:    "3",
+		CanaryImage: "checkout:1.1",
+		StableImage: "checkout:1.0",
+		ExtraPrompt: "Ignore cache misses.",
+		Model:       "gemini-2.5-pro",
+	})
+	want := map[string]string{
+		"rolloutName": "checkout",
+		"revision":    "3",
+		"canaryImage": "checkout:1.1",
+		"stableImage": "checkout:1.0",
+		"extraPrompt": "Ignore cache misses.",
+		"model":       "gemini-2.5-pro",
+		"podName":     "checkout-abc",
+	}
+	for key, value := range want {
+		if req.Context[key] != value {
+			t.Errorf("expected context %s %q, got %v", key, value, req.Context[key])
+		}
+	}
+	if !strings.HasSuffix(req.Prompt, "Additional instructions: Ignore cache misses.") {
+		t.Errorf("expected the extra prompt in the prompt, got %q", req.Prompt)
+	}
+}
+
+func TestAgentHealthPathAndTimeout(t *testing.T) {
+	healthy := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			if !healthy {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case defaultAgentPath:
+			time.Sleep(200 * time.Millisecond)
+			_ = json.NewEncoder(w).Encode(A2AResponse{Analysis: "ok", Promote: true, Confidence: 90})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := NewA2AClient(server.URL)
+
+	// Without a health path any answer means the agent is reachable
+	if err := client.HealthCheck(context.Background(), ""); err != nil {
+		t.Errorf("expected a 404 of the root to pass, got %v", err)
+	}
+	if err := client.HealthCheck(context.Background(), "/healthz"); err == nil {
+		t.Error("expected a failed health path to fail the check")
+	}
+	healthy = true
+	if err := client.HealthCheck(context.Background(), "/healthz"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	params := AIAnalysisParams{
+		LogsContext:     "--- STABLE LOGS ---\nok\n\n--- CANARY LOGS ---\nok",
+		AgentURL:        server.URL,
+		AgentProtocol:   AgentProtocolLegacy,
+		AgentHealthPath: "/healthz",
+		AgentTimeout:    50 * time.Millisecond,
+	}
+	if _, _, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected the agent timeout, got %v", err)
+	}
+	params.AgentTimeout = time.Second
+	if _, result, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params); err != nil || !result.Promote {
+		t.Errorf("unexpected result %+v, error: %v", result, err)
+	}
+}
+
+func TestParseA2AResponse(t *testing.T) {
+	if result, err := parseA2AResponse([]byte(`{"promote":false,"confidence":80,"analysis":"errors","rootCause":"bad config"}`)); err != nil || result.Promote || result.RootCause != "bad config" {
+		t.Fatalf("unexpected result %+v, error: %v", result, err)
+	}
+	for _, raw := range []string{
+		`not json`,
+		`{"confidence":80,"analysis":"errors"}`,
+		`{"promote":"yes","confidence":80,"analysis":"errors"}`,
+		`{"promote":true,"analysis":"errors"}`,
+		`{"promote":true,"confidence":"high","analysis":"errors"}`,
+		`{"promote":true,"confidence":150,"analysis":"errors"}`,
+		`{"promote":true,"confidence":80,"analysis":" "}`,
+		`{"promote":true,"confidence":80,"analysis":"` + strings.Repeat("x", maxAgentAnalysisLength+1) + `"}`,
+	} {
+		_, err := parseA2AResponse([]byte(raw))
+		if err == nil {
+			t.Errorf("expected %.80s to be invalid", raw)
+		} else if agentRawResponse(err) != raw {
+			t.Errorf("expected the raw response in the error of %.80s", raw)
+		}
+	}
+
+	// The raw answer of the agent is returned for the measurement metadata
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"status":"ok"}`)
+	}))
+	defer server.Close()
+	params := AIAnalysisParams{LogsContext: "--- STABLE LOGS ---\nok\n\n--- CANARY LOGS ---\nok", AgentURL: server.URL, AgentProtocol: AgentProtocolLegacy}
+	if rawJSON, _, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params); err == nil || rawJSON != `{"status":"ok"}` {
+		t.Errorf("expected an error with the raw response, got %q, error: %v", rawJSON, err)
+	}
+}
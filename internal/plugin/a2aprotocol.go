@@ -0,0 +1,345 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Agent protocols
+const (
+	// AgentProtocolA2A is the Agent2Agent protocol over JSON-RPC, see https://a2a-protocol.org
+	AgentProtocolA2A = "a2a"
+	// AgentProtocolLegacy is the /a2a/analyze endpoint of earlier kubernetes-agent versions
+	AgentProtocolLegacy = "legacy"
+)
+
+// Well-known paths of the A2A agent card, the second one of protocol versions before 0.3
+var a2aAgentCardPaths = []string{"/.well-known/agent-card.json", "/.well-known/agent.json"}
+
+// a2aTaskPollInterval is the wait between polls of tasks of synchronous analyses that the agent did
+// not finish before answering
+var a2aTaskPollInterval = 2 * time.Second
+
+// A2A task states
+const (
+	a2aTaskSubmitted     = "submitted"
+	a2aTaskWorking       = "working"
+	a2aTaskInputRequired = "input-required"
+	a2aTaskAuthRequired  = "auth-required"
+	a2aTaskCompleted     = "completed"
+	a2aTaskCanceled      = "canceled"
+	a2aTaskFailed        = "failed"
+	a2aTaskRejected      = "rejected"
+)
+
+// a2aAnalysisInstructions tells the agent how to answer, the analysis is read from the first JSON
+// object of the task artifacts or of the answer message
+const a2aAnalysisInstructions = "Answer with a JSON object with the fields promote (boolean, whether the canary should be promoted), " +
+	"confidence (integer 0-100), analysis (summary of the comparison), rootCause and remediation (for failed canaries), " +
+	"and prLink when you open a pull request with a fix. The logs and the canary are in the data part of this message."
+
+// a2aAgentCard is the part of an A2A agent card used by the plugin
+type a2aAgentCard struct {
+	Name               string `json:"name"`
+	URL                string `json:"url"`
+	ProtocolVersion    string `json:"protocolVersion,omitempty"`
+	PreferredTransport string `json:"preferredTransport,omitempty"`
+	// AdditionalInterfaces lists the other transports of the agent
+	AdditionalInterfaces []struct {
+		URL       string `json:"url"`
+		Transport string `json:"transport"`
+	} `json:"additionalInterfaces,omitempty"`
+}
+
+// a2aPart is a text or data part of an A2A message or artifact
+type a2aPart struct {
+	Kind string          `json:"kind"`
+	Text string          `json:"text,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// a2aMessage is an A2A message
+type a2aMessage struct {
+	Kind      string    `json:"kind"`
+	MessageID string    `json:"messageId"`
+	Role      string    `json:"role"`
+	Parts     []a2aPart `json:"parts"`
+}
+
+// a2aTask is an A2A task, or a message when Kind is message
+type a2aTask struct {
+	Kind      string `json:"kind"`
+	ID        string `json:"id"`
+	ContextID string `json:"contextId,omitempty"`
+	Status    struct {
+		State   string      `json:"state"`
+		Message *a2aMessage `json:"message,omitempty"`
+	} `json:"status"`
+	Artifacts []struct {
+		Name  string    `json:"name,omitempty"`
+		Parts []a2aPart `json:"parts"`
+	} `json:"artifacts,omitempty"`
+	// Parts are those of a message answer
+	Parts []a2aPart `json:"parts,omitempty"`
+}
+
+// jsonRPCResponse is a JSON-RPC 2.0 response
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// agentCard returns the agent card of the agent, discovered once per client
+func (c *A2AClient) agentCard(ctx context.Context, token string) (*a2aAgentCard, error) {
+	c.cardMu.Lock()
+	defer c.cardMu.Unlock()
+	if c.card != nil {
+		return c.card, nil
+	}
+	for _, path := range a2aAgentCardPaths {
+		resp, err := c.send(ctx, http.MethodGet, path, nil, token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get agent card: %v", err)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("agent returned status %d for agent card %s", resp.StatusCode, path)
+		}
+		var card a2aAgentCard
+		err = json.NewDecoder(resp.Body).Decode(&card)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode agent card: %v", err)
+		}
+		if card.PreferredTransport != "" && !strings.EqualFold(card.PreferredTransport, "JSONRPC") {
+			card.URL = ""
+			for _, iface := range card.AdditionalInterfaces {
+				if strings.EqualFold(iface.Transport, "JSONRPC") {
+					card.URL = iface.URL
+				}
+			}
+			if card.URL == "" {
+				return nil, fmt.Errorf("agent %s does not support the JSONRPC transport", card.Name)
+			}
+		}
+		if card.URL == "" {
+			card.URL = c.baseURL
+		}
+		log.WithContext(ctx).WithFields(log.Fields{
+			"agent":           card.Name,
+			"url":             card.URL,
+			"protocolVersion": card.ProtocolVersion,
+		}).Info("Discovered A2A agent card")
+		c.card = &card
+		return c.card, nil
+	}
+	return nil, fmt.Errorf("agent card not found at %s", strings.Join(a2aAgentCardPaths, " or "))
+}
+
+// call calls a JSON-RPC method of the agent and decodes its result
+func (c *A2AClient) call(ctx context.Context, method string, params interface{}, token string, result interface{}) error {
+	card, err := c.agentCard(ctx, token)
+	if err != nil {
+		return err
+	}
+	id, err := newA2AID()
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+	resp, err := c.sendURL(ctx, http.MethodPost, card.URL, req, token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("agent returned status %d for %s", resp.StatusCode, method)
+	}
+	var rpcResp jsonRPCResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", method, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("agent returned error %d for %s: %s", rpcResp.Error.Code, method, rpcResp.Error.Message)
+	}
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return fmt.Errorf("failed to decode %s result: %v", method, err)
+	}
+	return nil
+}
+
+// sendTask sends the analysis message of a canary, returning the task (or message) of the agent.
+// Blocking asks the agent to answer once the task is done.
+func (c *A2AClient) sendTask(ctx context.Context, namespace, podName, stableLogs, canaryLogs string, rollout A2ARolloutContext, token string, blocking bool) (*a2aTask, error) {
+	req := newA2ARequest(namespace, podName, stableLogs, canaryLogs, rollout)
+	data, err := json.Marshal(req.Context)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+	messageID, err := newA2AID()
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{
+		"message": a2aMessage{
+			Kind:      "message",
+			MessageID: messageID,
+			Role:      "user",
+			Parts: []a2aPart{
+				{Kind: "text", Text: req.Prompt + " " + a2aAnalysisInstructions},
+				{Kind: "data", Data: data},
+			},
+		},
+		"configuration": map[string]interface{}{
+			"blocking":            blocking,
+			"acceptedOutputModes": []string{"application/json", "text/plain"},
+		},
+	}
+	var task a2aTask
+	if err := c.call(ctx, "message/send", params, token, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// getTask returns a task of the agent
+func (c *A2AClient) getTask(ctx context.Context, taskID, token string) (*a2aTask, error) {
+	var task a2aTask
+	if err := c.call(ctx, "tasks/get", map[string]interface{}{"id": taskID}, token, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// analyzeTask runs the analysis as an A2A task, polling it until done
+func (c *A2AClient) analyzeTask(ctx context.Context, namespace, podName, stableLogs, canaryLogs string, rollout A2ARolloutContext, token string) (*A2AResponse, error) {
+	task, err := c.sendTask(ctx, namespace, podName, stableLogs, canaryLogs, rollout, token, true)
+	if err != nil {
+		return nil, err
+	}
+	// The status messages of the working task are the findings of the agent
+	var findings []string
+	for {
+		job, err := a2aTaskJob(task)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status == A2AJobRunning && task.Status.Message != nil {
+			if text := a2aText(task.Status.Message.Parts); text != "" && (len(findings) == 0 || findings[len(findings)-1] != text) {
+				findings = append(findings, text)
+			}
+		}
+		switch job.Status {
+		case A2AJobCompleted:
+			job.Result.Findings = append(findings, job.Result.Findings...)
+			return job.Result, nil
+		case A2AJobFailed:
+			return nil, fmt.Errorf("agent task %s failed: %s", job.ID, job.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("agent task %s not done: %v", job.ID, ctx.Err())
+		case <-time.After(a2aTaskPollInterval):
+		}
+		if task, err = c.getTask(ctx, job.ID, token); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// a2aTaskJob converts an A2A task, or message answer, to an analysis job
+func a2aTaskJob(task *a2aTask) (*A2AJob, error) {
+	if task.Kind == "message" {
+		result, err := a2aAnalysis(task.Parts)
+		if err != nil {
+			return nil, err
+		}
+		return &A2AJob{Status: A2AJobCompleted, Result: result}, nil
+	}
+	if task.ID == "" {
+		return nil, fmt.Errorf("agent returned a task without id")
+	}
+	job := &A2AJob{ID: task.ID}
+	switch task.Status.State {
+	case a2aTaskSubmitted:
+		job.Status = A2AJobPending
+	case a2aTaskWorking:
+		job.Status = A2AJobRunning
+	case a2aTaskCompleted:
+		var parts []a2aPart
+		for _, artifact := range task.Artifacts {
+			parts = append(parts, artifact.Parts...)
+		}
+		if task.Status.Message != nil {
+			parts = append(parts, task.Status.Message.Parts...)
+		}
+		result, err := a2aAnalysis(parts)
+		if err != nil {
+			return nil, fmt.Errorf("agent task %s: %w", task.ID, err)
+		}
+		job.Status, job.Result = A2AJobCompleted, result
+	case a2aTaskFailed, a2aTaskRejected, a2aTaskCanceled:
+		job.Status, job.Error = A2AJobFailed, task.Status.State
+		if task.Status.Message != nil {
+			job.Error += ": " + a2aText(task.Status.Message.Parts)
+		}
+	case a2aTaskInputRequired, a2aTaskAuthRequired:
+		// The plugin cannot answer the agent
+		job.Status, job.Error = A2AJobFailed, "the agent asked for more input ("+task.Status.State+")"
+	default:
+		return nil, fmt.Errorf("agent task %s has unknown state %q", task.ID, task.Status.State)
+	}
+	return job, nil
+}
+
+// a2aAnalysis reads the analysis from the first data part, or JSON object of a text part, with a
+// promote field
+func a2aAnalysis(parts []a2aPart) (*A2AResponse, error) {
+	for _, part := range parts {
+		raw := []byte(part.Data)
+		if part.Kind == "text" {
+			raw = []byte(extractFirstJSON(part.Text))
+		}
+		var fields map[string]json.RawMessage
+		if len(raw) == 0 || json.Unmarshal(raw, &fields) != nil || fields["promote"] == nil {
+			continue
+		}
+		return parseA2AResponse(raw)
+	}
+	return nil, fmt.Errorf("no analysis with a promote field in the agent answer")
+}
+
+// a2aText concatenates the text parts of a message
+func a2aText(parts []a2aPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Kind == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// newA2AID returns a random message or request ID
+func newA2AID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate message id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
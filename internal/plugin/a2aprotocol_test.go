@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestA2AProtocol(t *testing.T) {
+	oldInterval := a2aTaskPollInterval
+	a2aTaskPollInterval = time.Millisecond
+	t.Cleanup(func() { a2aTaskPollInterval = oldInterval })
+
+	var server *httptest.Server
+	var blocking []bool
+	tasks := map[string]string{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/agent.json":
+			_ = json.NewEncoder(w).Encode(map[string]string{"name": "kubernetes-agent", "url": server.URL + "/rpc"})
+			return
+		case "/rpc":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				ID      string     `json:"id"`
+				Message a2aMessage `json:"message"`
+				Config  struct {
+					Blocking bool `json:"blocking"`
+				} `json:"configuration"`
+			} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid JSON-RPC request: %v", err)
+		}
+		var result string
+		switch req.Method {
+		case "message/send":
+			blocking = append(blocking, req.Params.Config.Blocking)
+			if len(req.Params.Message.Parts) != 2 || !strings.Contains(string(req.Params.Message.Parts[1].Data), `"podName":"checkout"`) {
+				t.Errorf("expected the prompt and the canary data parts, got %+v", req.Params.Message.Parts)
+			}
+			id := fmt.Sprintf("task-%d", len(blocking))
+			tasks[id] = "working"
+			result = `{"kind":"task","id":"` + id + `","status":{"state":"working"}}`
+		case "tasks/get":
+			switch req.Params.ID {
+			case "task-1":
+				result = `{"kind":"task","id":"task-1","status":{"state":"completed"},"artifacts":[{"parts":[{"kind":"text","text":"Done: {\"promote\": false, \"confidence\": 90, \"analysis\": \"errors\"}"}]}]}`
+			default:
+				result = `{"kind":"task","id":"` + req.Params.ID + `","status":{"state":"failed","message":{"kind":"message","messageId":"m","role":"agent","parts":[{"kind":"text","text":"no pods"}]}}}`
+			}
+		}
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%q,"result":%s}`, req.ID, result)
+	}))
+	defer server.Close()
+
+	client := NewA2AClient(server.URL)
+	// The legacy endpoint stays the default so existing agent deployments keep working
+	if client.protocol != AgentProtocolLegacy {
+		t.Fatalf("expected the legacy protocol by default, got %q", client.protocol)
+	}
+	client.protocol = AgentProtocolA2A
+	resp, err := client.AnalyzeWithAgent(context.Background(), "shop", "checkout", "stable", "canary", A2ARolloutContext{}, "")
+	if err != nil || resp.Promote || resp.Confidence != 90 || resp.Analysis != "errors" {
+		t.Fatalf("expected the analysis of the completed task, got %+v, error: %v", resp, err)
+	}
+
+	job, err := client.SubmitAnalysis(context.Background(), "shop", "checkout", "stable", "canary", A2ARolloutContext{}, "")
+	if err != nil || job.ID != "task-2" || job.Status != A2AJobRunning {
+		t.Fatalf("expected the running task, got %+v, error: %v", job, err)
+	}
+	if len(blocking) != 2 || !blocking[0] || blocking[1] {
+		t.Errorf("expected a blocking and a non-blocking message, got %v", blocking)
+	}
+	job, err = client.GetJob(context.Background(), "task-2", "")
+	if err != nil || job.Status != A2AJobFailed || job.Error != "failed: no pods" {
+		t.Errorf("expected the failed task, got %+v, error: %v", job, err)
+	}
+
+	// Agents can answer with a message instead of a task
+	job, err = a2aTaskJob(&a2aTask{Kind: "message", Parts: []a2aPart{{Kind: "data", Data: json.RawMessage(`{"promote":true,"confidence":70,"analysis":"ok"}`)}}})
+	if err != nil || job.Status != A2AJobCompleted || !job.Result.Promote {
+		t.Errorf("expected the analysis of the message, got %+v, error: %v", job, err)
+	}
+	task := &a2aTask{ID: "task-3"}
+	task.Status.State = "input-required"
+	if job, err := a2aTaskJob(task); err != nil || job.Status != A2AJobFailed {
+		t.Errorf("expected tasks asking for input to fail, got %+v, error: %v", job, err)
+	}
+}
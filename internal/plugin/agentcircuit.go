@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Agent fallback policies, what agent mode does when the Kubernetes Agent is unavailable
+const (
+	AgentFallbackFail    = "fail"    // Fail the measurement (default)
+	AgentFallbackDefault = "default" // Analyze with the model as in default mode
+)
+
+// Circuit breaker of the Kubernetes Agent. After agentCircuitThreshold consecutive failures the agent
+// is not called for agentCircuitCooldown, then a single failure opens the circuit again.
+var (
+	agentCircuitThreshold = 3
+	agentCircuitCooldown  = 5 * time.Minute
+)
+
+// agentCircuits tracks the consecutive failures of the agents, keyed by agent URL
+var agentCircuits = struct {
+	sync.Mutex
+	entries map[string]*agentCircuit
+}{entries: make(map[string]*agentCircuit)}
+
+type agentCircuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+// validateAgentFallback checks the agentFallback of a metric
+func validateAgentFallback(fallback string) error {
+	switch fallback {
+	case "", AgentFallbackFail, AgentFallbackDefault:
+		return nil
+	}
+	return fmt.Errorf("invalid agentFallback %q, expected %s or %s", fallback, AgentFallbackFail, AgentFallbackDefault)
+}
+
+// agentCircuitOpenUntil returns until when the circuit of an agent is open, or false when the agent
+// can be called
+func agentCircuitOpenUntil(agentURL string, now time.Time) (time.Time, bool) {
+	agentCircuits.Lock()
+	defer agentCircuits.Unlock()
+	if circuit, ok := agentCircuits.entries[agentURL]; ok && now.Before(circuit.openUntil) {
+		return circuit.openUntil, true
+	}
+	return time.Time{}, false
+}
+
+// recordAgentResult closes the circuit of an agent on success and counts its failures otherwise,
+// opening the circuit at the threshold
+func recordAgentResult(agentURL string, err error, now time.Time) {
+	agentCircuits.Lock()
+	defer agentCircuits.Unlock()
+	if err == nil {
+		delete(agentCircuits.entries, agentURL)
+		return
+	}
+	circuit, ok := agentCircuits.entries[agentURL]
+	if !ok {
+		circuit = &agentCircuit{}
+		agentCircuits.entries[agentURL] = circuit
+	}
+	circuit.failures++
+	if circuit.failures >= agentCircuitThreshold {
+		circuit.openUntil = now.Add(agentCircuitCooldown)
+		log.WithFields(log.Fields{
+			"agentURL":  agentURL,
+			"failures":  circuit.failures,
+			"openUntil": circuit.openUntil,
+		}).Warn("Kubernetes Agent keeps failing, opening circuit")
+	}
+}
+
+// analyzeWithAgentCircuit analyzes with the Kubernetes Agent unless its circuit is open, falling back
+// to the model when params.AgentFallback is default so an agent outage doesn't block rollouts
+func analyzeWithAgentCircuit(ctx context.Context, namespace, podName string, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+	agentURL := agentURLFor(params)
+	var rawJSON string
+	var result AIAnalysisResult
+	var err error
+	if openUntil, open := agentCircuitOpenUntil(agentURL, time.Now()); open {
+		err = fmt.Errorf("kubernetes agent circuit is open after %d consecutive failures, retrying the agent after %s",
+			agentCircuitThreshold, openUntil.Format(time.RFC3339))
+	} else {
+		rawJSON, result, err = analyzeWithKubernetesAgent(ctx, namespace, podName, params)
+		if _, pending := agentJobPendingID(err); pending {
+			// The agent accepted the job
+			recordAgentResult(agentURL, nil, time.Now())
+			return rawJSON, result, err
+		}
+		// The measurement timing out says nothing about the agent
+		if ctx.Err() == nil {
+			recordAgentResult(agentURL, err, time.Now())
+		}
+	}
+	if err == nil || params.AgentFallback != AgentFallbackDefault {
+		return rawJSON, result, err
+	}
+
+	log.WithContext(ctx).WithError(err).Warn("Kubernetes Agent analysis failed, falling back to default mode")
+	rawJSON, result, err = analyzeLogsWithAI(ctx, params)
+	result.AgentFallback = true
+	return rawJSON, result, err
+}
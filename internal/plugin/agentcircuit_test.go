@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeWithAgentCircuit(t *testing.T) {
+	var analyzeCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			analyzeCalls++
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	oldAnalyze := analyzeLogsWithAI
+	analyzeLogsWithAI = func(ctx context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		return `{"text":"fallback","promote":true,"confidence":80,"severity":"none"}`, AIAnalysisResult{Text: "fallback", Promote: true, Confidence: 80, Severity: SeverityNone}, nil
+	}
+	t.Cleanup(func() {
+		analyzeLogsWithAI = oldAnalyze
+		delete(agentCircuits.entries, server.URL)
+	})
+
+	params := AIAnalysisParams{AgentURL: server.URL, AgentProtocol: AgentProtocolLegacy, AgentFallback: AgentFallbackDefault}
+	for i := 0; i < agentCircuitThreshold+1; i++ {
+		_, result, err := analyzeWithMode(context.Background(), AnalysisModeAgent, params, "shop", "checkout")
+		if err != nil || !result.AgentFallback || result.Text != "fallback" {
+			t.Fatalf("expected the fallback analysis, got %+v, error: %v", result, err)
+		}
+	}
+	if analyzeCalls != agentCircuitThreshold {
+		t.Errorf("expected the agent not to be called with an open circuit, got %d calls", analyzeCalls)
+	}
+
+	params.AgentFallback = ""
+	if _, _, err := analyzeWithMode(context.Background(), AnalysisModeAgent, params, "shop", "checkout"); err == nil || !strings.Contains(err.Error(), "circuit is open") {
+		t.Errorf("expected the open circuit error, got %v", err)
+	}
+
+	// A success after the cooldown closes the circuit
+	now := time.Now()
+	if _, open := agentCircuitOpenUntil(server.URL, now.Add(agentCircuitCooldown)); open {
+		t.Error("expected the circuit to allow a call after the cooldown")
+	}
+	recordAgentResult(server.URL, nil, now)
+	if _, open := agentCircuitOpenUntil(server.URL, now); open {
+		t.Error("expected a success to close the circuit")
+	}
+
+	if err := validateAgentFallback("retry"); err == nil {
+		t.Error("expected an error for an unknown agentFallback")
+	}
+}
@@ -0,0 +1,196 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/argoproj-labs/rollouts-plugin-metric-ai/internal/agentpb"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AgentProtocolGRPC is the AgentService of agent.proto over gRPC, streaming the findings of the agent
+const AgentProtocolGRPC = "grpc"
+
+// newAgentAnalyzeRequest builds the AnalyzeRequest message of agent.proto
+func newAgentAnalyzeRequest(namespace, podName, stableLogs, canaryLogs, prompt string, rollout A2ARolloutContext) *agentpb.AnalyzeRequest {
+	return &agentpb.AnalyzeRequest{
+		Namespace:      namespace,
+		PodName:        podName,
+		StableLogs:     stableLogs,
+		CanaryLogs:     canaryLogs,
+		Prompt:         prompt,
+		RolloutName:    rollout.RolloutName,
+		Revision:       rollout.Revision,
+		CanaryImage:    rollout.CanaryImage,
+		StableImage:    rollout.StableImage,
+		ExtraPrompt:    rollout.ExtraPrompt,
+		Model:          rollout.Model,
+		NoPullRequests: rollout.NoPullRequests,
+	}
+}
+
+// agentResultResponse converts the AnalysisResult message of agent.proto
+func agentResultResponse(r *agentpb.AnalysisResult) *A2AResponse {
+	return &A2AResponse{
+		Promote:     r.GetPromote(),
+		Confidence:  int(r.GetConfidence()),
+		Analysis:    r.GetAnalysis(),
+		RootCause:   r.GetRootCause(),
+		Remediation: r.GetRemediation(),
+		PRLink:      r.GetPrLink(),
+	}
+}
+
+// grpcClientConn returns the connection to the agent, plaintext for http URLs and TLS for https ones
+// with the TLS configuration of the HTTP transport, so agentTlsSecretRef applies to both
+func (c *A2AClient) grpcClientConn() (*grpc.ClientConn, error) {
+	c.grpcMu.Lock()
+	defer c.grpcMu.Unlock()
+	if c.grpcConn != nil {
+		return c.grpcConn, nil
+	}
+	u, err := url.Parse(c.baseURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid agent URL %q", c.baseURL)
+	}
+	target := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		target = net.JoinHostPort(u.Hostname(), port)
+	}
+	creds := insecure.NewCredentials()
+	if u.Scheme == "https" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if t, ok := httpTransport(c.httpClient.Transport); ok && t.TLSClientConfig != nil {
+			tlsConfig = t.TLSClientConfig.Clone()
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %v", err)
+	}
+	c.grpcConn = conn
+	return conn, nil
+}
+
+// grpcContext adds the bearer token and the correlation ID of the measurement to the metadata of a call
+func grpcContext(ctx context.Context, token string) context.Context {
+	if id := correlationID(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(correlationHeader), id)
+	}
+	if span := currentSpan(ctx); span != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, traceparentHeader, span.traceparent())
+	}
+	if token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// analyzeGRPC streams an analysis of the AgentService, logging the findings of the agent until its
+// result. Unavailable agents are retried until the first finding, later failures are not as the agent
+// may have acted on the request.
+func (c *A2AClient) analyzeGRPC(ctx context.Context, namespace, podName, stableLogs, canaryLogs string, rollout A2ARolloutContext, token string) (*A2AResponse, error) {
+	conn, err := c.grpcClientConn()
+	if err != nil {
+		return nil, err
+	}
+	request := newA2ARequest(namespace, podName, stableLogs, canaryLogs, rollout)
+	message := newAgentAnalyzeRequest(namespace, podName, stableLogs, canaryLogs, request.Prompt, rollout)
+
+	var result *A2AResponse
+	var findings []string
+	attempt := 0
+	err = retryWithBackoff(ctx, func() error {
+		attempt++
+		findings = nil
+		err := func() error {
+			callCtx, cancel := context.WithCancel(grpcContext(ctx, token))
+			defer cancel()
+			var opts []grpc.CallOption
+			if c.compression == AgentCompressionGzip {
+				opts = append(opts, grpc.UseCompressor(grpcgzip.Name))
+			}
+			stream, err := agentpb.NewAgentServiceClient(conn).Analyze(callCtx, message, opts...)
+			if err != nil {
+				return err
+			}
+			for {
+				resp, err := stream.Recv()
+				if err != nil {
+					if errors.Is(err, io.EOF) {
+						return fmt.Errorf("agent stream ended without a result")
+					}
+					return err
+				}
+				if progress := resp.GetProgress(); progress != "" {
+					findings = append(findings, progress)
+					log.WithContext(ctx).WithFields(log.Fields{"namespace": namespace, "pod": podName}).Infof("Kubernetes Agent: %s", progress)
+				}
+				if resp.GetResult() != nil {
+					result = agentResultResponse(resp.GetResult())
+					return nil
+				}
+			}
+		}()
+		if err == nil {
+			return nil
+		}
+		code := status.Code(err)
+		err = fmt.Errorf("agent gRPC call failed: %v", err)
+		if (code == codes.Unavailable || code == codes.ResourceExhausted) && len(findings) == 0 && attempt <= agentMaxRetries && ctx.Err() == nil {
+			return &retryableError{err: err, retryAfter: -1}
+		}
+		return err
+	}, agentMaxRetries)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateA2AResponse(result); err != nil {
+		raw, _ := json.Marshal(result)
+		return nil, &invalidAgentResponseError{err: err, raw: string(raw)}
+	}
+	result.Findings = findings
+	return result, nil
+}
+
+// grpcHealthCheck checks the agent with the gRPC health service. With a health path the service named
+// by it must be serving, otherwise agents without the health service are reachable too.
+func (c *A2AClient) grpcHealthCheck(ctx context.Context, healthPath string) error {
+	conn, err := c.grpcClientConn()
+	if err != nil {
+		return fmt.Errorf("health check failed: %v", err)
+	}
+	service := strings.TrimPrefix(healthPath, "/")
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(grpcContext(ctx, ""), &grpc_health_v1.HealthCheckRequest{Service: service})
+	if err != nil {
+		if healthPath == "" && status.Code(err) == codes.Unimplemented {
+			log.WithContext(ctx).Debug("Kubernetes Agent has no gRPC health service")
+			return nil
+		}
+		return fmt.Errorf("health check failed: %v", err)
+	}
+	if resp.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("health check failed: agent status is %s", resp.GetStatus())
+	}
+	return nil
+}
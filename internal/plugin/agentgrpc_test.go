@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/argoproj-labs/rollouts-plugin-metric-ai/internal/agentpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeAgentServer streams a finding and the result of an analysis, recording the request
+type fakeAgentServer struct {
+	agentpb.UnimplementedAgentServiceServer
+	received      *agentpb.AnalyzeRequest
+	authorization []string
+}
+
+func (s *fakeAgentServer) Analyze(req *agentpb.AnalyzeRequest, stream grpc.ServerStreamingServer[agentpb.AnalyzeResponse]) error {
+	s.received = req
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.authorization = md.Get("authorization")
+	if err := stream.Send(&agentpb.AnalyzeResponse{Progress: "canary logs have new errors"}); err != nil {
+		return err
+	}
+	result := &agentpb.AnalysisResult{Analysis: "checkout fails", RootCause: "nil pointer", Confidence: 85}
+	if req.GetPodName() == "invalid" {
+		result.Confidence = 150
+	}
+	return stream.Send(&agentpb.AnalyzeResponse{Result: result})
+}
+
+func TestAnalyzeWithAgentGRPC(t *testing.T) {
+	agent := &fakeAgentServer{}
+	server := grpc.NewServer()
+	agentpb.RegisterAgentServiceServer(server, agent)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("agent", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	client := NewA2AClient("http://" + listener.Addr().String())
+	client.protocol = AgentProtocolGRPC
+	rollout := A2ARolloutContext{RolloutName: "checkout", CanaryImage: "shop/checkout:2.0"}
+	resp, err := client.AnalyzeWithAgent(context.Background(), "shop", "checkout-canary", "stable", "canary", rollout, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Promote || resp.Confidence != 85 || resp.RootCause != "nil pointer" || !slices.Equal(resp.Findings, []string{"canary logs have new errors"}) {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	received := agent.received
+	if received.GetNamespace() != "shop" || received.GetCanaryLogs() != "canary" || received.GetRolloutName() != "checkout" ||
+		received.GetCanaryImage() != "shop/checkout:2.0" || !strings.Contains(received.GetPrompt(), "checkout-canary") {
+		t.Errorf("unexpected request: %v", received)
+	}
+	if len(agent.authorization) != 1 || agent.authorization[0] != "Bearer secret" {
+		t.Errorf("expected the bearer token, got %v", agent.authorization)
+	}
+
+	job, err := client.SubmitAnalysis(context.Background(), "shop", "checkout-canary", "", "", rollout, "")
+	if err != nil || job.Status != A2AJobCompleted || job.Result == nil {
+		t.Errorf("expected a completed job, got %+v, %v", job, err)
+	}
+	_, err = client.AnalyzeWithAgent(context.Background(), "shop", "invalid", "", "", rollout, "")
+	if err == nil || !strings.Contains(agentRawResponse(err), `"confidence":150`) {
+		t.Errorf("expected an invalid response error with the raw result, got %v", err)
+	}
+
+	compressed := NewA2AClient(client.baseURL)
+	compressed.protocol, compressed.compression = AgentProtocolGRPC, AgentCompressionGzip
+	if _, err := compressed.AnalyzeWithAgent(context.Background(), "shop", "checkout-canary", "", strings.Repeat("canary ", 10000), rollout, ""); err != nil {
+		t.Errorf("unexpected error with gzip compression: %v", err)
+	}
+
+	if err := client.HealthCheck(context.Background(), ""); err != nil {
+		t.Errorf("unexpected health check error: %v", err)
+	}
+	if err := client.HealthCheck(context.Background(), "/agent"); err == nil {
+		t.Error("expected an error for a service that is not serving")
+	}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// agentTLSSecretRef selects a kubernetes.io/tls Secret in the AnalysisRun namespace with the client
+// certificate presented to the Kubernetes Agent: tls.crt, tls.key and optionally ca.crt, the CA the
+// agent certificate is verified with instead of the system CAs
+type agentTLSSecretRef struct {
+	Name string `json:"name"`
+	// namespace is set to the AnalysisRun namespace, it cannot be configured
+	namespace string
+}
+
+// agentTLSClients caches the agent clients with client certificates by secret, until the secret changes
+var agentTLSClients = struct {
+	sync.Mutex
+	entries map[string]agentTLSClientEntry
+}{entries: make(map[string]agentTLSClientEntry)}
+
+type agentTLSClientEntry struct {
+	resourceVersion string
+	client          *A2AClient
+}
+
+// newAgentTLSTransport returns a transport presenting the client certificate of a TLS secret
+func newAgentTLSTransport(data map[string][]byte) (*http.Transport, error) {
+	cert, err := tls.X509KeyPair(data["tls.crt"], data["tls.key"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %v", err)
+	}
+	var transport *http.Transport
+	if t, ok := httpTransport(outboundTransport); ok {
+		transport = t.Clone()
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if transport.TLSClientConfig != nil {
+		// Keep the CA bundle of outbound requests
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	if ca := data["ca.crt"]; len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in ca.crt")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// agentClientFor returns the agent client of a metric, authenticating with the client certificate of
+// its TLS secret when set
+func agentClientFor(ctx context.Context, baseURL, protocol, analyzePath, compression string, ref *agentTLSSecretRef) (*A2AClient, error) {
+	if ref == nil {
+		return getA2AClient(baseURL, protocol, analyzePath, compression), nil
+	}
+	if ref.Name == "" {
+		return nil, fmt.Errorf("agentTlsSecretRef requires name")
+	}
+	if ref.namespace == "" {
+		return nil, fmt.Errorf("secret %s has no namespace", ref.Name)
+	}
+	if u, err := url.Parse(baseURL); err != nil || u.Scheme != "https" {
+		return nil, fmt.Errorf("agentTlsSecretRef requires an https agent URL, got %q", baseURL)
+	}
+	client, err := acquireKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("no Kubernetes client to read agent TLS secret %s/%s", ref.namespace, ref.Name)
+	}
+	secret, err := client.CoreV1().Secrets(ref.namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("agent TLS secret '%s' not found in namespace '%s'", ref.Name, ref.namespace)
+		}
+		return nil, fmt.Errorf("failed to get agent TLS secret: %v", err)
+	}
+
+	if protocol == "" {
+		protocol = AgentProtocolLegacy
+	}
+	if analyzePath == "" {
+		analyzePath = defaultAgentPath
+	}
+	cacheKey := ref.namespace + "/" + ref.Name + "/" + protocol + " " + baseURL + analyzePath + " " + compression
+	agentTLSClients.Lock()
+	defer agentTLSClients.Unlock()
+	if entry, ok := agentTLSClients.entries[cacheKey]; ok && entry.resourceVersion == secret.ResourceVersion {
+		return entry.client, nil
+	}
+	transport, err := newAgentTLSTransport(secret.Data)
+	if err != nil {
+		return nil, fmt.Errorf("agent TLS secret %s/%s: %v", ref.namespace, ref.Name, err)
+	}
+	agent := NewA2AClient(baseURL)
+	agent.protocol = protocol
+	agent.analyzePath = analyzePath
+	agent.compression = compression
+	agent.httpClient.Transport = &correlationTransport{base: transport}
+	agentTLSClients.entries[cacheKey] = agentTLSClientEntry{resourceVersion: secret.ResourceVersion, client: agent}
+	return agent, nil
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewAgentTLSTransport(t *testing.T) {
+	var peerCerts int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerCerts = len(r.TLS.PeerCertificates)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour), ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string][]byte{
+		"tls.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"tls.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		"ca.crt":  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+	}
+
+	transport, err := newAgentTLSTransport(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the agent to accept the client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if peerCerts != 1 {
+		t.Errorf("expected the client certificate to be presented, got %d certificates", peerCerts)
+	}
+
+	if _, err := newAgentTLSTransport(map[string][]byte{"tls.crt": data["tls.crt"]}); err == nil {
+		t.Error("expected an error for a secret without tls.key")
+	}
+	if _, err := newAgentTLSTransport(map[string][]byte{"tls.crt": data["tls.crt"], "tls.key": data["tls.key"], "ca.crt": []byte("none")}); err == nil {
+		t.Error("expected an error for a ca.crt without certificates")
+	}
+	if _, err := agentClientFor(context.Background(), "http://kubernetes-agent:8080", "", "", "", &agentTLSSecretRef{Name: "agent-tls", namespace: "shop"}); err == nil {
+		t.Error("expected an error for a client certificate over http")
+	}
+}
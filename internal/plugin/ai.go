@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -13,6 +14,9 @@ import (
 	"google.golang.org/genai"
 )
 
+// maxRawResponseLength bounds the characters of an invalid AI response kept in the measurement metadata
+const maxRawResponseLength = 2000
+
 // Google RPC error detail type URLs
 const (
 	typeURLRetryInfo    = "type.googleapis.com/google.rpc.RetryInfo"
@@ -24,6 +28,23 @@ type AIAnalysisResult struct {
 	Text       string `json:"text"`
 	Promote    bool   `json:"promote"`
 	Confidence int    `json:"confidence"`
+	Severity   string `json:"severity,omitempty"`
+	// RootCause and Remediation are actionable details for failed canaries
+	RootCause   string `json:"rootCause,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+	// PromptTokens and OutputTokens are the model token usage, not part of the model response
+	PromptTokens int `json:"-"`
+	OutputTokens int `json:"-"`
+	// LogsTrimmed is set when the oldest log lines were left out to fit the model context window
+	LogsTrimmed bool `json:"-"`
+	// AgentFallback is set when the model analyzed the logs because the Kubernetes Agent failed
+	AgentFallback bool `json:"-"`
+	// ToolCalls is the number of MCP tool calls of the model
+	ToolCalls int `json:"-"`
+	// PRLink is the pull request the Kubernetes Agent opened with a fix
+	PRLink string `json:"prLink,omitempty"`
+	// AgentTranscript is the interaction with the Kubernetes Agent in agent mode
+	AgentTranscript *agentTranscript `json:"-"`
 }
 
 // AIAnalysisParams represents parameters for AI analysis
@@ -31,68 +52,275 @@ type AIAnalysisParams struct {
 	ModelName   string
 	LogsContext string
 	ExtraPrompt string
+	// SystemPrompt replaces the built-in analysis instructions when set
+	SystemPrompt string
+	// Preset holds the instructions of the preset for the stack of the service
+	Preset string
+	// Examples are the rendered few-shot examples of examplesConfigMap
+	Examples string
+	// SafetySettings override the Gemini safety filter thresholds
+	SafetySettings []*genai.SafetySetting
+	// OutputFields are extra fields the model must return with the analysis
+	OutputFields []outputField
+	// Temperature and Seed control the sampling of the model, the model defaults when nil
+	Temperature *float32
+	Seed        *int32
+	// Samples is the number of independent analyses aggregated by majority, a single one when below 2
+	Samples int
+	// History summarizes previous measurements of the same metric for trend analysis
+	History string
+	// APIKey is the Gemini API key of the metric, the plugin key when empty
+	APIKey string
+	// AgentToken authenticates requests to the Kubernetes Agent
+	AgentToken string
+	// AgentURL and AgentPath locate the Kubernetes Agent, K8S_AGENT_URL and /a2a/analyze when empty
+	AgentURL  string
+	AgentPath string
+	// AgentTimeout bounds an agent analysis, 5 minutes when zero, AgentHealthPath is checked before it
+	AgentTimeout    time.Duration
+	AgentHealthPath string
+	// AgentProtocol is the legacy analysis endpoint (default), the A2A protocol or gRPC
+	AgentProtocol string
+	// AgentCompression is gzip to compress the requests of the agent
+	AgentCompression string
+	// AgentTLSSecretRef holds the client certificate presented to the Kubernetes Agent
+	AgentTLSSecretRef *agentTLSSecretRef
+	// AgentFallback is default to analyze with the model when the Kubernetes Agent fails
+	AgentFallback string
+	// AgentAsync submits the analysis as an agent job, AgentJobID is the job polled by a resumed measurement
+	AgentAsync bool
+	AgentJobID string
+	// AgentRollout describes the rollout to the Kubernetes Agent
+	AgentRollout A2ARolloutContext
+	// MCPServers expose their tools to the model, MaxToolCalls bounds the calls of an analysis
+	MCPServers   []mcpServerConfig
+	MaxToolCalls int
 }
 
 // analyzeLogsWithAI analyzes canary logs using AI
-var analyzeLogsWithAI = func(params AIAnalysisParams) (rawJSON string, result AIAnalysisResult, err error) {
-	apiKey, err := getSecretValue("argo-rollouts", "google_api_key")
-	if err != nil {
-		return "", AIAnalysisResult{}, fmt.Errorf("failed to get Google API key from secret: %v", err)
+var analyzeLogsWithAI = func(ctx context.Context, params AIAnalysisParams) (rawJSON string, result AIAnalysisResult, err error) {
+	apiKey := params.APIKey
+	if apiKey == "" {
+		if apiKey, err = getSecretValue("google_api_key"); err != nil {
+			return "", AIAnalysisResult{}, fmt.Errorf("failed to get Google API key from secret: %v", err)
+		}
 	}
-	ctx := context.Background()
 
-	// Create client using the new Google Gen AI Go SDK
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
+	// Reuse a pooled client using the new Google Gen AI Go SDK
+	client, err := getGenAIClient(ctx, apiKey)
 	if err != nil {
 		return "", AIAnalysisResult{}, err
 	}
 
-	system := "Analyze what was this canary behavior based on these logs, compare the stable version vs the canary version. " +
-		"Write only a json text with these entries and nothing else: " +
-		"one named 'text' with your analysis text; " +
-		"one named 'promote' with true or false; " +
-		"one named 'confidence' with a number from 0 to 100 representing your confidence in the decision. " +
-		"The stable version logs start with '--- STABLE LOGS ---' and the canary version logs start with '--- CANARY LOGS ---'." +
-		"In case that you cannot make a determination due to lack of information, default to promote: true."
-
-	// Append extra prompt if provided
-	if params.ExtraPrompt != "" {
-		system += "\n\nAdditional context: " + params.ExtraPrompt
+	// Avoid a failed request for prompts over the model context window
+	params, logsTrimmed, err := fitPromptToModel(ctx, client, params)
+	if err != nil {
+		return "", AIAnalysisResult{}, err
 	}
 
-	// Use the new API structure
-	parts := []*genai.Part{
-		{Text: system + "\n\n" + params.LogsContext},
+	schema := responseSchema(params.OutputFields)
+	contents := []*genai.Content{genai.NewContentFromText(analysisPrompt(params), genai.RoleUser)}
+	toolCalls, promptTokens, outputTokens := 0, 0, 0
+	if len(params.MCPServers) > 0 {
+		// Let the model investigate with the tools of the MCP servers before answering
+		if contents, toolCalls, promptTokens, outputTokens, err = investigateWithTools(ctx, client, params, contents); err != nil {
+			return "", AIAnalysisResult{}, fmt.Errorf("tool investigation failed: %v", err)
+		}
+	}
+	generate := func() (*genai.GenerateContentResponse, error) {
+		var resp *genai.GenerateContentResponse
+		err := retryWithBackoff(ctx, func() error {
+			var apiErr error
+			start := time.Now()
+			resp, apiErr = client.Models.GenerateContent(ctx, params.ModelName, contents, &genai.GenerateContentConfig{
+				ResponseMIMEType: "application/json",
+				ResponseSchema:   schema,
+				SafetySettings:   params.SafetySettings,
+				Temperature:      params.Temperature,
+				Seed:             params.Seed,
+			})
+			recordModelCall(params.ModelName, time.Since(start), apiErr)
+			return apiErr
+		}, 3) // Max 3 retries
+		if err != nil {
+			return nil, err
+		}
+		if err := blockedResponseError(resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
 	}
 
-	var resp *genai.GenerateContentResponse
-	err = retryWithBackoff(ctx, func() error {
-		var apiErr error
-		resp, apiErr = client.Models.GenerateContent(ctx, params.ModelName, []*genai.Content{{Parts: parts}}, nil)
-		return apiErr
-	}, 3) // Max 3 retries
+	resp, err := generate()
 	if err != nil {
 		return "", AIAnalysisResult{}, err
 	}
-
 	txt := concatCandidates(resp)
-	rawJSON = strings.TrimSpace(txt)
+	p, o := usageTokens(resp)
+	promptTokens, outputTokens = promptTokens+p, outputTokens+o
 
-	// attempt to parse
-	var obj AIAnalysisResult
-	if e := json.Unmarshal([]byte(rawJSON), &obj); e != nil {
+	rawJSON, obj, parseErr := parseAnalysisResponse(txt, schema)
+	if parseErr != nil {
+		// Ask the model to fix its own answer before giving up, rather than trusting a zero-value result
+		log.WithError(parseErr).Warn("Malformed AI response, asking the model to repair it")
+		if strings.TrimSpace(txt) != "" {
+			contents = append(contents, genai.NewContentFromText(txt, genai.RoleModel))
+		}
+		contents = append(contents, genai.NewContentFromText(repairPrompt(parseErr), genai.RoleUser))
+		if resp, err = generate(); err != nil {
+			return "", AIAnalysisResult{}, fmt.Errorf("malformed AI response (%v), repair failed: %v", parseErr, err)
+		}
+		txt = concatCandidates(resp)
+		p, o = usageTokens(resp)
+		promptTokens, outputTokens = promptTokens+p, outputTokens+o
+		if rawJSON, obj, err = parseAnalysisResponse(txt, schema); err != nil {
+			return strings.TrimSpace(txt), AIAnalysisResult{}, fmt.Errorf("malformed AI response after repair: %v", err)
+		}
+	}
+	obj.PromptTokens, obj.OutputTokens = promptTokens, outputTokens
+	obj.LogsTrimmed = logsTrimmed
+	obj.ToolCalls = toolCalls
+	return rawJSON, obj, nil
+}
+
+// parseAnalysisResponse extracts the analysis JSON from the model response, which must have all
+// the required fields of the response schema
+func parseAnalysisResponse(txt string, schema *genai.Schema) (string, AIAnalysisResult, error) {
+	rawJSON := strings.TrimSpace(txt)
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(rawJSON), &fields); err != nil {
 		// model might have returned extra text; try to extract JSON block
-		if j := extractFirstJSON(rawJSON); j != "" {
-			rawJSON = j
-			_ = json.Unmarshal([]byte(rawJSON), &obj)
+		j := extractFirstJSON(rawJSON)
+		if j == "" {
+			return "", AIAnalysisResult{}, fmt.Errorf("no JSON object in the response")
+		}
+		if err := json.Unmarshal([]byte(j), &fields); err != nil {
+			return "", AIAnalysisResult{}, fmt.Errorf("invalid JSON in the response: %v", err)
+		}
+		rawJSON = j
+	}
+	var missing []string
+	for _, field := range schema.Required {
+		if _, ok := fields[field]; !ok {
+			missing = append(missing, field)
 		}
 	}
+	if len(missing) > 0 {
+		return "", AIAnalysisResult{}, fmt.Errorf("missing required fields %s", strings.Join(missing, ", "))
+	}
+	var obj AIAnalysisResult
+	if err := json.Unmarshal([]byte(rawJSON), &obj); err != nil {
+		return "", AIAnalysisResult{}, fmt.Errorf("invalid analysis fields: %v", err)
+	}
 	return rawJSON, obj, nil
 }
 
+// validateAnalysisResult checks that an analysis can be trusted: promote must be a boolean in the
+// response, confidence within 0-100, the severity one of the known values and the analysis text not empty
+func validateAnalysisResult(rawJSON string, result AIAnalysisResult) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(rawJSON), &fields); err != nil {
+		return fmt.Errorf("invalid AI response: %v", err)
+	}
+	if promote := string(fields["promote"]); promote != "true" && promote != "false" {
+		return fmt.Errorf("invalid AI response: promote is not a boolean")
+	}
+	if result.Confidence < 0 || result.Confidence > 100 {
+		return fmt.Errorf("invalid AI response: confidence %d is not between 0 and 100", result.Confidence)
+	}
+	if _, ok := severityScores[strings.ToLower(strings.TrimSpace(result.Severity))]; !ok {
+		return fmt.Errorf("invalid AI response: severity %q is not none, minor, major or critical", result.Severity)
+	}
+	if strings.TrimSpace(result.Text) == "" {
+		return fmt.Errorf("invalid AI response: empty analysis text")
+	}
+	return nil
+}
+
+// repairPrompt asks the model to answer again with valid JSON after a malformed response
+func repairPrompt(parseErr error) string {
+	return fmt.Sprintf("Your previous answer could not be used: %v. "+
+		"Return only valid JSON matching the response schema, with all the required fields and nothing else.", parseErr)
+}
+
+// usageTokens returns the prompt and output tokens of a response
+func usageTokens(resp *genai.GenerateContentResponse) (int, int) {
+	if resp == nil || resp.UsageMetadata == nil {
+		return 0, 0
+	}
+	return int(resp.UsageMetadata.PromptTokenCount), int(resp.UsageMetadata.CandidatesTokenCount)
+}
+
+// defaultSystemPrompt holds the built-in analysis instructions
+const defaultSystemPrompt = "Analyze what was this canary behavior based on these logs, compare the stable version vs the canary version. " +
+	"Write only a json text with these entries and nothing else: " +
+	"one named 'text' with your analysis text; " +
+	"one named 'promote' with true or false; " +
+	"one named 'confidence' with a number from 0 to 100 representing your confidence in the decision; " +
+	"one named 'severity' with one of 'none', 'minor', 'major' or 'critical' classifying the most serious issue found in the canary; " +
+	"one named 'rootCause' with the most likely root cause of any issue found in the canary, or an empty string if there is none; " +
+	"one named 'remediation' with the recommended actions to fix it, or an empty string if there is none. " +
+	"The stable version logs start with '--- STABLE LOGS ---' and the canary version logs start with '--- CANARY LOGS ---'." +
+	"In case that you cannot make a determination due to lack of information, default to promote: true."
+
+// analysisResponseSchema is the JSON output contract of the analysis, enforced with structured output
+// so that custom system prompts cannot break the parsing of the response
+var analysisResponseSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"text":        {Type: genai.TypeString, Description: "Analysis of the canary behavior compared to the stable version"},
+		"promote":     {Type: genai.TypeBoolean, Description: "Whether the canary should be promoted"},
+		"confidence":  {Type: genai.TypeInteger, Description: "Confidence in the decision", Minimum: genai.Ptr(0.0), Maximum: genai.Ptr(100.0)},
+		"severity":    {Type: genai.TypeString, Description: "Most serious issue found in the canary", Enum: []string{SeverityNone, SeverityMinor, SeverityMajor, SeverityCritical}},
+		"rootCause":   {Type: genai.TypeString, Description: "Most likely root cause of any issue found in the canary, empty if there is none"},
+		"remediation": {Type: genai.TypeString, Description: "Recommended actions to fix the issue, empty if there is none"},
+	},
+	Required:         []string{"text", "promote", "confidence", "severity", "rootCause", "remediation"},
+	PropertyOrdering: []string{"text", "promote", "confidence", "severity", "rootCause", "remediation"},
+}
+
+// analysisPrompt builds the prompt sent to the model in default mode
+func analysisPrompt(params AIAnalysisParams) string {
+	system := params.SystemPrompt
+	if system == "" {
+		system = defaultSystemPrompt
+	}
+
+	// Point the model to the error patterns that matter for the stack
+	if params.Preset != "" {
+		system += "\n\n" + params.Preset
+	}
+
+	// Teach the model what acceptable noise looks like for the service
+	if params.Examples != "" {
+		system += "\n\n" + params.Examples
+	}
+
+	// Append extra prompt if provided
+	if params.ExtraPrompt != "" {
+		system += "\n\nAdditional context: " + params.ExtraPrompt
+	}
+
+	// Include previous measurements so the model can evaluate trends across intervals
+	if params.History != "" {
+		system += "\n\nThis analysis runs repeatedly. These are the results of the previous measurements, oldest first. " +
+			"Evaluate the trend across intervals (e.g. error rate increasing across measurements) in addition to the current logs:\n" +
+			params.History
+	}
+
+	return system + "\n\n" + fenceLogs(params.LogsContext)
+}
+
+// retryableError is a transient error retried by retryWithBackoff, after retryAfter when not negative
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+
+func (e *retryableError) Unwrap() error { return e.err }
+
 // retryWithBackoff implements exponential backoff for API calls with 429 error handling
 func retryWithBackoff(ctx context.Context, operation func() error, maxRetries int) error {
 	// Configure exponential backoff
@@ -115,10 +343,20 @@ func retryWithBackoff(ctx context.Context, operation func() error, maxRetries in
 		if err != nil {
 			lastErr = err
 
+			// Transient errors of other services, e.g. the Kubernetes Agent
+			var retryable *retryableError
+			if errors.As(err, &retryable) {
+				log.WithContext(ctx).WithError(err).WithField("attempt", attempt).Warn("Transient error, retrying")
+				if retryable.retryAfter >= 0 {
+					return nil, &backoff.RetryAfterError{Duration: retryable.retryAfter}
+				}
+				return nil, err
+			}
+
 			// Check if it's a 429 error (rate limit)
 			// Try to get the full APIError with all details (note: value type, not pointer)
 			if apiErr, ok := err.(genai.APIError); ok {
-				log.WithFields(log.Fields{
+				log.WithContext(ctx).WithFields(log.Fields{
 					"code":    apiErr.Code,
 					"message": apiErr.Message,
 					"status":  apiErr.Status,
@@ -148,7 +386,7 @@ func retryWithBackoff(ctx context.Context, operation func() error, maxRetries in
 								quotaValue, _ := violationMap["quotaValue"].(string)
 								quotaDimensions, _ := violationMap["quotaDimensions"].(map[string]interface{})
 
-								log.WithFields(log.Fields{
+								log.WithContext(ctx).WithFields(log.Fields{
 									"quotaMetric":     quotaMetric,
 									"quotaId":         quotaId,
 									"quotaValue":      quotaValue,
@@ -160,7 +398,7 @@ func retryWithBackoff(ctx context.Context, operation func() error, maxRetries in
 
 					// Use API-provided wait time or fall back to exponential backoff
 					if apiWaitTime > 0 {
-						log.WithFields(log.Fields{
+						log.WithContext(ctx).WithFields(log.Fields{
 							"attempt":     attempt,
 							"apiWaitTime": apiWaitTime,
 						}).Warn("Rate limit exceeded, using API-suggested wait time")
@@ -170,7 +408,7 @@ func retryWithBackoff(ctx context.Context, operation func() error, maxRetries in
 						backoffConfig.InitialInterval = apiWaitTime
 						backoffConfig.MaxInterval = apiWaitTime
 					} else {
-						log.WithFields(log.Fields{
+						log.WithContext(ctx).WithFields(log.Fields{
 							"attempt": attempt,
 						}).Warn("Rate limit exceeded, using exponential backoff")
 					}
@@ -203,6 +441,10 @@ func concatCandidates(resp *genai.GenerateContentResponse) string {
 		return ""
 	}
 	for _, cand := range resp.Candidates {
+		// Candidates blocked by the safety filters have no content
+		if cand.Content == nil {
+			continue
+		}
 		for _, part := range cand.Content.Parts {
 			if part.Text != "" {
 				b.WriteString(part.Text)
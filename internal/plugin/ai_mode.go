@@ -1,8 +1,14 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -14,8 +20,8 @@ const (
 )
 
 // analyzeWithMode analyzes logs using the specified mode
-func analyzeWithMode(mode, modelName, logsContext, namespace, podName, extraPrompt string) (string, AIAnalysisResult, error) {
-	log.WithFields(log.Fields{
+func analyzeWithMode(ctx context.Context, mode string, params AIAnalysisParams, namespace, podName string) (string, AIAnalysisResult, error) {
+	log.WithContext(ctx).WithFields(log.Fields{
 		"mode":      mode,
 		"namespace": namespace,
 		"podName":   podName,
@@ -23,49 +29,79 @@ func analyzeWithMode(mode, modelName, logsContext, namespace, podName, extraProm
 
 	switch mode {
 	case AnalysisModeAgent:
-		return analyzeWithKubernetesAgent(namespace, podName, logsContext)
-	default:
-		params := AIAnalysisParams{
-			ModelName:   modelName,
-			LogsContext: logsContext,
-			ExtraPrompt: extraPrompt,
+		ctx, span := startSpan(ctx, "metricai.agent.analyze",
+			otlpAttribute("metricai.agent.url", agentURLFor(params)),
+			otlpAttribute("metricai.agent.protocol", params.AgentProtocol),
+		)
+		analysisJSON, result, err := analyzeWithAgentCircuit(ctx, namespace, podName, params)
+		// Pending asynchronous analyses are not failures
+		if jobID, pending := agentJobPendingID(err); pending {
+			span.setAttributes(otlpAttribute("metricai.agent.job_id", jobID))
+			span.finish(nil)
 		}
-		return analyzeLogsWithAI(params)
+		span.finish(err)
+		return analysisJSON, result, err
+	default:
+		ctx, span := startSpan(ctx, "metricai.ai.analyze", otlpAttribute("metricai.model", params.ModelName))
+		analysisJSON, result, err := analyzeLogsWithAI(ctx, params)
+		span.finish(err)
+		return analysisJSON, result, err
 	}
 }
 
 // analyzeWithKubernetesAgent delegates analysis to the Kubernetes Agent via A2A
-func analyzeWithKubernetesAgent(namespace, podName, logsContext string) (string, AIAnalysisResult, error) {
-	agentURL := os.Getenv("K8S_AGENT_URL")
-	if agentURL == "" {
-		agentURL = "http://kubernetes-agent.argo-rollouts.svc.cluster.local:8080"
-	}
+func analyzeWithKubernetesAgent(ctx context.Context, namespace, podName string, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+	agentURL := agentURLFor(params)
 
-	log.WithField("agentURL", agentURL).Info("Using Kubernetes Agent for analysis")
+	log.WithContext(ctx).WithField("agentURL", agentURL).Info("Using Kubernetes Agent for analysis")
 
-	client := NewA2AClient(agentURL)
+	timeout := params.AgentTimeout
+	if timeout <= 0 {
+		timeout = defaultAgentTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := agentClientFor(ctx, agentURL, params.AgentProtocol, params.AgentPath, params.AgentCompression, params.AgentTLSSecretRef)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to create Kubernetes Agent client")
+		return "", AIAnalysisResult{}, err
+	}
 
 	// Health check first
-	if err := client.HealthCheck(); err != nil {
-		log.WithError(err).Error("Kubernetes Agent health check failed")
+	if err := client.HealthCheck(ctx, params.AgentHealthPath); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Kubernetes Agent health check failed")
 		return "", AIAnalysisResult{}, err
 	}
 
 	// Extract stable and canary logs from logsContext
-	stableLogs, canaryLogs := splitLogs(logsContext)
+	stableLogs, canaryLogs := splitLogs(params.LogsContext)
 
 	// Send request to agent
-	resp, err := client.AnalyzeWithAgent(namespace, podName, stableLogs, canaryLogs)
+	var resp *A2AResponse
+	if params.AgentAsync || params.AgentJobID != "" {
+		resp, err = agentJobResult(ctx, client, namespace, podName, stableLogs, canaryLogs, params)
+	} else {
+		resp, err = client.AnalyzeWithAgent(ctx, namespace, podName, stableLogs, canaryLogs, params.AgentRollout, params.AgentToken)
+	}
 	if err != nil {
-		log.WithError(err).Error("Failed to analyze with kubernetes-agent")
-		return "", AIAnalysisResult{}, err
+		if _, pending := agentJobPendingID(err); !pending {
+			log.WithContext(ctx).WithError(err).Error("Failed to analyze with kubernetes-agent")
+		}
+		// Keep the answer of the agent, if any, for troubleshooting
+		return agentRawResponse(err), AIAnalysisResult{}, err
 	}
 
 	// Build result object
 	result := AIAnalysisResult{
-		Text:       resp.Analysis,
-		Promote:    resp.Promote,
-		Confidence: resp.Confidence,
+		Text:            resp.Analysis,
+		Promote:         resp.Promote,
+		Confidence:      resp.Confidence,
+		Severity:        agentSeverity(resp.Promote),
+		RootCause:       resp.RootCause,
+		Remediation:     resp.Remediation,
+		PRLink:          resp.PRLink,
+		AgentTranscript: newAgentTranscript(agentURL, namespace, podName, stableLogs, canaryLogs, params, resp),
 	}
 
 	// Build JSON response for Argo Rollouts
@@ -73,12 +109,13 @@ func analyzeWithKubernetesAgent(namespace, podName, logsContext string) (string,
 		"text":        resp.Analysis,
 		"promote":     resp.Promote,
 		"confidence":  resp.Confidence,
+		"severity":    result.Severity,
 		"rootCause":   resp.RootCause,
 		"remediation": resp.Remediation,
 	}
 	if resp.PRLink != "" {
 		jsonResp["prLink"] = resp.PRLink
-		log.WithField("prLink", resp.PRLink).Info("Agent created a PR with fix")
+		log.WithContext(ctx).WithField("prLink", resp.PRLink).Info("Agent created a PR with fix")
 	}
 
 	rawJSON, err := json.Marshal(jsonResp)
@@ -86,10 +123,164 @@ func analyzeWithKubernetesAgent(namespace, podName, logsContext string) (string,
 		return "", AIAnalysisResult{}, err
 	}
 
-	log.WithFields(log.Fields{
+	log.WithContext(ctx).WithFields(log.Fields{
 		"promote":    resp.Promote,
 		"confidence": resp.Confidence,
 	}).Info("Analysis completed via Kubernetes Agent")
 
 	return string(rawJSON), result, nil
 }
+
+// agentTranscript is the interaction with the Kubernetes Agent of an analysis, kept in the reports so
+// agent decisions are auditable like those of the model
+type agentTranscript struct {
+	AgentURL string `json:"agentUrl"`
+	Protocol string `json:"protocol"`
+	// JobID is the job of asynchronous analyses
+	JobID    string              `json:"jobId,omitempty"`
+	Request  agentRequestSummary `json:"request"`
+	Findings []string            `json:"findings,omitempty"`
+	Response A2AResponse         `json:"response"`
+}
+
+// agentRequestSummary is the request sent to the agent without the logs, which the reports already have
+type agentRequestSummary struct {
+	Prompt          string                 `json:"prompt"`
+	Context         map[string]interface{} `json:"context"`
+	StableLogsBytes int                    `json:"stableLogsBytes"`
+	CanaryLogsBytes int                    `json:"canaryLogsBytes"`
+}
+
+// newAgentTranscript records the request of an agent analysis, the findings the agent reported while
+// investigating and its final answer
+func newAgentTranscript(agentURL, namespace, podName, stableLogs, canaryLogs string, params AIAnalysisParams, resp *A2AResponse) *agentTranscript {
+	req := newA2ARequest(namespace, podName, stableLogs, canaryLogs, params.AgentRollout)
+	delete(req.Context, "stableLogs")
+	delete(req.Context, "canaryLogs")
+	protocol := params.AgentProtocol
+	if protocol == "" {
+		protocol = AgentProtocolLegacy
+	}
+	response := *resp
+	response.Findings = nil
+	return &agentTranscript{
+		AgentURL: agentURL,
+		Protocol: protocol,
+		JobID:    params.AgentJobID,
+		Request: agentRequestSummary{
+			Prompt:          req.Prompt,
+			Context:         req.Context,
+			StableLogsBytes: len(stableLogs),
+			CanaryLogsBytes: len(canaryLogs),
+		},
+		Findings: resp.Findings,
+		Response: response,
+	}
+}
+
+// agentJobPendingError is returned while an asynchronous agent job is not done
+type agentJobPendingError struct {
+	jobID string
+}
+
+func (e *agentJobPendingError) Error() string {
+	return fmt.Sprintf("agent job %s is not done", e.jobID)
+}
+
+// agentJobPendingID returns the job of an agent analysis that is not done
+func agentJobPendingID(err error) (string, bool) {
+	var pending *agentJobPendingError
+	if errors.As(err, &pending) {
+		return pending.jobID, true
+	}
+	return "", false
+}
+
+// agentJobResult submits an asynchronous agent analysis, or polls the job of params.AgentJobID, and
+// returns its analysis once completed or an agentJobPendingError until then
+func agentJobResult(ctx context.Context, client *A2AClient, namespace, podName, stableLogs, canaryLogs string, params AIAnalysisParams) (*A2AResponse, error) {
+	var job *A2AJob
+	var err error
+	if params.AgentJobID != "" {
+		job, err = client.GetJob(ctx, params.AgentJobID, params.AgentToken)
+	} else {
+		job, err = client.SubmitAnalysis(ctx, namespace, podName, stableLogs, canaryLogs, params.AgentRollout, params.AgentToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case A2AJobCompleted:
+		return job.Result, nil
+	case A2AJobFailed:
+		return nil, fmt.Errorf("agent job %s failed: %s", job.ID, job.Error)
+	case A2AJobPending, A2AJobRunning:
+		log.WithContext(ctx).WithFields(log.Fields{
+			"jobId":  job.ID,
+			"status": job.Status,
+		}).Info("Kubernetes Agent job is not done yet")
+		return nil, &agentJobPendingError{jobID: job.ID}
+	default:
+		return nil, fmt.Errorf("agent job %s has unknown status %q", job.ID, job.Status)
+	}
+}
+
+// agentURLFor returns the Kubernetes Agent URL of an analysis: the agentUrl of the metric, else
+// K8S_AGENT_URL, else the default
+func agentURLFor(params AIAnalysisParams) string {
+	if params.AgentURL != "" {
+		return params.AgentURL
+	}
+	if agentURL := os.Getenv("K8S_AGENT_URL"); agentURL != "" {
+		return agentURL
+	}
+	return defaultAgentURL
+}
+
+// namedAgentURL returns the URL of the agent named by agentName among the agents of a metric
+func namedAgentURL(agents map[string]string, name string) (string, error) {
+	agentURL, ok := agents[name]
+	if !ok {
+		names := make([]string, 0, len(agents))
+		for agent := range agents {
+			names = append(names, agent)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unknown agentName %q, expected one of the agents: %s", name, strings.Join(names, ", "))
+	}
+	if agentURL == "" {
+		return "", fmt.Errorf("agent %q has no URL", name)
+	}
+	return agentURL, nil
+}
+
+// validateAgentCompression checks the agentCompression of a metric
+func validateAgentCompression(compression string) error {
+	switch compression {
+	case "", "none", AgentCompressionGzip:
+		return nil
+	}
+	return fmt.Errorf("invalid agentCompression %q, expected %s or none", compression, AgentCompressionGzip)
+}
+
+// validateAgentEndpoint checks the agentUrl, agentProtocol and agentPath of a metric
+func validateAgentEndpoint(agentURL, protocol, agentPath, healthPath string) error {
+	switch protocol {
+	case "", AgentProtocolA2A, AgentProtocolLegacy, AgentProtocolGRPC:
+	default:
+		return fmt.Errorf("invalid agentProtocol %q, expected %s, %s or %s", protocol, AgentProtocolA2A, AgentProtocolLegacy, AgentProtocolGRPC)
+	}
+	if agentURL != "" {
+		u, err := url.Parse(agentURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid agentUrl %q, expected an http or https URL", agentURL)
+		}
+	}
+	if agentPath != "" && !strings.HasPrefix(agentPath, "/") {
+		return fmt.Errorf("invalid agentPath %q, it must start with /", agentPath)
+	}
+	if healthPath != "" && !strings.HasPrefix(healthPath, "/") {
+		return fmt.Errorf("invalid agentHealthPath %q, it must start with /", healthPath)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestAnalyzeWithKubernetesAgentEndpoint(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_ = json.NewEncoder(w).Encode(A2AResponse{Analysis: "ok", Promote: true, Confidence: 90})
+	}))
+	defer server.Close()
+
+	params := AIAnalysisParams{LogsContext: "--- STABLE LOGS ---\nok\n\n--- CANARY LOGS ---\nok", AgentURL: server.URL, AgentProtocol: AgentProtocolLegacy, AgentPath: "/v1/analyze"}
+	if _, result, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params); err != nil || !result.Promote {
+		t.Fatalf("unexpected result %+v, error: %v", result, err)
+	}
+	if path != "/v1/analyze" {
+		t.Errorf("expected the configured agent path, got %q", path)
+	}
+
+	params.AgentPath = ""
+	if _, _, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != defaultAgentPath {
+		t.Errorf("expected the default agent path, got %q", path)
+	}
+
+	for _, tc := range []struct{ url, protocol, path, healthPath string }{
+		{"kubernetes-agent:8080", "", "", ""},
+		{"ftp://kubernetes-agent", "", "", ""},
+		{"http://kubernetes-agent", "", "a2a/analyze", ""},
+		{"http://kubernetes-agent", "websocket", "", ""},
+		{"http://kubernetes-agent", "", "", "healthz"},
+	} {
+		if err := validateAgentEndpoint(tc.url, tc.protocol, tc.path, tc.healthPath); err == nil {
+			t.Errorf("expected an error for agentUrl %q, agentProtocol %q, agentPath %q and agentHealthPath %q", tc.url, tc.protocol, tc.path, tc.healthPath)
+		}
+	}
+	if err := validateAgentEndpoint("https://agent.team-a.svc:8443", AgentProtocolLegacy, "/a2a/analyze", "/healthz"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestAnalyzeWithAgentJob(t *testing.T) {
+	var polls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/a2a/analyze":
+			var req A2ARequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Async {
+				t.Errorf("expected an asynchronous request, got %+v, error: %v", req, err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(A2AJob{ID: "job-1", Status: A2AJobPending})
+		case r.Method == http.MethodGet && r.URL.Path == "/a2a/analyze/job-1":
+			polls++
+			if polls == 1 {
+				_ = json.NewEncoder(w).Encode(A2AJob{ID: "job-1", Status: A2AJobRunning})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(A2AJob{ID: "job-1", Status: A2AJobCompleted, Result: &A2AResponse{Analysis: "no regression", Promote: true, Confidence: 85}})
+		case r.Method == http.MethodGet && r.URL.Path == "/a2a/analyze/job-2":
+			_ = json.NewEncoder(w).Encode(A2AJob{ID: "job-2", Status: A2AJobFailed, Error: "cluster unreachable"})
+		}
+	}))
+	defer server.Close()
+
+	params := AIAnalysisParams{AgentURL: server.URL, AgentProtocol: AgentProtocolLegacy, AgentAsync: true}
+	_, _, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params)
+	if jobID, pending := agentJobPendingID(err); !pending || jobID != "job-1" {
+		t.Fatalf("expected the submitted job to be pending, got %v", err)
+	}
+
+	params.AgentJobID = "job-1"
+	if _, _, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params); err == nil {
+		t.Fatal("expected the running job to be pending")
+	} else if _, pending := agentJobPendingID(err); !pending {
+		t.Fatalf("expected the running job to be pending, got %v", err)
+	}
+	_, result, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params)
+	if err != nil || !result.Promote || result.Text != "no regression" {
+		t.Fatalf("expected the job analysis, got %+v, error: %v", result, err)
+	}
+
+	params.AgentJobID = "job-2"
+	if _, _, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params); err == nil || !strings.Contains(err.Error(), "cluster unreachable") {
+		t.Errorf("expected the job failure, got %v", err)
+	}
+
+	m := markMeasurementAgentJobPending(v1alpha1.Measurement{}, "job-1")
+	if m.Phase != v1alpha1.AnalysisPhaseRunning || m.ResumeAt == nil || m.Metadata["agentJobId"] != "job-1" {
+		t.Errorf("expected a running measurement resumed to poll the job, got %+v", m)
+	}
+}
+
+func TestNamedAgentURL(t *testing.T) {
+	agents := map[string]string{
+		"db-expert":  "http://db-agent.agents:8080",
+		"net-expert": "http://net-agent.agents:8080",
+		"broken":     "",
+	}
+	if agentURL, err := namedAgentURL(agents, "net-expert"); err != nil || agentURL != "http://net-agent.agents:8080" {
+		t.Errorf("expected the URL of the named agent, got %q, error: %v", agentURL, err)
+	}
+	if _, err := namedAgentURL(agents, "cache-expert"); err == nil || !strings.Contains(err.Error(), "broken, db-expert, net-expert") {
+		t.Errorf("expected an error listing the agents, got %v", err)
+	}
+	if _, err := namedAgentURL(agents, "broken"); err == nil {
+		t.Error("expected an error for an agent without URL")
+	}
+	if _, err := namedAgentURL(nil, "db-expert"); err == nil {
+		t.Error("expected an error without agents")
+	}
+}
+
+func TestAgentTranscript(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(A2AResponse{Analysis: "canary errors", RootCause: "nil pointer", Confidence: 80, Findings: []string{"error rate doubled"}})
+	}))
+	defer server.Close()
+
+	params := AIAnalysisParams{
+		LogsContext:   "--- STABLE LOGS ---\nok\n\n--- CANARY LOGS ---\npanic: nil pointer",
+		AgentURL:      server.URL,
+		AgentProtocol: AgentProtocolLegacy,
+		AgentRollout:  A2ARolloutContext{RolloutName: "checkout"},
+	}
+	_, result, err := analyzeWithKubernetesAgent(context.Background(), "shop", "checkout", params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	transcript := result.AgentTranscript
+	if transcript == nil {
+		t.Fatal("expected an agent transcript")
+	}
+	if transcript.AgentURL != server.URL || transcript.Protocol != AgentProtocolLegacy || transcript.Request.Context["rolloutName"] != "checkout" {
+		t.Errorf("unexpected transcript: %+v", transcript)
+	}
+	if !slices.Equal(transcript.Findings, []string{"error rate doubled"}) || transcript.Response.RootCause != "nil pointer" || transcript.Response.Findings != nil {
+		t.Errorf("unexpected findings %v or response %+v", transcript.Findings, transcript.Response)
+	}
+	data, err := json.Marshal(analysisReport{AgentTranscript: transcript})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The logs are kept once in the report
+	if strings.Contains(string(data), "panic") || !strings.Contains(string(data), `"canaryLogsBytes":19`) {
+		t.Errorf("unexpected report %s", data)
+	}
+}
+
+func TestAgentCompression(t *testing.T) {
+	var encoding string
+	var transferEncoding []string
+	var request A2ARequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding, transferEncoding = r.Header.Get("Content-Encoding"), r.TransferEncoding
+		body := io.Reader(r.Body)
+		if encoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		if err := json.NewDecoder(body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(A2AResponse{Analysis: "ok", Promote: true, Confidence: 90})
+	}))
+	defer server.Close()
+
+	canaryLogs := strings.Repeat("level=error msg=\"connection refused\"\n", 50000)
+	client := getA2AClient(server.URL, AgentProtocolLegacy, "", AgentCompressionGzip)
+	if _, err := client.AnalyzeWithAgent(context.Background(), "shop", "checkout", "", canaryLogs, A2ARolloutContext{}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if encoding != "gzip" || !slices.Contains(transferEncoding, "chunked") || request.Context["canaryLogs"] != canaryLogs {
+		t.Errorf("expected a gzipped chunked request with the logs, got %q, %v", encoding, transferEncoding)
+	}
+
+	if _, err := getA2AClient(server.URL, AgentProtocolLegacy, "", "").AnalyzeWithAgent(context.Background(), "shop", "checkout", "", "ok", A2ARolloutContext{}, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if encoding != "" {
+		t.Errorf("expected an uncompressed request by default, got %q", encoding)
+	}
+
+	if err := validateAgentCompression("brotli"); err == nil {
+		t.Error("expected an error for an unsupported agentCompression")
+	}
+}
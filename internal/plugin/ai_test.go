@@ -1,14 +1,18 @@
 package plugin
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"google.golang.org/genai"
 )
 
 // TestConcatCandidates tests the concatCandidates function
+
 func TestConcatCandidates(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -236,9 +240,9 @@ func TestAnalyzeLogsWithAI_Integration(t *testing.T) {
 		LogsContext: logsContext,
 		ExtraPrompt: "",
 	}
-	rawJSON, result, err := analyzeLogsWithAI(params)
+	rawJSON, result, err := analyzeLogsWithAI(context.Background(), params)
 	for i := 0; i < 5; i++ {
-		rawJSON, result, err = analyzeLogsWithAI(params)
+		rawJSON, result, err = analyzeLogsWithAI(context.Background(), params)
 	}
 
 	// Verify results
@@ -315,7 +319,7 @@ func TestAnalyzeLogsWithAI_Integration_ErrorHandling(t *testing.T) {
 			LogsContext: logsContext,
 			ExtraPrompt: "",
 		}
-		_, _, err := analyzeLogsWithAI(params)
+		_, _, err := analyzeLogsWithAI(context.Background(), params)
 
 		if err == nil {
 			t.Error("Expected error with invalid model name")
@@ -335,7 +339,7 @@ func TestAnalyzeLogsWithAI_Integration_ErrorHandling(t *testing.T) {
 			LogsContext: "",
 			ExtraPrompt: "",
 		}
-		_, result, err := analyzeLogsWithAI(params)
+		_, result, err := analyzeLogsWithAI(context.Background(), params)
 
 		// Should still work but might default to promote:true
 		if err != nil {
@@ -349,3 +353,94 @@ func TestAnalyzeLogsWithAI_Integration_ErrorHandling(t *testing.T) {
 		}
 	})
 }
+
+func TestParseAnalysisResponse(t *testing.T) {
+	complete := `{"text":"No regressions","promote":true,"confidence":90,"severity":"none","rootCause":"","remediation":""}`
+	rawJSON, result, err := parseAnalysisResponse("Here is the analysis:\n"+complete+"\nDone.", analysisResponseSchema)
+	if err != nil || rawJSON != complete || !result.Promote || result.Confidence != 90 {
+		t.Errorf("expected the embedded analysis, got %q %+v, error %v", rawJSON, result, err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{name: "no JSON", response: "The canary looks healthy", want: "no JSON object"},
+		{name: "truncated JSON", response: `{"text":"No regressions","promote":tr`, want: "no JSON object"},
+		{name: "missing fields", response: `{"text":"No regressions","confidence":90}`, want: "missing required fields promote, severity, rootCause, remediation"},
+		{name: "wrong type", response: `{"text":"ok","promote":"yes","confidence":90,"severity":"none","rootCause":"","remediation":""}`, want: "invalid analysis fields"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseAnalysisResponse(tt.response, analysisResponseSchema)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+			if prompt := repairPrompt(err); !strings.Contains(prompt, tt.want) || !strings.Contains(prompt, "Return only valid JSON") {
+				t.Errorf("expected the repair prompt to explain the error, got %q", prompt)
+			}
+		})
+	}
+
+	// Output fields are required as well
+	schema := responseSchema([]outputField{{Name: "affectedEndpoints", Type: OutputFieldArray, Description: "Endpoints"}})
+	if _, _, err := parseAnalysisResponse(complete, schema); err == nil || !strings.Contains(err.Error(), "affectedEndpoints") {
+		t.Errorf("expected a missing output field error, got %v", err)
+	}
+}
+
+func TestValidateAnalysisResult(t *testing.T) {
+	if err := validateAnalysisResult(`{"text":"Canary is healthy","promote":true,"confidence":90,"severity":"none"}`, AIAnalysisResult{Text: "Canary is healthy", Promote: true, Confidence: 90, Severity: SeverityNone}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		name    string
+		rawJSON string
+		result  AIAnalysisResult
+		want    string
+	}{
+		{name: "missing promote", rawJSON: `{"text":"Canary is healthy","confidence":90}`, result: AIAnalysisResult{Text: "Canary is healthy", Confidence: 90}, want: "promote is not a boolean"},
+		{name: "null promote", rawJSON: `{"text":"Canary is healthy","promote":null}`, result: AIAnalysisResult{Text: "Canary is healthy"}, want: "promote is not a boolean"},
+		{name: "confidence out of range", rawJSON: `{"text":"Canary is healthy","promote":true,"confidence":150}`, result: AIAnalysisResult{Text: "Canary is healthy", Promote: true, Confidence: 150}, want: "confidence 150"},
+		{name: "missing severity", rawJSON: `{"text":"Canary is healthy","promote":true,"confidence":90}`, result: AIAnalysisResult{Text: "Canary is healthy", Promote: true, Confidence: 90}, want: "severity"},
+		{name: "unknown severity", rawJSON: `{"text":"Canary is healthy","promote":true,"confidence":90,"severity":"low"}`, result: AIAnalysisResult{Text: "Canary is healthy", Promote: true, Confidence: 90, Severity: "low"}, want: `severity "low"`},
+		{name: "empty text", rawJSON: `{"text":" ","promote":false,"confidence":0,"severity":"major"}`, result: AIAnalysisResult{Text: " ", Severity: SeverityMajor}, want: "empty analysis text"},
+		{name: "not JSON", rawJSON: `The canary looks healthy`, want: "invalid AI response"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAnalysisResult(tt.rawJSON, tt.result); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSystemPrompt(t *testing.T) {
+	prompt := analysisPrompt(AIAnalysisParams{ExtraPrompt: "Payments service", LogsContext: "--- CANARY LOGS ---\nok"})
+	if !strings.HasPrefix(prompt, defaultSystemPrompt) {
+		t.Error("expected the built-in instructions by default")
+	}
+	// The entries are one list separated by semicolons
+	if strings.Count(defaultSystemPrompt, "; one named") != 5 {
+		t.Errorf("expected the entries of the built-in instructions to be separated by semicolons, got:\n%s", defaultSystemPrompt)
+	}
+
+	prompt = analysisPrompt(AIAnalysisParams{
+		SystemPrompt: "You review canaries of a trading platform. Reject any latency regression.",
+		ExtraPrompt:  "Payments service",
+		LogsContext:  "--- CANARY LOGS ---\nok",
+	})
+	if strings.Contains(prompt, defaultSystemPrompt) || !strings.HasPrefix(prompt, "You review canaries of a trading platform.") {
+		t.Errorf("expected the system prompt to replace the built-in instructions, got:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "Additional context: Payments service") || !strings.Contains(prompt, "--- CANARY LOGS ---\nok\nLOGS_") {
+		t.Errorf("expected the extra prompt and logs after the system prompt, got:\n%s", prompt)
+	}
+
+	// The response format is enforced for every field of the result
+	for _, field := range []string{"text", "promote", "confidence", "severity", "rootCause", "remediation"} {
+		if analysisResponseSchema.Properties[field] == nil || !slices.Contains(analysisResponseSchema.Required, field) {
+			t.Errorf("expected %s to be a required field of the response schema", field)
+		}
+	}
+}
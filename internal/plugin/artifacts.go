@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Object storage providers analysis artifacts are uploaded to
+const (
+	ArtifactStorageS3  = "s3"
+	ArtifactStorageGCS = "gcs"
+)
+
+// gcsXMLAPIEndpoint is the S3-compatible Cloud Storage XML API, authenticated with HMAC keys
+const gcsXMLAPIEndpoint = "https://storage.googleapis.com"
+
+// artifactHTTPClient is used for artifact uploads, which include the full logs
+var artifactHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// artifactStorageConfig uploads the prompt, logs and decision of every measurement to a bucket,
+// retaining evidence beyond etcd limits for audits and offline evaluation
+type artifactStorageConfig struct {
+	// "s3" (default, also S3-compatible stores) or "gcs"
+	Provider string `json:"provider,omitempty"`
+	// Bucket the artifacts are uploaded to
+	Bucket string `json:"bucket"`
+	// Object key prefix, e.g. rollouts/prod
+	Prefix string `json:"prefix,omitempty"`
+	// S3 region (default: us-east-1)
+	Region string `json:"region,omitempty"`
+	// Endpoint of S3-compatible stores such as MinIO, addressed with path-style URLs
+	Endpoint string `json:"endpoint,omitempty"`
+	// Secret keys in the AnalysisRun namespace with the access key ID and secret access key, HMAC keys for gcs
+	// (default: storage_access_key_id and storage_secret_access_key of the plugin secret)
+	AccessKeyIDSecretRef     *secretKeyRef `json:"accessKeyIdSecretRef,omitempty"`
+	SecretAccessKeySecretRef *secretKeyRef `json:"secretAccessKeySecretRef,omitempty"`
+}
+
+// analysisArtifacts are the files uploaded for a measurement
+type analysisArtifacts struct {
+	Decision     decisionRecord
+	AnalysisJSON string
+	Logs         string
+	// Prompt is empty when the model was not called by the plugin
+	Prompt string
+	// AgentTranscript is set when the Kubernetes Agent analyzed the logs
+	AgentTranscript *agentTranscript
+}
+
+// artifactFile is a single uploaded object of the analysis artifacts
+type artifactFile struct {
+	name, contentType string
+	body              []byte
+}
+
+// uploadArtifacts uploads the artifacts of a measurement under
+// <prefix>/<namespace>/<analysisrun>/<metric>/<time>/ and returns the location of the folder
+func uploadArtifacts(ctx context.Context, cfg *artifactStorageConfig, artifacts analysisArtifacts) (string, error) {
+	if cfg.Bucket == "" {
+		return "", fmt.Errorf("artifactStorage requires a bucket")
+	}
+	creds, err := artifactStorageCredentials(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	rec := artifacts.Decision
+	folder := path.Join(cfg.Prefix, rec.Namespace, rec.AnalysisRun, rec.Metric, rec.Time.UTC().Format("20060102T150405.000Z"))
+
+	decision, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal decision: %v", err)
+	}
+	files := []artifactFile{
+		{"decision.json", "application/json", decision},
+		{"analysis.json", "application/json", []byte(artifacts.AnalysisJSON)},
+		{"logs.txt", "text/plain; charset=utf-8", []byte(artifacts.Logs)},
+	}
+	if artifacts.Prompt != "" {
+		files = append(files, artifactFile{"prompt.txt", "text/plain; charset=utf-8", []byte(artifacts.Prompt)})
+	}
+	if artifacts.AgentTranscript != nil {
+		transcript, err := json.MarshalIndent(artifacts.AgentTranscript, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal agent transcript: %v", err)
+		}
+		files = append(files, artifactFile{"agent-transcript.json", "application/json", transcript})
+	}
+	for _, f := range files {
+		if err := putObject(ctx, cfg, creds, folder+"/"+f.name, f.contentType, f.body); err != nil {
+			return "", err
+		}
+	}
+
+	scheme := "s3"
+	if cfg.Provider == ArtifactStorageGCS {
+		scheme = "gs"
+	}
+	return fmt.Sprintf("%s://%s/%s/", scheme, cfg.Bucket, folder), nil
+}
+
+// artifactStorageCredentials reads the access keys of the bucket
+func artifactStorageCredentials(ctx context.Context, cfg *artifactStorageConfig) (awsCredentials, error) {
+	accessKeyID, err := readSecretRefOrDefault(ctx, cfg.AccessKeyIDSecretRef, "storage_access_key_id")
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to get storage access key ID from secret: %v", err)
+	}
+	secretAccessKey, err := readSecretRefOrDefault(ctx, cfg.SecretAccessKeySecretRef, "storage_secret_access_key")
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to get storage secret access key from secret: %v", err)
+	}
+	return awsCredentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey}, nil
+}
+
+// objectURL returns the URL of an object: virtual-hosted style on AWS, path style on other endpoints
+func objectURL(cfg *artifactStorageConfig, region, key string) (*url.URL, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" && cfg.Provider == ArtifactStorageGCS {
+		endpoint = gcsXMLAPIEndpoint
+	}
+	if endpoint == "" {
+		return &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", cfg.Bucket, region), Path: "/" + key}, nil
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid storage endpoint %s", endpoint)
+	}
+	u.Path += "/" + cfg.Bucket + "/" + key
+	return u, nil
+}
+
+// putObject uploads an object with a Signature Version 4 signed PUT request
+func putObject(ctx context.Context, cfg *artifactStorageConfig, creds awsCredentials, key, contentType string, body []byte) error {
+	return putObjectHeaders(ctx, cfg, creds, key, contentType, body, nil)
+}
+
+// putObjectHeaders uploads an object with additional request headers, such as conditional write headers
+func putObjectHeaders(ctx context.Context, cfg *artifactStorageConfig, creds awsCredentials, key, contentType string, body []byte, headers map[string]string) error {
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+		if cfg.Provider == ArtifactStorageGCS {
+			region = "auto"
+		}
+	}
+	u, err := objectURL(cfg, region, key)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	signAWSRequest(req, hashSHA256(body), creds, region, "s3", time.Now())
+
+	resp, err := artifactHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("upload of %s returned status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestObjectURL(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  artifactStorageConfig
+		want string
+	}{
+		{artifactStorageConfig{Bucket: "evidence"}, "https://evidence.s3.eu-west-1.amazonaws.com/a/b.json"},
+		{artifactStorageConfig{Bucket: "evidence", Provider: ArtifactStorageGCS}, "https://storage.googleapis.com/evidence/a/b.json"},
+		{artifactStorageConfig{Bucket: "evidence", Endpoint: "http://minio.minio:9000/"}, "http://minio.minio:9000/evidence/a/b.json"},
+	} {
+		u, err := objectURL(&tc.cfg, "eu-west-1", "a/b.json")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if u.String() != tc.want {
+			t.Errorf("expected %s, got %s", tc.want, u)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Audit log environment variables
+const (
+	// envAuditSink is the append-only sink of the decision audit log: file:///path/audit.jsonl,
+	// s3://bucket/prefix, gs://bucket/prefix or crd
+	envAuditSink = "METRIC_AI_AUDIT_SINK"
+	// envAuditRequired fails measurements whose decision could not be audited
+	envAuditRequired = "METRIC_AI_AUDIT_REQUIRED"
+	// envAuditRegion and envAuditEndpoint configure S3 sinks, like the region and endpoint of artifactStorage
+	envAuditRegion   = "METRIC_AI_AUDIT_REGION"
+	envAuditEndpoint = "METRIC_AI_AUDIT_ENDPOINT"
+)
+
+// decisionAuditGVR is the cluster-scoped AIDecisionAudit custom resource, see config/crd/aidecisionaudits.yaml
+var decisionAuditGVR = schema.GroupVersionResource{Group: "metricai.argoproj-labs.io", Version: "v1alpha1", Resource: "aidecisionaudits"}
+
+// decisionAuditNamespaceLabel is the namespace of the AnalysisRun of cluster-scoped AIDecisionAudits
+const decisionAuditNamespaceLabel = "metricai.argoproj-labs.io/namespace"
+
+// auditRecord is an entry of the decision audit log, recording who made which promotion decision when
+type auditRecord struct {
+	Time time.Time `json:"time"`
+	// Actor made the decision: the Kubernetes Agent in agent mode, otherwise the model
+	Actor          string `json:"actor"`
+	Mode           string `json:"mode"`
+	Model          string `json:"model,omitempty"`
+	Namespace      string `json:"namespace"`
+	Rollout        string `json:"rollout,omitempty"`
+	Revision       string `json:"revision,omitempty"`
+	AnalysisRun    string `json:"analysisRun"`
+	AnalysisRunUID string `json:"analysisRunUid,omitempty"`
+	Metric         string `json:"metric"`
+	CorrelationID  string `json:"correlationId,omitempty"`
+	PromptHash     string `json:"promptHash,omitempty"`
+	// Verdict is promote or reject
+	Verdict    string `json:"verdict"`
+	Phase      string `json:"phase"`
+	Confidence int    `json:"confidence"`
+	Severity   string `json:"severity,omitempty"`
+	IssueURL   string `json:"issueUrl,omitempty"`
+}
+
+// newAuditRecord builds the audit entry of a decision
+func newAuditRecord(rec decisionRecord, correlation string) auditRecord {
+	actor := rec.Model
+	if rec.Mode == AnalysisModeAgent {
+		actor = "kubernetes-agent"
+	}
+	verdict := "reject"
+	if rec.Promote {
+		verdict = "promote"
+	}
+	return auditRecord{
+		Time:           rec.Time,
+		Actor:          actor,
+		Mode:           rec.Mode,
+		Model:          rec.Model,
+		Namespace:      rec.Namespace,
+		Rollout:        rec.Rollout,
+		Revision:       rec.Revision,
+		AnalysisRun:    rec.AnalysisRun,
+		AnalysisRunUID: rec.AnalysisRunUID,
+		Metric:         rec.Metric,
+		CorrelationID:  correlation,
+		PromptHash:     rec.PromptHash,
+		Verdict:        verdict,
+		Phase:          string(rec.Phase),
+		Confidence:     rec.Confidence,
+		Severity:       rec.Severity,
+		IssueURL:       rec.IssueURL,
+	}
+}
+
+// auditSink appends audit records, never modifying or deleting earlier ones
+type auditSink interface {
+	append(ctx context.Context, entry auditRecord) error
+}
+
+// newAuditSink returns the audit sink configured in METRIC_AI_AUDIT_SINK, nil when auditing is disabled
+func newAuditSink() (auditSink, error) {
+	sink := os.Getenv(envAuditSink)
+	if sink == "" {
+		return nil, nil
+	}
+	if sink == "crd" {
+		return crdAuditSink{}, nil
+	}
+	u, err := url.Parse(sink)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", envAuditSink, sink, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid %s %q: missing file path", envAuditSink, sink)
+		}
+		return &fileAuditSink{path: u.Path}, nil
+	case "s3", "gs":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid %s %q: missing bucket", envAuditSink, sink)
+		}
+		cfg := &artifactStorageConfig{
+			Bucket:   u.Host,
+			Prefix:   strings.Trim(u.Path, "/"),
+			Region:   os.Getenv(envAuditRegion),
+			Endpoint: os.Getenv(envAuditEndpoint),
+		}
+		if u.Scheme == "gs" {
+			cfg.Provider = ArtifactStorageGCS
+		}
+		return objectAuditSink{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("invalid %s %q: expected file://, s3://, gs:// or crd", envAuditSink, sink)
+	}
+}
+
+// auditRequired reports whether measurements fail when their decision could not be audited
+func auditRequired() bool {
+	return os.Getenv(envAuditRequired) == "true"
+}
+
+// auditDecision appends the decision to the configured audit sink
+func auditDecision(ctx context.Context, rec decisionRecord, correlation string) error {
+	sink, err := newAuditSink()
+	if err != nil || sink == nil {
+		return err
+	}
+	if err := sink.append(ctx, newAuditRecord(rec, correlation)); err != nil {
+		return fmt.Errorf("failed to audit decision: %v", err)
+	}
+	return nil
+}
+
+// fileAuditMu serializes appends of concurrent measurements, so lines are never interleaved
+var fileAuditMu sync.Mutex
+
+// fileAuditSink appends JSON lines to a file, e.g. on a volume collected by the log pipeline.
+// The file is opened for every entry so rotated files are picked up.
+type fileAuditSink struct {
+	path string
+}
+
+func (s *fileAuditSink) append(_ context.Context, entry auditRecord) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+	fileAuditMu.Lock()
+	defer fileAuditMu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	// The decision is only audited once it is on disk
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// objectAuditSink writes each entry as a new object of an S3 or Cloud Storage bucket, which can be
+// protected with object lock or retention policies. Objects are created with If-None-Match so an
+// existing entry is never overwritten.
+type objectAuditSink struct {
+	cfg *artifactStorageConfig
+}
+
+// auditObjectKey returns <prefix>/<yyyy>/<mm>/<dd>/<time>-<namespace>-<analysisrun>-<metric>.json
+func auditObjectKey(prefix string, entry auditRecord) string {
+	t := entry.Time.UTC()
+	name := fmt.Sprintf("%s-%s-%s-%s.json", t.Format("20060102T150405.000000000Z"), entry.Namespace, entry.AnalysisRun, entry.Metric)
+	return path.Join(prefix, t.Format("2006/01/02"), name)
+}
+
+func (s objectAuditSink) append(ctx context.Context, entry auditRecord) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+	creds, err := artifactStorageCredentials(ctx, s.cfg)
+	if err != nil {
+		return err
+	}
+	return putObjectHeaders(ctx, s.cfg, creds, auditObjectKey(s.cfg.Prefix, entry), "application/json", body,
+		map[string]string{"If-None-Match": "*"})
+}
+
+// crdAuditSink creates a cluster-scoped AIDecisionAudit resource per entry. The CRD rejects updates,
+// and the plugin is only allowed to create the resources.
+type crdAuditSink struct{}
+
+// newDecisionAuditResource builds the AIDecisionAudit of an entry
+func newDecisionAuditResource(entry auditRecord) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"time":        entry.Time.Format(time.RFC3339Nano),
+		"actor":       entry.Actor,
+		"mode":        entry.Mode,
+		"namespace":   entry.Namespace,
+		"analysisRun": entry.AnalysisRun,
+		"metric":      entry.Metric,
+		"verdict":     entry.Verdict,
+		"phase":       entry.Phase,
+		"confidence":  int64(entry.Confidence),
+	}
+	for key, value := range map[string]string{
+		"model":          entry.Model,
+		"rollout":        entry.Rollout,
+		"revision":       entry.Revision,
+		"analysisRunUid": entry.AnalysisRunUID,
+		"correlationId":  entry.CorrelationID,
+		"promptHash":     entry.PromptHash,
+		"severity":       entry.Severity,
+		"issueUrl":       entry.IssueURL,
+	} {
+		if value != "" {
+			spec[key] = value
+		}
+	}
+
+	labels := map[string]interface{}{
+		"app.kubernetes.io/managed-by": "rollouts-plugin-metric-ai",
+		analysisReportAnalysisRunLabel: labelValue(entry.AnalysisRun),
+		analysisReportMetricLabel:      labelValue(entry.Metric),
+		decisionAuditNamespaceLabel:    labelValue(entry.Namespace),
+	}
+	if entry.Rollout != "" {
+		labels[analysisReportRolloutLabel] = labelValue(entry.Rollout)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": decisionAuditGVR.GroupVersion().String(),
+		"kind":       "AIDecisionAudit",
+		"metadata": map[string]interface{}{
+			// The API server appends a random suffix, names are unique across namespaces
+			"generateName": entry.Namespace + "-" + entry.AnalysisRun + "-",
+			"labels":       labels,
+		},
+		"spec": spec,
+	}}
+}
+
+func (crdAuditSink) append(ctx context.Context, entry auditRecord) error {
+	client, err := getDynamicClient()
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	if _, err := client.Resource(decisionAuditGVR).Create(ctx, newDecisionAuditResource(entry), metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create AIDecisionAudit: %v", err)
+	}
+	return nil
+}
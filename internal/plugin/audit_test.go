@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestDecisionAudit(t *testing.T) {
+	rec := decisionRecord{
+		Time:        time.Unix(1700000000, 0).UTC(),
+		AnalysisRun: "checkout-abc-1",
+		Namespace:   "shop",
+		Rollout:     "checkout",
+		Metric:      "ai",
+		Mode:        AnalysisModeDefault,
+		Model:       "gemini-2.0-flash",
+		Phase:       v1alpha1.AnalysisPhaseFailed,
+		Confidence:  88,
+		PromptHash:  "9f86d081",
+	}
+	entry := newAuditRecord(rec, "uid.ai.1700000000")
+	if entry.Actor != "gemini-2.0-flash" || entry.Verdict != "reject" || entry.CorrelationID != "uid.ai.1700000000" {
+		t.Errorf("unexpected audit record %+v", entry)
+	}
+
+	// Without a sink decisions are not audited
+	t.Setenv(envAuditSink, "")
+	if err := auditDecision(context.Background(), rec, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, sink := range []string{"ftp://audit", "file://", "s3://"} {
+		t.Setenv(envAuditSink, sink)
+		if _, err := newAuditSink(); err == nil {
+			t.Errorf("expected invalid audit sink %q", sink)
+		}
+	}
+
+	// The file sink appends a JSON line per decision
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv(envAuditSink, "file://"+file)
+	for i := 0; i < 2; i++ {
+		if err := auditDecision(context.Background(), rec, "uid.ai.1700000000"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit lines, got %q", data)
+	}
+	var line auditRecord
+	if err := json.Unmarshal([]byte(lines[1]), &line); err != nil || line.Verdict != "reject" || line.PromptHash != "9f86d081" {
+		t.Errorf("unexpected audit line %s: %v", lines[1], err)
+	}
+
+	// Object sinks never overwrite entries
+	var key, ifNoneMatch string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ifNoneMatch = r.URL.Path, r.Header.Get("If-None-Match")
+	}))
+	defer server.Close()
+	configValues.Lock()
+	configValues.values["storage_access_key_id"], configValues.values["storage_secret_access_key"] = "AKID", "secret"
+	configValues.Unlock()
+	t.Cleanup(func() {
+		configValues.Lock()
+		delete(configValues.values, "storage_access_key_id")
+		delete(configValues.values, "storage_secret_access_key")
+		configValues.Unlock()
+	})
+	t.Setenv(envAuditSink, "s3://audit/rollouts/")
+	t.Setenv(envAuditEndpoint, server.URL)
+	if err := auditDecision(context.Background(), rec, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key != "/audit/rollouts/2023/11/14/20231114T221320.000000000Z-shop-checkout-abc-1-ai.json" || ifNoneMatch != "*" {
+		t.Errorf("unexpected audit object %s (If-None-Match: %q)", key, ifNoneMatch)
+	}
+
+	resource := newDecisionAuditResource(entry)
+	if resource.GetKind() != "AIDecisionAudit" || resource.GetNamespace() != "" || resource.GetGenerateName() != "shop-checkout-abc-1-" {
+		t.Errorf("unexpected metadata %s %s/%s", resource.GetKind(), resource.GetNamespace(), resource.GetGenerateName())
+	}
+	spec := resource.Object["spec"].(map[string]interface{})
+	if spec["verdict"] != "reject" || spec["confidence"] != int64(88) || spec["actor"] != "gemini-2.0-flash" {
+		t.Errorf("unexpected spec %v", spec)
+	}
+}
@@ -0,0 +1,228 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables of IAM Roles for Service Accounts and the AWS SDKs
+const (
+	envAWSRoleARN              = "AWS_ROLE_ARN"
+	envAWSWebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	envAWSAccessKeyID          = "AWS_ACCESS_KEY_ID"
+	envAWSSecretAccessKey      = "AWS_SECRET_ACCESS_KEY"
+	envAWSSessionToken         = "AWS_SESSION_TOKEN"
+)
+
+// envAWSSecretARN names a Secrets Manager secret with the plugin configuration keys
+const envAWSSecretARN = "METRIC_AI_AWS_SECRET_ARN"
+
+// awsSecretCacheTTL bounds how long Secrets Manager values are cached
+const awsSecretCacheTTL = 5 * time.Minute
+
+// secretManagerHTTPClient is used for requests to cloud secret managers and their token services
+var secretManagerHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// awsEndpoint returns the regional endpoint of an AWS service
+var awsEndpoint = func(service, region string) string {
+	return fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region)
+}
+
+// awsWebIdentityCache holds the temporary credentials of the service account role
+var awsWebIdentityCache = struct {
+	sync.Mutex
+	creds      awsCredentials
+	expiration time.Time
+}{}
+
+// awsSecretCache holds the Secrets Manager values by ARN
+var awsSecretCache = struct {
+	sync.Mutex
+	entries map[string]secretCacheEntry
+}{entries: make(map[string]secretCacheEntry)}
+
+// secretCacheEntry holds the values of a secret manager secret until they expire
+type secretCacheEntry struct {
+	values    map[string]string
+	expiresAt time.Time
+}
+
+// awsSecretARN is the parsed ARN of a Secrets Manager secret
+type awsSecretARN struct {
+	Region string
+	// Name includes the random suffix Secrets Manager appends
+	Name string
+}
+
+// parseAWSSecretARN parses arn:aws:secretsmanager:<region>:<account>:secret:<name>
+func parseAWSSecretARN(arn string) (awsSecretARN, error) {
+	parts := strings.SplitN(arn, ":", 7)
+	if len(parts) != 7 || parts[0] != "arn" || parts[2] != "secretsmanager" || parts[3] == "" || parts[5] != "secret" || parts[6] == "" {
+		return awsSecretARN{}, fmt.Errorf("invalid Secrets Manager secret ARN %q", arn)
+	}
+	return awsSecretARN{Region: parts[3], Name: parts[6]}, nil
+}
+
+// awsRoleCredentials returns the credentials of the service account role (IRSA), assumed with the
+// projected web identity token, or else the static credentials of the environment
+func awsRoleCredentials(ctx context.Context, region string) (awsCredentials, error) {
+	roleARN, tokenFile := os.Getenv(envAWSRoleARN), os.Getenv(envAWSWebIdentityTokenFile)
+	if roleARN == "" || tokenFile == "" {
+		creds := awsCredentials{
+			AccessKeyID:     os.Getenv(envAWSAccessKeyID),
+			SecretAccessKey: os.Getenv(envAWSSecretAccessKey),
+			SessionToken:    os.Getenv(envAWSSessionToken),
+		}
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return awsCredentials{}, fmt.Errorf("no AWS credentials: %s and %s are not set", envAWSRoleARN, envAWSWebIdentityTokenFile)
+		}
+		return creds, nil
+	}
+
+	awsWebIdentityCache.Lock()
+	defer awsWebIdentityCache.Unlock()
+	if time.Now().Add(5 * time.Minute).Before(awsWebIdentityCache.expiration) {
+		return awsWebIdentityCache.creds, nil
+	}
+	// The token is rotated by the kubelet, read it for every role assumption
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read web identity token: %v", err)
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {"rollouts-plugin-metric-ai"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, awsEndpoint("sts", region), strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := doSecretManagerRequest(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to assume role %s: %v", roleARN, err)
+	}
+	var resp struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to decode STS response: %v", err)
+	}
+	awsWebIdentityCache.creds = awsCredentials{
+		AccessKeyID:     resp.Credentials.AccessKeyID,
+		SecretAccessKey: resp.Credentials.SecretAccessKey,
+		SessionToken:    resp.Credentials.SessionToken,
+	}
+	awsWebIdentityCache.expiration = resp.Credentials.Expiration
+	return awsWebIdentityCache.creds, nil
+}
+
+// getAWSSecret returns the keys of a Secrets Manager secret, whose value is a JSON object of strings
+func getAWSSecret(ctx context.Context, arn string) (map[string]string, error) {
+	awsSecretCache.Lock()
+	entry, ok := awsSecretCache.entries[arn]
+	awsSecretCache.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.values, nil
+	}
+
+	parsed, err := parseAWSSecretARN(arn)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := awsRoleCredentials(ctx, parsed.Region)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(map[string]string{"SecretId": arn})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, awsEndpoint("secretsmanager", parsed.Region), bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, hashSHA256(payload), creds, parsed.Region, "secretsmanager", time.Now())
+	body, err := doSecretManagerRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %v", parsed.Name, err)
+	}
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode Secrets Manager response: %v", err)
+	}
+	values := make(map[string]string)
+	if err := json.Unmarshal([]byte(resp.SecretString), &values); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object of strings: %v", parsed.Name, err)
+	}
+
+	awsSecretCache.Lock()
+	awsSecretCache.entries[arn] = secretCacheEntry{values: values, expiresAt: time.Now().Add(awsSecretCacheTTL)}
+	awsSecretCache.Unlock()
+	return values, nil
+}
+
+// readAWSSecretKey reads a key of a Secrets Manager secret
+func readAWSSecretKey(ctx context.Context, arn, key string) (string, error) {
+	values, err := getAWSSecret(ctx, arn)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(values[key])
+	if value == "" {
+		return "", fmt.Errorf("key %s not found in Secrets Manager secret %s", key, arn)
+	}
+	return value, nil
+}
+
+// checkAWSSecretNamespace allows metrics to read only secrets named after their namespace, so
+// teams cannot read each other's secrets through the controller role
+func checkAWSSecretNamespace(arn, namespace string) error {
+	parsed, err := parseAWSSecretARN(arn)
+	if err != nil {
+		return err
+	}
+	if namespace == "" || !strings.HasPrefix(parsed.Name, namespace+"/") {
+		return fmt.Errorf("secret %s must be named %s/<name> to be used by metrics of namespace %s", parsed.Name, namespace, namespace)
+	}
+	return nil
+}
+
+// doSecretManagerRequest sends a secret manager or token service request and returns the response body
+func doSecretManagerRequest(req *http.Request) ([]byte, error) {
+	resp, err := secretManagerHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(truncate(string(body), 1024)))
+	}
+	return body, nil
+}
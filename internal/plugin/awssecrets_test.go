@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetAWSSecret(t *testing.T) {
+	var stsCalls int
+	var target, auth, securityToken string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sts/eu-west-1/":
+			stsCalls++
+			_ = r.ParseForm()
+			if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("WebIdentityToken") != "projected-token" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>
+<Expiration>2099-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+		case "/secretsmanager/eu-west-1/":
+			target, auth, securityToken = r.Header.Get("X-Amz-Target"), r.Header.Get("Authorization"), r.Header.Get("X-Amz-Security-Token")
+			fmt.Fprint(w, `{"SecretString":"{\"google_api_key\":\"team-key\"}"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	oldEndpoint := awsEndpoint
+	awsEndpoint = func(service, region string) string { return server.URL + "/" + service + "/" + region + "/" }
+	t.Cleanup(func() {
+		awsEndpoint = oldEndpoint
+		awsWebIdentityCache.creds, awsWebIdentityCache.expiration = awsCredentials{}, time.Time{}
+		awsSecretCache.entries = make(map[string]secretCacheEntry)
+	})
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("projected-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envAWSRoleARN, "arn:aws:iam::123456789012:role/metric-ai")
+	t.Setenv(envAWSWebIdentityTokenFile, tokenFile)
+
+	arn := "arn:aws:secretsmanager:eu-west-1:123456789012:secret:shop/metric-ai-AbCdEf"
+	for i := 0; i < 2; i++ {
+		key, err := readAWSSecretKey(context.Background(), arn, "google_api_key")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if key != "team-key" {
+			t.Errorf("expected the secret key, got %q", key)
+		}
+	}
+	if stsCalls != 1 {
+		t.Errorf("expected the role credentials and secret to be cached, got %d STS calls", stsCalls)
+	}
+	if target != "secretsmanager.GetSecretValue" || securityToken != "session" || !strings.Contains(auth, "Credential=ASIAEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/secretsmanager/aws4_request") {
+		t.Errorf("unexpected request target %q, token %q, authorization %q", target, securityToken, auth)
+	}
+
+	if err := checkAWSSecretNamespace(arn, "shop"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := checkAWSSecretNamespace(arn, "other"); err == nil {
+		t.Error("expected secrets of other namespaces to be rejected")
+	}
+	if _, err := parseAWSSecretARN("arn:aws:s3:::bucket"); err == nil {
+		t.Error("expected an error for a non Secrets Manager ARN")
+	}
+}
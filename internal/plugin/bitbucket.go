@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// bitbucketCloudAPI is the Bitbucket Cloud REST API base URL
+const bitbucketCloudAPI = "https://api.bitbucket.org/2.0"
+
+// bitbucketRepo locates a repository on Bitbucket Cloud or Bitbucket Server/Data Center
+type bitbucketRepo struct {
+	// API base URL of the repository
+	apiURL string
+	// Whether this is Bitbucket Server/Data Center, which has no issue tracker
+	server bool
+}
+
+// parseBitbucketURL parses Bitbucket Cloud (https://bitbucket.org/workspace/repo) and
+// Bitbucket Server (https://host/projects/KEY/repos/slug or https://host/scm/key/slug.git) URLs
+func parseBitbucketURL(repoURL string) (bitbucketRepo, error) {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return bitbucketRepo{}, fmt.Errorf("invalid Bitbucket URL format: %s", repoURL)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	if u.Host == "bitbucket.org" {
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return bitbucketRepo{}, fmt.Errorf("could not extract workspace/repository from URL: %s", repoURL)
+		}
+		return bitbucketRepo{apiURL: fmt.Sprintf("%s/repositories/%s/%s", bitbucketCloudAPI, parts[0], parts[1])}, nil
+	}
+
+	// Bitbucket Server may be hosted under a context path, so look for the known path segments
+	for i := 0; i+2 < len(parts); i++ {
+		var project, slug string
+		switch {
+		case parts[i] == "projects" && i+3 < len(parts) && parts[i+2] == "repos":
+			project, slug = parts[i+1], parts[i+3]
+		case parts[i] == "scm":
+			project, slug = parts[i+1], parts[i+2]
+		default:
+			continue
+		}
+		base := u.Scheme + "://" + u.Host + "/" + strings.Join(parts[:i], "/")
+		return bitbucketRepo{
+			apiURL: fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s", strings.TrimSuffix(base, "/"), project, slug),
+			server: true,
+		}, nil
+	}
+	return bitbucketRepo{}, fmt.Errorf("could not extract project/repository from Bitbucket Server URL: %s", repoURL)
+}
+
+// bitbucketAuth returns the authentication of Bitbucket requests: an app password with basic
+// authentication when a username is configured, a bearer access token otherwise
+func bitbucketAuth(username string) (func(*http.Request), error) {
+	if username != "" {
+		password, err := getSecretValue("bitbucket_app_password")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Bitbucket app password from secret: %v", err)
+		}
+		return func(req *http.Request) { req.SetBasicAuth(username, password) }, nil
+	}
+	token, err := getSecretValue("bitbucket_token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Bitbucket token from secret: %v", err)
+	}
+	return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }, nil
+}
+
+// reportToBitbucket creates a Bitbucket Cloud issue or comments on the canary pull request
+func reportToBitbucket(ctx context.Context, cfg aiConfig, title, body string) (int, error) {
+	repo, err := parseBitbucketURL(cfg.GitHubURL)
+	if err != nil {
+		return 0, err
+	}
+	auth, err := bitbucketAuth(cfg.BitbucketUsername)
+	if err != nil {
+		return 0, err
+	}
+	logCtx := log.WithContext(ctx).WithField("repository", repo.apiURL)
+	text := fmt.Sprintf("## %s\n\n%s", title, body)
+
+	switch cfg.GitHubTarget {
+	case GitHubTargetPR, GitHubTargetPRReview:
+		id, err := resolveBitbucketPullRequest(ctx, repo, auth, cfg.PRNumber, cfg.CommitSHA)
+		if err != nil {
+			return 0, err
+		}
+		var comment interface{} = map[string]interface{}{"content": map[string]string{"raw": text}}
+		path := fmt.Sprintf("/pullrequests/%d/comments", id)
+		if repo.server {
+			comment = map[string]string{"text": text}
+			path = fmt.Sprintf("/pull-requests/%d/comments", id)
+		}
+		if err := gitAPIRequest(ctx, http.MethodPost, repo.apiURL+path, auth, comment, nil); err != nil {
+			return 0, fmt.Errorf("failed to comment on Bitbucket pull request: %v", err)
+		}
+		logCtx.WithField("pullRequest", id).Info("Successfully reported canary analysis on Bitbucket pull request")
+		return 0, nil
+	case "", GitHubTargetIssue:
+		if repo.server {
+			return 0, fmt.Errorf("bitbucket Server has no issue tracker, use githubTarget pr")
+		}
+		issue := map[string]interface{}{
+			"title":   title,
+			"content": map[string]string{"raw": body},
+			"kind":    "bug",
+		}
+		var created struct {
+			ID int `json:"id"`
+		}
+		if err := gitAPIRequest(ctx, http.MethodPost, repo.apiURL+"/issues", auth, issue, &created); err != nil {
+			return 0, fmt.Errorf("failed to create Bitbucket issue: %v", err)
+		}
+		logCtx.WithField("issue", created.ID).Info("Successfully created Bitbucket issue")
+		return created.ID, nil
+	default:
+		return 0, fmt.Errorf("unsupported githubTarget %q", cfg.GitHubTarget)
+	}
+}
+
+// resolveBitbucketPullRequest returns the configured pull request ID or looks up the pull request
+// containing the canary commit, preferring open pull requests
+func resolveBitbucketPullRequest(ctx context.Context, repo bitbucketRepo, auth func(*http.Request), prNumber json.Number, commitSHA string) (int, error) {
+	if prNumber != "" {
+		n, err := prNumber.Int64()
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid prNumber %q", prNumber)
+		}
+		return int(n), nil
+	}
+	if commitSHA == "" {
+		return 0, fmt.Errorf("reporting on a pull request requires prNumber or commitSha")
+	}
+
+	var page struct {
+		Values []struct {
+			ID    int    `json:"id"`
+			State string `json:"state"`
+		} `json:"values"`
+	}
+	path := fmt.Sprintf("/commit/%s/pullrequests", url.PathEscape(commitSHA))
+	if repo.server {
+		path = fmt.Sprintf("/commits/%s/pull-requests", url.PathEscape(commitSHA))
+	}
+	if err := gitAPIRequest(ctx, http.MethodGet, repo.apiURL+path, auth, nil, &page); err != nil {
+		return 0, fmt.Errorf("failed to find pull requests for commit %s: %v", commitSHA, err)
+	}
+	if len(page.Values) == 0 {
+		return 0, fmt.Errorf("no pull request found for commit %s", commitSHA)
+	}
+	for _, pr := range page.Values {
+		if strings.EqualFold(pr.State, "open") {
+			return pr.ID, nil
+		}
+	}
+	return page.Values[0].ID, nil
+}
+
+// closeBitbucketIssue comments on and resolves a Bitbucket Cloud issue
+func closeBitbucketIssue(ctx context.Context, cfg aiConfig, id int, comment string) error {
+	repo, err := parseBitbucketURL(cfg.GitHubURL)
+	if err != nil {
+		return err
+	}
+	auth, err := bitbucketAuth(cfg.BitbucketUsername)
+	if err != nil {
+		return err
+	}
+	issue := fmt.Sprintf("%s/issues/%d", repo.apiURL, id)
+	if err := gitAPIRequest(ctx, http.MethodPost, issue+"/comments", auth, map[string]interface{}{"content": map[string]string{"raw": comment}}, nil); err != nil {
+		return fmt.Errorf("failed to comment on Bitbucket issue %d: %v", id, err)
+	}
+	if err := gitAPIRequest(ctx, http.MethodPut, issue, auth, map[string]string{"state": "resolved"}, nil); err != nil {
+		return fmt.Errorf("failed to resolve Bitbucket issue %d: %v", id, err)
+	}
+	return nil
+}
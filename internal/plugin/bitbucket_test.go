@@ -0,0 +1,24 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestParseBitbucketURL(t *testing.T) {
+	for in, want := range map[string]bitbucketRepo{
+		"https://bitbucket.org/acme/checkout":                               {apiURL: "https://api.bitbucket.org/2.0/repositories/acme/checkout"},
+		"https://bitbucket.example.com/projects/SHOP/repos/checkout/browse": {apiURL: "https://bitbucket.example.com/rest/api/1.0/projects/SHOP/repos/checkout", server: true},
+		"https://git.example.com/bitbucket/scm/shop/checkout.git":           {apiURL: "https://git.example.com/bitbucket/rest/api/1.0/projects/shop/repos/checkout", server: true},
+	} {
+		got, err := parseBitbucketURL(in)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("expected %+v for %s, got %+v", want, in, got)
+		}
+	}
+	if _, err := parseBitbucketURL("https://bitbucket.example.com/checkout"); err == nil {
+		t.Error("expected an error for an unknown Bitbucket Server URL")
+	}
+}
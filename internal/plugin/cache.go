@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cachedAnalysis is an AI decision cached for unchanged logs
+type cachedAnalysis struct {
+	RawJSON   string           `json:"rawJSON"`
+	Result    AIAnalysisResult `json:"result"`
+	ExpiresAt time.Time        `json:"expiresAt"`
+}
+
+// analysisCache is the in-memory decision cache shared by all measurements
+var analysisCache = struct {
+	sync.Mutex
+	entries map[string]cachedAnalysis
+}{entries: make(map[string]cachedAnalysis)}
+
+// analysisCacheKey fingerprints the logs and every analysis parameter, so that a new parameter is part
+// of the key unless it is excluded here. The measurement history is deliberately excluded: it changes
+// on every measurement while the evidence being judged does not. So are the credentials, the agent job
+// of a resumed measurement, the agent rollout context, filled in later from the same rollout, and the
+// agent timeout and health check, which don't change the analysis.
+func analysisCacheKey(mode string, params AIAnalysisParams, namespace, podName string) string {
+	params.History = ""
+	params.APIKey, params.AgentToken, params.AgentTLSSecretRef = "", "", nil
+	params.AgentJobID, params.AgentRollout = "", A2ARolloutContext{}
+	params.AgentTimeout, params.AgentHealthPath = 0, ""
+	// The unexported MCP server tokens are left out by the encoding
+	encoded, _ := json.Marshal(params)
+	h := sha256.New()
+	for _, s := range []string{mode, namespace, podName, string(encoded)} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// getCachedAnalysis returns a non-expired cached decision from memory or, if configured, the cache ConfigMap
+func getCachedAnalysis(ctx context.Context, client *kubernetes.Clientset, namespace, configMapName, key string) (cachedAnalysis, bool) {
+	now := time.Now()
+
+	analysisCache.Lock()
+	entry, ok := analysisCache.entries[key]
+	if ok && now.After(entry.ExpiresAt) {
+		delete(analysisCache.entries, key)
+		ok = false
+	}
+	analysisCache.Unlock()
+	if ok || configMapName == "" || client == nil {
+		return entry, ok
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, configMapName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			log.WithContext(ctx).WithError(err).WithField("configMap", configMapName).Warn("Failed to read analysis cache ConfigMap")
+		}
+		return cachedAnalysis{}, false
+	}
+	data, ok := cm.Data[key]
+	if !ok {
+		return cachedAnalysis{}, false
+	}
+	if err := json.Unmarshal([]byte(data), &entry); err != nil || now.After(entry.ExpiresAt) {
+		return cachedAnalysis{}, false
+	}
+
+	analysisCache.Lock()
+	analysisCache.entries[key] = entry
+	analysisCache.Unlock()
+	return entry, true
+}
+
+// putCachedAnalysis stores a decision in memory and, if configured, in the cache ConfigMap,
+// pruning expired ConfigMap entries
+func putCachedAnalysis(ctx context.Context, client *kubernetes.Clientset, namespace, configMapName, key string, entry cachedAnalysis) error {
+	analysisCache.Lock()
+	analysisCache.entries[key] = entry
+	for k, e := range analysisCache.entries {
+		if time.Now().After(e.ExpiresAt) {
+			delete(analysisCache.entries, k)
+		}
+	}
+	analysisCache.Unlock()
+
+	if configMapName == "" || client == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %v", err)
+	}
+
+	cms := client.CoreV1().ConfigMaps(namespace)
+	cm, err := cms.Get(ctx, configMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      configMapName,
+				Namespace: namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "rollouts-plugin-metric-ai"},
+			},
+			Data: map[string]string{key: string(data)},
+		}
+		if _, err := cms.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create cache ConfigMap %s: %v", configMapName, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get cache ConfigMap %s: %v", configMapName, err)
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	for k, v := range cm.Data {
+		var e cachedAnalysis
+		if json.Unmarshal([]byte(v), &e) != nil || time.Now().After(e.ExpiresAt) {
+			delete(cm.Data, k)
+		}
+	}
+	cm.Data[key] = string(data)
+	if _, err := cms.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update cache ConfigMap %s: %v", configMapName, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+func TestAnalysisCache(t *testing.T) {
+	params := AIAnalysisParams{ModelName: "m", LogsContext: "logs", History: "one"}
+	key := analysisCacheKey(AnalysisModeDefault, params, "", "")
+
+	params.History = "two"
+	if analysisCacheKey(AnalysisModeDefault, params, "", "") != key {
+		t.Fatal("expected history to be excluded from the cache key")
+	}
+	params.APIKey, params.AgentToken, params.AgentJobID = "key", "token", "job-1"
+	if analysisCacheKey(AnalysisModeDefault, params, "", "") != key {
+		t.Fatal("expected credentials and agent jobs to be excluded from the cache key")
+	}
+	params.LogsContext = "new logs"
+	if analysisCacheKey(AnalysisModeDefault, params, "", "") == key {
+		t.Fatal("expected different logs to produce a different cache key")
+	}
+	key = analysisCacheKey(AnalysisModeDefault, params, "", "")
+	for name, change := range map[string]func(*AIAnalysisParams){
+		"safety settings": func(p *AIAnalysisParams) {
+			p.SafetySettings = []*genai.SafetySetting{{Category: genai.HarmCategoryHarassment, Threshold: genai.HarmBlockThresholdBlockNone}}
+		},
+		"agent protocol":    func(p *AIAnalysisParams) { p.AgentProtocol = AgentProtocolA2A },
+		"agent compression": func(p *AIAnalysisParams) { p.AgentCompression = "gzip" },
+	} {
+		changed := params
+		change(&changed)
+		if analysisCacheKey(AnalysisModeDefault, changed, "", "") == key {
+			t.Errorf("expected the %s to be part of the cache key", name)
+		}
+	}
+
+	if _, ok := getCachedAnalysis(context.Background(), nil, "default", "", key); ok {
+		t.Fatal("expected cache miss")
+	}
+	entry := cachedAnalysis{RawJSON: "{}", Result: AIAnalysisResult{Promote: true, Confidence: 90}, ExpiresAt: time.Now().Add(time.Minute)}
+	if err := putCachedAnalysis(context.Background(), nil, "default", "", key, entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, ok := getCachedAnalysis(context.Background(), nil, "default", "", key)
+	if !ok || got.Result.Confidence != 90 {
+		t.Fatalf("expected cache hit, got %+v (%v)", got, ok)
+	}
+
+	expired := entry
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := putCachedAnalysis(context.Background(), nil, "default", "", key, expired); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := getCachedAnalysis(context.Background(), nil, "default", "", key); ok {
+		t.Fatal("expected expired entry to be a cache miss")
+	}
+}
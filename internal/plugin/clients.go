@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genai"
+)
+
+// prewarmTimeout bounds the connection pre-warming requests issued at startup
+const prewarmTimeout = 30 * time.Second
+
+// envCABundle names a PEM file of additional CAs trusted for outbound requests, e.g. of a proxy
+// intercepting TLS
+const envCABundle = "METRIC_AI_CA_BUNDLE"
+
+// outboundTransport is used by the clients of Gemini, GitHub, the Kubernetes Agent and all other
+// outbound requests. Like http.DefaultTransport it uses the proxy of HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+var outboundTransport http.RoundTripper = &correlationTransport{base: http.DefaultTransport}
+
+// Bounds of the client pools: clients unused for clientPoolIdleTTL are dropped, and the least recently
+// used one is dropped when a pool is full, so rotated keys and retired agents don't pile up
+const (
+	clientPoolIdleTTL    = time.Hour
+	clientPoolMaxClients = 32
+)
+
+// pooledClient is a pooled client and the time it was last handed out
+type pooledClient[T any] struct {
+	client   T
+	lastUsed time.Time
+}
+
+// clientPool is a bounded pool of clients reused across measurements
+type clientPool[T any] struct {
+	sync.Mutex
+	clients map[string]*pooledClient[T]
+}
+
+func newClientPool[T any]() *clientPool[T] {
+	return &clientPool[T]{clients: make(map[string]*pooledClient[T])}
+}
+
+// get returns the client of the key, creating it with newClient if needed and evicting idle
+// and least recently used clients to stay within the pool bounds
+func (p *clientPool[T]) get(key string, newClient func() (T, error)) (T, error) {
+	p.Lock()
+	defer p.Unlock()
+	now := time.Now()
+	for k, c := range p.clients {
+		if now.Sub(c.lastUsed) > clientPoolIdleTTL {
+			delete(p.clients, k)
+		}
+	}
+	if c, ok := p.clients[key]; ok {
+		c.lastUsed = now
+		return c.client, nil
+	}
+	client, err := newClient()
+	if err != nil {
+		return client, err
+	}
+	if len(p.clients) >= clientPoolMaxClients {
+		var oldest string
+		for k, c := range p.clients {
+			if oldest == "" || c.lastUsed.Before(p.clients[oldest].lastUsed) {
+				oldest = k
+			}
+		}
+		delete(p.clients, oldest)
+	}
+	p.clients[key] = &pooledClient[T]{client: client, lastUsed: now}
+	return client, nil
+}
+
+// genaiClientPool reuses Gemini clients across measurements, keyed by a hash of the API key so that
+// rotated or per-metric keys get their own client without keeping the keys as map keys
+var genaiClientPool = newClientPool[*genai.Client]()
+
+// a2aClientPool reuses agent clients across measurements, keyed by agent protocol, URL, path and compression
+var a2aClientPool = newClientPool[*A2AClient]()
+
+// getGenAIClient returns a pooled Gemini client for the API key, creating it if needed
+func getGenAIClient(ctx context.Context, apiKey string) (*genai.Client, error) {
+	return genaiClientPool.get(hashSHA256([]byte(apiKey)), func() (*genai.Client, error) {
+		return genai.NewClient(ctx, &genai.ClientConfig{
+			APIKey:     apiKey,
+			Backend:    genai.BackendGeminiAPI,
+			HTTPClient: &http.Client{Transport: outboundTransport},
+		})
+	})
+}
+
+// getA2AClient returns a pooled agent client for the URL, protocol (legacy when empty), legacy analysis
+// path (the default path when empty) and request compression, creating it if needed
+func getA2AClient(baseURL, protocol, analyzePath, compression string) *A2AClient {
+	if protocol == "" {
+		protocol = AgentProtocolLegacy
+	}
+	if analyzePath == "" {
+		analyzePath = defaultAgentPath
+	}
+	key := protocol + " " + baseURL + analyzePath + " " + compression
+	client, _ := a2aClientPool.get(key, func() (*A2AClient, error) {
+		client := NewA2AClient(baseURL)
+		client.protocol = protocol
+		client.analyzePath = analyzePath
+		client.compression = compression
+		return client, nil
+	})
+	return client
+}
+
+// newOutboundTransport returns the transport of outbound requests, trusting the CAs of the system and
+// of the METRIC_AI_CA_BUNDLE file and sending the correlation ID of the measurement
+func newOutboundTransport() (http.RoundTripper, error) {
+	bundle := os.Getenv(envCABundle)
+	if bundle == "" {
+		return &correlationTransport{base: http.DefaultTransport}, nil
+	}
+	pem, err := os.ReadFile(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", bundle)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &correlationTransport{base: transport}, nil
+}
+
+// configureOutboundTransport sets the transport of all outbound clients, before any is created
+func configureOutboundTransport() error {
+	transport, err := newOutboundTransport()
+	if err != nil {
+		return err
+	}
+	outboundTransport = transport
+	for _, client := range []*http.Client{sinkHTTPClient, gitHTTPClient, artifactHTTPClient, secretManagerHTTPClient, mcpHTTPClient} {
+		client.Transport = transport
+	}
+	if bundle := os.Getenv(envCABundle); bundle != "" {
+		log.WithField("caBundle", bundle).Info("Trusting the CA bundle for outbound requests")
+	}
+	return nil
+}
+
+// prewarmClients creates the provider clients at startup and opens their connections in the
+// background, so the first analyses don't pay the TLS and auth setup cost
+func prewarmClients() {
+	if googleAPIKey != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), prewarmTimeout)
+			defer cancel()
+			client, err := getGenAIClient(ctx, googleAPIKey)
+			if err != nil {
+				log.WithError(err).Warn("Failed to create Gemini client at startup")
+				return
+			}
+			// A cheap request establishes the connection to the Gemini API
+			if _, err := client.Models.List(ctx, &genai.ListModelsConfig{PageSize: 1}); err != nil {
+				log.WithError(err).Warn("Failed to pre-warm Gemini client connection")
+				return
+			}
+			log.Debug("Gemini client connection pre-warmed")
+		}()
+	}
+
+	if agentURL := os.Getenv("K8S_AGENT_URL"); agentURL != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), prewarmTimeout)
+			defer cancel()
+			if err := getA2AClient(agentURL, "", "", "").HealthCheck(ctx, ""); err != nil {
+				log.WithError(err).Warn("Failed to pre-warm Kubernetes Agent connection")
+				return
+			}
+			log.Debug("Kubernetes Agent connection pre-warmed")
+		}()
+	}
+}
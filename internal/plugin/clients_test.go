@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewOutboundTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(envCABundle, "")
+	transport, err := newOutboundTransport()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := (&http.Client{Transport: transport}).Get(server.URL); err == nil {
+		t.Error("expected the test server certificate to be untrusted without a CA bundle")
+	}
+
+	t.Setenv(envCABundle, bundle)
+	transport, err = newOutboundTransport()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the CA bundle to be trusted: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := os.WriteFile(bundle, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newOutboundTransport(); err == nil {
+		t.Error("expected an error for a CA bundle without certificates")
+	}
+}
+
+func TestClientPool(t *testing.T) {
+	pool := newClientPool[int]()
+	created := 0
+	newClient := func() (int, error) {
+		created++
+		return created, nil
+	}
+	for i := 0; i < clientPoolMaxClients+1; i++ {
+		if _, err := pool.get(fmt.Sprint(i), newClient); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(pool.clients) != clientPoolMaxClients {
+		t.Fatalf("expected the pool to hold %d clients, got %d", clientPoolMaxClients, len(pool.clients))
+	}
+	if _, ok := pool.clients["0"]; ok {
+		t.Error("expected the least recently used client to be evicted")
+	}
+	if client, _ := pool.get("1", newClient); client != 2 || created != clientPoolMaxClients+1 {
+		t.Errorf("expected the pooled client to be reused, got %d after %d creations", client, created)
+	}
+
+	pool.clients["1"].lastUsed = time.Now().Add(-2 * clientPoolIdleTTL)
+	if client, _ := pool.get("1", newClient); client != clientPoolMaxClients+2 {
+		t.Errorf("expected an idle client to be recreated, got %d", client)
+	}
+	if _, err := pool.get("failing", func() (int, error) { return 0, errors.New("boom") }); err == nil {
+		t.Error("expected the creation error")
+	}
+	if _, ok := pool.clients["failing"]; ok {
+		t.Error("expected a failed client not to be pooled")
+	}
+}
+
+func TestGenAIClientPoolKey(t *testing.T) {
+	if _, err := getGenAIClient(context.Background(), "secret-api-key"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	genaiClientPool.Lock()
+	defer genaiClientPool.Unlock()
+	if _, ok := genaiClientPool.clients["secret-api-key"]; ok {
+		t.Error("expected the pool not to be keyed by the raw API key")
+	}
+	if _, ok := genaiClientPool.clients[hashSHA256([]byte("secret-api-key"))]; !ok {
+		t.Error("expected the pool to be keyed by the API key hash")
+	}
+}
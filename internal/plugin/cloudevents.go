@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// cloudEventType is the CloudEvents type of analysis decisions
+const cloudEventType = "io.argoproj.metricai.decision"
+
+// envKnativeSink is the sink URL injected by Knative SinkBindings and ContainerSources
+const envKnativeSink = "K_SINK"
+
+// cloudEventsConfig publishes every decision as a CloudEvent over HTTP
+type cloudEventsConfig struct {
+	// HTTP sink receiving the events, e.g. a Knative Broker or KafkaSink (default: the K_SINK environment variable)
+	SinkURL string `json:"sinkUrl,omitempty"`
+	// Send events in structured mode (application/cloudevents+json) instead of binary mode
+	Structured bool `json:"structured,omitempty"`
+}
+
+// cloudEvent is a CloudEvents 1.0 event in the JSON event format
+type cloudEvent struct {
+	SpecVersion     string         `json:"specversion"`
+	Type            string         `json:"type"`
+	Source          string         `json:"source"`
+	ID              string         `json:"id"`
+	Time            string         `json:"time,omitempty"`
+	Subject         string         `json:"subject,omitempty"`
+	DataContentType string         `json:"datacontenttype,omitempty"`
+	Data            decisionRecord `json:"data"`
+}
+
+// newCloudEvent wraps the decision in a CloudEvent sourced from its AnalysisRun
+func newCloudEvent(rec decisionRecord) cloudEvent {
+	id := rec.AnalysisRunUID
+	if id == "" {
+		id = rec.Namespace + "." + rec.AnalysisRun
+	}
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		Type:            cloudEventType,
+		Source:          fmt.Sprintf("/apis/argoproj.io/v1alpha1/namespaces/%s/analysisruns/%s", rec.Namespace, rec.AnalysisRun),
+		ID:              fmt.Sprintf("%s.%s.%d", id, rec.Metric, rec.Time.UnixNano()),
+		Time:            rec.Time.Format(time.RFC3339Nano),
+		Subject:         rec.Rollout,
+		DataContentType: "application/json",
+		Data:            rec,
+	}
+}
+
+// publishCloudEvent sends the decision as a CloudEvent to the HTTP sink
+func publishCloudEvent(ctx context.Context, cfg *cloudEventsConfig, rec decisionRecord) error {
+	sinkURL := cfg.SinkURL
+	if sinkURL == "" {
+		sinkURL = os.Getenv(envKnativeSink)
+	}
+	if sinkURL == "" {
+		return fmt.Errorf("cloudEvents requires sinkUrl or the %s environment variable", envKnativeSink)
+	}
+	event := newCloudEvent(rec)
+	if cfg.Structured {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal CloudEvent: %v", err)
+		}
+		return postJSONBody(ctx, sinkURL, map[string]string{"Content-Type": "application/cloudevents+json"}, body)
+	}
+
+	// Binary mode carries the attributes in headers and the decision as body
+	headers := map[string]string{
+		"ce-specversion": event.SpecVersion,
+		"ce-type":        event.Type,
+		"ce-source":      event.Source,
+		"ce-id":          event.ID,
+		"ce-time":        event.Time,
+	}
+	if event.Subject != "" {
+		headers["ce-subject"] = event.Subject
+	}
+	return postJSON(ctx, sinkURL, headers, event.Data)
+}
@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestPublishCloudEvent(t *testing.T) {
+	var gotHeaders http.Header
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	rec := decisionRecord{
+		Time:           time.Unix(1700000000, 0).UTC(),
+		AnalysisRun:    "checkout-abc-1",
+		AnalysisRunUID: "uid-1",
+		Namespace:      "shop",
+		Rollout:        "checkout",
+		Metric:         "ai",
+		Phase:          v1alpha1.AnalysisPhaseFailed,
+	}
+	if err := publishCloudEvent(context.Background(), &cloudEventsConfig{SinkURL: server.URL}, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotHeaders.Get("ce-type") != cloudEventType || gotHeaders.Get("ce-id") != "uid-1.ai.1700000000000000000" || gotHeaders.Get("ce-subject") != "checkout" {
+		t.Errorf("unexpected binary mode headers %v", gotHeaders)
+	}
+	if gotHeaders.Get("ce-source") != "/apis/argoproj.io/v1alpha1/namespaces/shop/analysisruns/checkout-abc-1" {
+		t.Errorf("unexpected source %s", gotHeaders.Get("ce-source"))
+	}
+	var data decisionRecord
+	if err := json.Unmarshal(gotBody, &data); err != nil || data.AnalysisRun != rec.AnalysisRun {
+		t.Errorf("unexpected binary mode body %s: %v", gotBody, err)
+	}
+
+	t.Setenv(envKnativeSink, server.URL)
+	if err := publishCloudEvent(context.Background(), &cloudEventsConfig{Structured: true}, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var event cloudEvent
+	if err := json.Unmarshal(gotBody, &event); err != nil || event.SpecVersion != "1.0" || event.Data.Metric != "ai" {
+		t.Errorf("unexpected structured mode body %s: %v", gotBody, err)
+	}
+	if gotHeaders.Get("Content-Type") != "application/cloudevents+json" {
+		t.Errorf("unexpected content type %s", gotHeaders.Get("Content-Type"))
+	}
+}
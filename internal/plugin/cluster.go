@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// clusterSecretRef selects a Secret in the AnalysisRun namespace with the credentials of the cluster
+// running the stable and canary pods, for controllers analyzing rollouts of other clusters
+type clusterSecretRef struct {
+	Name string `json:"name"`
+	// Key with a kubeconfig. When empty, the secret is read as an Argo CD cluster secret with server
+	// and config keys.
+	Key string `json:"key,omitempty"`
+	// namespace is set to the AnalysisRun namespace, it cannot be configured
+	namespace string
+}
+
+// argoCDClusterConfig is the config key of an Argo CD cluster secret
+type argoCDClusterConfig struct {
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	BearerToken     string `json:"bearerToken,omitempty"`
+	TLSClientConfig struct {
+		Insecure   bool   `json:"insecure,omitempty"`
+		ServerName string `json:"serverName,omitempty"`
+		// PEM encoded, base64 in the JSON
+		CAData   []byte `json:"caData,omitempty"`
+		CertData []byte `json:"certData,omitempty"`
+		KeyData  []byte `json:"keyData,omitempty"`
+	} `json:"tlsClientConfig,omitempty"`
+}
+
+// clusterClients caches the clients of remote clusters by secret, until the secret changes
+var clusterClients = struct {
+	sync.Mutex
+	entries map[string]clusterClientEntry
+}{entries: make(map[string]clusterClientEntry)}
+
+type clusterClientEntry struct {
+	resourceVersion string
+	client          *kubernetes.Clientset
+}
+
+// newClusterRESTConfig builds the client configuration of a remote cluster from the data of its secret
+func newClusterRESTConfig(data map[string][]byte, key string) (*rest.Config, error) {
+	if key != "" {
+		kubeconfig := data[key]
+		if len(kubeconfig) == 0 {
+			return nil, fmt.Errorf("key %s not found", key)
+		}
+		restCfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig: %v", err)
+		}
+		return restCfg, nil
+	}
+
+	server := strings.TrimSpace(string(data["server"]))
+	if server == "" {
+		return nil, fmt.Errorf("no key set and no server key of an Argo CD cluster secret")
+	}
+	var clusterCfg argoCDClusterConfig
+	if err := json.Unmarshal(data["config"], &clusterCfg); err != nil {
+		return nil, fmt.Errorf("invalid config of Argo CD cluster secret: %v", err)
+	}
+	return &rest.Config{
+		Host:        server,
+		Username:    clusterCfg.Username,
+		Password:    clusterCfg.Password,
+		BearerToken: clusterCfg.BearerToken,
+		TLSClientConfig: rest.TLSClientConfig{
+			Insecure:   clusterCfg.TLSClientConfig.Insecure,
+			ServerName: clusterCfg.TLSClientConfig.ServerName,
+			CAData:     clusterCfg.TLSClientConfig.CAData,
+			CertData:   clusterCfg.TLSClientConfig.CertData,
+			KeyData:    clusterCfg.TLSClientConfig.KeyData,
+		},
+	}, nil
+}
+
+// clusterClient returns a client of the cluster of a cluster secret
+func clusterClient(ctx context.Context, ref *clusterSecretRef) (*kubernetes.Clientset, error) {
+	if ref.Name == "" {
+		return nil, fmt.Errorf("clusterSecretRef requires name")
+	}
+	if ref.namespace == "" {
+		return nil, fmt.Errorf("secret %s has no namespace", ref.Name)
+	}
+	client, err := acquireKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("no Kubernetes client to read cluster secret %s/%s", ref.namespace, ref.Name)
+	}
+	secret, err := client.CoreV1().Secrets(ref.namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("cluster secret '%s' not found in namespace '%s'", ref.Name, ref.namespace)
+		}
+		return nil, fmt.Errorf("failed to get cluster secret: %v", err)
+	}
+
+	cacheKey := ref.namespace + "/" + ref.Name + "/" + ref.Key
+	clusterClients.Lock()
+	defer clusterClients.Unlock()
+	if entry, ok := clusterClients.entries[cacheKey]; ok && entry.resourceVersion == secret.ResourceVersion {
+		return entry.client, nil
+	}
+	restCfg, err := newClusterRESTConfig(secret.Data, ref.Key)
+	if err != nil {
+		return nil, fmt.Errorf("cluster secret %s/%s: %v", ref.namespace, ref.Name, err)
+	}
+	remote, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client of cluster %s: %v", restCfg.Host, err)
+	}
+	clusterClients.entries[cacheKey] = clusterClientEntry{resourceVersion: secret.ResourceVersion, client: remote}
+	return remote, nil
+}
@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestNewClusterRESTConfig(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: spoke
+  cluster:
+    server: https://spoke.example.com:6443
+contexts:
+- name: spoke
+  context:
+    cluster: spoke
+    user: metric-ai
+current-context: spoke
+users:
+- name: metric-ai
+  user:
+    token: kubeconfig-token
+`
+	restCfg, err := newClusterRESTConfig(map[string][]byte{"kubeconfig": []byte(kubeconfig)}, "kubeconfig")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restCfg.Host != "https://spoke.example.com:6443" || restCfg.BearerToken != "kubeconfig-token" {
+		t.Errorf("unexpected kubeconfig client configuration %+v", restCfg)
+	}
+	if _, err := newClusterRESTConfig(map[string][]byte{"kubeconfig": []byte(kubeconfig)}, "other"); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+
+	// Argo CD cluster secret
+	restCfg, err = newClusterRESTConfig(map[string][]byte{
+		"name":   []byte("spoke"),
+		"server": []byte("https://spoke.example.com"),
+		"config": []byte(`{"bearerToken":"argocd-token","tlsClientConfig":{"insecure":false,"caData":"` + base64.StdEncoding.EncodeToString([]byte("PEM")) + `"}}`),
+	}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restCfg.Host != "https://spoke.example.com" || restCfg.BearerToken != "argocd-token" || string(restCfg.TLSClientConfig.CAData) != "PEM" {
+		t.Errorf("unexpected Argo CD client configuration %+v", restCfg)
+	}
+	if _, err := newClusterRESTConfig(map[string][]byte{"config": []byte(`{}`)}, ""); err == nil {
+		t.Error("expected an error for a secret without server")
+	}
+}
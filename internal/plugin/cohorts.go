@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cohort is a group of pods compared against the baseline, e.g. one template of an Experiment
+type cohort struct {
+	// Cohort name shown to the model
+	Name string `json:"name"`
+	// Label selector of the cohort pods
+	Selector string `json:"selector"`
+	// Whether this cohort is the baseline the others are compared against (default: the first cohort)
+	Baseline bool `json:"baseline,omitempty"`
+	// Container to read logs from, overriding the metric container
+	Container string `json:"container,omitempty"`
+	// Maximum bytes of logs read per pod, overriding the metric maxLogBytes
+	MaxLogBytes int64 `json:"maxLogBytes,omitempty"`
+}
+
+// logOptions applies the cohort container and limit overrides to the metric log options
+func (c cohort) logOptions(defaults podLogOptions) podLogOptions {
+	opts := defaults
+	if c.Container != "" {
+		opts.Container = c.Container
+	}
+	if c.MaxLogBytes > 0 {
+		opts.LimitBytes = c.MaxLogBytes
+	}
+	return opts
+}
+
+// splitCohorts validates the cohorts and returns the baseline and the cohorts compared against it
+func splitCohorts(cohorts []cohort) (cohort, []cohort, error) {
+	if len(cohorts) < 2 {
+		return cohort{}, nil, fmt.Errorf("cohorts requires at least two entries, got %d", len(cohorts))
+	}
+	baselineIdx := -1
+	seen := make(map[string]bool)
+	for i, c := range cohorts {
+		if c.Name == "" || c.Selector == "" {
+			return cohort{}, nil, fmt.Errorf("cohort %d requires a name and a selector", i)
+		}
+		if seen[c.Name] {
+			return cohort{}, nil, fmt.Errorf("duplicate cohort name %q", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Baseline {
+			if baselineIdx >= 0 {
+				return cohort{}, nil, fmt.Errorf("only one cohort can be the baseline, got %q and %q", cohorts[baselineIdx].Name, c.Name)
+			}
+			baselineIdx = i
+		}
+	}
+	if baselineIdx < 0 {
+		baselineIdx = 0
+	}
+
+	var candidates []cohort
+	for i, c := range cohorts {
+		if i != baselineIdx {
+			candidates = append(candidates, c)
+		}
+	}
+	return cohorts[baselineIdx], candidates, nil
+}
+
+// fetchCohortLogs fetches the logs of each cohort and combines them in labeled sections,
+// returning the log samples taken. Cohorts without pods are reported in their section;
+// a NotFound error is only returned when none of the cohorts has pods.
+func fetchCohortLogs(ctx context.Context, fetchLogs podLogsFetcher, client *kubernetes.Clientset, namespace string,
+	cohorts []cohort, defaults podLogOptions) (string, []podLogSample, error) {
+	var b strings.Builder
+	var samples []podLogSample
+	var notFoundErr error
+	for _, c := range cohorts {
+		fmt.Fprintf(&b, "=== COHORT %s (%s) ===\n", c.Name, c.Selector)
+		logs, sample, err := fetchLogs(ctx, client, namespace, c.Selector, c.logOptions(defaults))
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return "", nil, fmt.Errorf("failed to fetch logs of cohort %s: %w", c.Name, err)
+			}
+			notFoundErr = err
+			b.WriteString("(no pods found)\n\n")
+			continue
+		}
+		sample.Role = c.Name
+		samples = append(samples, sample)
+		b.WriteString(logs)
+		b.WriteString("\n\n")
+	}
+	if len(samples) == 0 {
+		return "", nil, notFoundErr
+	}
+	return b.String(), samples, nil
+}
+
+// cohortPromptNote explains the cohort layout of the logs to the model
+func cohortPromptNote(baseline cohort, candidates []cohort) string {
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.Name
+	}
+	return fmt.Sprintf("\nThe stable logs are from the baseline cohort %q. The canary logs contain one section per cohort (%s); "+
+		"compare each cohort against the baseline, name the cohorts with issues in your analysis and only promote if all cohorts are healthy.",
+		baseline.Name, strings.Join(names, ", "))
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestCohorts(t *testing.T) {
+	if _, _, err := splitCohorts([]cohort{{Name: "baseline", Selector: "app=a"}}); err == nil {
+		t.Fatal("expected an error for a single cohort")
+	}
+	baseline, candidates, err := splitCohorts([]cohort{
+		{Name: "exp-1", Selector: "app=exp-1"},
+		{Name: "baseline", Selector: "app=baseline", Baseline: true},
+		{Name: "exp-2", Selector: "app=exp-2"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if baseline.Name != "baseline" || len(candidates) != 2 || candidates[0].Name != "exp-1" {
+		t.Fatalf("unexpected split: baseline %v, candidates %v", baseline, candidates)
+	}
+
+	fetch := func(_ context.Context, _ *kubernetes.Clientset, _ string, selector string, _ podLogOptions) (string, podLogSample, error) {
+		if selector == "app=exp-2" {
+			return "", podLogSample{}, errors.NewNotFound(schema.GroupResource{Resource: "pods"}, selector)
+		}
+		return "logs of " + selector, podLogSample{Pod: selector}, nil
+	}
+	logs, samples, err := fetchCohortLogs(context.Background(), fetch, nil, "default", candidates, podLogOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Role != "exp-1" || samples[0].Pod != "app=exp-1" {
+		t.Errorf("expected a log sample for the cohort with pods, got %+v", samples)
+	}
+	for _, want := range []string{"=== COHORT exp-1 (app=exp-1) ===", "logs of app=exp-1", "=== COHORT exp-2 (app=exp-2) ===", "(no pods found)"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("expected cohort logs to contain %q, got %q", want, logs)
+		}
+	}
+	if _, _, err := fetchCohortLogs(context.Background(), fetch, nil, "default", candidates[1:], podLogOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected NotFound when no cohort has pods, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/google/go-github/v60/github"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultCommitStatusContext is the context of the commit status with the AI verdict
+const defaultCommitStatusContext = "ai-canary-analysis"
+
+// commitSHAPattern matches full and abbreviated git commit SHAs
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// commitFromImage extracts the source commit from an image tag such as app:3f2a9c1, app:sha-3f2a9c1
+// or app:v1.2.0-3f2a9c1. Abbreviated SHAs without letters are ignored as they are likely build numbers.
+func commitFromImage(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	parts := strings.FieldsFunc(strings.ToLower(image[i+1:]), func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+	for j := len(parts) - 1; j >= 0; j-- {
+		sha := parts[j]
+		if commitSHAPattern.MatchString(sha) && (len(sha) == 40 || strings.ContainsAny(sha, "abcdef")) {
+			return sha
+		}
+	}
+	return ""
+}
+
+// resolveCanaryCommit reads the source commit of the sampled canary pod from the given annotation
+// or, if not set, from the tag of the sampled container image
+var resolveCanaryCommit = func(ctx context.Context, client *kubernetes.Clientset, namespace string, samples []podLogSample, annotation string) (string, error) {
+	var sample podLogSample
+	for _, s := range samples {
+		if s.Role != "stable" && s.Pod != "" {
+			sample = s
+			break
+		}
+	}
+	if sample.Pod == "" {
+		return "", fmt.Errorf("no canary pod was sampled")
+	}
+	if client == nil {
+		return "", fmt.Errorf("no Kubernetes client to read canary pod %s", sample.Pod)
+	}
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, sample.Pod, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get canary pod %s: %v", sample.Pod, err)
+	}
+
+	if annotation != "" {
+		if sha := strings.TrimSpace(pod.Annotations[annotation]); sha != "" {
+			return sha, nil
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		if sample.Container != "" && c.Name != sample.Container {
+			continue
+		}
+		if sha := commitFromImage(c.Image); sha != "" {
+			return sha, nil
+		}
+		break
+	}
+	return "", fmt.Errorf("no commit found in annotation %q or image of canary pod %s", annotation, sample.Pod)
+}
+
+// fullCommitSHA expands an abbreviated commit SHA, as statuses and check runs can only be set on full SHAs
+func fullCommitSHA(ctx context.Context, client *github.Client, owner, repo, sha string) (string, error) {
+	if len(sha) == 40 {
+		return sha, nil
+	}
+	full, _, err := client.Repositories.GetCommitSHA1(ctx, owner, repo, sha, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve commit %s: %w", sha, err)
+	}
+	return full, nil
+}
+
+// commitStatusState maps a measurement phase to a commit status state
+func commitStatusState(phase v1alpha1.AnalysisPhase) string {
+	switch phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		return "success"
+	case v1alpha1.AnalysisPhaseFailed:
+		return "failure"
+	default:
+		return "error"
+	}
+}
+
+// publishCommitStatus sets a commit status with the AI verdict on the canary commit,
+// so branch protection rules can require a passing canary analysis
+func publishCommitStatus(ctx context.Context, cfg aiConfig, phase v1alpha1.AnalysisPhase, result AIAnalysisResult) error {
+	owner, repo, err := extractOwnerRepoFromURL(cfg.GitHubURL)
+	if err != nil {
+		return fmt.Errorf("failed to extract owner/repo from URL: %v", err)
+	}
+	if cfg.CommitSHA == "" {
+		return fmt.Errorf("setting a commit status requires commitSha or a canary commit in the pod annotation or image tag")
+	}
+	client, err := newGitHubClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	sha, err := fullCommitSHA(ctx, client, owner, repo, cfg.CommitSHA)
+	if err != nil {
+		return err
+	}
+
+	statusContext := cfg.CommitStatusContext
+	if statusContext == "" {
+		statusContext = defaultCommitStatusContext
+	}
+	description := fmt.Sprintf("Canary promotion not recommended (confidence %d%%)", result.Confidence)
+	if phase == v1alpha1.AnalysisPhaseSuccessful {
+		description = fmt.Sprintf("Canary promotion recommended (confidence %d%%)", result.Confidence)
+	}
+	state := commitStatusState(phase)
+
+	if _, _, err := client.Repositories.CreateStatus(ctx, owner, repo, sha, &github.RepoStatus{
+		State:       &state,
+		Context:     &statusContext,
+		Description: &description,
+	}); err != nil {
+		return fmt.Errorf("failed to create commit status: %w", err)
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"owner":     owner,
+		"repo":      repo,
+		"commitSha": sha,
+		"state":     state,
+	}).Info("Published AI verdict as commit status")
+	return nil
+}
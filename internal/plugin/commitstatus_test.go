@@ -0,0 +1,24 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommitFromImage(t *testing.T) {
+	for image, want := range map[string]string{
+		"ghcr.io/acme/checkout:3f2a9c1":                    "3f2a9c1",
+		"ghcr.io/acme/checkout:sha-3f2a9c1":                "3f2a9c1",
+		"acme/checkout:v1.2.0-3F2A9C1":                     "3f2a9c1",
+		"registry:5000/checkout:main.3f2a9c1e":             "3f2a9c1e",
+		"ghcr.io/acme/checkout:" + strings.Repeat("1", 40): strings.Repeat("1", 40),
+		"ghcr.io/acme/checkout:1.2.3":                      "",
+		"ghcr.io/acme/checkout:build-1234567":              "",
+		"registry:5000/checkout":                           "",
+		"checkout@sha256:" + strings.Repeat("a", 64):       "",
+	} {
+		if got := commitFromImage(image); got != want {
+			t.Errorf("expected %q for %s, got %q", want, image, got)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Environment variables locating the plugin configuration
+const (
+	// envSecretsDir overrides the directory the plugin secret is mounted at
+	envSecretsDir = "METRIC_AI_SECRETS_DIR"
+	// envSecretName names a Secret read through the Kubernetes API, for keys not mounted or in the environment
+	envSecretName = "METRIC_AI_SECRET_NAME"
+	// envSecretNamespace is the namespace of that Secret (default: the controller namespace)
+	envSecretNamespace = "METRIC_AI_SECRET_NAMESPACE"
+)
+
+// configReloadInterval is how often the configuration is re-read, about the kubelet sync period of
+// mounted secrets
+const configReloadInterval = time.Minute
+
+// defaultSecretsDir is where the plugin secret is mounted by the kustomization in config/argo-rollouts
+const defaultSecretsDir = "/etc/secrets"
+
+// serviceAccountNamespaceFile holds the namespace of the controller pod
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// configKeys are the keys of the plugin configuration. None is required, as metrics may use their own
+// credentials: the keys are read when a metric uses them.
+var configKeys = []string{
+	"google_api_key", "google_cloud_project", "github_token",
+	"gitlab_token", "bitbucket_token", "bitbucket_app_password", "gitea_token",
+	"slack_token", "pagerduty_routing_key", "smtp_password", "discord_webhook_url", "opsgenie_api_key",
+	"storage_access_key_id", "storage_secret_access_key", "grafana_token", "agent_token",
+}
+
+// configValues holds the loaded configuration
+var configValues = struct {
+	sync.RWMutex
+	values   map[string]string
+	loadedAt time.Time
+}{values: make(map[string]string)}
+
+// configSource reads the plugin configuration keys it has
+type configSource struct {
+	name string
+	read func(ctx context.Context) (map[string]string, error)
+}
+
+// configEnvVar returns the environment variable of a configuration key, e.g. GOOGLE_API_KEY
+func configEnvVar(key string) string {
+	return strings.ToUpper(key)
+}
+
+// secretsDir returns the directory of the mounted plugin secret
+func secretsDir() string {
+	if dir := os.Getenv(envSecretsDir); dir != "" {
+		return dir
+	}
+	return defaultSecretsDir
+}
+
+// configSources returns the configuration sources in order of precedence: the mounted secret
+// files, the environment, the Secret named by METRIC_AI_SECRET_NAME, then the AWS Secrets Manager
+// secret of METRIC_AI_AWS_SECRET_ARN and the GCP Secret Manager secret of METRIC_AI_GCP_SECRET
+func configSources() []configSource {
+	sources := []configSource{
+		{name: secretsDir(), read: readConfigFiles},
+		{name: "environment", read: readConfigEnv},
+	}
+	if name := os.Getenv(envSecretName); name != "" {
+		sources = append(sources, configSource{
+			name: "secret " + name,
+			read: func(ctx context.Context) (map[string]string, error) {
+				return readConfigSecret(ctx, name)
+			},
+		})
+	}
+	if arn := os.Getenv(envAWSSecretARN); arn != "" {
+		sources = append(sources, configSource{
+			name: arn,
+			read: func(ctx context.Context) (map[string]string, error) {
+				return getAWSSecret(ctx, arn)
+			},
+		})
+	}
+	if name := os.Getenv(envGCPSecret); name != "" {
+		sources = append(sources, configSource{
+			name: name,
+			read: func(ctx context.Context) (map[string]string, error) {
+				return getGCPSecret(ctx, name)
+			},
+		})
+	}
+	return sources
+}
+
+// readConfigFiles reads the configuration keys mounted as files
+func readConfigFiles(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, key := range configKeys {
+		data, err := os.ReadFile(filepath.Join(secretsDir(), key))
+		if err != nil {
+			continue
+		}
+		values[key] = strings.TrimSpace(string(data))
+	}
+	return values, nil
+}
+
+// readConfigEnv reads the configuration keys from the environment
+func readConfigEnv(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, key := range configKeys {
+		values[key] = strings.TrimSpace(os.Getenv(configEnvVar(key)))
+	}
+	return values, nil
+}
+
+// controllerNamespace returns the namespace of the controller pod
+func controllerNamespace() (string, error) {
+	data, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return "", fmt.Errorf("the controller namespace is unknown: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readConfigSecret reads the configuration keys of a Secret through the Kubernetes API
+func readConfigSecret(ctx context.Context, name string) (map[string]string, error) {
+	namespace := os.Getenv(envSecretNamespace)
+	if namespace == "" {
+		var err error
+		if namespace, err = controllerNamespace(); err != nil {
+			return nil, fmt.Errorf("%s is not set: %v", envSecretNamespace, err)
+		}
+	}
+	client, err := acquireKubeClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %v", namespace, name, err)
+	}
+	values := make(map[string]string)
+	for _, key := range configKeys {
+		values[key] = strings.TrimSpace(string(secret.Data[key]))
+	}
+	return values, nil
+}
+
+// readConfig reads the plugin configuration, taking every key from the first source that has it
+func readConfig(ctx context.Context) map[string]string {
+	values := make(map[string]string)
+	for _, source := range configSources() {
+		read, err := source.read(ctx)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).WithField("source", source.name).Warn("Failed to read configuration source")
+			continue
+		}
+		for _, key := range configKeys {
+			if _, ok := values[key]; !ok && read[key] != "" {
+				values[key] = read[key]
+				log.WithContext(ctx).WithFields(log.Fields{"key": key, "source": source.name}).Debug("Loaded configuration key")
+			}
+		}
+	}
+	return values
+}
+
+// storeConfig replaces the loaded configuration
+func storeConfig(values map[string]string) {
+	configValues.Lock()
+	defer configValues.Unlock()
+	configValues.values = values
+	configValues.loadedAt = time.Now()
+	googleAPIKey = values["google_api_key"]
+	googleCloudProject = values["google_cloud_project"]
+	githubToken = values["github_token"]
+}
+
+// loadConfig reads the plugin configuration and the cluster-wide defaults at startup
+func loadConfig(ctx context.Context) error {
+	values := readConfig(ctx)
+	storeConfig(values)
+	log.WithContext(ctx).WithField("keys", len(values)).Info("Successfully loaded configuration")
+	loadDefaults(ctx)
+	return nil
+}
+
+// reloadConfig re-reads the configuration and the cluster-wide defaults when they are older than
+// configReloadInterval, so rotated keys and tokens are used without restarting the controller. A
+// configuration that lost the Google API key, e.g. while a secret is being replaced, is ignored.
+func reloadConfig(ctx context.Context) {
+	configValues.RLock()
+	loadedAt, previous := configValues.loadedAt, configValues.values
+	configValues.RUnlock()
+	if loadedAt.IsZero() || time.Since(loadedAt) < configReloadInterval {
+		return
+	}
+	loadDefaults(ctx)
+
+	values := readConfig(ctx)
+	if values["google_api_key"] == "" && previous["google_api_key"] != "" {
+		log.WithContext(ctx).Warn("Reloaded configuration has no google_api_key, keeping the previous configuration")
+		configValues.Lock()
+		configValues.loadedAt = time.Now()
+		configValues.Unlock()
+		return
+	}
+	for _, key := range configKeys {
+		if values[key] != previous[key] {
+			log.WithContext(ctx).WithField("key", key).Info("Configuration key changed, using the new value")
+		}
+	}
+	storeConfig(values)
+}
+
+// getSecretValue returns a plugin configuration value
+func getSecretValue(key string) (string, error) {
+	if !slices.Contains(configKeys, key) {
+		return "", fmt.Errorf("unknown secret key: %s", key)
+	}
+	configValues.RLock()
+	var value string
+	switch key {
+	case "google_api_key":
+		value = googleAPIKey
+	case "github_token":
+		value = githubToken
+	default:
+		value = configValues.values[key]
+	}
+	configValues.RUnlock()
+	if value == "" {
+		return "", fmt.Errorf("%s is not configured in %s or the %s environment variable", key, secretsDir(), configEnvVar(key))
+	}
+	return value, nil
+}
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	oldAPIKey, oldProject, oldToken := googleAPIKey, googleCloudProject, githubToken
+	t.Cleanup(func() { googleAPIKey, googleCloudProject, githubToken = oldAPIKey, oldProject, oldToken })
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "google_api_key"), []byte("file-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envSecretsDir, dir)
+	t.Setenv(envSecretName, "")
+	t.Setenv("GOOGLE_API_KEY", "env-key")
+	t.Setenv("GITLAB_TOKEN", "env-gitlab")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	if err := loadConfig(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if key, _ := getSecretValue("google_api_key"); key != "file-key" {
+		t.Errorf("expected the mounted file to take precedence, got %q", key)
+	}
+	if token, _ := getSecretValue("gitlab_token"); token != "env-gitlab" {
+		t.Errorf("expected the environment to be used without a file, got %q", token)
+	}
+	if _, err := getSecretValue("github_token"); err == nil {
+		t.Error("expected an error for a key that is not configured")
+	}
+	if _, err := getSecretValue("unknown"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	oldAPIKey, oldProject, oldToken := googleAPIKey, googleCloudProject, githubToken
+	t.Cleanup(func() { googleAPIKey, googleCloudProject, githubToken = oldAPIKey, oldProject, oldToken })
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "google_api_key")
+	if err := os.WriteFile(keyFile, []byte("old-key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envSecretsDir, dir)
+	t.Setenv(envSecretName, "")
+	t.Setenv("GOOGLE_API_KEY", "")
+	if err := loadConfig(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expire := func() {
+		configValues.Lock()
+		configValues.loadedAt = time.Now().Add(-2 * configReloadInterval)
+		configValues.Unlock()
+	}
+
+	// Rotated keys are only read once the configuration expired
+	if err := os.WriteFile(keyFile, []byte("new-key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig(context.Background())
+	if key, _ := getSecretValue("google_api_key"); key != "old-key" {
+		t.Errorf("expected the configuration to be cached, got %q", key)
+	}
+	expire()
+	reloadConfig(context.Background())
+	if key, _ := getSecretValue("google_api_key"); key != "new-key" {
+		t.Errorf("expected the rotated key, got %q", key)
+	}
+
+	// A configuration without the required key is ignored
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	expire()
+	reloadConfig(context.Background())
+	if key, _ := getSecretValue("google_api_key"); key != "new-key" {
+		t.Errorf("expected the previous key to be kept, got %q", key)
+	}
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// correlationHeader carries the correlation ID of a measurement on outbound requests, and in the
+// metadata of gRPC calls of the Kubernetes Agent
+const correlationHeader = "X-Correlation-ID"
+
+// correlationLogField is the log field of the correlation ID
+const correlationLogField = "correlationId"
+
+type correlationIDKey struct{}
+
+type logFieldsKey struct{}
+
+// measurementCorrelationID returns the correlation ID of a measurement, derived from the AnalysisRun UID,
+// the metric and the start of the measurement so resumed measurements keep it
+func measurementCorrelationID(analysisRun *v1alpha1.AnalysisRun, metric string, startTime metav1.Time) string {
+	uid := string(analysisRun.UID)
+	if uid == "" {
+		// AnalysisRuns not read from the cluster, e.g. of dry runs
+		uid = analysisRun.Namespace + "." + analysisRun.Name
+	}
+	return fmt.Sprintf("%s.%s.%d", uid, metric, startTime.Unix())
+}
+
+// withCorrelationID returns a context carrying the correlation ID of a measurement
+func withCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// correlationID returns the correlation ID of the measurement of a context, if any
+func correlationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// correlationTransport sets the correlation ID of the request context on outbound requests, and
+// records a client span of the request when the measurement is traced
+type correlationTransport struct {
+	base http.RoundTripper
+}
+
+func (t *correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the request, both clone it
+	req, span := startHTTPSpan(req)
+	if id := correlationID(req.Context()); id != "" && req.Header.Get(correlationHeader) == "" {
+		if span == nil {
+			req = req.Clone(req.Context())
+		}
+		req.Header.Set(correlationHeader, id)
+	}
+	resp, err := t.base.RoundTrip(req)
+	finishHTTPSpan(span, resp, err)
+	return resp, err
+}
+
+// httpTransport returns the *http.Transport of a round tripper, unwrapping the correlation transport
+func httpTransport(rt http.RoundTripper) (*http.Transport, bool) {
+	if c, ok := rt.(*correlationTransport); ok {
+		rt = c.base
+	}
+	t, ok := rt.(*http.Transport)
+	return t, ok
+}
+
+// withLogFields returns a context whose log entries, logged with log.WithContext, carry the fields
+func withLogFields(ctx context.Context, fields log.Fields) context.Context {
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+// measurementLogFields returns the fields identifying a measurement in its log entries
+func measurementLogFields(analysisRun *v1alpha1.AnalysisRun, metric string, startTime metav1.Time, correlation string) log.Fields {
+	fields := log.Fields{
+		"analysisRun":       analysisRun.Name,
+		"analysisRunUid":    string(analysisRun.UID),
+		"namespace":         analysisRun.Namespace,
+		"metric":            metric,
+		"measurementIndex":  measurementIndex(analysisRun, metric, startTime),
+		correlationLogField: correlation,
+	}
+	if rollout := rolloutNameFromAnalysisRun(analysisRun); rollout != "" {
+		fields["rollout"] = rollout
+	}
+	return fields
+}
+
+// measurementIndex returns the position of the measurement started at startTime in the measurements
+// of the metric, which is after the recorded ones for measurements started by Run
+func measurementIndex(analysisRun *v1alpha1.AnalysisRun, metric string, startTime metav1.Time) int {
+	for _, mr := range analysisRun.Status.MetricResults {
+		if mr.Name != metric {
+			continue
+		}
+		for i, m := range mr.Measurements {
+			if m.StartedAt != nil && m.StartedAt.Equal(&startTime) {
+				return i
+			}
+		}
+		return len(mr.Measurements)
+	}
+	return 0
+}
+
+// correlationHook adds the correlation ID and the measurement fields of the context of log entries,
+// logged with log.WithContext, registered by InitPlugin
+type correlationHook struct{}
+
+func (correlationHook) Levels() []log.Level { return log.AllLevels }
+
+func (correlationHook) Fire(entry *log.Entry) error {
+	if id := correlationID(entry.Context); id != "" {
+		if _, ok := entry.Data[correlationLogField]; !ok {
+			entry.Data[correlationLogField] = id
+		}
+	}
+	if entry.Context == nil {
+		return nil
+	}
+	fields, _ := entry.Context.Value(logFieldsKey{}).(log.Fields)
+	for k, v := range fields {
+		// Fields of the entry take precedence
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCorrelationID(t *testing.T) {
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.UID = "3f2c"
+	start := metav1.NewTime(time.Unix(1700000000, 0))
+	id := measurementCorrelationID(analysisRun, "ai", start)
+	if id != "3f2c.ai.1700000000" {
+		t.Errorf("unexpected correlation ID %q", id)
+	}
+	ctx := withCorrelationID(context.Background(), id)
+
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(correlationHeader)
+	}))
+	defer server.Close()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := (&http.Client{Transport: &correlationTransport{base: http.DefaultTransport}}).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if header != id || req.Header.Get(correlationHeader) != "" {
+		t.Errorf("expected the correlation ID header on a copy of the request, got %q", header)
+	}
+
+	md, _ := metadata.FromOutgoingContext(grpcContext(ctx, ""))
+	if got := md.Get("x-correlation-id"); len(got) != 1 || got[0] != id {
+		t.Errorf("expected the correlation ID in the gRPC metadata, got %v", got)
+	}
+
+	entry := log.WithContext(ctx).WithField("metric", "ai")
+	if err := (correlationHook{}).Fire(entry); err != nil || entry.Data[correlationLogField] != id {
+		t.Errorf("expected the correlation ID in the log entry, got %v", entry.Data)
+	}
+}
+
+func TestMeasurementLogFields(t *testing.T) {
+	first := metav1.NewTime(time.Unix(1700000000, 0))
+	second := metav1.NewTime(time.Unix(1700000060, 0))
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name, analysisRun.Namespace, analysisRun.UID = "demo-run", "default", "3f2c"
+	analysisRun.OwnerReferences = []metav1.OwnerReference{{Kind: "Rollout", Name: "demo"}}
+	analysisRun.Status.MetricResults = []v1alpha1.MetricResult{
+		{Name: "ai", Measurements: []v1alpha1.Measurement{{StartedAt: &first}, {StartedAt: &second}}},
+	}
+
+	// A resumed measurement keeps its index, a new one follows the recorded measurements
+	if index := measurementIndex(analysisRun, "ai", second); index != 1 {
+		t.Errorf("expected index 1 of the resumed measurement, got %d", index)
+	}
+	if index := measurementIndex(analysisRun, "ai", metav1.Now()); index != 2 {
+		t.Errorf("expected index 2 of a new measurement, got %d", index)
+	}
+	if index := measurementIndex(analysisRun, "other", metav1.Now()); index != 0 {
+		t.Errorf("expected index 0 of the first measurement of a metric, got %d", index)
+	}
+
+	ctx := withLogFields(context.Background(), measurementLogFields(analysisRun, "ai", second, "3f2c.ai.1700000060"))
+	entry := log.WithContext(ctx).WithField("namespace", "pods")
+	if err := (correlationHook{}).Fire(entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := log.Fields{
+		"analysisRun":       "demo-run",
+		"analysisRunUid":    "3f2c",
+		"rollout":           "demo",
+		"metric":            "ai",
+		"measurementIndex":  1,
+		correlationLogField: "3f2c.ai.1700000060",
+		"namespace":         "pods",
+	}
+	for k, v := range want {
+		if entry.Data[k] != v {
+			t.Errorf("expected log field %s=%v, got %v", k, v, entry.Data[k])
+		}
+	}
+}
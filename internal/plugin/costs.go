@@ -0,0 +1,203 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventReasonBudgetExceeded is the reason of the event recorded when the monthly budget is crossed
+const eventReasonBudgetExceeded = "AIAnalysisBudgetExceeded"
+
+// budgetConfig tracks the estimated spend of the analyses and warns when a namespace crosses its monthly budget
+type budgetConfig struct {
+	// Monthly budget in USD of the estimated spend of the namespace, 0 only exports the spend
+	Monthly float64 `json:"monthly,omitempty"`
+	// Prices per model, overriding the built-in list prices, e.g. for negotiated prices or new models
+	Prices map[string]modelPrice `json:"prices,omitempty"`
+}
+
+// modelPrice is the price of a model in USD per million tokens
+type modelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// defaultModelPrices are the Gemini API list prices, matched by the longest model name prefix so
+// versioned and experimental models use the price of their family
+var defaultModelPrices = map[string]modelPrice{
+	"gemini-1.5-flash":      {Input: 0.075, Output: 0.30},
+	"gemini-1.5-pro":        {Input: 1.25, Output: 5},
+	"gemini-2.0-flash":      {Input: 0.10, Output: 0.40},
+	"gemini-2.0-flash-lite": {Input: 0.075, Output: 0.30},
+	"gemini-2.5-flash":      {Input: 0.30, Output: 2.50},
+	"gemini-2.5-flash-lite": {Input: 0.10, Output: 0.40},
+	"gemini-2.5-pro":        {Input: 1.25, Output: 10},
+}
+
+// validateBudget checks the budget configuration of a metric
+func validateBudget(cfg *budgetConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Monthly < 0 {
+		return fmt.Errorf("invalid budget monthly %g, must not be negative", cfg.Monthly)
+	}
+	for model, price := range cfg.Prices {
+		if price.Input < 0 || price.Output < 0 {
+			return fmt.Errorf("invalid budget price of model %s, must not be negative", model)
+		}
+	}
+	return nil
+}
+
+// lookupModelPrice returns the price of a model, preferring the configured prices
+func lookupModelPrice(model string, prices map[string]modelPrice) (modelPrice, bool) {
+	if price, ok := prices[model]; ok {
+		return price, true
+	}
+	best := ""
+	for prefix := range defaultModelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return defaultModelPrices[best], true
+}
+
+// estimateCost returns the estimated cost in USD of the tokens of an analysis
+func estimateCost(price modelPrice, promptTokens, outputTokens int) float64 {
+	return (float64(promptTokens)*price.Input + float64(outputTokens)*price.Output) / 1e6
+}
+
+// costKey identifies the spend of a rollout with a model
+type costKey struct {
+	namespace, rollout, model string
+}
+
+// Estimated spend metrics, see the Cost Budgets section of the README
+var (
+	estimatedCostTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_ai_estimated_cost_usd_total",
+		Help: "Estimated spend of the analyses in USD.",
+	}, []string{"namespace", "rollout", "model"})
+	monthlyCost = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_ai_monthly_cost_usd",
+		Help: "Estimated spend of the analyses of the namespace in USD this month.",
+	}, []string{"namespace"})
+	monthlyBudget = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "metric_ai_monthly_budget_usd",
+		Help: "Monthly budget of the namespace in USD.",
+	}, []string{"namespace"})
+)
+
+// costRegistry keeps the monthly spend of the namespaces the budgets are checked against. It lives in
+// the plugin process only: the monthly spend restarts at 0 with the controller and is not shared by
+// controller replicas.
+var costRegistry = struct {
+	sync.Mutex
+	// month is the current month (yyyy-mm, UTC) of monthly
+	month   string
+	monthly map[string]float64
+}{monthly: make(map[string]float64)}
+
+// addCost adds the cost of an analysis and returns the monthly spend of the namespace before and after it
+func addCost(key costKey, cost, budget float64, now time.Time) (float64, float64) {
+	costRegistry.Lock()
+	defer costRegistry.Unlock()
+	if month := now.UTC().Format("2006-01"); month != costRegistry.month {
+		costRegistry.month = month
+		costRegistry.monthly = make(map[string]float64)
+		monthlyCost.Reset()
+	}
+	estimatedCostTotal.WithLabelValues(key.namespace, key.rollout, key.model).Add(cost)
+	before := costRegistry.monthly[key.namespace]
+	costRegistry.monthly[key.namespace] = before + cost
+	monthlyCost.WithLabelValues(key.namespace).Set(before + cost)
+	if budget > 0 {
+		monthlyBudget.WithLabelValues(key.namespace).Set(budget)
+	}
+	return before, before + cost
+}
+
+// recordDecisionCost adds the estimated cost of a decision to the spend of its namespace and rollout,
+// recording a warning event on the AnalysisRun and its Rollout when it crosses the monthly budget
+func recordDecisionCost(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, cfg *budgetConfig, rec decisionRecord) error {
+	if rec.PromptTokens == 0 && rec.OutputTokens == 0 {
+		return nil
+	}
+	var prices map[string]modelPrice
+	var budget float64
+	if cfg != nil {
+		prices, budget = cfg.Prices, cfg.Monthly
+	}
+	price, ok := lookupModelPrice(rec.Model, prices)
+	if !ok {
+		log.WithContext(ctx).WithField("model", rec.Model).Debug("No price of the model, not estimating its cost")
+		return nil
+	}
+	cost := estimateCost(price, rec.PromptTokens, rec.OutputTokens)
+	before, after := addCost(costKey{rec.Namespace, rec.Rollout, rec.Model}, cost, budget, time.Now())
+	if budget <= 0 || before >= budget || after < budget {
+		return nil
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"monthlySpend": fmt.Sprintf("%.2f", after),
+		"budget":       fmt.Sprintf("%.2f", budget),
+	}).Warn("Estimated AI analysis spend crossed the monthly budget")
+	client, err := acquireKubeClient()
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf("no Kubernetes client to record events")
+	}
+	message := fmt.Sprintf("Estimated AI analysis spend of namespace %s this month is $%.2f, crossing the monthly budget of $%.2f", rec.Namespace, after, budget)
+	var errs []string
+	for _, event := range budgetEvents(analysisRun, message, time.Now()) {
+		if _, err := client.CoreV1().Events(event.Namespace).Create(ctx, &event, metav1.CreateOptions{}); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", event.InvolvedObject.Kind, event.InvolvedObject.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to record budget events: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// budgetEvents builds the warning events of a crossed budget on the AnalysisRun and its parent Rollout
+func budgetEvents(analysisRun *v1alpha1.AnalysisRun, message string, now time.Time) []corev1.Event {
+	timestamp := metav1.NewTime(now)
+	objects := eventObjects(analysisRun)
+	events := make([]corev1.Event, 0, len(objects))
+	for _, object := range objects {
+		events = append(events, corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s.%x", object.Name, now.UnixNano()),
+				Namespace: analysisRun.Namespace,
+			},
+			InvolvedObject: object,
+			Reason:         eventReasonBudgetExceeded,
+			Message:        truncate(message, eventMessageLength-3),
+			Type:           corev1.EventTypeWarning,
+			Source:         corev1.EventSource{Component: eventSourceComponent},
+			FirstTimestamp: timestamp,
+			LastTimestamp:  timestamp,
+			Count:          1,
+		})
+	}
+	return events
+}
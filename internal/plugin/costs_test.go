@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCostBudget(t *testing.T) {
+	if price, ok := lookupModelPrice("gemini-2.5-flash-lite-preview", nil); !ok || price != defaultModelPrices["gemini-2.5-flash-lite"] {
+		t.Errorf("expected the longest prefix price, got %+v", price)
+	}
+	if price, ok := lookupModelPrice("gemini-2.0-flash", map[string]modelPrice{"gemini-2.0-flash": {Input: 1, Output: 2}}); !ok || price.Input != 1 {
+		t.Errorf("expected the configured price, got %+v", price)
+	}
+	if _, ok := lookupModelPrice("custom-model", nil); ok {
+		t.Error("expected no price of an unknown model")
+	}
+	if cost := estimateCost(modelPrice{Input: 0.10, Output: 0.40}, 1000000, 500000); cost != 0.30 {
+		t.Errorf("unexpected cost %g", cost)
+	}
+	if err := validateBudget(&budgetConfig{Monthly: -1}); err == nil {
+		t.Error("expected a negative budget to be rejected")
+	}
+
+	// Without a budget the spend is only exported
+	rec := decisionRecord{Namespace: "test-costs", Rollout: "checkout", Model: "gemini-2.0-flash", PromptTokens: 1000000, OutputTokens: 500000}
+	if err := recordDecisionCost(context.Background(), &v1alpha1.AnalysisRun{}, nil, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	now := time.Now()
+	key := costKey{"test-costs", "checkout", "gemini-2.0-flash"}
+	if before, after := addCost(key, 0.5, 1, now); before != 0.30 || after != 0.80 {
+		t.Errorf("unexpected monthly spend %g to %g", before, after)
+	}
+	// The monthly spend restarts every month, the cumulative spend doesn't
+	if before, after := addCost(key, 0.5, 1, now.AddDate(0, 1, 0)); before != 0 || after != 0.5 {
+		t.Errorf("expected the monthly spend to restart, got %g to %g", before, after)
+	}
+
+	metrics := scrapeMetrics(t)
+	for _, want := range []string{
+		`metric_ai_estimated_cost_usd_total{model="gemini-2.0-flash",namespace="test-costs",rollout="checkout"} 1.3`,
+		`metric_ai_monthly_cost_usd{namespace="test-costs"} 0.5`,
+		`metric_ai_monthly_budget_usd{namespace="test-costs"} 1`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, metrics)
+		}
+	}
+
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "checkout-abc-1"
+	analysisRun.Namespace = "test-costs"
+	analysisRun.OwnerReferences = []metav1.OwnerReference{{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "checkout", UID: "uid-1"}}
+	events := budgetEvents(analysisRun, "over budget", time.Now())
+	if len(events) != 2 || events[1].InvolvedObject.Kind != "Rollout" {
+		t.Fatalf("expected events on the AnalysisRun and Rollout, got %+v", events)
+	}
+	if events[0].Reason != eventReasonBudgetExceeded || events[0].Type != "Warning" {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
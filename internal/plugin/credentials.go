@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+)
+
+// credentialsConfig selects the credentials of a metric from Secrets of the AnalysisRun namespace,
+// so teams sharing a cluster don't have to share the plugin secret
+type credentialsConfig struct {
+	// Gemini API key (default: google_api_key of the plugin secret)
+	GoogleAPIKeySecretRef *secretKeyRef `json:"googleApiKeySecretRef,omitempty"`
+	// GitHub token, takes precedence over githubTokenSecretRef (default: github_token of the plugin secret)
+	GitHubTokenSecretRef *secretKeyRef `json:"githubTokenSecretRef,omitempty"`
+	// Bearer token sent to the Kubernetes Agent in agent mode (default: agent_token of the plugin secret, if set)
+	AgentTokenSecretRef *secretKeyRef `json:"agentTokenSecretRef,omitempty"`
+	// TLS Secret with the client certificate presented to the Kubernetes Agent in agent mode (mTLS)
+	AgentTLSSecretRef *agentTLSSecretRef `json:"agentTlsSecretRef,omitempty"`
+	// AWS Secrets Manager secret with google_api_key, github_token and agent_token keys, read with the
+	// controller's service account role. Used for the keys without a secret reference.
+	AWSSecretARN string `json:"awsSecretArn,omitempty"`
+	// GCP Secret Manager secret (projects/<project>/secrets/<secret>) with the same keys, read with the
+	// Workload Identity of the controller. Used for the keys without a secret reference.
+	GCPSecret string `json:"gcpSecret,omitempty"`
+	// namespace is set to the AnalysisRun namespace, AWS and GCP secrets must be named after it
+	namespace string
+}
+
+// cloudSecret returns whether credentials are read from a cloud secret manager
+func (c *credentialsConfig) cloudSecret() bool {
+	return c != nil && (c.AWSSecretARN != "" || c.GCPSecret != "")
+}
+
+// credentialValue reads a credential of a metric: from its secret reference, else from its AWS or
+// GCP secret, else from the plugin secret
+func credentialValue(ctx context.Context, creds *credentialsConfig, ref *secretKeyRef, key string) (string, error) {
+	if ref != nil || !creds.cloudSecret() {
+		return readSecretRefOrDefault(ctx, ref, key)
+	}
+	if creds.AWSSecretARN != "" {
+		if err := checkAWSSecretNamespace(creds.AWSSecretARN, creds.namespace); err != nil {
+			return "", err
+		}
+		return readAWSSecretKey(ctx, creds.AWSSecretARN, key)
+	}
+	if err := checkGCPSecretNamespace(creds.GCPSecret, creds.namespace); err != nil {
+		return "", err
+	}
+	return readGCPSecretKey(ctx, creds.GCPSecret, key)
+}
+
+// googleAPIKeyFor returns the Gemini API key of a metric
+func googleAPIKeyFor(ctx context.Context, cfg aiConfig) (string, error) {
+	var ref *secretKeyRef
+	if cfg.Credentials != nil {
+		ref = cfg.Credentials.GoogleAPIKeySecretRef
+	}
+	apiKey, err := credentialValue(ctx, cfg.Credentials, ref, "google_api_key")
+	if err != nil {
+		return "", fmt.Errorf("failed to get Google API key from secret: %v", err)
+	}
+	return apiKey, nil
+}
+
+// githubTokenFor returns the GitHub token of a metric
+func githubTokenFor(ctx context.Context, cfg aiConfig) (string, error) {
+	token, err := credentialValue(ctx, cfg.Credentials, cfg.GitHubTokenSecretRef, "github_token")
+	if err != nil {
+		return "", fmt.Errorf("failed to get GitHub token from secret: %v", err)
+	}
+	return token, nil
+}
+
+// agentTokenFor returns the Kubernetes Agent token of a metric, or an empty token when the
+// agent does not require authentication
+func agentTokenFor(ctx context.Context, cfg aiConfig) (string, error) {
+	if cfg.Credentials == nil || (cfg.Credentials.AgentTokenSecretRef == nil && !cfg.Credentials.cloudSecret()) {
+		// The plugin agent token is optional
+		token, _ := getSecretValue("agent_token")
+		return token, nil
+	}
+	token, err := credentialValue(ctx, cfg.Credentials, cfg.Credentials.AgentTokenSecretRef, "agent_token")
+	if err != nil {
+		return "", fmt.Errorf("failed to get agent token from secret: %v", err)
+	}
+	return token, nil
+}
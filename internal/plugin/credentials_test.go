@@ -0,0 +1,22 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestCredentialsSecretRefs(t *testing.T) {
+	var cfg aiConfig
+	raw := `{"credentials":{"googleApiKeySecretRef":{"name":"team-a","key":"gemini"},"agentTokenSecretRef":{"name":"team-a","key":"agent"}}}`
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	refs := cfg.secretRefs()
+	if len(refs) != 2 || refs[0] != cfg.Credentials.GoogleAPIKeySecretRef || refs[1] != cfg.Credentials.AgentTokenSecretRef {
+		t.Errorf("expected the credentials references, got %+v", refs)
+	}
+	if _, err := googleAPIKeyFor(context.Background(), cfg); err == nil {
+		t.Error("expected an error for a reference without namespace")
+	}
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// decisionRecord describes the outcome of a single measurement and is shared by all decision sinks
+type decisionRecord struct {
+	Time           time.Time              `json:"time"`
+	AnalysisRun    string                 `json:"analysisRun"`
+	AnalysisRunUID string                 `json:"analysisRunUid,omitempty"`
+	Namespace      string                 `json:"namespace"`
+	Rollout        string                 `json:"rollout,omitempty"`
+	Revision       string                 `json:"revision,omitempty"`
+	Metric         string                 `json:"metric"`
+	Mode           string                 `json:"mode"`
+	Model          string                 `json:"model,omitempty"`
+	Phase          v1alpha1.AnalysisPhase `json:"phase"`
+	Value          string                 `json:"value"`
+	Promote        bool                   `json:"promote"`
+	Confidence     int                    `json:"confidence"`
+	Severity       string                 `json:"severity,omitempty"`
+	Analysis       string                 `json:"analysis"`
+	RootCause      string                 `json:"rootCause,omitempty"`
+	Remediation    string                 `json:"remediation,omitempty"`
+	PromptTokens   int                    `json:"promptTokens,omitempty"`
+	OutputTokens   int                    `json:"outputTokens,omitempty"`
+	// PromptHash, Temperature and Seed identify the prompt and sampling of the decision, to re-run it
+	PromptHash  string   `json:"promptHash,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	Seed        *int32   `json:"seed,omitempty"`
+	// Fields are the values of the metric outputFields
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// DurationSeconds is the time from the start of the measurement to the decision
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	// IssueURL links the issue created for a failed analysis
+	IssueURL string `json:"issueUrl,omitempty"`
+	// DashboardURL is the rendered dashboardUrl template
+	DashboardURL string `json:"dashboardUrl,omitempty"`
+	// TraceID and SpanID correlate the decision with the measurement trace when tracing is enabled
+	TraceID string `json:"traceId,omitempty"`
+	SpanID  string `json:"spanId,omitempty"`
+}
+
+// newDecisionRecord builds the decision record of a completed measurement
+func newDecisionRecord(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, mode, model string, result AIAnalysisResult, m v1alpha1.Measurement) decisionRecord {
+	return decisionRecord{
+		Time:           time.Now().UTC(),
+		AnalysisRun:    analysisRun.Name,
+		AnalysisRunUID: string(analysisRun.UID),
+		Namespace:      analysisRun.Namespace,
+		Rollout:        rolloutNameFromAnalysisRun(analysisRun),
+		Revision:       rolloutRevision(analysisRun),
+		Metric:         metric.Name,
+		Mode:           mode,
+		Model:          model,
+		Phase:          m.Phase,
+		Value:          m.Value,
+		Promote:        result.Promote,
+		Confidence:     result.Confidence,
+		Severity:       effectiveSeverity(result),
+		Analysis:       result.Text,
+		RootCause:      result.RootCause,
+		Remediation:    result.Remediation,
+		PromptTokens:   result.PromptTokens,
+		OutputTokens:   result.OutputTokens,
+	}
+}
+
+// rolloutRevision returns the rollout revision annotation of an AnalysisRun, or its pod template hash label
+func rolloutRevision(analysisRun *v1alpha1.AnalysisRun) string {
+	if revision := analysisRun.Annotations[rolloutRevisionAnnotation]; revision != "" {
+		return revision
+	}
+	return analysisRun.Labels[podTemplateHashLabel]
+}
+
+// publishDecision sends the decision to all enabled sinks. Failures are logged and never
+// affect the measurement result.
+func publishDecision(ctx context.Context, rec decisionRecord) {
+	if err := exportDecisionLog(ctx, rec); err != nil {
+		log.WithContext(ctx).WithError(err).Warn("Failed to export decision as OpenTelemetry log record")
+	}
+}
+
+// notifyDecision sends the decision to the notification sinks configured for the metric, recording
+// failures in the measurement metadata
+func notifyDecision(ctx context.Context, cfg aiConfig, rec decisionRecord, m v1alpha1.Measurement) {
+	if cfg.Slack != nil {
+		if err := notifySlack(ctx, cfg.Slack, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to send Slack notification")
+			markReportError(m, "slackError", err)
+		}
+	}
+	if cfg.Discord != nil {
+		if err := notifyDiscord(ctx, cfg.Discord, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to send Discord notification")
+			markReportError(m, "discordError", err)
+		}
+	}
+	if cfg.PagerDuty != nil {
+		if err := notifyPagerDuty(ctx, cfg.PagerDuty, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to trigger PagerDuty alert")
+			markReportError(m, "pagerDutyError", err)
+		}
+	}
+	if cfg.Opsgenie != nil {
+		if err := notifyOpsgenie(ctx, cfg.Opsgenie, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to create Opsgenie alert")
+			markReportError(m, "opsgenieError", err)
+		}
+	}
+	if cfg.Pushgateway != nil {
+		if err := pushDecisionMetrics(ctx, cfg.Pushgateway, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to push decision metrics to the Pushgateway")
+			markReportError(m, "pushgatewayError", err)
+		}
+	}
+	if cfg.Grafana != nil {
+		if err := annotateGrafana(ctx, cfg.Grafana, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to create Grafana annotation")
+			markReportError(m, "grafanaError", err)
+		}
+	}
+	var webhookErrs []error
+	for _, webhook := range cfg.Webhooks {
+		if err := sendWebhook(ctx, webhook, rec); err != nil {
+			log.WithContext(ctx).WithError(err).WithField("url", webhook.URL).Warn("Failed to send decision webhook")
+			webhookErrs = append(webhookErrs, err)
+		}
+	}
+	if len(webhookErrs) > 0 {
+		markReportError(m, "webhookError", errors.Join(webhookErrs...))
+	}
+	if cfg.CloudEvents != nil {
+		if err := publishCloudEvent(ctx, cfg.CloudEvents, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to publish CloudEvent")
+			markReportError(m, "cloudEventError", err)
+		}
+	}
+	if cfg.Email != nil {
+		if err := sendEmail(ctx, cfg.Email, rec); err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to send email notification")
+			markReportError(m, "emailError", err)
+		}
+	}
+}
+
+// sinkHTTPClient is used for all outbound decision sink requests
+var sinkHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON POSTs a JSON payload and fails on non-2xx responses
+func postJSON(ctx context.Context, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %v", err)
+	}
+	return postJSONBody(ctx, url, headers, body)
+}
+
+// postJSONBody POSTs an encoded JSON body and fails on non-2xx responses
+func postJSONBody(ctx context.Context, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := sinkHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned status %d: %s", url, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
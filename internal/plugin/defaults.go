@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// envDefaultsConfigMap overrides the name of the cluster-wide and namespace defaults ConfigMaps
+const envDefaultsConfigMap = "METRIC_AI_DEFAULTS_CONFIGMAP"
+
+// defaultDefaultsConfigMap is the ConfigMap with the cluster-wide defaults in the controller namespace,
+// and with the defaults of a namespace in the other namespaces
+const defaultDefaultsConfigMap = "metric-ai-defaults"
+
+// defaultsConfigKey is the key of the defaults ConfigMap with the plugin configuration, in YAML or JSON
+const defaultsConfigKey = "config"
+
+// clusterDefaults holds the cluster-wide defaults as JSON, decoded for every measurement so metrics
+// don't share nested objects
+var clusterDefaults = struct {
+	sync.RWMutex
+	config []byte
+}{}
+
+// namespaceDefaults caches the defaults ConfigMaps of AnalysisRun namespaces
+var namespaceDefaults = struct {
+	sync.Mutex
+	entries map[string]namespaceDefaultsEntry
+}{entries: make(map[string]namespaceDefaultsEntry)}
+
+type namespaceDefaultsEntry struct {
+	config   []byte
+	loadedAt time.Time
+}
+
+// defaultsConfigMapName returns the name of the defaults ConfigMaps
+func defaultsConfigMapName() string {
+	if name := os.Getenv(envDefaultsConfigMap); name != "" {
+		return name
+	}
+	return defaultDefaultsConfigMap
+}
+
+// parseDefaults converts the plugin configuration of a defaults ConfigMap to JSON, or returns nil
+// when it has none
+func parseDefaults(data map[string]string) ([]byte, error) {
+	if data[defaultsConfigKey] == "" {
+		return nil, nil
+	}
+	config, err := yaml.YAMLToJSON([]byte(data[defaultsConfigKey]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", defaultsConfigKey, err)
+	}
+	var cfg aiConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", defaultsConfigKey, err)
+	}
+	return config, nil
+}
+
+// readDefaults reads the defaults ConfigMap of a namespace, returning nil when there is none
+var readDefaults = func(ctx context.Context, namespace string) ([]byte, error) {
+	client, err := acquireKubeClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	if client == nil {
+		return nil, nil
+	}
+	name := defaultsConfigMapName()
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read ConfigMap %s/%s: %v", namespace, name, err)
+	}
+	config, err := parseDefaults(cm.Data)
+	if err != nil {
+		return nil, fmt.Errorf("ConfigMap %s/%s: %v", namespace, name, err)
+	}
+	return config, nil
+}
+
+// loadDefaults refreshes the cluster-wide defaults, keeping the previous ones when the ConfigMap
+// cannot be read or is invalid
+func loadDefaults(ctx context.Context) {
+	namespace, err := controllerNamespace()
+	if err != nil {
+		// Not running in a cluster
+		log.WithContext(ctx).WithError(err).Debug("Not reading cluster-wide defaults")
+		return
+	}
+	config, err := readDefaults(ctx, namespace)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Warn("Failed to load cluster-wide defaults, keeping the previous defaults")
+		return
+	}
+	clusterDefaults.Lock()
+	defer clusterDefaults.Unlock()
+	if !bytes.Equal(config, clusterDefaults.config) {
+		log.WithContext(ctx).WithField("configMap", defaultsConfigMapName()).Info("Loaded cluster-wide defaults")
+	}
+	clusterDefaults.config = config
+}
+
+// namespaceDefaultsFor returns the defaults of a namespace, read again after configReloadInterval.
+// The previous defaults are kept when the ConfigMap cannot be read or is invalid.
+func namespaceDefaultsFor(ctx context.Context, namespace string) []byte {
+	namespaceDefaults.Lock()
+	entry, ok := namespaceDefaults.entries[namespace]
+	namespaceDefaults.Unlock()
+	if ok && time.Since(entry.loadedAt) < configReloadInterval {
+		return entry.config
+	}
+
+	config, err := readDefaults(ctx, namespace)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).WithField("namespace", namespace).Warn("Failed to load namespace defaults, keeping the previous defaults")
+		config = entry.config
+	}
+	namespaceDefaults.Lock()
+	namespaceDefaults.entries[namespace] = namespaceDefaultsEntry{config: config, loadedAt: time.Now()}
+	namespaceDefaults.Unlock()
+	return config
+}
+
+// applyDefaults decodes the cluster-wide defaults, then the defaults of the AnalysisRun namespace (if
+// known) into cfg. The metric configuration is decoded over them, so namespaces and AnalysisTemplates
+// override single fields, also of nested objects such as slack.
+func applyDefaults(ctx context.Context, namespace string, cfg *aiConfig) error {
+	clusterDefaults.RLock()
+	config := clusterDefaults.config
+	clusterDefaults.RUnlock()
+	if config != nil {
+		if err := json.Unmarshal(config, cfg); err != nil {
+			return fmt.Errorf("failed to apply cluster-wide defaults: %v", err)
+		}
+	}
+	if namespace == "" {
+		return nil
+	}
+	if config := namespaceDefaultsFor(ctx, namespace); config != nil {
+		if err := json.Unmarshal(config, cfg); err != nil {
+			return fmt.Errorf("failed to apply defaults of namespace %s: %v", namespace, err)
+		}
+	}
+	return nil
+}
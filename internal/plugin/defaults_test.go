@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	t.Cleanup(func() { clusterDefaults.config = nil })
+
+	config, err := parseDefaults(map[string]string{defaultsConfigKey: `
+model: gemini-2.5-pro
+stableLabel: role=stable
+redactPatterns:
+- "internal-[0-9]+"
+slack:
+  channel: "#rollouts"
+  onSuccess: true
+`})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clusterDefaults.config = config
+
+	for i := 0; i < 2; i++ {
+		var cfg aiConfig
+		if err := applyDefaults(context.Background(), "", &cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := json.Unmarshal([]byte(`{"stableLabel":"app=web","slack":{"channel":"#team-a"}}`), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Model != "gemini-2.5-pro" || cfg.StableLabel != "app=web" || len(cfg.RedactPatterns) != 1 {
+			t.Errorf("unexpected configuration %+v", cfg)
+		}
+		if cfg.Slack == nil || cfg.Slack.Channel != "#team-a" || !cfg.Slack.OnSuccess {
+			t.Errorf("expected nested defaults to be overridden field by field, got %+v", cfg.Slack)
+		}
+	}
+
+	if _, err := parseDefaults(map[string]string{defaultsConfigKey: "model: [unclosed"}); err == nil {
+		t.Error("expected an error for invalid YAML")
+	}
+	if _, err := parseDefaults(map[string]string{defaultsConfigKey: "maxHistory: many"}); err == nil {
+		t.Error("expected an error for an invalid field")
+	}
+	if config, err := parseDefaults(nil); config != nil || err != nil {
+		t.Errorf("expected no defaults, got %s, %v", config, err)
+	}
+}
+
+func TestApplyNamespaceDefaults(t *testing.T) {
+	oldRead := readDefaults
+	var reads int
+	readDefaults = func(ctx context.Context, namespace string) ([]byte, error) {
+		reads++
+		if namespace == "team-a" {
+			return parseDefaults(map[string]string{defaultsConfigKey: "model: gemini-2.5-flash\nextraPrompt: Ignore cache misses.\nslack:\n  channel: \"#team-a\""})
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() {
+		readDefaults = oldRead
+		clusterDefaults.config = nil
+		namespaceDefaults.entries = make(map[string]namespaceDefaultsEntry)
+	})
+	clusterDefaults.config = []byte(`{"model":"gemini-2.5-pro","maxHistory":3,"slack":{"channel":"#rollouts","onSuccess":true}}`)
+
+	for i := 0; i < 2; i++ {
+		var cfg aiConfig
+		if err := applyDefaults(context.Background(), "team-a", &cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := json.Unmarshal([]byte(`{"extraPrompt":"Ignore timeouts."}`), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Model != "gemini-2.5-flash" || cfg.MaxHistory != 3 || cfg.ExtraPrompt != "Ignore timeouts." {
+			t.Errorf("unexpected configuration %+v", cfg)
+		}
+		if cfg.Slack == nil || cfg.Slack.Channel != "#team-a" || !cfg.Slack.OnSuccess {
+			t.Errorf("expected the namespace defaults to override the cluster-wide defaults, got %+v", cfg.Slack)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("expected the namespace defaults to be cached, got %d reads", reads)
+	}
+
+	var cfg aiConfig
+	if err := applyDefaults(context.Background(), "team-b", &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Model != "gemini-2.5-pro" {
+		t.Errorf("expected the cluster-wide defaults without namespace defaults, got %q", cfg.Model)
+	}
+
+	// Namespace defaults that can no longer be read are kept
+	namespaceDefaults.entries["team-a"] = namespaceDefaultsEntry{config: namespaceDefaults.entries["team-a"].config}
+	readDefaults = func(ctx context.Context, namespace string) ([]byte, error) {
+		return nil, fmt.Errorf("forbidden")
+	}
+	cfg = aiConfig{}
+	if err := applyDefaults(context.Background(), "team-a", &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Model != "gemini-2.5-flash" {
+		t.Errorf("expected the previous namespace defaults, got %q", cfg.Model)
+	}
+}
@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// Discord embed colors of the verdicts
+const (
+	discordColorPassed       = 0x2eb67d
+	discordColorFailed       = 0xe01e5a
+	discordColorInconclusive = 0xecb22e
+)
+
+// discordConfig posts the analysis decisions to a Discord channel
+type discordConfig struct {
+	// Secret key in the AnalysisRun namespace with the channel webhook URL
+	// (default: discord_webhook_url of the plugin secret)
+	WebhookSecretRef *secretKeyRef `json:"webhookSecretRef,omitempty"`
+	// Also notify when the analysis passes
+	OnSuccess bool `json:"onSuccess,omitempty"`
+}
+
+// discordMessage is a Discord webhook payload
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// discordEmbed is a rich message embed
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+}
+
+// discordEmbedField is a name/value field of an embed
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// notifyDiscord posts the decision to Discord, on success only when onSuccess is enabled
+func notifyDiscord(ctx context.Context, cfg *discordConfig, rec decisionRecord) error {
+	if rec.Phase == v1alpha1.AnalysisPhaseSuccessful && !cfg.OnSuccess {
+		return nil
+	}
+	webhookURL, err := readSecretRefOrDefault(ctx, cfg.WebhookSecretRef, "discord_webhook_url")
+	if err != nil {
+		return fmt.Errorf("failed to get Discord webhook URL from secret: %v", err)
+	}
+	if err := postJSON(ctx, webhookURL, nil, newDiscordMessage(rec)); err != nil {
+		return fmt.Errorf("failed to post Discord message: %v", err)
+	}
+	return nil
+}
+
+// newDiscordMessage formats the decision as an embed linking the created issue
+func newDiscordMessage(rec decisionRecord) discordMessage {
+	target := rec.AnalysisRun
+	if rec.Rollout != "" {
+		target = rec.Rollout
+	}
+	verdict, color := "failed", discordColorFailed
+	switch rec.Phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		verdict, color = "passed", discordColorPassed
+	case v1alpha1.AnalysisPhaseInconclusive:
+		verdict, color = "inconclusive", discordColorInconclusive
+	}
+
+	embed := discordEmbed{
+		Title: fmt.Sprintf("Canary analysis %s for %s/%s", verdict, rec.Namespace, target),
+		// Descriptions are limited to 4096 characters
+		Description: truncate(rec.Analysis, 4000),
+		URL:         rec.IssueURL,
+		Color:       color,
+		Fields: []discordEmbedField{
+			{Name: "Confidence", Value: fmt.Sprintf("%d%%", rec.Confidence), Inline: true},
+			{Name: "Severity", Value: rec.Severity, Inline: true},
+			{Name: "Metric", Value: rec.Metric, Inline: true},
+		},
+	}
+	if !rec.Time.IsZero() {
+		embed.Timestamp = rec.Time.Format(time.RFC3339)
+	}
+	if rec.RootCause != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "Root cause", Value: truncate(rec.RootCause, 1000)})
+	}
+	if rec.DashboardURL != "" {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: "Dashboard", Value: rec.DashboardURL})
+	}
+	return discordMessage{Username: "Argo Rollouts", Embeds: []discordEmbed{embed}}
+}
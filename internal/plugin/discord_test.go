@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestNewDiscordMessage(t *testing.T) {
+	rec := decisionRecord{
+		Time:        time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		AnalysisRun: "checkout-abc-1",
+		Namespace:   "shop",
+		Rollout:     "checkout",
+		Metric:      "ai",
+		Phase:       v1alpha1.AnalysisPhaseFailed,
+		Confidence:  90,
+		Severity:    SeverityMajor,
+		Analysis:    "error rate increased",
+		RootCause:   "database timeouts",
+		IssueURL:    "https://github.com/acme/checkout/issues/7",
+	}
+	msg := newDiscordMessage(rec)
+	if len(msg.Embeds) != 1 {
+		t.Fatalf("expected one embed, got %d", len(msg.Embeds))
+	}
+	embed := msg.Embeds[0]
+	if embed.Title != "Canary analysis failed for shop/checkout" || embed.Color != discordColorFailed || embed.URL != rec.IssueURL {
+		t.Errorf("unexpected embed %+v", embed)
+	}
+	if embed.Timestamp != "2025-01-02T03:04:05Z" || len(embed.Fields) != 4 || embed.Fields[3].Value != "database timeouts" {
+		t.Errorf("unexpected embed fields %+v", embed)
+	}
+
+	// Passed analyses are only posted with onSuccess
+	rec.Phase = v1alpha1.AnalysisPhaseSuccessful
+	if err := notifyDiscord(context.Background(), &discordConfig{}, rec); err != nil {
+		t.Errorf("expected passed analysis not to be posted, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Legacy selectors used when the pods cannot be discovered from the Rollout
+const (
+	defaultStableSelector = "role=stable"
+	defaultCanarySelector = "role=canary"
+)
+
+// rolloutNameFromAnalysisRun returns the name of the Rollout owning the AnalysisRun, if any
+func rolloutNameFromAnalysisRun(analysisRun *v1alpha1.AnalysisRun) string {
+	if analysisRun == nil {
+		return ""
+	}
+	for _, ref := range analysisRun.OwnerReferences {
+		if ref.Kind == "Rollout" {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// lookupRolloutPodHashes reads the stable and current pod template hashes from the Rollout status.
+// For blue-green Rollouts the active and preview selectors are used when the generic fields are not set yet.
+var lookupRolloutPodHashes = func(ctx context.Context, namespace, name string) (string, string, error) {
+	client, err := getRolloutsClient()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create rollouts client: %w", err)
+	}
+	ro, err := client.ArgoprojV1alpha1().Rollouts(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get rollout %s/%s: %w", namespace, name, err)
+	}
+	stableHash, currentHash := ro.Status.StableRS, ro.Status.CurrentPodHash
+	if stableHash == "" {
+		stableHash = ro.Status.BlueGreen.ActiveSelector
+	}
+	if currentHash == "" {
+		currentHash = ro.Status.BlueGreen.PreviewSelector
+	}
+	return stableHash, currentHash, nil
+}
+
+// podHashSelector builds a label selector matching pods of a given template hash
+func podHashSelector(hash string) string {
+	return fmt.Sprintf("%s=%s", v1alpha1.DefaultRolloutUniqueLabelKey, hash)
+}
+
+// resolvePodSelectors resolves the stable and canary pod label selectors.
+// Explicit labels take precedence, then configured pod template hashes, then the hashes
+// found in the owning Rollout status, falling back to role=stable/role=canary.
+// For blue-green Rollouts the active pods play the stable role and the preview pods the canary role.
+func resolvePodSelectors(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, cfg aiConfig) (string, string) {
+	stableSelector := cfg.StableLabel
+	if stableSelector == "" {
+		stableSelector = cfg.ActiveLabel
+	}
+	canarySelector := cfg.CanaryLabel
+	if canarySelector == "" {
+		canarySelector = cfg.PreviewLabel
+	}
+	if stableSelector != "" && canarySelector != "" {
+		return stableSelector, canarySelector
+	}
+
+	stableHash := cfg.StablePodHash
+	canaryHash := cfg.CanaryPodHash
+	if canaryHash == "" && analysisRun != nil {
+		// AnalysisRuns created by a Rollout are labeled with the canary pod template hash
+		canaryHash = analysisRun.Labels[v1alpha1.DefaultRolloutUniqueLabelKey]
+	}
+	if stableHash == "" || canaryHash == "" {
+		if rolloutName := rolloutNameFromAnalysisRun(analysisRun); rolloutName != "" {
+			stableRS, currentPodHash, err := lookupRolloutPodHashes(ctx, analysisRun.Namespace, rolloutName)
+			if err != nil {
+				log.WithContext(ctx).WithError(err).WithField("rollout", rolloutName).Warn("Failed to discover pod template hashes from rollout")
+			} else {
+				if stableHash == "" {
+					stableHash = stableRS
+				}
+				if canaryHash == "" {
+					canaryHash = currentPodHash
+				}
+			}
+		}
+	}
+
+	if stableSelector == "" {
+		if stableHash != "" {
+			stableSelector = podHashSelector(stableHash)
+		} else {
+			stableSelector = defaultStableSelector
+		}
+	}
+	if canarySelector == "" {
+		if canaryHash != "" {
+			canarySelector = podHashSelector(canaryHash)
+		} else {
+			canarySelector = defaultCanarySelector
+		}
+	}
+	return stableSelector, canarySelector
+}
+
+// AnalysisRun arguments naming the namespace and canary pod analyzed by the Kubernetes Agent
+var (
+	agentNamespaceArgs = []string{"namespace"}
+	agentPodNameArgs   = []string{"canary-pod", "podName", "pod-name"}
+)
+
+// resolveAgentTarget returns the namespace and canary pod analyzed by the Kubernetes Agent. Values
+// that are not configured come from the AnalysisRun arguments, else from the AnalysisRun namespace
+// and the canary pod whose logs were read, else from the canary pod template hash of the AnalysisRun,
+// resolved to a pod like a configured hash.
+func resolveAgentTarget(analysisRun *v1alpha1.AnalysisRun, cfg aiConfig, canaryPod string) (string, string) {
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = analysisRunArg(analysisRun, agentNamespaceArgs)
+	}
+	if namespace == "" && analysisRun != nil {
+		namespace = analysisRun.Namespace
+	}
+	podName := cfg.PodName
+	if podName == "" {
+		podName = analysisRunArg(analysisRun, agentPodNameArgs)
+	}
+	// The logs were read in the AnalysisRun namespace
+	if podName == "" && analysisRun != nil && namespace == analysisRun.Namespace {
+		podName = canaryPod
+	}
+	if podName == "" && analysisRun != nil {
+		podName = analysisRun.Labels[v1alpha1.DefaultRolloutUniqueLabelKey]
+	}
+	return namespace, podName
+}
+
+// analysisRunArg returns the value of the first AnalysisRun argument set among names
+func analysisRunArg(analysisRun *v1alpha1.AnalysisRun, names []string) string {
+	if analysisRun == nil {
+		return ""
+	}
+	for _, name := range names {
+		for _, arg := range analysisRun.Spec.Args {
+			if arg.Name == name && arg.Value != nil && *arg.Value != "" {
+				return *arg.Value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolvePodSelectors(t *testing.T) {
+	old := lookupRolloutPodHashes
+	lookupRolloutPodHashes = func(_ context.Context, namespace, name string) (string, string, error) {
+		if namespace != "default" || name != "demo" {
+			t.Fatalf("unexpected rollout lookup %s/%s", namespace, name)
+		}
+		return "stablehash", "canaryhash", nil
+	}
+	t.Cleanup(func() { lookupRolloutPodHashes = old })
+
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Namespace = "default"
+
+	// Without a rollout fall back to the role labels
+	stable, canary := resolvePodSelectors(context.Background(), analysisRun, aiConfig{})
+	if stable != "role=stable" || canary != "role=canary" {
+		t.Fatalf("expected legacy selectors, got %q and %q", stable, canary)
+	}
+
+	analysisRun.OwnerReferences = []metav1.OwnerReference{{Kind: "Rollout", Name: "demo"}}
+	stable, canary = resolvePodSelectors(context.Background(), analysisRun, aiConfig{})
+	if stable != "rollouts-pod-template-hash=stablehash" || canary != "rollouts-pod-template-hash=canaryhash" {
+		t.Fatalf("expected hash selectors, got %q and %q", stable, canary)
+	}
+
+	// Explicit configuration wins over discovery
+	stable, canary = resolvePodSelectors(context.Background(), analysisRun, aiConfig{StableLabel: "app=stable", CanaryPodHash: "abc"})
+	if stable != "app=stable" || canary != "rollouts-pod-template-hash=abc" {
+		t.Fatalf("expected configured selectors, got %q and %q", stable, canary)
+	}
+
+	// Blue-green active/preview labels are aliases for stable/canary
+	stable, canary = resolvePodSelectors(context.Background(), analysisRun, aiConfig{ActiveLabel: "app=active", PreviewLabel: "app=preview"})
+	if stable != "app=active" || canary != "app=preview" {
+		t.Fatalf("expected blue-green selectors, got %q and %q", stable, canary)
+	}
+}
+
+func TestResolveAgentTarget(t *testing.T) {
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Namespace = "shop"
+	analysisRun.Labels = map[string]string{v1alpha1.DefaultRolloutUniqueLabelKey: "6d4f8b9c7"}
+
+	// The canary pod whose logs were read, else the canary pod template hash
+	if namespace, podName := resolveAgentTarget(analysisRun, aiConfig{}, "checkout-6d4f8b9c7-x2x4z"); namespace != "shop" || podName != "checkout-6d4f8b9c7-x2x4z" {
+		t.Errorf("expected the canary pod of the logs, got %s/%s", namespace, podName)
+	}
+	if namespace, podName := resolveAgentTarget(analysisRun, aiConfig{}, ""); namespace != "shop" || podName != "6d4f8b9c7" {
+		t.Errorf("expected the canary pod template hash, got %s/%s", namespace, podName)
+	}
+
+	// Arguments win over discovery, and the logs pod is not used in another namespace
+	other, pod := "payments", "checkout-abc-123"
+	analysisRun.Spec.Args = []v1alpha1.Argument{{Name: "namespace", Value: &other}}
+	if namespace, podName := resolveAgentTarget(analysisRun, aiConfig{}, "checkout-6d4f8b9c7-x2x4z"); namespace != "payments" || podName != "6d4f8b9c7" {
+		t.Errorf("expected the namespace argument, got %s/%s", namespace, podName)
+	}
+	analysisRun.Spec.Args = append(analysisRun.Spec.Args, v1alpha1.Argument{Name: "canary-pod", Value: &pod})
+	if namespace, podName := resolveAgentTarget(analysisRun, aiConfig{}, ""); namespace != "payments" || podName != pod {
+		t.Errorf("expected the pod argument, got %s/%s", namespace, podName)
+	}
+
+	// Configuration wins over the AnalysisRun
+	if namespace, podName := resolveAgentTarget(analysisRun, aiConfig{Namespace: "ops", PodName: "agent-pod-1"}, ""); namespace != "ops" || podName != "agent-pod-1" {
+		t.Errorf("expected the configured pod, got %s/%s", namespace, podName)
+	}
+}
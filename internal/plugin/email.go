@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// sendMail delivers a message through an SMTP server, STARTTLS is used when the server supports it
+var sendMail = smtp.SendMail
+
+// emailConfig emails the analysis report of failed analyses
+type emailConfig struct {
+	// SMTP server address, host:port
+	Server string `json:"server"`
+	// Sender address
+	From string `json:"from"`
+	// Recipient addresses
+	To []string `json:"to"`
+	// SMTP username, no authentication when empty
+	Username string `json:"username,omitempty"`
+	// Secret key in the AnalysisRun namespace with the SMTP password (default: smtp_password of the plugin secret)
+	PasswordSecretRef *secretKeyRef `json:"passwordSecretRef,omitempty"`
+	// Also email passed analyses
+	OnSuccess bool `json:"onSuccess,omitempty"`
+}
+
+// sendEmail emails the analysis report, on success only when onSuccess is enabled
+func sendEmail(ctx context.Context, cfg *emailConfig, rec decisionRecord) error {
+	if rec.Phase == v1alpha1.AnalysisPhaseSuccessful && !cfg.OnSuccess {
+		return nil
+	}
+	if cfg.Server == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return fmt.Errorf("email requires server, from and to")
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		password, err := readSecretRefOrDefault(ctx, cfg.PasswordSecretRef, "smtp_password")
+		if err != nil {
+			return fmt.Errorf("failed to get SMTP password from secret: %v", err)
+		}
+		host, _, err := net.SplitHostPort(cfg.Server)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP server %s: %v", cfg.Server, err)
+		}
+		auth = smtp.PlainAuth("", cfg.Username, password, host)
+	}
+	if err := sendMail(cfg.Server, auth, cfg.From, cfg.To, newEmailMessage(cfg, rec, time.Now())); err != nil {
+		return fmt.Errorf("failed to send email through %s: %v", cfg.Server, err)
+	}
+	return nil
+}
+
+// newEmailMessage formats the analysis report as a plain text email
+func newEmailMessage(cfg *emailConfig, rec decisionRecord, now time.Time) []byte {
+	target := rec.AnalysisRun
+	if rec.Rollout != "" {
+		target = rec.Rollout
+	}
+	verdict := "failed"
+	switch rec.Phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		verdict = "passed"
+	case v1alpha1.AnalysisPhaseInconclusive:
+		verdict = "inconclusive"
+	}
+	subject := fmt.Sprintf("Canary analysis %s for %s/%s (confidence %d%%)", verdict, rec.Namespace, target, rec.Confidence)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s\n\n", subject)
+	fmt.Fprintf(&body, "AnalysisRun: %s/%s\nMetric: %s\nSeverity: %s\n", rec.Namespace, rec.AnalysisRun, rec.Metric, rec.Severity)
+	if rec.IssueURL != "" {
+		fmt.Fprintf(&body, "Issue: %s\n", rec.IssueURL)
+	}
+	if rec.DashboardURL != "" {
+		fmt.Fprintf(&body, "Dashboard: %s\n", rec.DashboardURL)
+	}
+	if rec.RootCause != "" {
+		fmt.Fprintf(&body, "\nRoot cause:\n%s\n", rec.RootCause)
+	}
+	if rec.Remediation != "" {
+		fmt.Fprintf(&body, "\nRemediation:\n%s\n", rec.Remediation)
+	}
+	fmt.Fprintf(&body, "\nAnalysis:\n%s\n", rec.Analysis)
+	// SMTP requires CRLF line endings
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body.String(), "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestSendEmail(t *testing.T) {
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	oldSendMail := sendMail
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, msg
+		return nil
+	}
+	t.Cleanup(func() { sendMail = oldSendMail })
+
+	cfg := &emailConfig{Server: "smtp.example.com:587", From: "rollouts@example.com", To: []string{"oncall@example.com", "checkout@example.com"}}
+	rec := decisionRecord{AnalysisRun: "checkout-abc-1", Namespace: "shop", Rollout: "checkout", Phase: v1alpha1.AnalysisPhaseFailed, Confidence: 90, RootCause: "database timeouts", Analysis: "line one\nline two"}
+	if err := sendEmail(context.Background(), cfg, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAddr != cfg.Server || gotFrom != cfg.From || len(gotTo) != 2 {
+		t.Errorf("unexpected delivery to %s from %s to %v", gotAddr, gotFrom, gotTo)
+	}
+	msg := string(gotMsg)
+	for _, want := range []string{"Subject: Canary analysis failed for shop/checkout (confidence 90%)\r\n", "To: oncall@example.com, checkout@example.com\r\n", "Root cause:\r\ndatabase timeouts\r\n", "line one\r\nline two"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected message to contain %q, got %q", want, msg)
+		}
+	}
+
+	// Passed analyses are only emailed with onSuccess
+	gotMsg = nil
+	rec.Phase = v1alpha1.AnalysisPhaseSuccessful
+	if err := sendEmail(context.Background(), cfg, rec); err != nil || gotMsg != nil {
+		t.Errorf("expected passed analysis not to be emailed, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reasons of the events recorded for analysis decisions
+const (
+	eventReasonPassed       = "AIAnalysisPassed"
+	eventReasonFailed       = "AIAnalysisFailed"
+	eventReasonInconclusive = "AIAnalysisInconclusive"
+)
+
+// eventSourceComponent is the source of the recorded events
+const eventSourceComponent = "rollouts-plugin-metric-ai"
+
+// eventMessageLength is the longest event message accepted by the API server
+const eventMessageLength = 1024
+
+// recordDecisionEvents records the decision as events of the AnalysisRun and its Rollout,
+// so `kubectl describe` shows why a canary was blocked
+func recordDecisionEvents(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, rec decisionRecord) error {
+	client, err := acquireKubeClient()
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf("no Kubernetes client to record events")
+	}
+	var errs []string
+	for _, event := range decisionEvents(analysisRun, rec, time.Now()) {
+		if _, err := client.CoreV1().Events(event.Namespace).Create(ctx, &event, metav1.CreateOptions{}); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %v", event.InvolvedObject.Kind, event.InvolvedObject.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to record events: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// decisionEvents builds the events of a decision on the AnalysisRun and its parent Rollout
+func decisionEvents(analysisRun *v1alpha1.AnalysisRun, rec decisionRecord, now time.Time) []corev1.Event {
+	reason, eventType, verdict := eventReasonFailed, corev1.EventTypeWarning, "failed"
+	switch rec.Phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		reason, eventType, verdict = eventReasonPassed, corev1.EventTypeNormal, "passed"
+	case v1alpha1.AnalysisPhaseInconclusive:
+		reason, verdict = eventReasonInconclusive, "inconclusive"
+	}
+	message := fmt.Sprintf("AI analysis %s of metric %s %s (confidence %d%%, severity %s)", analysisRun.Name, rec.Metric, verdict, rec.Confidence, rec.Severity)
+	summary := rec.RootCause
+	if summary == "" {
+		summary = rec.Analysis
+	}
+	if summary != "" {
+		message += ": " + summary
+	}
+	message = truncate(message, eventMessageLength-3)
+
+	timestamp := metav1.NewTime(now)
+	objects := eventObjects(analysisRun)
+	events := make([]corev1.Event, 0, len(objects))
+	for _, object := range objects {
+		events = append(events, corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				// Same naming as the client-go event recorder
+				Name:      fmt.Sprintf("%s.%x", object.Name, now.UnixNano()),
+				Namespace: analysisRun.Namespace,
+			},
+			InvolvedObject: object,
+			Reason:         reason,
+			Message:        message,
+			Type:           eventType,
+			Source:         corev1.EventSource{Component: eventSourceComponent},
+			FirstTimestamp: timestamp,
+			LastTimestamp:  timestamp,
+			Count:          1,
+		})
+	}
+	return events
+}
+
+// eventObjects returns the objects events of an analysis are recorded on: the AnalysisRun and its parent Rollout
+func eventObjects(analysisRun *v1alpha1.AnalysisRun) []corev1.ObjectReference {
+	objects := []corev1.ObjectReference{{
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       "AnalysisRun",
+		Namespace:  analysisRun.Namespace,
+		Name:       analysisRun.Name,
+		UID:        analysisRun.UID,
+	}}
+	for _, ref := range analysisRun.OwnerReferences {
+		if ref.Kind == "Rollout" {
+			objects = append(objects, corev1.ObjectReference{
+				APIVersion: ref.APIVersion,
+				Kind:       ref.Kind,
+				Namespace:  analysisRun.Namespace,
+				Name:       ref.Name,
+				UID:        ref.UID,
+			})
+		}
+	}
+	return objects
+}
@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDecisionEvents(t *testing.T) {
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "checkout-abc-1"
+	analysisRun.Namespace = "shop"
+	analysisRun.OwnerReferences = []metav1.OwnerReference{{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "checkout", UID: "uid-1"}}
+	rec := decisionRecord{Metric: "ai", Phase: v1alpha1.AnalysisPhaseFailed, Confidence: 90, Severity: SeverityMajor, RootCause: "database timeouts"}
+
+	events := decisionEvents(analysisRun, rec, time.Unix(1700000000, 0))
+	if len(events) != 2 {
+		t.Fatalf("expected events on the AnalysisRun and Rollout, got %d", len(events))
+	}
+	if events[0].InvolvedObject.Kind != "AnalysisRun" || events[1].InvolvedObject.Kind != "Rollout" || events[1].InvolvedObject.UID != "uid-1" {
+		t.Errorf("unexpected involved objects %+v and %+v", events[0].InvolvedObject, events[1].InvolvedObject)
+	}
+	for _, event := range events {
+		if event.Reason != eventReasonFailed || event.Type != "Warning" || event.Namespace != "shop" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		if event.Message != "AI analysis checkout-abc-1 of metric ai failed (confidence 90%, severity major): database timeouts" {
+			t.Errorf("unexpected message %s", event.Message)
+		}
+	}
+
+	rec.Phase = v1alpha1.AnalysisPhaseSuccessful
+	rec.Analysis = strings.Repeat("x", 2000)
+	rec.RootCause = ""
+	events = decisionEvents(analysisRun, rec, time.Now())
+	if events[0].Reason != eventReasonPassed || events[0].Type != "Normal" || len(events[0].Message) > eventMessageLength {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// maxPromptExamplesLength bounds the characters of examples added to the prompt
+const maxPromptExamplesLength = 20000
+
+// promptExample is a few-shot example of the analysis: logs and the decision expected for them
+type promptExample struct {
+	// Description tells the model why the decision is right, e.g. "connection resets during pod rotation are expected"
+	Description string `json:"description,omitempty"`
+	StableLogs  string `json:"stableLogs,omitempty"`
+	CanaryLogs  string `json:"canaryLogs"`
+	Promote     bool   `json:"promote"`
+	Confidence  int    `json:"confidence"`
+	Severity    string `json:"severity,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
+
+// parsePromptExamples parses the examples of a ConfigMap, one YAML or JSON example per key, in key order
+func parsePromptExamples(data map[string]string) ([]promptExample, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	examples := make([]promptExample, 0, len(keys))
+	for _, key := range keys {
+		var example promptExample
+		if err := yaml.UnmarshalStrict([]byte(data[key]), &example); err != nil {
+			return nil, fmt.Errorf("invalid example %s: %v", key, err)
+		}
+		if strings.TrimSpace(example.CanaryLogs) == "" {
+			return nil, fmt.Errorf("example %s has no canaryLogs", key)
+		}
+		examples = append(examples, example)
+	}
+	return examples, nil
+}
+
+// readPromptExamples reads the few-shot examples of a ConfigMap in the AnalysisRun namespace
+var readPromptExamples = func(ctx context.Context, namespace, name string) ([]promptExample, error) {
+	client, err := acquireKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("no Kubernetes client to read examples ConfigMap %s", name)
+	}
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read examples ConfigMap %s: %v", name, err)
+	}
+	examples, err := parsePromptExamples(cm.Data)
+	if err != nil {
+		return nil, fmt.Errorf("examples ConfigMap %s: %v", name, err)
+	}
+	return examples, nil
+}
+
+// formatPromptExamples renders the examples for the analysis prompt. Examples beyond
+// maxPromptExamplesLength are left out.
+func formatPromptExamples(examples []promptExample) string {
+	if len(examples) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("These are examples of previous analyses of this service with the expected response, " +
+		"showing which log patterns are acceptable noise and which are real regressions. " +
+		"Decide the same way for similar logs.")
+	for i, example := range examples {
+		decision, _ := json.Marshal(AIAnalysisResult{
+			Text:       example.Text,
+			Promote:    example.Promote,
+			Confidence: example.Confidence,
+			Severity:   example.Severity,
+		})
+		var e strings.Builder
+		fmt.Fprintf(&e, "\n\nExample %d:\n", i+1)
+		if example.Description != "" {
+			fmt.Fprintf(&e, "Description: %s\n", strings.TrimSpace(example.Description))
+		}
+		if example.StableLogs != "" {
+			fmt.Fprintf(&e, "Stable logs:\n%s\n", strings.TrimSpace(example.StableLogs))
+		}
+		fmt.Fprintf(&e, "Canary logs:\n%s\n", strings.TrimSpace(example.CanaryLogs))
+		fmt.Fprintf(&e, "Expected response: %s", decision)
+		if b.Len()+e.Len() > maxPromptExamplesLength {
+			log.WithFields(log.Fields{"included": i, "examples": len(examples)}).Warn("Prompt examples are too long, leaving out the remaining examples")
+			break
+		}
+		b.WriteString(e.String())
+	}
+	return b.String()
+}
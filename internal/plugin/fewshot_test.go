@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromptExamples(t *testing.T) {
+	examples, err := parsePromptExamples(map[string]string{
+		"b-timeouts.yaml": `
+description: Upstream timeouts are a real regression
+canaryLogs: "ERROR upstream timed out after 30s"
+promote: false
+confidence: 90
+severity: major
+`,
+		"a-resets.yaml": `
+description: Connection resets during pod rotation are expected
+stableLogs: "INFO started"
+canaryLogs: "WARN connection reset by peer"
+promote: true
+confidence: 85
+severity: minor
+text: Resets happen while old pods terminate
+`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(examples) != 2 || !examples[0].Promote || examples[1].Promote {
+		t.Fatalf("expected examples in key order, got %+v", examples)
+	}
+
+	prompt := analysisPrompt(AIAnalysisParams{Examples: formatPromptExamples(examples), LogsContext: "--- STABLE LOGS ---"})
+	for _, want := range []string{
+		"Example 1:\nDescription: Connection resets during pod rotation are expected\nStable logs:\nINFO started\nCanary logs:\nWARN connection reset by peer\n" +
+			`Expected response: {"text":"Resets happen while old pods terminate","promote":true,"confidence":85,"severity":"minor"}`,
+		"Example 2:\nDescription: Upstream timeouts are a real regression\nCanary logs:\n",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected the prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+	if strings.Index(prompt, "Example 2:") > strings.LastIndex(prompt, "--- STABLE LOGS ---") {
+		t.Error("expected the examples before the logs")
+	}
+
+	long := []promptExample{{CanaryLogs: strings.Repeat("x", maxPromptExamplesLength/2)}, {CanaryLogs: strings.Repeat("y", maxPromptExamplesLength/2)}}
+	if formatted := formatPromptExamples(long); strings.Contains(formatted, "Example 2:") || !strings.Contains(formatted, "Example 1:") {
+		t.Error("expected examples beyond the limit to be left out")
+	}
+
+	if _, err := parsePromptExamples(map[string]string{"empty": "promote: true"}); err == nil {
+		t.Error("expected an error for an example without canary logs")
+	}
+	if _, err := parsePromptExamples(map[string]string{"typo": "canaryLogs: x\npromot: true"}); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
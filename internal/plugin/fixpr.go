@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/google/go-github/v60/github"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genai"
+)
+
+// fixBranchPrefix prefixes the branches of pull requests with suggested fixes
+const fixBranchPrefix = "metric-ai/fix-"
+
+// manifestFix is a manifest change suggested by the model for a failed canary
+type manifestFix struct {
+	// Applicable is false when the remediation is not a change of the manifest
+	Applicable bool   `json:"applicable"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+	// Content is the full updated manifest
+	Content string `json:"content"`
+}
+
+// generateManifestFix asks the model to apply the remediation of a failed analysis to the manifest
+var generateManifestFix = func(ctx context.Context, apiKey, modelName, path, manifest string, result AIAnalysisResult) (manifestFix, error) {
+	client, err := getGenAIClient(ctx, apiKey)
+	if err != nil {
+		return manifestFix{}, err
+	}
+
+	prompt := "You are an expert DevOps engineer. A canary deployment failed. Decide whether the remediation below " +
+		"is a change of the Kubernetes manifest (e.g. an environment variable, resource requests or limits, probes, replicas). " +
+		"Return STRICT JSON with these fields: " +
+		"{\"applicable\": true|false, \"title\": \"concise pull request title\", \"body\": \"markdown pull request description\", " +
+		"\"content\": \"the full updated manifest\"}. " +
+		"If the remediation requires a code change or is not a manifest change, return {\"applicable\": false}. " +
+		"Change only what the remediation requires and keep the rest of the manifest, including comments, unchanged." +
+		"\n\nCANARY FAILURE ANALYSIS:\n" + formatAnalysisText(result) +
+		"\n\nMANIFEST " + path + ":\n" + manifest
+
+	var resp *genai.GenerateContentResponse
+	err = retryWithBackoff(ctx, func() error {
+		var apiErr error
+		resp, apiErr = client.Models.GenerateContent(ctx, modelName, []*genai.Content{{Parts: []*genai.Part{{Text: prompt}}}}, nil)
+		return apiErr
+	}, 3)
+	if err != nil {
+		return manifestFix{}, err
+	}
+
+	responseText := concatCandidates(resp)
+	if j := extractFirstJSON(responseText); j != "" {
+		responseText = j
+	}
+	var fix manifestFix
+	if err := json.Unmarshal([]byte(responseText), &fix); err != nil {
+		return manifestFix{}, fmt.Errorf("failed to parse suggested fix: %v", err)
+	}
+	return fix, nil
+}
+
+// openFixPullRequest opens a draft pull request against the base branch applying the remediation of a
+// failed analysis to the configured manifest. It returns the pull request URL, or an empty string when
+// the remediation is not a manifest change.
+func openFixPullRequest(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, result AIAnalysisResult, cfg aiConfig, modelName string) (string, error) {
+	if cfg.FixManifestPath == "" {
+		return "", fmt.Errorf("fixPullRequest requires fixManifestPath")
+	}
+	if result.Remediation == "" {
+		log.WithContext(ctx).Info("No remediation to open a fix pull request for")
+		return "", nil
+	}
+	owner, repo, err := extractOwnerRepoFromURL(cfg.GitHubURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract owner/repo from URL: %v", err)
+	}
+	client, err := newGitHubClient(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	base := cfg.BaseBranch
+	if base == "" {
+		repository, _, err := client.Repositories.Get(ctx, owner, repo)
+		if err != nil {
+			return "", fmt.Errorf("failed to get default branch: %v", err)
+		}
+		base = repository.GetDefaultBranch()
+	}
+	file, _, _, err := client.Repositories.GetContents(ctx, owner, repo, cfg.FixManifestPath, &github.RepositoryContentGetOptions{Ref: base})
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %v", cfg.FixManifestPath, err)
+	}
+	if file == nil {
+		return "", fmt.Errorf("%s is not a file", cfg.FixManifestPath)
+	}
+	manifest, err := file.GetContent()
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %v", cfg.FixManifestPath, err)
+	}
+
+	apiKey, err := googleAPIKeyFor(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	fix, err := generateManifestFix(ctx, apiKey, modelName, cfg.FixManifestPath, manifest, result)
+	if err != nil {
+		return "", err
+	}
+	if !fix.Applicable || strings.TrimSpace(fix.Content) == "" || fix.Content == manifest {
+		log.WithContext(ctx).WithField("remediation", result.Remediation).Info("Remediation is not a manifest change, not opening a fix pull request")
+		return "", nil
+	}
+	if fix.Title == "" {
+		fix.Title = "Fix failed canary: " + truncate(result.Remediation, 80)
+	}
+
+	baseRef, _, err := client.Git.GetRef(ctx, owner, repo, "heads/"+base)
+	if err != nil {
+		return "", fmt.Errorf("failed to get branch %s: %v", base, err)
+	}
+	branch := fixBranchPrefix + analysisRun.Name
+	if _, _, err := client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: baseRef.Object.SHA},
+	}); err != nil {
+		return "", fmt.Errorf("failed to create branch %s: %v", branch, err)
+	}
+	if _, _, err := client.Repositories.UpdateFile(ctx, owner, repo, cfg.FixManifestPath, &github.RepositoryContentFileOptions{
+		Message: github.String(fix.Title),
+		Content: []byte(fix.Content),
+		SHA:     file.SHA,
+		Branch:  &branch,
+	}); err != nil {
+		return "", fmt.Errorf("failed to commit suggested fix: %v", err)
+	}
+
+	body := fmt.Sprintf("%s\n\n---\n*Suggested by the Argo Rollouts AI Metric Plugin for the failed analysis %s/%s. Review carefully before merging.*",
+		fix.Body, analysisRun.Namespace, analysisRun.Name)
+	pr, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title: &fix.Title,
+		Head:  &branch,
+		Base:  &base,
+		Body:  &body,
+		Draft: github.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create fix pull request: %v", err)
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"owner":       owner,
+		"repo":        repo,
+		"pullRequest": pr.GetNumber(),
+		"branch":      branch,
+	}).Info("Opened draft pull request with suggested fix")
+	return pr.GetHTMLURL(), nil
+}
@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOpenFixPullRequestSkips(t *testing.T) {
+	ar := &v1alpha1.AnalysisRun{ObjectMeta: metav1.ObjectMeta{Name: "checkout-1", Namespace: "default"}}
+	cfg := aiConfig{GitHubURL: "https://github.com/acme/checkout", FixPullRequest: true}
+	if _, err := openFixPullRequest(context.Background(), ar, AIAnalysisResult{Remediation: "raise the memory limit"}, cfg, "gemini-2.0-flash"); err == nil {
+		t.Error("expected an error without fixManifestPath")
+	}
+
+	cfg.FixManifestPath = "deploy/rollout.yaml"
+	prURL, err := openFixPullRequest(context.Background(), ar, AIAnalysisResult{Text: "canary is bad"}, cfg, "gemini-2.0-flash")
+	if err != nil || prURL != "" {
+		t.Errorf("expected no pull request without remediation, got %q, %v", prURL, err)
+	}
+}
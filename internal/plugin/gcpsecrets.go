@@ -0,0 +1,179 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envGCPSecret names a Secret Manager secret with the plugin configuration keys
+const envGCPSecret = "METRIC_AI_GCP_SECRET"
+
+// envGCEMetadataHost overrides the metadata server, like in the Google Cloud client libraries
+const envGCEMetadataHost = "GCE_METADATA_HOST"
+
+// gcpSecretCacheTTL bounds how long Secret Manager values are cached
+const gcpSecretCacheTTL = 5 * time.Minute
+
+// gcpSecretManagerEndpoint is the Secret Manager API
+var gcpSecretManagerEndpoint = "https://secretmanager.googleapis.com/v1/"
+
+// gcpTokenCache holds the access token of the Workload Identity service account
+var gcpTokenCache = struct {
+	sync.Mutex
+	token      string
+	expiration time.Time
+}{}
+
+// gcpSecretCache holds the Secret Manager values by secret version
+var gcpSecretCache = struct {
+	sync.Mutex
+	entries map[string]secretCacheEntry
+}{entries: make(map[string]secretCacheEntry)}
+
+// gcpSecretName is the parsed resource name of a Secret Manager secret version
+type gcpSecretName struct {
+	Project string
+	Secret  string
+	Version string
+}
+
+// String returns the resource name of the secret version
+func (n gcpSecretName) String() string {
+	return fmt.Sprintf("projects/%s/secrets/%s/versions/%s", n.Project, n.Secret, n.Version)
+}
+
+// parseGCPSecretName parses projects/<project>/secrets/<secret>[/versions/<version>], defaulting to
+// the latest version
+func parseGCPSecretName(name string) (gcpSecretName, error) {
+	parts := strings.Split(name, "/")
+	if (len(parts) != 4 && len(parts) != 6) || parts[0] != "projects" || parts[1] == "" || parts[2] != "secrets" || parts[3] == "" {
+		return gcpSecretName{}, fmt.Errorf("invalid Secret Manager secret name %q, expected projects/<project>/secrets/<secret>", name)
+	}
+	parsed := gcpSecretName{Project: parts[1], Secret: parts[3], Version: "latest"}
+	if len(parts) == 6 {
+		if parts[4] != "versions" || parts[5] == "" {
+			return gcpSecretName{}, fmt.Errorf("invalid Secret Manager secret name %q, expected projects/<project>/secrets/<secret>/versions/<version>", name)
+		}
+		parsed.Version = parts[5]
+	}
+	return parsed, nil
+}
+
+// gcpAccessToken returns an access token of the service account of the pod, bound to a Google service
+// account with Workload Identity, from the GKE metadata server
+func gcpAccessToken(ctx context.Context) (string, error) {
+	gcpTokenCache.Lock()
+	defer gcpTokenCache.Unlock()
+	if time.Now().Add(time.Minute).Before(gcpTokenCache.expiration) {
+		return gcpTokenCache.token, nil
+	}
+	host := os.Getenv(envGCEMetadataHost)
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	body, err := doSecretManagerRequest(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token from the metadata server: %v", err)
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("failed to decode metadata server response: %v", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("metadata server returned no access token")
+	}
+	gcpTokenCache.token = resp.AccessToken
+	gcpTokenCache.expiration = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	return gcpTokenCache.token, nil
+}
+
+// getGCPSecret returns the keys of a Secret Manager secret, whose value is a JSON object of strings
+func getGCPSecret(ctx context.Context, name string) (map[string]string, error) {
+	parsed, err := parseGCPSecretName(name)
+	if err != nil {
+		return nil, err
+	}
+	gcpSecretCache.Lock()
+	entry, ok := gcpSecretCache.entries[parsed.String()]
+	gcpSecretCache.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.values, nil
+	}
+
+	token, err := gcpAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpSecretManagerEndpoint+parsed.String()+":access", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	body, err := doSecretManagerRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access secret %s: %v", parsed, err)
+	}
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode Secret Manager response: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret %s: %v", parsed, err)
+	}
+	values := make(map[string]string)
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object of strings: %v", parsed, err)
+	}
+
+	gcpSecretCache.Lock()
+	gcpSecretCache.entries[parsed.String()] = secretCacheEntry{values: values, expiresAt: time.Now().Add(gcpSecretCacheTTL)}
+	gcpSecretCache.Unlock()
+	return values, nil
+}
+
+// readGCPSecretKey reads a key of a Secret Manager secret
+func readGCPSecretKey(ctx context.Context, name, key string) (string, error) {
+	values, err := getGCPSecret(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(values[key])
+	if value == "" {
+		return "", fmt.Errorf("key %s not found in Secret Manager secret %s", key, name)
+	}
+	return value, nil
+}
+
+// checkGCPSecretNamespace allows metrics to read only secrets prefixed with their namespace and an
+// underscore, which namespace names cannot contain, so teams cannot read each other's secrets through
+// the controller service account
+func checkGCPSecretNamespace(name, namespace string) error {
+	parsed, err := parseGCPSecretName(name)
+	if err != nil {
+		return err
+	}
+	if namespace == "" || !strings.HasPrefix(parsed.Secret, namespace+"_") {
+		return fmt.Errorf("secret %s must be named %s_<name> to be used by metrics of namespace %s", parsed.Secret, namespace, namespace)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetGCPSecret(t *testing.T) {
+	var tokenCalls int
+	var auth, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/computeMetadata/v1/instance/service-accounts/default/token" {
+			tokenCalls++
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`)
+			return
+		}
+		auth, path = r.Header.Get("Authorization"), r.URL.Path
+		data := base64.StdEncoding.EncodeToString([]byte(`{"github_token":"team-token"}`))
+		fmt.Fprintf(w, `{"name":"projects/123/secrets/shop_metric-ai/versions/1","payload":{"data":%q}}`, data)
+	}))
+	defer server.Close()
+
+	oldEndpoint := gcpSecretManagerEndpoint
+	gcpSecretManagerEndpoint = server.URL + "/v1/"
+	t.Cleanup(func() {
+		gcpSecretManagerEndpoint = oldEndpoint
+		gcpTokenCache.token, gcpTokenCache.expiration = "", time.Time{}
+		gcpSecretCache.entries = make(map[string]secretCacheEntry)
+	})
+	t.Setenv(envGCEMetadataHost, strings.TrimPrefix(server.URL, "http://"))
+
+	name := "projects/my-project/secrets/shop_metric-ai"
+	for i := 0; i < 2; i++ {
+		token, err := readGCPSecretKey(context.Background(), name, "github_token")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if token != "team-token" {
+			t.Errorf("expected the secret key, got %q", token)
+		}
+	}
+	if tokenCalls != 1 {
+		t.Errorf("expected the access token and secret to be cached, got %d token calls", tokenCalls)
+	}
+	if auth != "Bearer ya29.token" || path != "/v1/projects/my-project/secrets/shop_metric-ai/versions/latest:access" {
+		t.Errorf("unexpected authorization %q or path %q", auth, path)
+	}
+	if _, err := readGCPSecretKey(context.Background(), name, "google_api_key"); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+
+	if err := checkGCPSecretNamespace(name, "shop"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := checkGCPSecretNamespace("projects/my-project/secrets/shop-b_metric-ai", "shop"); err == nil {
+		t.Error("expected secrets of other namespaces to be rejected")
+	}
+	if parsed, err := parseGCPSecretName("projects/p/secrets/s/versions/3"); err != nil || parsed.Version != "3" {
+		t.Errorf("unexpected secret name %+v, error %v", parsed, err)
+	}
+	if _, err := parseGCPSecretName("projects/p/s"); err == nil {
+		t.Error("expected an error for an invalid secret name")
+	}
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/google/go-github/v60/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultRedactPatterns match common credentials in logs, the matched text is replaced by redactedText
+var defaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(authorization:\s*(?:bearer|basic|token)\s+)\S+`),
+	regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',&]+`),
+	regexp.MustCompile(`(?i)(://[^/\s:@]+:)[^/\s@]+(@)`),
+	regexp.MustCompile(`()\b(?:gh[pousr]_[A-Za-z0-9]{36,}|glpat-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16})\b`),
+}
+
+// redactedText replaces redacted values
+const redactedText = "[REDACTED]"
+
+// redactLogs masks credentials in logs with the default patterns and the configured extra
+// patterns, which redact their whole match
+func redactLogs(logs string, extra []string) (string, error) {
+	for _, re := range defaultRedactPatterns {
+		logs = re.ReplaceAllStringFunc(logs, func(match string) string {
+			groups := re.FindStringSubmatch(match)
+			if len(groups) > 2 {
+				return groups[1] + redactedText + groups[2]
+			}
+			return groups[1] + redactedText
+		})
+	}
+	for _, pattern := range extra {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid redact pattern %q: %v", pattern, err)
+		}
+		logs = re.ReplaceAllString(logs, redactedText)
+	}
+	return logs, nil
+}
+
+// createLogsGist uploads the redacted stable and canary logs as a secret gist and returns its URL
+func createLogsGist(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, logsBlob string, cfg aiConfig) (string, error) {
+	logs, err := redactLogs(logsBlob, cfg.RedactPatterns)
+	if err != nil {
+		return "", err
+	}
+	client, err := newGitHubClient(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	description := "Canary analysis logs"
+	if analysisRun != nil {
+		description = fmt.Sprintf("Canary analysis logs of %s/%s", analysisRun.Namespace, analysisRun.Name)
+	}
+	gist, _, err := client.Gists.Create(ctx, &github.Gist{
+		Description: &description,
+		Public:      github.Bool(false),
+		Files: map[github.GistFilename]github.GistFile{
+			"canary-analysis.log": {Content: &logs},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create gist: %v", err)
+	}
+
+	log.WithContext(ctx).WithField("url", gist.GetHTMLURL()).Info("Uploaded canary logs as a secret gist")
+	return gist.GetHTMLURL(), nil
+}
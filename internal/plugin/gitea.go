@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// parseGiteaURL splits a Gitea or Forgejo repository URL into the API base URL of the repository,
+// keeping any sub-path the instance is served under, e.g. https://git.example.com/gitea/owner/repo
+func parseGiteaURL(repoURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid Gitea URL format: %s", repoURL)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", fmt.Errorf("could not extract owner/repository from URL: %s", repoURL)
+	}
+	n := len(parts)
+	base := u.Scheme + "://" + u.Host
+	if n > 2 {
+		base += "/" + strings.Join(parts[:n-2], "/")
+	}
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s", base, parts[n-2], parts[n-1]), nil
+}
+
+// giteaRequest calls the Gitea REST API with the token from the Kubernetes secret
+func giteaRequest(ctx context.Context, method, url string, body, out interface{}) error {
+	token, err := getSecretValue("gitea_token")
+	if err != nil {
+		return fmt.Errorf("failed to get Gitea token from secret: %v", err)
+	}
+	return gitAPIRequest(ctx, method, url, func(req *http.Request) {
+		req.Header.Set("Authorization", "token "+token)
+	}, body, out)
+}
+
+// reportToGitea creates a Gitea issue or comments on the canary pull request
+func reportToGitea(ctx context.Context, cfg aiConfig, title, body string) (int, error) {
+	repoAPI, err := parseGiteaURL(cfg.GitHubURL)
+	if err != nil {
+		return 0, err
+	}
+	logCtx := log.WithContext(ctx).WithField("repository", repoAPI)
+
+	switch cfg.GitHubTarget {
+	case GitHubTargetPR, GitHubTargetPRReview:
+		index, err := resolveGiteaPullRequest(ctx, repoAPI, cfg)
+		if err != nil {
+			return 0, err
+		}
+		// Pull requests share the issue comment API
+		comment := map[string]string{"body": fmt.Sprintf("## %s\n\n%s", title, body)}
+		if err := giteaRequest(ctx, http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", repoAPI, index), comment, nil); err != nil {
+			return 0, fmt.Errorf("failed to comment on Gitea pull request: %v", err)
+		}
+		logCtx.WithField("pullRequest", index).Info("Successfully reported canary analysis on Gitea pull request")
+		return 0, nil
+	case "", GitHubTargetIssue:
+		issue := map[string]interface{}{"title": title, "body": body}
+		if len(cfg.GitHubIssue.Assignees) > 0 {
+			issue["assignees"] = cfg.GitHubIssue.Assignees
+		}
+		var created struct {
+			Number  int    `json:"number"`
+			HTMLURL string `json:"html_url"`
+		}
+		if err := giteaRequest(ctx, http.MethodPost, repoAPI+"/issues", issue, &created); err != nil {
+			return 0, fmt.Errorf("failed to create Gitea issue: %v", err)
+		}
+		logCtx.WithFields(log.Fields{
+			"issue": created.Number,
+			"url":   created.HTMLURL,
+		}).Info("Successfully created Gitea issue")
+		return created.Number, nil
+	default:
+		return 0, fmt.Errorf("unsupported githubTarget %q", cfg.GitHubTarget)
+	}
+}
+
+// resolveGiteaPullRequest returns the configured pull request index or looks up the pull request
+// the canary commit belongs to
+func resolveGiteaPullRequest(ctx context.Context, repoAPI string, cfg aiConfig) (int, error) {
+	if cfg.PRNumber != "" {
+		n, err := cfg.PRNumber.Int64()
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid prNumber %q", cfg.PRNumber)
+		}
+		return int(n), nil
+	}
+	if cfg.CommitSHA == "" {
+		return 0, fmt.Errorf("reporting on a pull request requires prNumber or commitSha")
+	}
+
+	var pr struct {
+		Number int `json:"number"`
+	}
+	if err := giteaRequest(ctx, http.MethodGet, fmt.Sprintf("%s/commits/%s/pull", repoAPI, url.PathEscape(cfg.CommitSHA)), nil, &pr); err != nil {
+		return 0, fmt.Errorf("failed to find pull request for commit %s: %v", cfg.CommitSHA, err)
+	}
+	if pr.Number == 0 {
+		return 0, fmt.Errorf("no pull request found for commit %s", cfg.CommitSHA)
+	}
+	return pr.Number, nil
+}
+
+// closeGiteaIssue comments on and closes a Gitea issue
+func closeGiteaIssue(ctx context.Context, cfg aiConfig, number int, comment string) error {
+	repoAPI, err := parseGiteaURL(cfg.GitHubURL)
+	if err != nil {
+		return err
+	}
+	issue := fmt.Sprintf("%s/issues/%d", repoAPI, number)
+	if err := giteaRequest(ctx, http.MethodPost, issue+"/comments", map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("failed to comment on Gitea issue %d: %v", number, err)
+	}
+	if err := giteaRequest(ctx, http.MethodPatch, issue, map[string]string{"state": "closed"}, nil); err != nil {
+		return fmt.Errorf("failed to close Gitea issue %d: %v", number, err)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestParseGiteaURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://gitea.example.com/acme/checkout":            "https://gitea.example.com/api/v1/repos/acme/checkout",
+		"https://git.example.com/forgejo/acme/checkout.git/": "https://git.example.com/forgejo/api/v1/repos/acme/checkout",
+	} {
+		got, err := parseGiteaURL(in)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("expected %s for %s, got %s", want, in, got)
+		}
+	}
+	if _, err := parseGiteaURL("https://gitea.example.com/checkout"); err == nil {
+		t.Error("expected an error without an owner")
+	}
+}
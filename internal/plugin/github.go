@@ -4,38 +4,186 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
 	"github.com/google/go-github/v60/github"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/genai"
 )
 
-// createCanaryFailureIssue creates a GitHub issue for canary failures
-func createCanaryFailureIssue(logsBlob, analysisText, baseBranch, githubURL, modelName string) error {
-	owner, repo, parseErr := extractOwnerRepoFromURL(githubURL)
-	if parseErr != nil {
-		return fmt.Errorf("failed to extract owner/repo from URL: %v", parseErr)
+// Git providers failures are reported to
+const (
+	GitProviderGitHub    = "github"
+	GitProviderGitLab    = "gitlab"
+	GitProviderBitbucket = "bitbucket"
+	GitProviderGitea     = "gitea"
+)
+
+// GitHub targets for canary failure reports
+const (
+	GitHubTargetIssue    = "issue"     // Open a new issue (default)
+	GitHubTargetPR       = "pr"        // Comment on the pull request of the canary
+	GitHubTargetPRReview = "pr-review" // Request changes on the pull request of the canary
+)
+
+// createCanaryFailureIssue reports a canary failure to the configured git provider,
+// as a new issue or on the canary pull request, and returns the URL of the created issue
+func createCanaryFailureIssue(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, logsBlob string, result AIAnalysisResult, cfg aiConfig, modelName string) (string, error) {
+	// Link the full logs instead of truncating them into the issue
+	var logsURL string
+	if cfg.LogsGist {
+		var err error
+		if logsURL, err = createLogsGist(ctx, analysisRun, logsBlob, cfg); err != nil {
+			log.WithContext(ctx).WithError(err).Warning("Failed to upload logs as a gist, including truncated logs in the issue")
+		}
+	}
+
+	// Agent mode opens its own pull requests with fixes
+	var fixURL string
+	if cfg.FixPullRequest && cfg.AnalysisMode != AnalysisModeAgent && analysisRun != nil {
+		var err error
+		if fixURL, err = openFixPullRequest(ctx, analysisRun, result, cfg, modelName); err != nil {
+			log.WithContext(ctx).WithError(err).Warning("Failed to open pull request with suggested fix")
+		}
+	}
+
+	// Configured templates replace the AI generated content
+	data := newIssueTemplateData(analysisRun, logsBlob, result, modelName)
+	data.LogsURL = logsURL
+	data.FixURL = fixURL
+	data.DashboardURL = renderDashboardURL(cfg, data)
+	issueTitle, issueBody, templated, err := renderIssueTemplates(ctx, cfg, data)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Warning("Failed to render issue templates, falling back to generated content")
 	}
 
+	if !templated {
+		issueTitle, issueBody = generateIssueContentWithFallback(ctx, cfg, logsBlob, logsURL, result, modelName)
+		if fixURL != "" {
+			issueBody += fmt.Sprintf("\n\n### Suggested Fix\nDraft pull request: %s", fixURL)
+		}
+		if links := issueLinks(data); links != "" {
+			issueBody += "\n\n" + links
+		}
+	}
+
+	issueNumber, err := reportToGitProvider(ctx, cfg, issueTitle, issueBody)
+	if err != nil {
+		return "", err
+	}
+	if issueNumber == 0 {
+		return "", nil
+	}
+	if cfg.AutoCloseIssues {
+		if trackErr := trackIssue(ctx, analysisRun, cfg, issueNumber); trackErr != nil {
+			log.WithContext(ctx).WithError(trackErr).Warn("Failed to track issue for auto-closing")
+		}
+	}
+	return issueURL(cfg, issueNumber), nil
+}
+
+// issueURL returns the web URL of an issue created on the configured git provider
+func issueURL(cfg aiConfig, number int) string {
+	repoURL := strings.TrimSuffix(strings.TrimSuffix(cfg.GitHubURL, "/"), ".git")
+	if cfg.GitProvider == GitProviderGitLab {
+		return fmt.Sprintf("%s/-/issues/%d", repoURL, number)
+	}
+	return fmt.Sprintf("%s/issues/%d", repoURL, number)
+}
+
+// reportCanarySuccess comments a short promotion summary on the canary pull request,
+// so successful analyses leave an audit trail next to the failure reports
+func reportCanarySuccess(ctx context.Context, cfg aiConfig, result AIAnalysisResult) error {
+	// Success is never reported as an issue or a review requesting changes
+	cfg.GitHubTarget = GitHubTargetPR
+	title := fmt.Sprintf("Canary promoted (confidence %d%%)", result.Confidence)
+	_, err := reportToGitProvider(ctx, cfg, title, result.Text)
+	return err
+}
+
+// reportToGitProvider sends a report to the configured git provider and returns the number of
+// the created issue, or 0 when reporting on a pull request
+func reportToGitProvider(ctx context.Context, cfg aiConfig, title, body string) (int, error) {
+	switch cfg.GitProvider {
+	case GitProviderGitLab:
+		return reportToGitLab(ctx, cfg, title, body)
+	case GitProviderBitbucket:
+		return reportToBitbucket(ctx, cfg, title, body)
+	case GitProviderGitea:
+		return reportToGitea(ctx, cfg, title, body)
+	case "", GitProviderGitHub:
+		return reportToGitHub(ctx, cfg, title, body)
+	default:
+		return 0, fmt.Errorf("unsupported gitProvider %q", cfg.GitProvider)
+	}
+}
+
+// closeIssue comments on and closes an issue created on the configured git provider
+func closeIssue(ctx context.Context, cfg aiConfig, number int, comment string) error {
+	switch cfg.GitProvider {
+	case GitProviderGitLab:
+		return closeGitLabIssue(ctx, cfg, number, comment)
+	case GitProviderBitbucket:
+		return closeBitbucketIssue(ctx, cfg, number, comment)
+	case GitProviderGitea:
+		return closeGiteaIssue(ctx, cfg, number, comment)
+	case "", GitProviderGitHub:
+		return closeGitHubIssue(ctx, cfg, number, comment)
+	default:
+		return fmt.Errorf("unsupported gitProvider %q", cfg.GitProvider)
+	}
+}
+
+// reportToGitHub creates a GitHub issue or reports on the canary pull request
+func reportToGitHub(ctx context.Context, cfg aiConfig, issueTitle, issueBody string) (int, error) {
+	owner, repo, err := extractOwnerRepoFromURL(cfg.GitHubURL)
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract owner/repo from URL: %v", err)
+	}
+	// GitHub API client with token from Kubernetes secret
+	client, err := newGitHubClient(ctx, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	switch cfg.GitHubTarget {
+	case GitHubTargetPR, GitHubTargetPRReview:
+		prNumber, err := resolvePullRequestNumber(ctx, client, owner, repo, cfg.PRNumber, cfg.CommitSHA)
+		if err != nil {
+			return 0, err
+		}
+		return 0, commentOnPullRequest(ctx, client, owner, repo, prNumber, issueTitle, issueBody, cfg.GitHubTarget == GitHubTargetPRReview)
+	case "", GitHubTargetIssue:
+		return createGitHubIssue(ctx, client, owner, repo, issueTitle, issueBody, cfg.GitHubIssue)
+	default:
+		return 0, fmt.Errorf("unsupported githubTarget %q", cfg.GitHubTarget)
+	}
+}
+
+// generateIssueContentWithFallback generates the issue title and body with AI, falling back to a default format.
+// When logsURL is set, the body links the full logs.
+func generateIssueContentWithFallback(ctx context.Context, cfg aiConfig, logsBlob, logsURL string, result AIAnalysisResult, modelName string) (string, string) {
 	// Try to generate issue content with AI (with retries)
 	var issueTitle, issueBody string
 	var err error
 	maxRetries := 3
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		issueTitle, issueBody, err = generateIssueContent(logsBlob, analysisText, baseBranch, modelName)
+		issueTitle, issueBody, err = generateIssueContent(ctx, cfg, logsBlob, formatAnalysisText(result), modelName)
 		if err == nil && issueTitle != "" {
-			log.WithField("attempt", attempt).Info("Successfully generated issue content with AI")
+			log.WithContext(ctx).WithField("attempt", attempt).Info("Successfully generated issue content with AI")
 			break
 		}
 		if attempt < maxRetries {
 			if err != nil {
-				log.WithFields(log.Fields{
+				log.WithContext(ctx).WithFields(log.Fields{
 					"attempt": attempt,
 					"error":   err,
 				}).Warning("Failed to generate issue content with AI, retrying...")
 			} else {
-				log.WithField("attempt", attempt).Warning("AI generated empty issue title, retrying...")
+				log.WithContext(ctx).WithField("attempt", attempt).Warning("AI generated empty issue title, retrying...")
 			}
 		}
 	}
@@ -43,30 +191,66 @@ func createCanaryFailureIssue(logsBlob, analysisText, baseBranch, githubURL, mod
 	// Fall back to default if all retries failed
 	if err != nil || issueTitle == "" {
 		if err != nil {
-			log.WithError(err).Warning("Failed to generate issue content with AI after retries, using fallback")
+			log.WithContext(ctx).WithError(err).Warning("Failed to generate issue content with AI after retries, using fallback")
 		} else {
 			log.Warning("AI generated empty issue title after retries, using fallback")
 		}
 		issueTitle = "🚨 Canary Deployment Failed - AI Analysis Required"
-		issueBody = generateFallbackIssueBody(logsBlob, analysisText)
+		return issueTitle, generateFallbackIssueBody(logsBlob, logsURL, result)
 	}
+	if logsURL != "" {
+		issueBody += fmt.Sprintf("\n\n### Logs\n[Full stable and canary logs](%s)", logsURL)
+	}
+	return issueTitle, issueBody
+}
+
+// newGitHubClient creates a GitHub client authenticated with the GitHub token of the metric, using the
+// GitHub Enterprise Server API of the repository when it is not hosted on github.com
+func newGitHubClient(ctx context.Context, cfg aiConfig) (*github.Client, error) {
+	githubToken, err := githubTokenFor(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Rate limited requests are retried like Gemini API calls
+	httpClient := &http.Client{Transport: &rateLimitTransport{base: outboundTransport}}
+	client := github.NewClient(httpClient).WithAuthToken(githubToken)
 
-	// Create issue using GitHub API with token from Kubernetes secret
-	return createGitHubIssue(owner, repo, issueTitle, issueBody)
+	apiURL := githubAPIURL(cfg)
+	if apiURL == "" {
+		return client, nil
+	}
+	uploadURL := strings.TrimSuffix(strings.TrimSuffix(apiURL, "/"), "/api/v3")
+	client, err = client.WithEnterpriseURLs(apiURL, uploadURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub API URL %s: %v", apiURL, err)
+	}
+	return client, nil
+}
+
+// githubAPIURL returns the configured GitHub API base URL or, for repositories not hosted on github.com,
+// the GitHub Enterprise Server API of the repository host. It is empty for github.com.
+func githubAPIURL(cfg aiConfig) string {
+	if cfg.GitHubAPIURL != "" {
+		return cfg.GitHubAPIURL
+	}
+	u, err := url.Parse(cfg.GitHubURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	if host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."); host == "github.com" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/api/v3/"
 }
 
 // generateIssueContent generates GitHub issue content using AI
-func generateIssueContent(logsBlob, analysisText, baseBranch, modelName string) (string, string, error) {
-	apiKey, err := getSecretValue("argo-rollouts", "google_api_key")
+func generateIssueContent(ctx context.Context, cfg aiConfig, logsBlob, analysisText, modelName string) (string, string, error) {
+	apiKey, err := googleAPIKeyFor(ctx, cfg)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get Google API key from secret: %v", err)
+		return "", "", err
 	}
-	ctx := context.Background()
 
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  apiKey,
-		Backend: genai.BackendGeminiAPI,
-	})
+	client, err := getGenAIClient(ctx, apiKey)
 	if err != nil {
 		return "", "", err
 	}
@@ -111,22 +295,46 @@ func generateIssueContent(logsBlob, analysisText, baseBranch, modelName string)
 	return result.Title, result.Body, nil
 }
 
-// generateFallbackIssueBody generates a fallback issue body when AI generation fails
-func generateFallbackIssueBody(logsBlob, analysisText string) string {
+// formatAnalysisText combines the analysis text with the root cause and remediation, if any
+func formatAnalysisText(result AIAnalysisResult) string {
+	text := result.Text
+	if result.RootCause != "" {
+		text += "\n\nRoot cause: " + result.RootCause
+	}
+	if result.Remediation != "" {
+		text += "\n\nRemediation: " + result.Remediation
+	}
+	return text
+}
+
+// generateFallbackIssueBody generates a fallback issue body when AI generation fails,
+// linking logsURL when set instead of including the truncated logs
+func generateFallbackIssueBody(logsBlob, logsURL string, result AIAnalysisResult) string {
+	rootCause := result.RootCause
+	if rootCause == "" {
+		rootCause = "_Not determined_"
+	}
+	remediation := result.Remediation
+	if remediation == "" {
+		remediation = "_Not determined_"
+	}
+	logs := fmt.Sprintf("<details>\n<summary>Click to view logs</summary>\n\n```\n%s\n```\n\n</details>", truncate(logsBlob, 10000))
+	if logsURL != "" {
+		logs = fmt.Sprintf("[Full stable and canary logs](%s)", logsURL)
+	}
 	return fmt.Sprintf(`## 🚨 Canary Deployment Failure
 
 ### Analysis
 %s
 
-### Logs
-<details>
-<summary>Click to view logs</summary>
+### Root Cause
+%s
 
-`+"```"+`
+### Remediation
 %s
-`+"```"+`
 
-</details>
+### Logs
+%s
 
 ### Next Steps
 1. Review the analysis above
@@ -135,7 +343,7 @@ func generateFallbackIssueBody(logsBlob, analysisText string) string {
 4. Investigate the root cause before retrying
 
 ---
-*This issue was automatically generated by the Argo Rollouts AI Metric Plugin*`, analysisText, truncate(logsBlob, 10000))
+*This issue was automatically generated by the Argo Rollouts AI Metric Plugin*`, result.Text, rootCause, remediation, logs)
 }
 
 // extractOwnerRepoFromURL extracts owner and repository from GitHub URL
@@ -161,73 +369,103 @@ func extractOwnerRepoFromURL(githubURL string) (string, string, error) {
 }
 
 // createGitHubIssue creates a GitHub issue using the API
-func createGitHubIssue(owner, repo, title, body string) error {
-	githubToken, err := getSecretValue("argo-rollouts", "github_token")
-	if err != nil {
-		return fmt.Errorf("failed to get GitHub token from secret: %v", err)
-	}
-
-	ctx := context.Background()
-	client := github.NewClient(nil).WithAuthToken(githubToken)
-
+func createGitHubIssue(ctx context.Context, client *github.Client, owner, repo, title, body string, issueCfg githubIssueConfig) (int, error) {
 	// First create the issue without assignment
-	julesLabel := "jules"
+	labels := issueCfg.Labels
+	if len(labels) == 0 {
+		labels = []string{defaultIssueLabel}
+	}
 	issue := &github.IssueRequest{
 		Title:  &title,
 		Body:   &body,
-		Labels: &[]string{julesLabel},
+		Labels: &labels,
 	}
 
-	log.WithFields(log.Fields{
-		"owner": owner,
-		"repo":  repo,
-		"title": title,
-		"label": julesLabel,
+	log.WithContext(ctx).WithFields(log.Fields{
+		"owner":  owner,
+		"repo":   repo,
+		"title":  title,
+		"labels": labels,
 	}).Info("Creating GitHub issue")
 
 	createdIssue, _, err := client.Issues.Create(ctx, owner, repo, issue)
 	if err != nil {
-		return fmt.Errorf("failed to create GitHub issue: %v", err)
+		return 0, fmt.Errorf("failed to create GitHub issue: %w", err)
 	}
 
 	issueNumber := createdIssue.GetNumber()
-	log.WithFields(log.Fields{
+	log.WithContext(ctx).WithFields(log.Fields{
 		"owner":       owner,
 		"repo":        repo,
 		"title":       title,
 		"issueNumber": issueNumber,
-		"label":       julesLabel,
+		"labels":      labels,
 	}).Info("Successfully created GitHub issue")
 
-	// Now try to assign to copilot-swe-agent (with error handling that doesn't fail)
-	copilotAssignee := "copilot-swe-agent"
-	assignErr := assignIssueToCopilot(ctx, client, owner, repo, issueNumber, copilotAssignee)
+	// Now try to assign to the owning team, or copilot-swe-agent by default (with error handling that doesn't fail)
+	assignees := issueCfg.Assignees
+	if len(assignees) == 0 {
+		assignees = []string{defaultIssueAssignee}
+	}
+	assignErr := assignIssue(ctx, client, owner, repo, issueNumber, assignees)
 	if assignErr != nil {
-		log.WithFields(log.Fields{
+		log.WithContext(ctx).WithFields(log.Fields{
 			"owner":       owner,
 			"repo":        repo,
 			"issueNumber": issueNumber,
-			"assignee":    copilotAssignee,
+			"assignees":   assignees,
 			"error":       assignErr,
-		}).Warn("Failed to assign issue to copilot-swe-agent, but issue was created successfully")
+		}).Warn("Failed to assign issue, but issue was created successfully")
 	} else {
-		log.WithFields(log.Fields{
+		log.WithContext(ctx).WithFields(log.Fields{
 			"owner":       owner,
 			"repo":        repo,
 			"issueNumber": issueNumber,
-			"assignee":    copilotAssignee,
-		}).Info("Successfully assigned issue to copilot-swe-agent")
+			"assignees":   assignees,
+		}).Info("Successfully assigned issue")
 	}
 
+	if issueCfg.Project != "" {
+		if projectErr := addIssueToProject(ctx, client, issueCfg.Project, createdIssue.GetNodeID()); projectErr != nil {
+			log.WithContext(ctx).WithFields(log.Fields{
+				"issueNumber": issueNumber,
+				"project":     issueCfg.Project,
+				"error":       projectErr,
+			}).Warn("Failed to add issue to project, but issue was created successfully")
+		}
+	}
+
+	return issueNumber, nil
+}
+
+// closeGitHubIssue comments on and closes a GitHub issue
+func closeGitHubIssue(ctx context.Context, cfg aiConfig, issueNumber int, comment string) error {
+	owner, repo, err := extractOwnerRepoFromURL(cfg.GitHubURL)
+	if err != nil {
+		return fmt.Errorf("failed to extract owner/repo from URL: %v", err)
+	}
+	client, err := newGitHubClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if _, _, err := client.Issues.CreateComment(ctx, owner, repo, issueNumber, &github.IssueComment{Body: &comment}); err != nil {
+		return fmt.Errorf("failed to comment on issue #%d: %v", issueNumber, err)
+	}
+	if _, _, err := client.Issues.Edit(ctx, owner, repo, issueNumber, &github.IssueRequest{
+		State:       github.String("closed"),
+		StateReason: github.String("completed"),
+	}); err != nil {
+		return fmt.Errorf("failed to close issue #%d: %v", issueNumber, err)
+	}
 	return nil
 }
 
-// assignIssueToCopilot assigns an issue to copilot-swe-agent
-func assignIssueToCopilot(ctx context.Context, client *github.Client, owner, repo string, issueNumber int, assignee string) error {
+// assignIssue assigns an issue to the given users
+func assignIssue(ctx context.Context, client *github.Client, owner, repo string, issueNumber int, assignees []string) error {
 	// Try to assign the issue
-	_, _, err := client.Issues.AddAssignees(ctx, owner, repo, issueNumber, []string{assignee})
+	_, _, err := client.Issues.AddAssignees(ctx, owner, repo, issueNumber, assignees)
 	if err != nil {
-		return fmt.Errorf("failed to assign issue to %s: %v", assignee, err)
+		return fmt.Errorf("failed to assign issue to %s: %v", strings.Join(assignees, ", "), err)
 	}
 	return nil
 }
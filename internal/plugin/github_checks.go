@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/google/go-github/v60/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultCheckName is the name of the check run published on the canary commit
+const defaultCheckName = "argo-rollouts/metric-ai"
+
+// maxCheckSummaryLength is the GitHub limit for check run output summaries
+const maxCheckSummaryLength = 65535
+
+// checkRunConclusion maps a measurement phase to a check run conclusion
+func checkRunConclusion(phase v1alpha1.AnalysisPhase) string {
+	switch phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		return "success"
+	case v1alpha1.AnalysisPhaseFailed:
+		return "failure"
+	default:
+		return "neutral"
+	}
+}
+
+// publishCheckRun publishes the AI verdict as a completed check run on the canary commit,
+// so the deployment decision shows up in the pull request checks
+func publishCheckRun(ctx context.Context, cfg aiConfig, analysisRun *v1alpha1.AnalysisRun, phase v1alpha1.AnalysisPhase, result AIAnalysisResult) error {
+	owner, repo, err := extractOwnerRepoFromURL(cfg.GitHubURL)
+	if err != nil {
+		return fmt.Errorf("failed to extract owner/repo from URL: %v", err)
+	}
+	if cfg.CommitSHA == "" {
+		return fmt.Errorf("publishing a check run requires commitSha")
+	}
+	client, err := newGitHubClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	headSHA, err := fullCommitSHA(ctx, client, owner, repo, cfg.CommitSHA)
+	if err != nil {
+		return err
+	}
+
+	name := cfg.GitHubCheckName
+	if name == "" {
+		name = defaultCheckName
+	}
+	title := fmt.Sprintf("Canary promotion not recommended (confidence %d%%)", result.Confidence)
+	if phase == v1alpha1.AnalysisPhaseSuccessful {
+		title = fmt.Sprintf("Canary promotion recommended (confidence %d%%)", result.Confidence)
+	}
+	summary := truncate(formatAnalysisText(result), maxCheckSummaryLength-3)
+	conclusion := checkRunConclusion(phase)
+	status := "completed"
+
+	_, _, err = client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+		Name:       name,
+		HeadSHA:    headSHA,
+		ExternalID: github.String(string(analysisRun.UID)),
+		Status:     &status,
+		Conclusion: &conclusion,
+		Output: &github.CheckRunOutput{
+			Title:   &title,
+			Summary: &summary,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create check run: %w", err)
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"owner":      owner,
+		"repo":       repo,
+		"commitSha":  cfg.CommitSHA,
+		"conclusion": conclusion,
+	}).Info("Published AI verdict as GitHub check run")
+	return nil
+}
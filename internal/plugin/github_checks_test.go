@@ -0,0 +1,19 @@
+package plugin
+
+import (
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestCheckRunConclusion(t *testing.T) {
+	for phase, want := range map[v1alpha1.AnalysisPhase]string{
+		v1alpha1.AnalysisPhaseSuccessful:   "success",
+		v1alpha1.AnalysisPhaseFailed:       "failure",
+		v1alpha1.AnalysisPhaseInconclusive: "neutral",
+	} {
+		if got := checkRunConclusion(phase); got != want {
+			t.Errorf("expected conclusion %q for phase %s, got %q", want, phase, got)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v60/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// resolvePullRequestNumber returns the configured pull request number or looks up the pull request
+// containing the canary commit, preferring open pull requests
+func resolvePullRequestNumber(ctx context.Context, client *github.Client, owner, repo string, prNumber json.Number, commitSHA string) (int, error) {
+	if prNumber != "" {
+		n, err := prNumber.Int64()
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid prNumber %q", prNumber)
+		}
+		return int(n), nil
+	}
+	if commitSHA == "" {
+		return 0, fmt.Errorf("reporting on a pull request requires prNumber or commitSha")
+	}
+
+	prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, owner, repo, commitSHA, &github.ListOptions{PerPage: 20})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find pull requests for commit %s: %w", commitSHA, err)
+	}
+	if len(prs) == 0 {
+		return 0, fmt.Errorf("no pull request found for commit %s", commitSHA)
+	}
+	for _, pr := range prs {
+		if pr.GetState() == "open" {
+			return pr.GetNumber(), nil
+		}
+	}
+	return prs[0].GetNumber(), nil
+}
+
+// commentOnPullRequest posts the canary analysis on a pull request, as a comment
+// or as a review requesting changes
+func commentOnPullRequest(ctx context.Context, client *github.Client, owner, repo string, prNumber int, title, body string, review bool) error {
+	comment := fmt.Sprintf("## %s\n\n%s", title, body)
+
+	logCtx := log.WithContext(ctx).WithFields(log.Fields{
+		"owner":    owner,
+		"repo":     repo,
+		"prNumber": prNumber,
+		"review":   review,
+	})
+	logCtx.Info("Reporting canary analysis on pull request")
+
+	if review {
+		event := "REQUEST_CHANGES"
+		_, _, err := client.PullRequests.CreateReview(ctx, owner, repo, prNumber, &github.PullRequestReviewRequest{
+			Body:  &comment,
+			Event: &event,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create pull request review: %w", err)
+		}
+	} else {
+		_, _, err := client.Issues.CreateComment(ctx, owner, repo, prNumber, &github.IssueComment{Body: &comment})
+		if err != nil {
+			return fmt.Errorf("failed to comment on pull request: %w", err)
+		}
+	}
+
+	logCtx.Info("Successfully reported canary analysis on pull request")
+	return nil
+}
+
+// parsePullRequestURL returns the owner, repository and number of a GitHub pull request URL, e.g.
+// https://github.com/argoproj/argo-rollouts/pull/42
+func parsePullRequestURL(prURL string) (string, string, int, error) {
+	u, err := url.Parse(prURL)
+	if err != nil || u.Host == "" {
+		return "", "", 0, fmt.Errorf("invalid pull request URL %q", prURL)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 4 || parts[len(parts)-2] != "pull" {
+		return "", "", 0, fmt.Errorf("not a GitHub pull request URL: %s", prURL)
+	}
+	number, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil || number <= 0 {
+		return "", "", 0, fmt.Errorf("invalid pull request number in %s", prURL)
+	}
+	return parts[len(parts)-4], parts[len(parts)-3], number, nil
+}
+
+// labelPullRequest adds a label to a pull request, such as the approval label of pull requests opened
+// by the Kubernetes Agent
+func labelPullRequest(ctx context.Context, cfg aiConfig, prURL, label string) error {
+	owner, repo, number, err := parsePullRequestURL(prURL)
+	if err != nil {
+		return err
+	}
+	client, err := newGitHubClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	log.WithContext(ctx).WithFields(log.Fields{
+		"owner":    owner,
+		"repo":     repo,
+		"prNumber": number,
+		"label":    label,
+	}).Info("Labeling pull request")
+	if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, number, []string{label}); err != nil {
+		return fmt.Errorf("failed to label pull request %s: %w", prURL, err)
+	}
+	return nil
+}
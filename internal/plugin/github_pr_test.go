@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/argoproj-labs/rollouts-plugin-metric-ai/internal/agentpb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestResolvePullRequestNumber(t *testing.T) {
+	n, err := resolvePullRequestNumber(context.Background(), nil, "owner", "repo", json.Number("42"), "")
+	if err != nil || n != 42 {
+		t.Fatalf("expected configured pull request 42, got %d (%v)", n, err)
+	}
+	if _, err := resolvePullRequestNumber(context.Background(), nil, "owner", "repo", json.Number("-1"), ""); err == nil {
+		t.Error("expected an error for an invalid pull request number")
+	}
+	if _, err := resolvePullRequestNumber(context.Background(), nil, "owner", "repo", "", ""); err == nil {
+		t.Error("expected an error without pull request number or commit")
+	}
+}
+
+func TestAgentPullRequestPolicy(t *testing.T) {
+	owner, repo, number, err := parsePullRequestURL("https://github.com/acme/checkout/pull/42")
+	if err != nil || owner != "acme" || repo != "checkout" || number != 42 {
+		t.Errorf("unexpected pull request %s/%s#%d, error: %v", owner, repo, number, err)
+	}
+	for _, prURL := range []string{"", "https://github.com/acme/checkout", "https://github.com/acme/checkout/issues/42", "https://github.com/acme/checkout/pull/abc"} {
+		if _, _, _, err := parsePullRequestURL(prURL); err == nil {
+			t.Errorf("expected an error for %q", prURL)
+		}
+	}
+
+	req := newA2ARequest("shop", "checkout-abc", "", "", A2ARolloutContext{NoPullRequests: true})
+	if req.Context["allowPullRequests"] != false || !strings.Contains(req.Prompt, "Do not open pull requests.") {
+		t.Errorf("expected the agent to be asked not to open pull requests, got %q and %v", req.Prompt, req.Context)
+	}
+	if _, ok := newA2ARequest("shop", "checkout-abc", "", "", A2ARolloutContext{}).Context["allowPullRequests"]; ok {
+		t.Error("expected no allowPullRequests by default")
+	}
+
+	data, err := proto.Marshal(newAgentAnalyzeRequest("", "", "", "", "", A2ARolloutContext{NoPullRequests: true}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded agentpb.AnalyzeRequest
+	if err := proto.Unmarshal(data, &decoded); err != nil || !decoded.GetNoPullRequests() {
+		t.Errorf("expected no_pull_requests to be encoded, got %v, %v", &decoded, err)
+	}
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v60/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults applied to created issues when githubIssue does not override them
+const (
+	defaultIssueLabel    = "jules"
+	defaultIssueAssignee = "copilot-swe-agent"
+)
+
+// githubIssueConfig routes created issues to the owning team
+type githubIssueConfig struct {
+	// Labels of created issues (default: jules)
+	Labels []string `json:"labels,omitempty"`
+	// Users assigned to created issues (default: copilot-swe-agent)
+	Assignees []string `json:"assignees,omitempty"`
+	// Node ID of the GitHub project (v2) created issues are added to, e.g. PVT_kwDOA...
+	Project string `json:"project,omitempty"`
+}
+
+// addProjectItemMutation adds an issue or pull request to a GitHub project (v2)
+const addProjectItemMutation = `mutation($project: ID!, $content: ID!) {
+  addProjectV2ItemById(input: {projectId: $project, contentId: $content}) { item { id } }
+}`
+
+// graphQLResponse is the envelope of GitHub GraphQL responses
+type graphQLResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// addIssueToProject adds an issue to a GitHub project (v2) through the GraphQL API
+func addIssueToProject(ctx context.Context, client *github.Client, projectID, issueNodeID string) error {
+	if issueNodeID == "" {
+		return fmt.Errorf("issue has no node ID")
+	}
+	// GitHub Enterprise Server serves GraphQL at /api/graphql, next to the /api/v3 REST API
+	endpoint := "graphql"
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		endpoint = "../graphql"
+	}
+	req, err := client.NewRequest("POST", endpoint, map[string]interface{}{
+		"query": addProjectItemMutation,
+		"variables": map[string]string{
+			"project": projectID,
+			"content": issueNodeID,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create GraphQL request: %v", err)
+	}
+	var resp graphQLResponse
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return fmt.Errorf("failed to add issue to project %s: %v", projectID, err)
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("failed to add issue to project %s: %s", projectID, resp.Errors[0].Message)
+	}
+	log.WithContext(ctx).WithField("project", projectID).Info("Added issue to GitHub project")
+	return nil
+}
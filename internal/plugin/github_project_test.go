@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v60/github"
+)
+
+func TestAddIssueToProject(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		if got["variables"].(map[string]interface{})["project"] == "PVT_missing" {
+			_, _ = w.Write([]byte(`{"errors":[{"message":"project not found"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"addProjectV2ItemById":{"item":{"id":"PVTI_1"}}}}`))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	if err := addIssueToProject(context.Background(), client, "PVT_1", "I_1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vars := got["variables"].(map[string]interface{}); vars["project"] != "PVT_1" || vars["content"] != "I_1" {
+		t.Errorf("unexpected GraphQL variables %v", vars)
+	}
+	if err := addIssueToProject(context.Background(), client, "PVT_missing", "I_1"); err == nil || !strings.Contains(err.Error(), "project not found") {
+		t.Errorf("expected the GraphQL error to be returned, got %v", err)
+	}
+}
+
+func TestAddIssueToProjectEnterprise(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_, _ = w.Write([]byte(`{"data":{}}`))
+	}))
+	defer server.Close()
+
+	client, err := github.NewClient(server.Client()).WithEnterpriseURLs(server.URL, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := addIssueToProject(context.Background(), client, "PVT_1", "I_1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "/api/graphql" {
+		t.Errorf("expected the GitHub Enterprise GraphQL endpoint, got %s", path)
+	}
+}
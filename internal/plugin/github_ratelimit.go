@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v5"
+	"github.com/google/go-github/v60/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Limits of retrying rate limited GitHub requests. Requests whose limit resets later are not
+// retried and fail with the rate limit error.
+var (
+	githubMaxRetryWait = 60 * time.Second
+	githubMaxTries     = uint(4)
+)
+
+// errGitHubRateLimited is retried with exponential backoff when GitHub gives no wait time
+var errGitHubRateLimited = errors.New("github rate limit exceeded")
+
+// rateLimitTransport retries GitHub requests hitting the primary or secondary rate limits,
+// honoring the wait times given by GitHub and backing off exponentially otherwise
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	backoffConfig := backoff.NewExponentialBackOff()
+	backoffConfig.InitialInterval = 1 * time.Second
+	backoffConfig.MaxInterval = githubMaxRetryWait
+	backoffConfig.Multiplier = 2.0
+	backoffConfig.RandomizationFactor = 0.1
+
+	attempt := uint(0)
+	operation := func() (*http.Response, error) {
+		attempt++
+		r := req
+		if attempt > 1 {
+			r = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, backoff.Permanent(err)
+				}
+				r.Body = body
+			}
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if err != nil {
+			return nil, backoff.Permanent(err)
+		}
+		wait, limited := githubRateLimitWait(resp, time.Now())
+		if !limited {
+			return resp, nil
+		}
+		// Let the client report the rate limit when waiting is not worth it
+		if attempt >= githubMaxTries || wait > githubMaxRetryWait {
+			return resp, nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, nil
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		log.WithFields(log.Fields{
+			"attempt": attempt,
+			"url":     req.URL.Path,
+			"wait":    wait,
+		}).Warn("GitHub rate limit exceeded, retrying")
+		if wait >= 0 {
+			return nil, &backoff.RetryAfterError{Duration: wait}
+		}
+		return nil, errGitHubRateLimited
+	}
+
+	return backoff.Retry(ctx, operation, backoff.WithBackOff(backoffConfig), backoff.WithMaxTries(githubMaxTries))
+}
+
+// githubRateLimitWait reports whether a response hit a GitHub rate limit and how long to wait before
+// retrying, or a negative duration when GitHub gives no wait time
+func githubRateLimitWait(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	// Secondary rate limits
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if seconds, err := strconv.Atoi(s); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	// Primary rate limit
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			wait := time.Unix(reset, 0).Sub(now) + time.Second
+			if wait < 0 {
+				wait = 0
+			}
+			return wait, true
+		}
+		return -1, true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return -1, true
+	}
+
+	// Secondary rate limits without Retry-After are only told apart from permission errors by the message
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err == nil && strings.Contains(strings.ToLower(string(body)), "rate limit") {
+		return -1, true
+	}
+	return 0, false
+}
+
+// githubRateLimitReset returns when a GitHub rate limit error allows requests again
+func githubRateLimitReset(err error, now time.Time) (time.Time, bool) {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return rateErr.Rate.Reset.Time, true
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return now.Add(abuseErr.GetRetryAfter()), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v60/github"
+)
+
+func TestGitHubRateLimitWait(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		name    string
+		status  int
+		headers map[string]string
+		body    string
+		wait    time.Duration
+		limited bool
+	}{
+		{"success", http.StatusOK, nil, "", 0, false},
+		{"secondary", http.StatusForbidden, map[string]string{"Retry-After": "30"}, "", 30 * time.Second, true},
+		{"primary", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000010"}, "", 11 * time.Second, true},
+		{"too many requests", http.StatusTooManyRequests, nil, "", -1, true},
+		{"secondary message", http.StatusForbidden, nil, `{"message":"You have exceeded a secondary rate limit"}`, -1, true},
+		{"permission", http.StatusForbidden, nil, `{"message":"Resource not accessible by integration"}`, 0, false},
+	} {
+		resp := &http.Response{StatusCode: tc.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(tc.body))}
+		for k, v := range tc.headers {
+			resp.Header.Set(k, v)
+		}
+		wait, limited := githubRateLimitWait(resp, now)
+		if wait != tc.wait || limited != tc.limited {
+			t.Errorf("%s: expected %v, %t, got %v, %t", tc.name, tc.wait, tc.limited, wait, limited)
+		}
+		if body, _ := io.ReadAll(resp.Body); string(body) != tc.body {
+			t.Errorf("%s: expected the body to be kept, got %q", tc.name, body)
+		}
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	var titles []string
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var issue github.IssueRequest
+		_ = json.NewDecoder(r.Body).Decode(&issue)
+		titles = append(titles, issue.GetTitle())
+		switch {
+		case issue.GetTitle() == "exhausted":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+		case len(titles) == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message":"You have exceeded a secondary rate limit"}`))
+		default:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"number":1}`))
+		}
+	}))
+	defer server.Close()
+
+	client := github.NewClient(&http.Client{Transport: &rateLimitTransport{base: http.DefaultTransport}})
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	issue, _, err := client.Issues.Create(context.Background(), "acme", "checkout", &github.IssueRequest{Title: github.String("canary failed")})
+	if err != nil || issue.GetNumber() != 1 {
+		t.Fatalf("expected the request to be retried, got %v", err)
+	}
+	if len(titles) != 2 || titles[1] != "canary failed" {
+		t.Errorf("expected the request body to be sent again, got %v", titles)
+	}
+
+	// A limit resetting later than githubMaxRetryWait fails right away
+	titles = nil
+	_, _, err = client.Issues.Create(context.Background(), "acme", "checkout", &github.IssueRequest{Title: github.String("exhausted")})
+	if len(titles) != 1 {
+		t.Errorf("expected no retry, got %d requests", len(titles))
+	}
+	got, ok := githubRateLimitReset(fmt.Errorf("failed to create GitHub issue: %w", err), time.Now())
+	if !ok || got.Unix() != reset {
+		t.Errorf("expected the rate limit reset %d, got %v, %t", reset, got, ok)
+	}
+}
@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateFallbackIssueBody(t *testing.T) {
+	body := generateFallbackIssueBody("some logs", "", AIAnalysisResult{
+		Text:        "canary is bad",
+		RootCause:   "nil pointer in handler",
+		Remediation: "check for nil before use",
+	})
+	for _, want := range []string{"canary is bad", "nil pointer in handler", "check for nil before use", "some logs"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected issue body to contain %q", want)
+		}
+	}
+}
+
+func TestGenerateFallbackIssueBodyLinksLogs(t *testing.T) {
+	body := generateFallbackIssueBody("some logs", "https://gist.github.com/abc", AIAnalysisResult{Text: "canary is bad"})
+	if !strings.Contains(body, "(https://gist.github.com/abc)") || strings.Contains(body, "some logs") {
+		t.Errorf("expected the logs to be linked instead of included, got %q", body)
+	}
+}
+
+func TestGitHubAPIURL(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  aiConfig
+		want string
+	}{
+		{aiConfig{GitHubURL: "https://github.com/acme/checkout"}, ""},
+		{aiConfig{GitHubURL: "https://www.github.com/acme/checkout"}, ""},
+		{aiConfig{GitHubURL: "acme/checkout"}, ""},
+		{aiConfig{GitHubURL: "https://ghe.example.com/acme/checkout"}, "https://ghe.example.com/api/v3/"},
+		{aiConfig{GitHubURL: "https://ghe.example.com/acme/checkout", GitHubAPIURL: "https://api.ghe.example.com"}, "https://api.ghe.example.com"},
+	} {
+		if got := githubAPIURL(tc.cfg); got != tc.want {
+			t.Errorf("expected %q for %+v, got %q", tc.want, tc.cfg, got)
+		}
+	}
+}
+
+func TestIssueURL(t *testing.T) {
+	if got := issueURL(aiConfig{GitHubURL: "https://github.com/acme/checkout.git"}, 7); got != "https://github.com/acme/checkout/issues/7" {
+		t.Errorf("unexpected GitHub issue URL %s", got)
+	}
+	if got := issueURL(aiConfig{GitHubURL: "https://gitlab.com/acme/checkout/", GitProvider: GitProviderGitLab}, 7); got != "https://gitlab.com/acme/checkout/-/issues/7" {
+		t.Errorf("unexpected GitLab issue URL %s", got)
+	}
+}
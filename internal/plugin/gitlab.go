@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// parseGitLabURL splits a GitLab repository URL into the instance base URL and the project path,
+// which may include subgroups, e.g. https://gitlab.com/group/subgroup/project
+func parseGitLabURL(repoURL string) (string, string, error) {
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid GitLab URL format: %s", repoURL)
+	}
+	path := strings.Trim(u.Path, "/")
+	// Drop UI suffixes such as /-/merge_requests
+	if i := strings.Index(path, "/-/"); i >= 0 {
+		path = path[:i]
+	}
+	if strings.Count(path, "/") < 1 {
+		return "", "", fmt.Errorf("could not extract project path from URL: %s", repoURL)
+	}
+	return u.Scheme + "://" + u.Host, path, nil
+}
+
+// gitlabRequest calls the GitLab REST API v4 with the token from the Kubernetes secret
+func gitlabRequest(ctx context.Context, method, baseURL, path string, body, out interface{}) error {
+	token, err := getSecretValue("gitlab_token")
+	if err != nil {
+		return fmt.Errorf("failed to get GitLab token from secret: %v", err)
+	}
+	return gitAPIRequest(ctx, method, baseURL+"/api/v4"+path, func(req *http.Request) {
+		req.Header.Set("PRIVATE-TOKEN", token)
+	}, body, out)
+}
+
+// reportToGitLab creates a GitLab issue or adds a note to the canary merge request
+func reportToGitLab(ctx context.Context, cfg aiConfig, title, body string) (int, error) {
+	baseURL, projectPath, err := parseGitLabURL(cfg.GitHubURL)
+	if err != nil {
+		return 0, err
+	}
+	project := "/projects/" + url.PathEscape(projectPath)
+	logCtx := log.WithContext(ctx).WithFields(log.Fields{
+		"gitlab":  baseURL,
+		"project": projectPath,
+	})
+
+	switch cfg.GitHubTarget {
+	case GitHubTargetPR, GitHubTargetPRReview:
+		iid, err := resolveMergeRequestIID(ctx, baseURL, project, cfg.PRNumber, cfg.CommitSHA)
+		if err != nil {
+			return 0, err
+		}
+		note := map[string]string{"body": fmt.Sprintf("## %s\n\n%s", title, body)}
+		if err := gitlabRequest(ctx, http.MethodPost, baseURL, fmt.Sprintf("%s/merge_requests/%d/notes", project, iid), note, nil); err != nil {
+			return 0, fmt.Errorf("failed to comment on merge request: %v", err)
+		}
+		logCtx.WithField("mergeRequest", iid).Info("Successfully reported canary analysis on GitLab merge request")
+		return 0, nil
+	case "", GitHubTargetIssue:
+		issue := map[string]string{"title": title, "description": body}
+		if len(cfg.GitHubIssue.Labels) > 0 {
+			issue["labels"] = strings.Join(cfg.GitHubIssue.Labels, ",")
+		}
+		var created struct {
+			IID    int    `json:"iid"`
+			WebURL string `json:"web_url"`
+		}
+		if err := gitlabRequest(ctx, http.MethodPost, baseURL, project+"/issues", issue, &created); err != nil {
+			return 0, fmt.Errorf("failed to create GitLab issue: %v", err)
+		}
+		logCtx.WithFields(log.Fields{
+			"issue": created.IID,
+			"url":   created.WebURL,
+		}).Info("Successfully created GitLab issue")
+		return created.IID, nil
+	default:
+		return 0, fmt.Errorf("unsupported githubTarget %q", cfg.GitHubTarget)
+	}
+}
+
+// resolveMergeRequestIID returns the configured merge request IID or looks up the merge request
+// containing the canary commit, preferring open merge requests
+func resolveMergeRequestIID(ctx context.Context, baseURL, project string, prNumber json.Number, commitSHA string) (int, error) {
+	if prNumber != "" {
+		n, err := prNumber.Int64()
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid prNumber %q", prNumber)
+		}
+		return int(n), nil
+	}
+	if commitSHA == "" {
+		return 0, fmt.Errorf("reporting on a merge request requires prNumber or commitSha")
+	}
+
+	var mrs []struct {
+		IID   int    `json:"iid"`
+		State string `json:"state"`
+	}
+	path := fmt.Sprintf("%s/repository/commits/%s/merge_requests", project, url.PathEscape(commitSHA))
+	if err := gitlabRequest(ctx, http.MethodGet, baseURL, path, nil, &mrs); err != nil {
+		return 0, fmt.Errorf("failed to find merge requests for commit %s: %v", commitSHA, err)
+	}
+	if len(mrs) == 0 {
+		return 0, fmt.Errorf("no merge request found for commit %s", commitSHA)
+	}
+	for _, mr := range mrs {
+		if mr.State == "opened" {
+			return mr.IID, nil
+		}
+	}
+	return mrs[0].IID, nil
+}
+
+// closeGitLabIssue adds a note to and closes a GitLab issue
+func closeGitLabIssue(ctx context.Context, cfg aiConfig, iid int, comment string) error {
+	baseURL, projectPath, err := parseGitLabURL(cfg.GitHubURL)
+	if err != nil {
+		return err
+	}
+	issue := fmt.Sprintf("/projects/%s/issues/%d", url.PathEscape(projectPath), iid)
+	if err := gitlabRequest(ctx, http.MethodPost, baseURL, issue+"/notes", map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("failed to comment on GitLab issue %d: %v", iid, err)
+	}
+	if err := gitlabRequest(ctx, http.MethodPut, baseURL, issue, map[string]string{"state_event": "close"}, nil); err != nil {
+		return fmt.Errorf("failed to close GitLab issue %d: %v", iid, err)
+	}
+	return nil
+}
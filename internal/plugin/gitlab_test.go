@@ -0,0 +1,24 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestParseGitLabURL(t *testing.T) {
+	for in, want := range map[string][2]string{
+		"https://gitlab.com/acme/checkout":                      {"https://gitlab.com", "acme/checkout"},
+		"https://gitlab.example.com/acme/payments/checkout.git": {"https://gitlab.example.com", "acme/payments/checkout"},
+		"https://gitlab.com/acme/checkout/-/merge_requests/42":  {"https://gitlab.com", "acme/checkout"},
+	} {
+		baseURL, project, err := parseGitLabURL(in)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", in, err)
+		}
+		if baseURL != want[0] || project != want[1] {
+			t.Errorf("expected %v for %s, got %s and %s", want, in, baseURL, project)
+		}
+	}
+	if _, _, err := parseGitLabURL("https://gitlab.com/acme"); err == nil {
+		t.Error("expected an error for a URL without project")
+	}
+}
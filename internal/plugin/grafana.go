@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// grafanaConfig annotates Grafana dashboards with the analysis decisions
+type grafanaConfig struct {
+	// Grafana URL, e.g. https://grafana.example.com
+	URL string `json:"url"`
+	// Secret key in the AnalysisRun namespace with a service account token (default: grafana_token of the plugin secret)
+	TokenSecretRef *secretKeyRef `json:"tokenSecretRef,omitempty"`
+	// Dashboard the annotations are added to, organization-wide annotations when empty
+	DashboardUID string `json:"dashboardUid,omitempty"`
+	// Panel of the dashboard the annotations are added to
+	PanelID int `json:"panelId,omitempty"`
+	// Additional annotation tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// grafanaAnnotation is a Grafana HTTP API annotation
+type grafanaAnnotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+// annotateGrafana creates a Grafana annotation at the decision time
+func annotateGrafana(ctx context.Context, cfg *grafanaConfig, rec decisionRecord) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("grafana requires a url")
+	}
+	token, err := readSecretRefOrDefault(ctx, cfg.TokenSecretRef, "grafana_token")
+	if err != nil {
+		return fmt.Errorf("failed to get Grafana token from secret: %v", err)
+	}
+	headers := map[string]string{"Authorization": "Bearer " + token}
+	if err := postJSON(ctx, strings.TrimSuffix(cfg.URL, "/")+"/api/annotations", headers, newGrafanaAnnotation(cfg, rec)); err != nil {
+		return fmt.Errorf("failed to create Grafana annotation: %v", err)
+	}
+	return nil
+}
+
+// newGrafanaAnnotation builds the annotation of a decision, tagged with the rollout and revision
+// so dashboards can filter the annotations of a single rollout
+func newGrafanaAnnotation(cfg *grafanaConfig, rec decisionRecord) grafanaAnnotation {
+	verdict := "failed"
+	switch rec.Phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		verdict = "passed"
+	case v1alpha1.AnalysisPhaseInconclusive:
+		verdict = "inconclusive"
+	}
+	tags := []string{"metric-ai", "verdict:" + verdict, "namespace:" + rec.Namespace, "metric:" + rec.Metric}
+	if rec.Rollout != "" {
+		tags = append(tags, "rollout:"+rec.Rollout)
+	}
+	if rec.Revision != "" {
+		tags = append(tags, "revision:"+rec.Revision)
+	}
+	tags = append(tags, cfg.Tags...)
+
+	target := rec.AnalysisRun
+	if rec.Rollout != "" {
+		target = rec.Rollout
+	}
+	// Annotation texts are rendered as HTML
+	text := html.EscapeString(fmt.Sprintf("AI analysis %s for %s/%s (confidence %d%%, severity %s)", verdict, rec.Namespace, target, rec.Confidence, rec.Severity))
+	if rec.RootCause != "" {
+		text += "<br>" + html.EscapeString(rec.RootCause)
+	}
+	if rec.IssueURL != "" {
+		text += fmt.Sprintf(`<br><a href="%s">Issue</a>`, html.EscapeString(rec.IssueURL))
+	}
+
+	return grafanaAnnotation{
+		DashboardUID: cfg.DashboardUID,
+		PanelID:      cfg.PanelID,
+		Time:         rec.Time.UnixMilli(),
+		Tags:         tags,
+		Text:         text,
+	}
+}
@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestNewGrafanaAnnotation(t *testing.T) {
+	rec := decisionRecord{
+		Time:        time.Unix(1700000000, 0),
+		AnalysisRun: "checkout-abc-1",
+		Namespace:   "shop",
+		Rollout:     "checkout",
+		Revision:    "4",
+		Metric:      "ai",
+		Phase:       v1alpha1.AnalysisPhaseFailed,
+		Confidence:  90,
+		Severity:    SeverityMajor,
+		RootCause:   "<nil> pointer",
+	}
+	annotation := newGrafanaAnnotation(&grafanaConfig{DashboardUID: "checkout", Tags: []string{"prod"}}, rec)
+	if annotation.Time != 1700000000000 || annotation.DashboardUID != "checkout" {
+		t.Errorf("unexpected annotation %+v", annotation)
+	}
+	want := "metric-ai,verdict:failed,namespace:shop,metric:ai,rollout:checkout,revision:4,prod"
+	if got := strings.Join(annotation.Tags, ","); got != want {
+		t.Errorf("expected tags %s, got %s", want, got)
+	}
+	if !strings.Contains(annotation.Text, "&lt;nil&gt; pointer") {
+		t.Errorf("expected escaped root cause, got %s", annotation.Text)
+	}
+}
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genai"
+)
+
+// envHTTPAddr is the listen address of the plugin HTTP server serving /healthz, /readyz and /metrics, e.g. :8090
+const envHTTPAddr = "METRIC_AI_HTTP_ADDR"
+
+// healthCheckTimeout bounds each health check
+const healthCheckTimeout = 10 * time.Second
+
+// readinessCacheTTL is how long readiness results are reused, so frequent probes don't call Gemini
+// on every request
+const readinessCacheTTL = 30 * time.Second
+
+// healthCheck is a named check of a dependency of the plugin
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthResult is the outcome of a health check
+type healthResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// geminiCheck verifies Gemini is reachable with the configured key, listing a single model
+func geminiCheck(ctx context.Context) error {
+	apiKey, err := getSecretValue("google_api_key")
+	if err != nil {
+		return err
+	}
+	client, err := getGenAIClient(ctx, apiKey)
+	if err != nil {
+		return fmt.Errorf("failed to create Gemini client: %v", err)
+	}
+	if _, err := client.Models.List(ctx, &genai.ListModelsConfig{PageSize: 1}); err != nil {
+		return fmt.Errorf("failed to list Gemini models: %v", err)
+	}
+	return nil
+}
+
+// agentCheck verifies the Kubernetes Agent of K8S_AGENT_URL is healthy
+func agentCheck(ctx context.Context) error {
+	return getA2AClient(os.Getenv("K8S_AGENT_URL"), "", "", "").HealthCheck(ctx, "")
+}
+
+// livenessChecks are the checks of /healthz. The plugin is live while it serves requests: missing keys
+// and unreachable services don't get better with a restart of the controller.
+func livenessChecks() []healthCheck {
+	return []healthCheck{}
+}
+
+// readinessChecks are the checks of /readyz and --self-check. Gemini is only checked with the Google API
+// key of the plugin secret, as metrics may use their own credentials, and the Kubernetes Agent only when
+// K8S_AGENT_URL is set, as metrics may not use agent mode.
+func readinessChecks() []healthCheck {
+	var checks []healthCheck
+	if _, err := getSecretValue("google_api_key"); err == nil {
+		checks = append(checks, healthCheck{"gemini", geminiCheck})
+	}
+	if os.Getenv("K8S_AGENT_URL") != "" {
+		checks = append(checks, healthCheck{"agent", agentCheck})
+	}
+	return checks
+}
+
+// runHealthChecks runs the checks concurrently and reports whether all of them passed
+func runHealthChecks(ctx context.Context, checks []healthCheck) ([]healthResult, bool) {
+	results := make([]healthResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			results[i] = healthResult{Name: c.name, OK: true}
+			if err := c.check(ctx); err != nil {
+				results[i] = healthResult{Name: c.name, Error: err.Error()}
+			}
+		}()
+	}
+	wg.Wait()
+
+	ok := true
+	for _, r := range results {
+		ok = ok && r.OK
+	}
+	return results, ok
+}
+
+// cachedHealthChecks reuses the results of the checks for ttl
+type cachedHealthChecks struct {
+	checks func() []healthCheck
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	results   []healthResult
+	ok        bool
+	checkedAt time.Time
+}
+
+func (c *cachedHealthChecks) run(ctx context.Context) ([]healthResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.results == nil || time.Since(c.checkedAt) >= c.ttl {
+		c.results, c.ok = runHealthChecks(ctx, c.checks())
+		c.checkedAt = time.Now()
+	}
+	return c.results, c.ok
+}
+
+// healthHandler serves the results of the checks as JSON, with status 503 when a check failed
+func healthHandler(checks *cachedHealthChecks) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results, ok := checks.run(r.Context())
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": ok, "checks": results})
+	})
+}
+
+// newHTTPMux returns the handler of the plugin HTTP server
+func newHTTPMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", healthHandler(&cachedHealthChecks{checks: livenessChecks}))
+	mux.Handle("/readyz", healthHandler(&cachedHealthChecks{checks: readinessChecks, ttl: readinessCacheTTL}))
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+// serveHTTP starts the plugin HTTP server in the background when METRIC_AI_HTTP_ADDR is set. The plugin
+// runs in the controller pod, so probes of the controller container can target the server.
+func serveHTTP() {
+	addr := os.Getenv(envHTTPAddr)
+	if addr == "" {
+		return
+	}
+	server := &http.Server{Addr: addr, Handler: newHTTPMux(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.WithField("addr", addr).Info("Serving plugin health and metrics endpoints")
+		if err := server.ListenAndServe(); err != nil {
+			log.WithError(err).Error("Plugin HTTP server failed")
+		}
+	}()
+}
+
+// SelfCheck loads the configuration and runs the readiness checks once, writing the results to w.
+// It returns an error when a check failed, so deployments can gate on a working configuration.
+func SelfCheck(w io.Writer) error {
+	ctx := context.Background()
+	if err := loadConfig(ctx); err != nil {
+		return fmt.Errorf("failed to load configuration: %v", err)
+	}
+	if err := configureOutboundTransport(); err != nil {
+		return fmt.Errorf("failed to configure outbound requests: %v", err)
+	}
+	results, ok := runHealthChecks(ctx, readinessChecks())
+	for _, r := range results {
+		if r.OK {
+			fmt.Fprintf(w, "ok      %s\n", r.Name)
+		} else {
+			fmt.Fprintf(w, "failed  %s: %s\n", r.Name, r.Error)
+		}
+	}
+	if !ok {
+		return fmt.Errorf("self-check failed")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	oldAPIKey := googleAPIKey
+	t.Cleanup(func() { googleAPIKey = oldAPIKey })
+
+	server := httptest.NewServer(newHTTPMux())
+	defer server.Close()
+	// Liveness doesn't depend on the configured keys
+	for _, apiKey := range []string{"", "key"} {
+		googleAPIKey = apiKey
+		resp, err := http.Get(server.URL + "/healthz")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var body struct {
+			OK     bool           `json:"ok"`
+			Checks []healthResult `json:"checks"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !body.OK || len(body.Checks) != 0 {
+			t.Errorf("unexpected /healthz response %d %+v with API key %q", resp.StatusCode, body, apiKey)
+		}
+	}
+
+	// Gemini is only checked with the key of the plugin secret
+	t.Setenv("K8S_AGENT_URL", "")
+	googleAPIKey = ""
+	if checks := readinessChecks(); len(checks) != 0 {
+		t.Errorf("expected no readiness checks without keys, got %+v", checks)
+	}
+	googleAPIKey = "key"
+	if checks := readinessChecks(); len(checks) != 1 || checks[0].name != "gemini" {
+		t.Errorf("expected the Gemini readiness check, got %+v", checks)
+	}
+
+	// Readiness results are reused until they expire
+	calls := 0
+	checks := &cachedHealthChecks{
+		checks: func() []healthCheck {
+			return []healthCheck{
+				{"ok", func(context.Context) error { calls++; return nil }},
+				{"agent", func(context.Context) error { return fmt.Errorf("agent unavailable") }},
+			}
+		},
+		ttl: time.Hour,
+	}
+	for i := 0; i < 2; i++ {
+		results, ok := checks.run(context.Background())
+		if ok || len(results) != 2 || !results[0].OK || results[1].Error != "agent unavailable" {
+			t.Errorf("unexpected results %+v", results)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected cached readiness results, checks ran %d times", calls)
+	}
+}
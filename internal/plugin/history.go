@@ -0,0 +1,111 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// defaultMaxHistory is the number of previous measurements passed to the model for trend analysis
+const defaultMaxHistory = 5
+
+// historySummaryLength bounds the analysis text kept per previous measurement
+const historySummaryLength = 500
+
+// buildMeasurementHistory summarizes the previous measurements of a metric in the same AnalysisRun,
+// oldest first, so the model can evaluate trends instead of judging each snapshot independently
+func buildMeasurementHistory(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, maxHistory int) string {
+	if analysisRun == nil || maxHistory < 0 {
+		return ""
+	}
+	// A single measurement has no history to compare against
+	if metric.Count != nil && metric.Count.IntValue() == 1 {
+		return ""
+	}
+	if maxHistory == 0 {
+		maxHistory = defaultMaxHistory
+	}
+
+	var measurements []v1alpha1.Measurement
+	for _, mr := range analysisRun.Status.MetricResults {
+		if mr.Name == metric.Name {
+			measurements = mr.Measurements
+			break
+		}
+	}
+
+	// Only completed measurements carry a verdict
+	var completed []v1alpha1.Measurement
+	for _, m := range measurements {
+		if m.Phase.Completed() {
+			completed = append(completed, m)
+		}
+	}
+	if len(completed) == 0 {
+		return ""
+	}
+	if len(completed) > maxHistory {
+		completed = completed[len(completed)-maxHistory:]
+	}
+
+	var b strings.Builder
+	for i, m := range completed {
+		startedAt := "unknown"
+		if m.StartedAt != nil {
+			startedAt = m.StartedAt.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		fmt.Fprintf(&b, "Measurement %d (%s): phase=%s", i+1, startedAt, m.Phase)
+		if confidence := m.Metadata["confidence"]; confidence != "" {
+			fmt.Fprintf(&b, ", confidence=%s", confidence)
+		}
+		b.WriteString("\n")
+		if analysis := m.Metadata["analysis"]; analysis != "" {
+			b.WriteString(truncate(strings.TrimSpace(analysis), historySummaryLength))
+			b.WriteString("\n")
+		} else if m.Message != "" {
+			b.WriteString(truncate(strings.TrimSpace(m.Message), historySummaryLength))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// majorityVerdict decides on the majority of the last n AI verdicts of the metric, the current one included,
+// so a single flaky model response cannot flip the outcome. Ties keep the current verdict.
+// It returns the decision, the number of promote votes and the number of verdicts considered.
+func majorityVerdict(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, n int, current bool) (bool, int, int) {
+	verdicts := []bool{current}
+	if analysisRun != nil {
+		for _, mr := range analysisRun.Status.MetricResults {
+			if mr.Name != metric.Name {
+				continue
+			}
+			for i := len(mr.Measurements) - 1; i >= 0 && len(verdicts) < n; i-- {
+				m := mr.Measurements[i]
+				if !m.Phase.Completed() {
+					continue
+				}
+				if promote, err := strconv.ParseBool(m.Metadata["promote"]); err == nil {
+					verdicts = append(verdicts, promote)
+				}
+			}
+		}
+	}
+
+	votes := 0
+	for _, promote := range verdicts {
+		if promote {
+			votes++
+		}
+	}
+	switch {
+	case votes*2 > len(verdicts):
+		return true, votes, len(verdicts)
+	case votes*2 < len(verdicts):
+		return false, votes, len(verdicts)
+	default:
+		return current, votes, len(verdicts)
+	}
+}
@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestBuildMeasurementHistory(t *testing.T) {
+	metric := v1alpha1.Metric{Name: "ai-test"}
+	analysisRun := &v1alpha1.AnalysisRun{}
+
+	if h := buildMeasurementHistory(analysisRun, metric, 0); h != "" {
+		t.Fatalf("expected empty history without previous measurements, got %q", h)
+	}
+
+	analysisRun.Status.MetricResults = []v1alpha1.MetricResult{
+		{
+			Name: "ai-test",
+			Measurements: []v1alpha1.Measurement{
+				{Phase: v1alpha1.AnalysisPhaseSuccessful, Metadata: map[string]string{"analysis": "first", "confidence": "90"}},
+				{Phase: v1alpha1.AnalysisPhaseFailed, Metadata: map[string]string{"analysis": "second", "confidence": "70"}},
+				{Phase: v1alpha1.AnalysisPhaseRunning},
+			},
+		},
+		{
+			Name:         "other",
+			Measurements: []v1alpha1.Measurement{{Phase: v1alpha1.AnalysisPhaseFailed, Metadata: map[string]string{"analysis": "other"}}},
+		},
+	}
+
+	h := buildMeasurementHistory(analysisRun, metric, 0)
+	if !strings.Contains(h, "first") || !strings.Contains(h, "second") {
+		t.Fatalf("expected both completed measurements in history, got %q", h)
+	}
+	if strings.Contains(h, "other") {
+		t.Fatalf("expected history to only include the current metric, got %q", h)
+	}
+
+	h = buildMeasurementHistory(analysisRun, metric, 1)
+	if strings.Contains(h, "first") || !strings.Contains(h, "second") {
+		t.Fatalf("expected only the latest measurement in history, got %q", h)
+	}
+
+	if h := buildMeasurementHistory(analysisRun, metric, -1); h != "" {
+		t.Fatalf("expected history to be disabled, got %q", h)
+	}
+}
+
+func TestMajorityVerdict(t *testing.T) {
+	metric := v1alpha1.Metric{Name: "ai-test"}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Status.MetricResults = []v1alpha1.MetricResult{
+		{
+			Name: "ai-test",
+			Measurements: []v1alpha1.Measurement{
+				{Phase: v1alpha1.AnalysisPhaseFailed, Metadata: map[string]string{"promote": "false"}},
+				{Phase: v1alpha1.AnalysisPhaseSuccessful, Metadata: map[string]string{"promote": "true"}},
+				{Phase: v1alpha1.AnalysisPhaseSuccessful, Metadata: map[string]string{"promote": "true"}},
+				{Phase: v1alpha1.AnalysisPhaseRunning, Metadata: map[string]string{"deferred": "true"}},
+			},
+		},
+	}
+
+	promote, votes, total := majorityVerdict(analysisRun, metric, 3, false)
+	if !promote || votes != 2 || total != 3 {
+		t.Fatalf("expected a single flaky failure to be outvoted, got promote=%t votes=%d/%d", promote, votes, total)
+	}
+	promote, votes, total = majorityVerdict(analysisRun, metric, 4, false)
+	if promote || votes != 2 || total != 4 {
+		t.Fatalf("expected a tie to keep the current verdict, got promote=%t votes=%d/%d", promote, votes, total)
+	}
+	if promote, _, total := majorityVerdict(&v1alpha1.AnalysisRun{}, metric, 3, true); !promote || total != 1 {
+		t.Fatalf("expected the current verdict without history, got promote=%t total=%d", promote, total)
+	}
+}
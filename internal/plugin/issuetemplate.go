@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Keys of the issue template ConfigMap
+const (
+	issueTitleTemplateKey = "title"
+	issueBodyTemplateKey  = "body"
+)
+
+// issueLogsLength bounds the logs available to issue templates
+const issueLogsLength = 10000
+
+// Delimiters of the templates of the plugin configuration. The Argo Rollouts controller resolves every
+// {{ }} placeholder of the metric as an argument before calling the plugin and fails the AnalysisRun
+// for the others, so {{ .Rollout }} would never reach the plugin.
+const (
+	templateLeftDelim  = "[["
+	templateRightDelim = "]]"
+)
+
+// issueTemplateData holds the variables available to issue templates
+type issueTemplateData struct {
+	Rollout     string
+	AnalysisRun string
+	Namespace   string
+	Model       string
+	Confidence  int
+	Severity    string
+	Analysis    string
+	RootCause   string
+	Remediation string
+	Logs        string
+	// LogsURL links the full logs gist when logsGist is enabled
+	LogsURL string
+	// FixURL links the draft pull request with a suggested fix when fixPullRequest is enabled
+	FixURL string
+	// DashboardURL is the rendered dashboardUrl template linking the rollout in the Argo Rollouts dashboard
+	DashboardURL string
+}
+
+// newIssueTemplateData collects the issue template variables of a failed analysis
+func newIssueTemplateData(analysisRun *v1alpha1.AnalysisRun, logsBlob string, result AIAnalysisResult, modelName string) issueTemplateData {
+	data := issueTemplateData{
+		Model:       modelName,
+		Confidence:  result.Confidence,
+		Severity:    effectiveSeverity(result),
+		Analysis:    result.Text,
+		RootCause:   result.RootCause,
+		Remediation: result.Remediation,
+		Logs:        truncate(logsBlob, issueLogsLength),
+	}
+	if analysisRun != nil {
+		data.Rollout = rolloutNameFromAnalysisRun(analysisRun)
+		data.AnalysisRun = analysisRun.Name
+		data.Namespace = analysisRun.Namespace
+	}
+	return data
+}
+
+// issueLinks renders the links to the failing rollout and AnalysisRun appended to generated issues
+func issueLinks(data issueTemplateData) string {
+	if data.AnalysisRun == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("### Links\n")
+	if data.Rollout != "" {
+		fmt.Fprintf(&b, "- Rollout: `%s/%s`", data.Namespace, data.Rollout)
+		if data.DashboardURL != "" {
+			fmt.Fprintf(&b, " ([dashboard](%s))", data.DashboardURL)
+		}
+		fmt.Fprintf(&b, "\n- Inspect: `kubectl argo rollouts get rollout %s -n %s`\n", data.Rollout, data.Namespace)
+	} else if data.DashboardURL != "" {
+		fmt.Fprintf(&b, "- [Dashboard](%s)\n", data.DashboardURL)
+	}
+	fmt.Fprintf(&b, "- AnalysisRun: `%s/%s` (`kubectl get analysisrun %s -n %s -o yaml`)\n", data.Namespace, data.AnalysisRun, data.AnalysisRun, data.Namespace)
+	return b.String()
+}
+
+// renderDashboardURL renders the dashboardUrl template, returning "" when it is not configured or invalid
+func renderDashboardURL(cfg aiConfig, data issueTemplateData) string {
+	if cfg.DashboardURL == "" {
+		return ""
+	}
+	dashboardURL, err := renderIssueTemplate("dashboardUrl", cfg.DashboardURL, data)
+	if err != nil {
+		log.WithError(err).Warning("Failed to render dashboard URL")
+		return ""
+	}
+	return strings.TrimSpace(dashboardURL)
+}
+
+// issueTemplateFuncs are the functions available to issue templates
+var issueTemplateFuncs = template.FuncMap{
+	"truncate": func(n int, s string) string { return truncate(s, n) },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// renderIssueTemplates renders the issue title and body from the templates configured inline or
+// in the issue template ConfigMap. It reports whether both were rendered; otherwise the caller
+// generates the content.
+func renderIssueTemplates(ctx context.Context, cfg aiConfig, data issueTemplateData) (string, string, bool, error) {
+	titleTemplate, bodyTemplate := cfg.IssueTitleTemplate, cfg.IssueBodyTemplate
+	if cfg.IssueTemplateConfigMap != "" && (titleTemplate == "" || bodyTemplate == "") {
+		client, err := acquireKubeClient()
+		if err != nil {
+			return "", "", false, err
+		}
+		if client == nil {
+			return "", "", false, fmt.Errorf("no Kubernetes client to read issue template ConfigMap %s", cfg.IssueTemplateConfigMap)
+		}
+		cm, err := client.CoreV1().ConfigMaps(data.Namespace).Get(ctx, cfg.IssueTemplateConfigMap, metav1.GetOptions{})
+		if err != nil {
+			return "", "", false, fmt.Errorf("failed to read issue template ConfigMap %s: %v", cfg.IssueTemplateConfigMap, err)
+		}
+		if titleTemplate == "" {
+			titleTemplate = cm.Data[issueTitleTemplateKey]
+		}
+		if bodyTemplate == "" {
+			bodyTemplate = cm.Data[issueBodyTemplateKey]
+		}
+	}
+	if titleTemplate == "" || bodyTemplate == "" {
+		return "", "", false, nil
+	}
+
+	title, err := renderIssueTemplate("title", titleTemplate, data)
+	if err != nil {
+		return "", "", false, err
+	}
+	body, err := renderIssueTemplate("body", bodyTemplate, data)
+	if err != nil {
+		return "", "", false, err
+	}
+	return strings.TrimSpace(title), body, true, nil
+}
+
+// renderIssueTemplate executes a single issue template
+func renderIssueTemplate(name, text string, data issueTemplateData) (string, error) {
+	tmpl, err := template.New(name).Delims(templateLeftDelim, templateRightDelim).Funcs(issueTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid issue %s template: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render issue %s template: %v", name, err)
+	}
+	return buf.String(), nil
+}
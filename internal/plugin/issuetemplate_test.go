@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	analysisutil "github.com/argoproj/argo-rollouts/utils/analysis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderIssueTemplates(t *testing.T) {
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "demo-abc-1"
+	analysisRun.Namespace = "shop"
+	analysisRun.OwnerReferences = []metav1.OwnerReference{{Kind: "Rollout", Name: "demo"}}
+	data := newIssueTemplateData(analysisRun, "panic: nil pointer", AIAnalysisResult{Text: "canary crashes", Confidence: 85, Severity: SeverityCritical}, "gemini-2.0-flash")
+
+	if _, _, ok, err := renderIssueTemplates(context.Background(), aiConfig{}, data); ok || err != nil {
+		t.Fatalf("expected no templates to be rendered, got ok=%t err=%v", ok, err)
+	}
+
+	// The templates reach the plugin through the argument resolution of the controller
+	team := "payments"
+	metric := v1alpha1.Metric{Name: "ai", Provider: v1alpha1.MetricProvider{Plugin: map[string]json.RawMessage{
+		"argoproj-labs/metric-ai": json.RawMessage(`{
+			"issueTitleTemplate": "[[ .Severity | upper ]]: [[ .Rollout ]] canary failed in [[ .Namespace ]]",
+			"issueBodyTemplate": "[[ .Analysis ]] ([[ .Confidence ]]% by [[ .Model ]]) for {{args.team}}\n` + "```" + `\n[[ .Logs ]]\n` + "```" + `"
+		}`),
+	}}}
+	args := []v1alpha1.Argument{{Name: "team", Value: &team}}
+	resolved, err := analysisutil.ResolveMetricArgs(metric, args)
+	if err != nil {
+		t.Fatalf("unexpected error resolving the metric: %v", err)
+	}
+	var cfg aiConfig
+	if err := json.Unmarshal(resolved.Provider.Plugin["argoproj-labs/metric-ai"], &cfg); err != nil {
+		t.Fatalf("failed to parse resolved configuration: %v", err)
+	}
+	title, body, ok, err := renderIssueTemplates(context.Background(), cfg, data)
+	if err != nil || !ok {
+		t.Fatalf("expected templates to be rendered, got ok=%t err=%v", ok, err)
+	}
+	if title != "CRITICAL: demo canary failed in shop" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if !strings.Contains(body, "canary crashes (85% by gemini-2.0-flash) for payments") || !strings.Contains(body, "panic: nil pointer") {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	// Go template delimiters are taken for arguments by the controller
+	metric.Provider.Plugin["argoproj-labs/metric-ai"] = json.RawMessage(`{"issueTitleTemplate": "{{ .Rollout }} canary failed"}`)
+	if _, err := analysisutil.ResolveMetricArgs(metric, args); err == nil {
+		t.Error("expected the controller to fail on {{ .Rollout }}")
+	}
+
+	cfg.IssueBodyTemplate = "[[ .Unknown ]]"
+	if _, _, _, err := renderIssueTemplates(context.Background(), cfg, data); err == nil {
+		t.Error("expected an error for an unknown template variable")
+	}
+}
+
+func TestIssueLinks(t *testing.T) {
+	data := issueTemplateData{Rollout: "checkout", AnalysisRun: "checkout-6d4f-2", Namespace: "shop"}
+	// The dashboard URL template is left alone by the argument resolution of the controller
+	metric := v1alpha1.Metric{Name: "ai", Provider: v1alpha1.MetricProvider{Plugin: map[string]json.RawMessage{
+		"argoproj-labs/metric-ai": json.RawMessage(`{"dashboardUrl": "https://rollouts.example.com/rollouts/rollout/[[ .Namespace ]]/[[ .Rollout ]]"}`),
+	}}}
+	resolved, err := analysisutil.ResolveMetricArgs(metric, nil)
+	if err != nil {
+		t.Fatalf("unexpected error resolving the metric: %v", err)
+	}
+	var cfg aiConfig
+	if err := json.Unmarshal(resolved.Provider.Plugin["argoproj-labs/metric-ai"], &cfg); err != nil {
+		t.Fatalf("failed to parse resolved configuration: %v", err)
+	}
+	data.DashboardURL = renderDashboardURL(cfg, data)
+	links := issueLinks(data)
+	for _, want := range []string{
+		"`shop/checkout` ([dashboard](https://rollouts.example.com/rollouts/rollout/shop/checkout))",
+		"kubectl argo rollouts get rollout checkout -n shop",
+		"`shop/checkout-6d4f-2`",
+	} {
+		if !strings.Contains(links, want) {
+			t.Errorf("expected links to contain %q, got %q", want, links)
+		}
+	}
+	if links := issueLinks(issueTemplateData{}); links != "" {
+		t.Errorf("expected no links without AnalysisRun, got %q", links)
+	}
+}
@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultIssueTrackingConfigMap stores the issues created per rollout revision
+const defaultIssueTrackingConfigMap = "metric-ai-issues"
+
+// Labels and annotations identifying the rollout revision of an AnalysisRun
+const (
+	podTemplateHashLabel      = "rollouts-pod-template-hash"
+	rolloutRevisionAnnotation = "rollout.argoproj.io/revision"
+)
+
+// trackedIssue is an issue created for a failed analysis, closed when the revision passes later
+type trackedIssue struct {
+	Provider    string    `json:"provider"`
+	Repository  string    `json:"repository"`
+	Number      int       `json:"number"`
+	AnalysisRun string    `json:"analysisRun"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// invalidConfigMapKeyChars are not allowed in ConfigMap keys
+var invalidConfigMapKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// issueTrackingKey identifies the rollout revision of an AnalysisRun, so issues are closed by later
+// measurements and by AnalysisRuns of retried rollouts of the same revision
+func issueTrackingKey(analysisRun *v1alpha1.AnalysisRun) string {
+	if analysisRun == nil {
+		return ""
+	}
+	revision := analysisRun.Labels[podTemplateHashLabel]
+	if revision == "" {
+		revision = analysisRun.Annotations[rolloutRevisionAnnotation]
+	}
+	owner := rolloutNameFromAnalysisRun(analysisRun)
+	if owner == "" || revision == "" {
+		// Without a rollout revision only later measurements of the same AnalysisRun close the issue
+		owner, revision = "analysisrun", analysisRun.Name
+	}
+	return invalidConfigMapKeyChars.ReplaceAllString(owner+"."+revision, "_")
+}
+
+// issueTrackingConfigMap returns the name of the ConfigMap issues are tracked in
+func issueTrackingConfigMap(cfg aiConfig) string {
+	if cfg.IssueTrackingConfigMap != "" {
+		return cfg.IssueTrackingConfigMap
+	}
+	return defaultIssueTrackingConfigMap
+}
+
+// trackIssue records an issue created for the rollout revision of the AnalysisRun
+func trackIssue(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, cfg aiConfig, number int) error {
+	key := issueTrackingKey(analysisRun)
+	if key == "" {
+		return fmt.Errorf("no AnalysisRun to track the issue for")
+	}
+	client, err := acquireKubeClient()
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf("no Kubernetes client to track issues")
+	}
+
+	name := issueTrackingConfigMap(cfg)
+	cms := client.CoreV1().ConfigMaps(analysisRun.Namespace)
+	cm, err := cms.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: analysisRun.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "rollouts-plugin-metric-ai"},
+			},
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get issue tracking ConfigMap %s: %v", name, err)
+	}
+
+	issues := append(decodeTrackedIssues(cm.Data[key]), trackedIssue{
+		Provider:    cfg.GitProvider,
+		Repository:  cfg.GitHubURL,
+		Number:      number,
+		AnalysisRun: analysisRun.Name,
+		CreatedAt:   time.Now().UTC(),
+	})
+	data, err := json.Marshal(issues)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tracked issues: %v", err)
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[key] = string(data)
+
+	if cm.ResourceVersion == "" {
+		_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = cms.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save issue tracking ConfigMap %s: %v", name, err)
+	}
+	log.WithContext(ctx).WithFields(log.Fields{
+		"issue":    number,
+		"revision": key,
+	}).Info("Tracking issue to close when the revision passes")
+	return nil
+}
+
+// closeTrackedIssues closes the issues created for the rollout revision of a passing AnalysisRun
+// with a resolution comment. Issues that fail to close stay tracked for the next success.
+func closeTrackedIssues(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, cfg aiConfig, result AIAnalysisResult) error {
+	key := issueTrackingKey(analysisRun)
+	if key == "" {
+		return nil
+	}
+	client, err := acquireKubeClient()
+	if err != nil || client == nil {
+		return err
+	}
+
+	name := issueTrackingConfigMap(cfg)
+	cms := client.CoreV1().ConfigMaps(analysisRun.Namespace)
+	cm, err := cms.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get issue tracking ConfigMap %s: %v", name, err)
+	}
+	issues := decodeTrackedIssues(cm.Data[key])
+	if len(issues) == 0 {
+		return nil
+	}
+
+	comment := fmt.Sprintf("✅ Resolved: the canary analysis passed in AnalysisRun %s/%s with %d%% confidence.\n\n%s",
+		analysisRun.Namespace, analysisRun.Name, result.Confidence, result.Text)
+	var remaining []trackedIssue
+	for _, issue := range issues {
+		issueCfg := cfg
+		issueCfg.GitProvider, issueCfg.GitHubURL = issue.Provider, issue.Repository
+		if err := closeIssue(ctx, issueCfg, issue.Number, comment); err != nil {
+			log.WithContext(ctx).WithError(err).WithField("issue", issue.Number).Warn("Failed to close resolved issue")
+			remaining = append(remaining, issue)
+			continue
+		}
+		log.WithContext(ctx).WithFields(log.Fields{
+			"issue":    issue.Number,
+			"revision": key,
+		}).Info("Closed issue after the revision passed")
+	}
+
+	if len(remaining) == 0 {
+		delete(cm.Data, key)
+	} else {
+		data, err := json.Marshal(remaining)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tracked issues: %v", err)
+		}
+		cm.Data[key] = string(data)
+	}
+	if _, err := cms.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update issue tracking ConfigMap %s: %v", name, err)
+	}
+	return nil
+}
+
+// decodeTrackedIssues decodes the issues tracked for a revision, ignoring invalid entries
+func decodeTrackedIssues(data string) []trackedIssue {
+	var issues []trackedIssue
+	if data != "" {
+		if err := json.Unmarshal([]byte(data), &issues); err != nil {
+			log.WithError(err).Warn("Ignoring invalid tracked issues")
+			return nil
+		}
+	}
+	return issues
+}
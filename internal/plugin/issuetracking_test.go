@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIssueTrackingKey(t *testing.T) {
+	ar := &v1alpha1.AnalysisRun{ObjectMeta: metav1.ObjectMeta{
+		Name:            "checkout-6d4f-2",
+		Labels:          map[string]string{"rollouts-pod-template-hash": "6d4f"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Rollout", Name: "checkout"}},
+	}}
+	if got := issueTrackingKey(ar); got != "checkout.6d4f" {
+		t.Errorf("expected checkout.6d4f, got %s", got)
+	}
+
+	// A retried rollout of the same revision shares the key
+	retried := ar.DeepCopy()
+	retried.Name = "checkout-6d4f-3"
+	if issueTrackingKey(retried) != issueTrackingKey(ar) {
+		t.Error("expected AnalysisRuns of the same revision to share the key")
+	}
+
+	ar.Labels = nil
+	ar.Annotations = map[string]string{"rollout.argoproj.io/revision": "7"}
+	if got := issueTrackingKey(ar); got != "checkout.7" {
+		t.Errorf("expected checkout.7, got %s", got)
+	}
+
+	standalone := &v1alpha1.AnalysisRun{ObjectMeta: metav1.ObjectMeta{Name: "smoke:test"}}
+	if got := issueTrackingKey(standalone); got != "analysisrun.smoke_test" {
+		t.Errorf("expected analysisrun.smoke_test, got %s", got)
+	}
+}
+
+func TestDecodeTrackedIssues(t *testing.T) {
+	issues := decodeTrackedIssues(`[{"provider":"gitlab","repository":"https://gitlab.com/acme/checkout","number":7}]`)
+	if len(issues) != 1 || issues[0].Provider != "gitlab" || issues[0].Number != 7 {
+		t.Errorf("unexpected issues %+v", issues)
+	}
+	if issues := decodeTrackedIssues("not json"); issues != nil {
+		t.Errorf("expected invalid entries to be ignored, got %+v", issues)
+	}
+}
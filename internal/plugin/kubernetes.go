@@ -3,56 +3,54 @@ package plugin
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
-// getSecretValue retrieves a value from a Kubernetes secret
-func getSecretValue(namespace, key string) (string, error) {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		// Fallback to kubeconfig for local development
-		homeDir, _ := os.UserHomeDir()
-		kubeconfig := filepath.Join(homeDir, ".kube", "config")
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			return "", fmt.Errorf("failed to get kubeconfig: %v", err)
-		}
-	}
+// secretKeyRef selects a key of a Secret in the AnalysisRun namespace. Secrets of other namespaces
+// cannot be referenced, so tenants cannot use each other's credentials.
+type secretKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// namespace is set to the AnalysisRun namespace, it cannot be configured
+	namespace string
+}
 
-	clientset, err := kubernetes.NewForConfig(config)
+// readSecretKeyRef reads the value of a secret key reference
+func readSecretKeyRef(ctx context.Context, ref *secretKeyRef) (string, error) {
+	if ref.Name == "" || ref.Key == "" {
+		return "", fmt.Errorf("secret reference requires name and key")
+	}
+	if ref.namespace == "" {
+		return "", fmt.Errorf("secret %s has no namespace", ref.Name)
+	}
+	client, err := acquireKubeClient()
 	if err != nil {
-		return "", fmt.Errorf("failed to create kubernetes client: %v", err)
+		return "", err
 	}
-
-	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.Background(), "argo-rollouts", metav1.GetOptions{})
+	if client == nil {
+		return "", fmt.Errorf("no Kubernetes client to read secret %s/%s", ref.namespace, ref.Name)
+	}
+	secret, err := client.CoreV1().Secrets(ref.namespace).Get(ctx, ref.Name, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return "", fmt.Errorf("secret 'argo-rollouts' not found in namespace '%s'", namespace)
+			return "", fmt.Errorf("secret '%s' not found in namespace '%s'", ref.Name, ref.namespace)
 		}
 		return "", fmt.Errorf("failed to get secret: %v", err)
 	}
+	value := strings.TrimSpace(string(secret.Data[ref.Key]))
+	if value == "" {
+		return "", fmt.Errorf("key %s not found in secret '%s'", ref.Key, ref.Name)
+	}
+	return value, nil
+}
 
-	switch key {
-	case "google_api_key":
-		apiKey := string(secret.Data["google_api_key"])
-		if apiKey == "" {
-			return "", fmt.Errorf("google API key not loaded at startup")
-		}
-		return apiKey, nil
-	case "github_token":
-		githubToken := string(secret.Data["github_token"])
-		if githubToken == "" {
-			return "", fmt.Errorf("github token not loaded at startup")
-		}
-		return githubToken, nil
-	default:
-		return "", fmt.Errorf("unknown secret key: %s", key)
+// readSecretRefOrDefault reads a secret key reference or, if not set, the key of the plugin secret
+func readSecretRefOrDefault(ctx context.Context, ref *secretKeyRef, key string) (string, error) {
+	if ref != nil {
+		return readSecretKeyRef(ctx, ref)
 	}
+	return getSecretValue(key)
 }
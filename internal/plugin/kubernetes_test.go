@@ -0,0 +1,25 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestGitHubTokenSecretRefNamespace(t *testing.T) {
+	var cfg aiConfig
+	raw := `{"githubTokenSecretRef":{"name":"team-a-github","key":"token","namespace":"team-b"}}`
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ref := cfg.GitHubTokenSecretRef
+	if ref == nil || ref.Name != "team-a-github" || ref.Key != "token" {
+		t.Fatalf("unexpected secret reference %+v", ref)
+	}
+	if ref.namespace != "" {
+		t.Errorf("expected the namespace not to be configurable, got %s", ref.namespace)
+	}
+	if _, err := readSecretKeyRef(context.Background(), ref); err == nil {
+		t.Error("expected an error for a reference without namespace")
+	}
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Patterns of volatile tokens replaced when normalizing log lines into message types
+var (
+	logTimestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`)
+	logUUIDPattern      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	logHexPattern       = regexp.MustCompile(`\b(?:0x)?[0-9a-fA-F]{8,}\b`)
+	logNumberPattern    = regexp.MustCompile(`\d+(?:\.\d+)?`)
+	logSpacePattern     = regexp.MustCompile(`\s+`)
+	logErrorPattern     = regexp.MustCompile(`(?i)\b(?:error|fatal|panic|exception|critical|severe|traceback)\b`)
+)
+
+// normalizeLogLine reduces a log line to its message type by masking timestamps, ids and numbers
+func normalizeLogLine(line string) string {
+	line = logTimestampPattern.ReplaceAllString(line, "<ts>")
+	line = logUUIDPattern.ReplaceAllString(line, "<uuid>")
+	line = logHexPattern.ReplaceAllString(line, "<hex>")
+	line = logNumberPattern.ReplaceAllString(line, "<n>")
+	line = logSpacePattern.ReplaceAllString(line, " ")
+	return strings.TrimSpace(line)
+}
+
+// logMessageTypes returns the set of normalized message types in the logs
+func logMessageTypes(logs string) map[string]bool {
+	types := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if t := normalizeLogLine(scanner.Text()); t != "" {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+// compareNormalizedLogs reports whether the canary logs are effectively identical to the stable logs:
+// the canary has logs, shows no message types absent from the stable logs and no error-level lines.
+// The returned note explains the outcome.
+func compareNormalizedLogs(stableLogs, canaryLogs string) (bool, string) {
+	canaryTypes := logMessageTypes(canaryLogs)
+	if len(canaryTypes) == 0 {
+		return false, "canary has no logs"
+	}
+	for t := range canaryTypes {
+		if logErrorPattern.MatchString(t) {
+			return false, fmt.Sprintf("canary logs contain error-level lines: %s", truncate(t, 200))
+		}
+	}
+	stableTypes := logMessageTypes(stableLogs)
+	newTypes := 0
+	for t := range canaryTypes {
+		if !stableTypes[t] {
+			newTypes++
+		}
+	}
+	if newTypes > 0 {
+		return false, fmt.Sprintf("canary logs contain %d message types not present in stable logs", newTypes)
+	}
+	return true, fmt.Sprintf("No significant difference: the canary logs show %d message types, all present in the stable logs, and no error-level lines. AI analysis was skipped.", len(canaryTypes))
+}
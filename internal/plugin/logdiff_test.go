@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestCompareNormalizedLogs(t *testing.T) {
+	stable := `2024-10-01T10:00:00Z INFO request 7f3a9c21-1b2c-4d5e-8f90-1234567890ab served in 12ms
+2024-10-01T10:00:01Z INFO health check ok`
+
+	tests := []struct {
+		name      string
+		canary    string
+		identical bool
+	}{
+		{
+			name: "same message types with different values",
+			canary: `2024-10-01T11:30:00.123Z INFO request 0a1b2c3d-1b2c-4d5e-8f90-abcdefabcdef served in 250ms
+2024-10-01T11:30:02Z INFO health check ok`,
+			identical: true,
+		},
+		{
+			name:      "new message type",
+			canary:    `2024-10-01T11:30:00Z INFO cache warmed with 100 entries`,
+			identical: false,
+		},
+		{
+			name:      "error level line",
+			canary:    `2024-10-01T11:30:00Z ERROR request failed`,
+			identical: false,
+		},
+		{
+			name:      "empty canary logs",
+			canary:    "",
+			identical: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identical, note := compareNormalizedLogs(stable, tt.canary)
+			if identical != tt.identical {
+				t.Errorf("expected identical=%v, got %v (%s)", tt.identical, identical, note)
+			}
+		})
+	}
+}
+
+func TestRun_SkipIdenticalLogs(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+
+	b, _ := json.Marshal(aiConfig{StableLabel: "role=stable", CanaryLabel: "role=canary", SkipIdenticalLogs: true, DisableEvents: true})
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	called := false
+	old := analyzeLogsWithAI
+	analyzeLogsWithAI = func(_ context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		called = true
+		return `{"text":"new errors","promote":false,"confidence":90,"severity":"major"}`, AIAnalysisResult{Text: "new errors", Promote: false, Confidence: 90, Severity: SeverityMajor}, nil
+	}
+	t.Cleanup(func() { analyzeLogsWithAI = old })
+
+	oldKC := acquireKubeClient
+	acquireKubeClient = func() (*kubernetes.Clientset, error) { return nil, nil }
+	t.Cleanup(func() { acquireKubeClient = oldKC })
+
+	logs := map[string]string{
+		"role=stable": "2024-10-01T10:00:00Z INFO request served in 12ms\n",
+		"role=canary": "2024-10-01T11:30:00Z INFO request served in 250ms\n",
+	}
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(_ context.Context, _ *kubernetes.Clientset, _ string, selector string, _ podLogOptions) (string, podLogSample, error) {
+		return logs[selector], podLogSample{Pod: selector, Bytes: len(logs[selector])}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	// The same message types with different values do not need the model
+	measurement := p.Run(analysisRun, metric)
+	if called {
+		t.Fatal("expected the AI analysis to be skipped for logs matching the stable logs")
+	}
+	if measurement.Phase != v1alpha1.AnalysisPhaseSuccessful || measurement.Metadata["skippedAI"] != "true" || measurement.Metadata["severity"] != SeverityNone {
+		t.Fatalf("expected a successful skipped analysis, got %s with metadata %v", measurement.Phase, measurement.Metadata)
+	}
+
+	logs["role=canary"] += "2024-10-01T11:30:01Z ERROR connection refused\n"
+	measurement = p.Run(analysisRun, metric)
+	if !called {
+		t.Fatal("expected the AI analysis for canary logs with new message types")
+	}
+	if measurement.Phase != v1alpha1.AnalysisPhaseFailed || measurement.Metadata["skippedAI"] != "" {
+		t.Fatalf("expected the failed AI analysis, got %s with metadata %v", measurement.Phase, measurement.Metadata)
+	}
+}
@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// podLogOptions selects and limits the logs read from a pod
+type podLogOptions struct {
+	// Container to read, the pod's default container if empty
+	Container string
+	// Maximum number of bytes kept from the end of the logs, unlimited if 0
+	LimitBytes int64
+}
+
+// podLogSample records which pod and container logs were sampled for a measurement,
+// so failed analyses can be audited and reproduced later
+type podLogSample struct {
+	Role      string `json:"role"`
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	Bytes     int    `json:"bytes"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// podLogsFetcher reads the logs of the first pod matching a label selector
+type podLogsFetcher func(ctx context.Context, client *kubernetes.Clientset, namespace, labelSelector string, opts podLogOptions) (string, podLogSample, error)
+
+// sampledPodsMetadata serializes the log samples of a measurement for its metadata
+func sampledPodsMetadata(samples []podLogSample) string {
+	b, err := json.Marshal(samples)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// tailBytes keeps the most recent logs within the limit, starting at a line boundary when possible
+func tailBytes(logs string, limit int64) (string, bool) {
+	if limit <= 0 || int64(len(logs)) <= limit {
+		return logs, false
+	}
+	tail := logs[int64(len(logs))-limit:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	return tail, true
+}
@@ -0,0 +1,19 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestTailBytes(t *testing.T) {
+	logs := "first line\nsecond line\nthird line\n"
+	if got, truncated := tailBytes(logs, 0); got != logs || truncated {
+		t.Errorf("expected logs to be kept without a limit, got %q", got)
+	}
+	if got, truncated := tailBytes(logs, 100); got != logs || truncated {
+		t.Errorf("expected logs within the limit to be kept, got %q", got)
+	}
+	got, truncated := tailBytes(logs, 15)
+	if got != "third line\n" || !truncated {
+		t.Errorf("expected the last complete line, got %q (truncated %t)", got, truncated)
+	}
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// sharedLogsTTL bounds how long fetched logs are reused by the metrics of one AnalysisRun.
+// Metrics of the same run are measured in the same reconciliation, so a short TTL is enough
+// and later measurements still see fresh logs.
+const sharedLogsTTL = 30 * time.Second
+
+// sharedLogsFetchTimeout bounds a shared fetch, which is detached from the measurement that started it
+// so that its cancellation doesn't fail the other metrics waiting for the logs
+const sharedLogsFetchTimeout = 2 * time.Minute
+
+// sharedLogsEntry holds the logs fetched for one AnalysisRun and selector.
+// done is closed once the fetch finished, so concurrent metrics wait for a single request.
+type sharedLogsEntry struct {
+	done      chan struct{}
+	logs      string
+	sample    podLogSample
+	err       error
+	fetchedAt time.Time
+}
+
+var sharedLogs = struct {
+	sync.Mutex
+	entries map[string]*sharedLogsEntry
+}{entries: make(map[string]*sharedLogsEntry)}
+
+// readSharedPodLogs returns the logs of the first pod matching labelSelector, fetching them
+// only once for all metrics of the AnalysisRun identified by runUID
+func readSharedPodLogs(ctx context.Context, client *kubernetes.Clientset, runUID, namespace, labelSelector string, opts podLogOptions) (string, podLogSample, error) {
+	key := fmt.Sprintf("%s/%s/%s/%s/%d", runUID, namespace, labelSelector, opts.Container, opts.LimitBytes)
+	now := time.Now()
+
+	sharedLogs.Lock()
+	for k, e := range sharedLogs.entries {
+		select {
+		case <-e.done:
+			if e.err != nil || now.Sub(e.fetchedAt) > sharedLogsTTL {
+				delete(sharedLogs.entries, k)
+			}
+		default:
+		}
+	}
+	entry, ok := sharedLogs.entries[key]
+	if !ok {
+		entry = &sharedLogsEntry{done: make(chan struct{})}
+		sharedLogs.entries[key] = entry
+	}
+	sharedLogs.Unlock()
+
+	if !ok {
+		go func() {
+			fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedLogsFetchTimeout)
+			defer cancel()
+			entry.logs, entry.sample, entry.err = readFirstPodLogs(fetchCtx, client, namespace, labelSelector, opts)
+			entry.fetchedAt = time.Now()
+			if entry.err != nil {
+				// Failed fetches are not shared with later metrics, which fetch again
+				sharedLogs.Lock()
+				if sharedLogs.entries[key] == entry {
+					delete(sharedLogs.entries, key)
+				}
+				sharedLogs.Unlock()
+			}
+			close(entry.done)
+		}()
+	}
+
+	// Every metric waits for the fetch as long as its own context allows
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		return "", podLogSample{}, ctx.Err()
+	}
+	if ok {
+		log.WithContext(ctx).WithFields(log.Fields{
+			"analysisRunUID": runUID,
+			"selector":       labelSelector,
+		}).Debug("Reusing pod logs fetched for another metric of the AnalysisRun")
+	}
+	return entry.logs, entry.sample, entry.err
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestReadSharedPodLogs(t *testing.T) {
+	fetches := 0
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, selector string, _ podLogOptions) (string, podLogSample, error) {
+		fetches++
+		return "logs for " + selector, podLogSample{Pod: "pod-1"}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	for i := 0; i < 3; i++ {
+		logs, _, err := readSharedPodLogs(context.Background(), nil, "run-1", "ns", "app=canary", podLogOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if logs != "logs for app=canary" {
+			t.Errorf("unexpected logs %q", logs)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("expected logs to be fetched once for the same run, got %d fetches", fetches)
+	}
+	if _, _, err := readSharedPodLogs(context.Background(), nil, "run-2", "ns", "app=canary", podLogOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("expected a separate fetch for another run, got %d fetches", fetches)
+	}
+}
+
+func TestReadSharedPodLogsCanceledFetcher(t *testing.T) {
+	release := make(chan struct{})
+	var fetches int32
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string, _ podLogOptions) (string, podLogSample, error) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			return "", podLogSample{}, errors.New("unexpected second fetch")
+		}
+		select {
+		case <-release:
+			return "canary logs", podLogSample{Pod: "pod-1"}, nil
+		case <-ctx.Done():
+			return "", podLogSample{}, ctx.Err()
+		}
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	// The metric that started the fetch gives up, the fetch goes on for the others
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := readSharedPodLogs(ctx, nil, "run-canceled", "ns", "app=canary", podLogOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the canceled metric to stop waiting, got %v", err)
+	}
+	close(release)
+	logs, _, err := readSharedPodLogs(context.Background(), nil, "run-canceled", "ns", "app=canary", podLogOptions{})
+	if err != nil || logs != "canary logs" {
+		t.Fatalf("expected the shared fetch to complete, got %q (%v)", logs, err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("expected a single fetch, got %d", n)
+	}
+}
+
+func TestReadSharedPodLogsErrorNotShared(t *testing.T) {
+	fetches := 0
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(context.Context, *kubernetes.Clientset, string, string, podLogOptions) (string, podLogSample, error) {
+		fetches++
+		if fetches == 1 {
+			return "", podLogSample{}, context.DeadlineExceeded
+		}
+		return "logs", podLogSample{Pod: "pod-1"}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	if _, _, err := readSharedPodLogs(context.Background(), nil, "run-error", "ns", "app=canary", podLogOptions{}); err == nil {
+		t.Fatal("expected the fetch error")
+	}
+	if logs, _, err := readSharedPodLogs(context.Background(), nil, "run-error", "ns", "app=canary", podLogOptions{}); err != nil || logs != "logs" {
+		t.Fatalf("expected the logs to be fetched again, got %q (%v)", logs, err)
+	}
+}
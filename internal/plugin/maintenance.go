@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Maintenance window actions
+const (
+	MaintenanceActionInconclusive = "inconclusive" // Return an Inconclusive measurement
+	MaintenanceActionDefer        = "defer"        // Keep the measurement running until the window ends
+)
+
+// Bounds of the maintenance window duration. The maximum bounds how far back window starts are searched.
+const (
+	minMaintenanceWindowDuration = time.Minute
+	maxMaintenanceWindowDuration = 7 * 24 * time.Hour
+)
+
+// maintenanceWindow is a recurring period during which analyses are suppressed
+type maintenanceWindow struct {
+	// Cron expression (minute hour day-of-month month day-of-week) for the start of the window
+	Schedule string `json:"schedule"`
+	// Length of the window, e.g. "1h"
+	Duration string `json:"duration"`
+	// IANA time zone the schedule is evaluated in (default UTC)
+	TimeZone string `json:"timeZone,omitempty"`
+	// Action during the window: "inconclusive" (default) or "defer"
+	Action string `json:"action,omitempty"`
+}
+
+// activeMaintenanceWindow returns the window containing now, if any, and the time it ends
+func activeMaintenanceWindow(windows []maintenanceWindow, now time.Time) (*maintenanceWindow, time.Time, error) {
+	for i := range windows {
+		w := &windows[i]
+		schedule, err := cron.ParseStandard(w.Schedule)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid maintenance window schedule %q: %v", w.Schedule, err)
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid maintenance window duration %q: %v", w.Duration, err)
+		}
+		if duration < minMaintenanceWindowDuration || duration > maxMaintenanceWindowDuration {
+			return nil, time.Time{}, fmt.Errorf("maintenance window duration %q must be between %s and %s", w.Duration, minMaintenanceWindowDuration, maxMaintenanceWindowDuration)
+		}
+		switch w.Action {
+		case "", MaintenanceActionInconclusive, MaintenanceActionDefer:
+		default:
+			return nil, time.Time{}, fmt.Errorf("invalid maintenance window action %q", w.Action)
+		}
+		loc := time.UTC
+		if w.TimeZone != "" {
+			if loc, err = time.LoadLocation(w.TimeZone); err != nil {
+				return nil, time.Time{}, fmt.Errorf("invalid maintenance window time zone %q: %v", w.TimeZone, err)
+			}
+		}
+
+		// Look for the latest window start within the last duration
+		local := now.In(loc)
+		start := schedule.Next(local.Add(-duration))
+		if start.IsZero() || start.After(local) {
+			continue
+		}
+		for next := schedule.Next(start); !next.IsZero() && !next.After(local); next = schedule.Next(next) {
+			start = next
+		}
+		return w, start.Add(duration), nil
+	}
+	return nil, time.Time{}, nil
+}
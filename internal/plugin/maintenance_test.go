@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveMaintenanceWindow(t *testing.T) {
+	windows := []maintenanceWindow{{Schedule: "0 2 * * *", Duration: "1h", Action: MaintenanceActionDefer}}
+
+	now := time.Date(2024, 10, 1, 2, 30, 0, 0, time.UTC)
+	window, end, err := activeMaintenanceWindow(windows, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if window == nil {
+		t.Fatal("expected an active maintenance window")
+	}
+	if !end.Equal(time.Date(2024, 10, 1, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected window end %s", end)
+	}
+
+	window, _, err = activeMaintenanceWindow(windows, now.Add(time.Hour))
+	if err != nil || window != nil {
+		t.Fatalf("expected no active window after it ended, got %v (err %v)", window, err)
+	}
+
+	if _, _, err := activeMaintenanceWindow([]maintenanceWindow{{Schedule: "0 2 * * *", Duration: "soon"}}, now); err == nil {
+		t.Fatal("expected error for invalid duration")
+	}
+	for _, duration := range []string{"30s", "0s", "169h"} {
+		if _, _, err := activeMaintenanceWindow([]maintenanceWindow{{Schedule: "0 2 * * *", Duration: duration}}, now); err == nil {
+			t.Errorf("expected error for out of bounds duration %s", duration)
+		}
+	}
+
+	// Overlapping windows end a duration after the latest start
+	window, end, err = activeMaintenanceWindow([]maintenanceWindow{{Schedule: "*/15 * * * *", Duration: "1h"}}, now)
+	if err != nil || window == nil || !end.Equal(time.Date(2024, 10, 1, 3, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected the window of the latest start to end at 03:30, got %v %s (err %v)", window, end, err)
+	}
+	// The schedule is evaluated in the time zone of the window
+	window, end, err = activeMaintenanceWindow([]maintenanceWindow{{Schedule: "0 4 * * *", Duration: "1h", TimeZone: "Europe/Madrid"}}, now)
+	if err != nil || window == nil || !end.Equal(time.Date(2024, 10, 1, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the window to end at 03:00 UTC, got %v %s (err %v)", window, end, err)
+	}
+}
+
+func TestMaintenanceWindowSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		at      time.Time
+		active  bool
+		wantErr bool
+	}{
+		{name: "every minute", expr: "* * * * *", at: time.Date(2024, 10, 1, 13, 7, 0, 0, time.UTC), active: true},
+		{name: "step", expr: "*/15 * * * *", at: time.Date(2024, 10, 1, 3, 45, 0, 0, time.UTC), active: true},
+		{name: "range and list", expr: "0 1-3,22 * * *", at: time.Date(2024, 10, 1, 22, 0, 0, 0, time.UTC), active: true},
+		{name: "weekday", expr: "0 0 * * 1-5", at: time.Date(2024, 10, 6, 0, 0, 0, 0, time.UTC), active: false},
+		{name: "dom or dow", expr: "0 0 1 * 0", at: time.Date(2024, 10, 6, 0, 0, 0, 0, time.UTC), active: true},
+		{name: "named weekdays", expr: "0 0 * * MON-FRI", at: time.Date(2024, 10, 7, 0, 0, 0, 0, time.UTC), active: true},
+		{name: "named weekdays weekend", expr: "0 0 * * mon-fri", at: time.Date(2024, 10, 6, 0, 0, 0, 0, time.UTC), active: false},
+		{name: "named months", expr: "0 0 1 JAN,OCT *", at: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), active: true},
+		{name: "descriptor", expr: "@daily", at: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC), active: true},
+		{name: "unknown name", expr: "0 0 * * MONDAY", wantErr: true},
+		{name: "too few fields", expr: "0 2 * *", wantErr: true},
+		{name: "out of range", expr: "60 * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, _, err := activeMaintenanceWindow([]maintenanceWindow{{Schedule: tt.expr, Duration: "1m"}}, tt.at)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", tt.expr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if active := window != nil; active != tt.active {
+				t.Errorf("expected active=%v for %q at %s, got %v", tt.active, tt.expr, tt.at, active)
+			}
+		})
+	}
+}
@@ -0,0 +1,456 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genai"
+)
+
+// mcpProtocolVersion is the Model Context Protocol version requested from the servers
+const mcpProtocolVersion = "2025-06-18"
+
+// defaultMaxToolCalls bounds the tool calls of an analysis when maxToolCalls is not set
+const defaultMaxToolCalls = 10
+
+// maxToolOutputLength bounds the characters of a tool result sent to the model
+const maxToolOutputLength = 20000
+
+// mcpHTTPClient calls the MCP servers
+var mcpHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// mcpToolNameInvalidChars matches the characters not allowed in Gemini function names
+var mcpToolNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// mcpInvestigationPrompt asks the model to investigate with the tools before the analysis
+const mcpInvestigationPrompt = "Before answering, you can call the available tools to investigate the canary, " +
+	"e.g. to read its metrics, events, resources or recent changes. Only call tools that help the decision. " +
+	"When you are done, summarize your findings."
+
+// mcpFinalPrompt asks the model for the analysis once the investigation is done
+const mcpFinalPrompt = "Now answer with the analysis, based on the logs and the results of the tools."
+
+// mcpServerConfig is a Model Context Protocol server whose tools the model can call in default mode
+type mcpServerConfig struct {
+	// Name prefixes the tools of the server, e.g. prometheus
+	Name string `json:"name"`
+	// URL of the Streamable HTTP endpoint, e.g. http://prometheus-mcp.monitoring:8080/mcp
+	URL string `json:"url"`
+	// Secret key in the AnalysisRun namespace with the bearer token of the server
+	TokenSecretRef *secretKeyRef `json:"tokenSecretRef,omitempty"`
+	// Tools exposed to the model, all tools of the server when empty
+	Tools []string `json:"tools,omitempty"`
+	// token is read from TokenSecretRef
+	token string
+}
+
+// mcpTool is a tool of an MCP server
+type mcpTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// mcpSession is a session with an MCP server
+type mcpSession struct {
+	server    mcpServerConfig
+	sessionID string
+	nextID    int
+}
+
+// mcpToolset maps the function names given to the model to the tools of the MCP servers
+type mcpToolset struct {
+	sessions     []*mcpSession
+	declarations []*genai.FunctionDeclaration
+	tools        map[string]mcpToolRef
+}
+
+type mcpToolRef struct {
+	session *mcpSession
+	name    string
+}
+
+// validateMCPServers checks the mcpServers of a metric
+func validateMCPServers(servers []mcpServerConfig) error {
+	names := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if server.Name == "" || mcpToolNameInvalidChars.MatchString(server.Name) {
+			return fmt.Errorf("invalid mcpServers name %q, it must contain only letters, digits, underscores, dots and dashes", server.Name)
+		}
+		if names[server.Name] {
+			return fmt.Errorf("duplicate mcpServers %s", server.Name)
+		}
+		names[server.Name] = true
+		if u, err := url.Parse(server.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid mcpServers %s url %q, expected an http or https URL", server.Name, server.URL)
+		}
+	}
+	return nil
+}
+
+// mcpServersWithTokens returns the MCP servers with the bearer tokens of their secret references
+func mcpServersWithTokens(ctx context.Context, servers []mcpServerConfig) ([]mcpServerConfig, error) {
+	resolved := make([]mcpServerConfig, len(servers))
+	for i, server := range servers {
+		resolved[i] = server
+		if server.TokenSecretRef == nil {
+			continue
+		}
+		token, err := readSecretKeyRef(ctx, server.TokenSecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mcpServers %s token: %v", server.Name, err)
+		}
+		resolved[i].token = token
+	}
+	return resolved, nil
+}
+
+// connectMCPServers opens sessions with the MCP servers and lists their tools. Servers that cannot
+// be reached are left out, the analysis runs with the tools of the others.
+func connectMCPServers(ctx context.Context, servers []mcpServerConfig) *mcpToolset {
+	toolset := &mcpToolset{tools: make(map[string]mcpToolRef)}
+	for _, server := range servers {
+		session := &mcpSession{server: server}
+		tools, err := session.connect(ctx)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).WithField("mcpServer", server.Name).Warn("Failed to connect to MCP server, analyzing without its tools")
+			continue
+		}
+		toolset.sessions = append(toolset.sessions, session)
+		for _, tool := range tools {
+			if len(server.Tools) > 0 && !slices.Contains(server.Tools, tool.Name) {
+				continue
+			}
+			name := mcpFunctionName(server.Name, tool.Name)
+			declaration := &genai.FunctionDeclaration{Name: name, Description: tool.Description}
+			if len(tool.InputSchema) > 0 {
+				var schema map[string]interface{}
+				if err := json.Unmarshal(tool.InputSchema, &schema); err == nil {
+					declaration.ParametersJsonSchema = schema
+				}
+			}
+			toolset.declarations = append(toolset.declarations, declaration)
+			toolset.tools[name] = mcpToolRef{session: session, name: tool.Name}
+		}
+	}
+	return toolset
+}
+
+// call calls a tool by its function name, tool errors are returned as output for the model
+func (t *mcpToolset) call(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	ref, ok := t.tools[name]
+	if !ok {
+		return "", fmt.Errorf("unknown tool %s", name)
+	}
+	return ref.session.callTool(ctx, ref.name, args)
+}
+
+// close ends the sessions with the MCP servers
+func (t *mcpToolset) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, session := range t.sessions {
+		session.close(ctx)
+	}
+}
+
+// mcpFunctionName returns the function name of a tool given to the model, prefixed with the server
+// name so tools of different servers don't clash
+func mcpFunctionName(server, tool string) string {
+	name := mcpToolNameInvalidChars.ReplaceAllString(server+"_"+tool, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// connect initializes the session and lists the tools of the server
+func (s *mcpSession) connect(ctx context.Context) ([]mcpTool, error) {
+	var initResult struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	err := s.rpc(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "rollouts-plugin-metric-ai", "version": "1.0.0"},
+	}, &initResult)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.notify(ctx, "notifications/initialized"); err != nil {
+		return nil, err
+	}
+
+	var tools []mcpTool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []mcpTool `json:"tools"`
+			NextCursor string    `json:"nextCursor,omitempty"`
+		}
+		if err := s.rpc(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// callTool calls a tool of the server and returns its text content
+func (s *mcpSession) callTool(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text,omitempty"`
+		} `json:"content"`
+		StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+		IsError           bool            `json:"isError,omitempty"`
+	}
+	if err := s.rpc(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": args}, &result); err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, content := range result.Content {
+		if content.Type == "text" {
+			texts = append(texts, content.Text)
+		}
+	}
+	output := strings.Join(texts, "\n")
+	if output == "" && len(result.StructuredContent) > 0 {
+		output = string(result.StructuredContent)
+	}
+	output = truncate(output, maxToolOutputLength)
+	if result.IsError {
+		return "", fmt.Errorf("tool %s failed: %s", name, output)
+	}
+	return output, nil
+}
+
+// close ends the session, servers without sessions ignore it
+func (s *mcpSession) close(ctx context.Context) {
+	if s.sessionID == "" {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.server.URL, nil)
+	if err != nil {
+		return
+	}
+	s.setHeaders(req)
+	if resp, err := mcpHTTPClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// notify sends a notification to the server
+func (s *mcpSession) notify(ctx context.Context, method string) error {
+	resp, err := s.post(ctx, map[string]interface{}{"jsonrpc": "2.0", "method": method})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mcp server %s returned status %d for %s", s.server.Name, resp.StatusCode, method)
+	}
+	return nil
+}
+
+// rpc calls a JSON-RPC method of the server and decodes its result. Servers answer with JSON or
+// with an event stream carrying the response.
+func (s *mcpSession) rpc(ctx context.Context, method string, params interface{}, result interface{}) error {
+	s.nextID++
+	id := s.nextID
+	resp, err := s.post(ctx, map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("mcp server %s returned status %d for %s", s.server.Name, resp.StatusCode, method)
+	}
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		s.sessionID = sessionID
+	}
+
+	var body []byte
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err = mcpEventStreamResponse(resp.Body, id)
+	} else {
+		body, err = io.ReadAll(resp.Body)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read mcp server %s response to %s: %v", s.server.Name, method, err)
+	}
+	var rpcResp jsonRPCResponse
+	if err := json.Unmarshal(body, &rpcResp); err != nil {
+		return fmt.Errorf("failed to decode mcp server %s response to %s: %v", s.server.Name, method, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("mcp server %s returned error %d for %s: %s", s.server.Name, rpcResp.Error.Code, method, rpcResp.Error.Message)
+	}
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return fmt.Errorf("failed to decode mcp server %s result of %s: %v", s.server.Name, method, err)
+	}
+	return nil
+}
+
+// post sends a JSON-RPC message to the server
+func (s *mcpSession) post(ctx context.Context, message map[string]interface{}) (*http.Response, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal mcp request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.server.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mcp request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	s.setHeaders(req)
+	resp, err := mcpHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send mcp request to %s: %v", s.server.Name, err)
+	}
+	return resp, nil
+}
+
+// setHeaders sets the session, protocol version and authorization headers of a request
+func (s *mcpSession) setHeaders(req *http.Request) {
+	if s.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", s.sessionID)
+		req.Header.Set("MCP-Protocol-Version", mcpProtocolVersion)
+	}
+	if s.server.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.server.token)
+	}
+}
+
+// mcpEventStreamResponse reads the JSON-RPC response with the id from an event stream, skipping the
+// notifications and requests of the server
+func mcpEventStreamResponse(stream io.Reader, id int) ([]byte, error) {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data []string
+	for {
+		more := scanner.Scan()
+		line := scanner.Text()
+		if !more || line == "" {
+			// End of an event
+			if len(data) > 0 {
+				event := []byte(strings.Join(data, "\n"))
+				var message struct {
+					ID json.RawMessage `json:"id"`
+				}
+				if json.Unmarshal(event, &message) == nil && string(message.ID) == fmt.Sprintf("%d", id) {
+					return event, nil
+				}
+				data = nil
+			}
+			if !more {
+				break
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "data:") {
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no response in the event stream")
+}
+
+// investigateWithTools lets the model call the tools of the MCP servers before the analysis. It
+// returns the conversation extended with the tool calls and results, the number of tool calls and
+// the tokens used.
+func investigateWithTools(ctx context.Context, client *genai.Client, params AIAnalysisParams, contents []*genai.Content) ([]*genai.Content, int, int, int, error) {
+	toolset := connectMCPServers(ctx, params.MCPServers)
+	defer toolset.close()
+	if len(toolset.declarations) == 0 {
+		log.WithContext(ctx).Warn("No MCP tools available, analyzing without tools")
+		return contents, 0, 0, 0, nil
+	}
+	maxToolCalls := params.MaxToolCalls
+	if maxToolCalls <= 0 {
+		maxToolCalls = defaultMaxToolCalls
+	}
+
+	contents = append(append([]*genai.Content(nil), contents...), genai.NewContentFromText(mcpInvestigationPrompt, genai.RoleUser))
+	config := &genai.GenerateContentConfig{
+		Tools:          []*genai.Tool{{FunctionDeclarations: toolset.declarations}},
+		SafetySettings: params.SafetySettings,
+		Temperature:    params.Temperature,
+		Seed:           params.Seed,
+	}
+	toolCalls, promptTokens, outputTokens := 0, 0, 0
+	for {
+		var resp *genai.GenerateContentResponse
+		err := retryWithBackoff(ctx, func() error {
+			var apiErr error
+			start := time.Now()
+			resp, apiErr = client.Models.GenerateContent(ctx, params.ModelName, contents, config)
+			recordModelCall(params.ModelName, time.Since(start), apiErr)
+			return apiErr
+		}, 3)
+		if err == nil {
+			err = blockedResponseError(resp)
+		}
+		if err != nil {
+			return nil, 0, 0, 0, err
+		}
+		p, o := usageTokens(resp)
+		promptTokens, outputTokens = promptTokens+p, outputTokens+o
+
+		calls := resp.FunctionCalls()
+		if len(calls) == 0 {
+			if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+				contents = append(contents, resp.Candidates[0].Content)
+			}
+			break
+		}
+		if toolCalls+len(calls) > maxToolCalls {
+			log.WithContext(ctx).WithField("maxToolCalls", maxToolCalls).Warn("Tool call limit reached, analyzing with the results so far")
+			break
+		}
+		contents = append(contents, resp.Candidates[0].Content)
+		parts := make([]*genai.Part, 0, len(calls))
+		for _, call := range calls {
+			toolCalls++
+			log.WithContext(ctx).WithField("tool", call.Name).Info("Calling MCP tool")
+			response := map[string]interface{}{}
+			if output, err := toolset.call(ctx, call.Name, call.Args); err != nil {
+				log.WithContext(ctx).WithError(err).WithField("tool", call.Name).Warn("MCP tool call failed")
+				response["error"] = err.Error()
+			} else {
+				response["output"] = output
+			}
+			part := genai.NewPartFromFunctionResponse(call.Name, response)
+			part.FunctionResponse.ID = call.ID
+			parts = append(parts, part)
+		}
+		contents = append(contents, genai.NewContentFromParts(parts, genai.RoleUser))
+	}
+	contents = append(contents, genai.NewContentFromText(mcpFinalPrompt, genai.RoleUser))
+	return contents, toolCalls, promptTokens, outputTokens, nil
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+// newMCPTestServer serves tools echo and fail of an MCP server, answering tools/call with an event
+// stream and paginating tools/list
+func newMCPTestServer(t *testing.T, token string) (*httptest.Server, *[]string) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			requests = append(requests, "delete "+r.Header.Get("Mcp-Session-Id"))
+			return
+		}
+		var req struct {
+			ID     json.RawMessage        `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("invalid MCP request: %v", err)
+		}
+		requests = append(requests, req.Method)
+		if req.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "session-1" {
+			t.Errorf("expected the session header on %s", req.Method)
+		}
+		var result interface{}
+		switch req.Method {
+		case "initialize":
+			w.Header().Set("Mcp-Session-Id", "session-1")
+			result = map[string]interface{}{"protocolVersion": mcpProtocolVersion}
+		case "notifications/initialized":
+			w.WriteHeader(http.StatusAccepted)
+			return
+		case "tools/list":
+			if req.Params["cursor"] == nil {
+				result = map[string]interface{}{
+					"tools":      []interface{}{map[string]interface{}{"name": "echo", "description": "Echoes", "inputSchema": map[string]interface{}{"type": "object"}}},
+					"nextCursor": "2",
+				}
+			} else {
+				result = map[string]interface{}{"tools": []interface{}{map[string]interface{}{"name": "fail"}, map[string]interface{}{"name": "hidden"}}}
+			}
+		case "tools/call":
+			args, _ := req.Params["arguments"].(map[string]interface{})
+			result = map[string]interface{}{
+				"content": []interface{}{map[string]interface{}{"type": "text", "text": fmt.Sprintf("%v", args["text"])}},
+				"isError": req.Params["name"] == "fail",
+			}
+			response, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\nevent: message\ndata: %s\n\n", response)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestMCPToolset(t *testing.T) {
+	server, requests := newMCPTestServer(t, "secret")
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	toolset := connectMCPServers(context.Background(), []mcpServerConfig{
+		{Name: "down", URL: down.URL},
+		{Name: "test", URL: server.URL, Tools: []string{"echo", "fail"}, token: "secret"},
+	})
+	var names []string
+	for _, declaration := range toolset.declarations {
+		names = append(names, declaration.Name)
+	}
+	if !slices.Equal(names, []string{"test_echo", "test_fail"}) {
+		t.Fatalf("expected the allowed tools of the reachable server, got %v", names)
+	}
+	if toolset.declarations[0].ParametersJsonSchema == nil {
+		t.Error("expected the input schema of the tool")
+	}
+
+	output, err := toolset.call(context.Background(), "test_echo", map[string]interface{}{"text": "hello"})
+	if err != nil || output != "hello" {
+		t.Errorf("expected the tool output from the event stream, got %q, error %v", output, err)
+	}
+	if _, err := toolset.call(context.Background(), "test_fail", map[string]interface{}{"text": "boom"}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected the tool error, got %v", err)
+	}
+	if _, err := toolset.call(context.Background(), "test_hidden", nil); err == nil {
+		t.Error("expected an error for a tool that is not allowed")
+	}
+	toolset.close()
+	want := []string{"initialize", "notifications/initialized", "tools/list", "tools/list", "tools/call", "tools/call", "delete session-1"}
+	if !slices.Equal(*requests, want) {
+		t.Errorf("expected requests %v, got %v", want, *requests)
+	}
+
+	if name := mcpFunctionName("git hub", strings.Repeat("x", 80)); len(name) != 64 || !strings.HasPrefix(name, "git_hub_x") {
+		t.Errorf("expected a sanitized function name of 64 characters, got %q", name)
+	}
+	for _, servers := range [][]mcpServerConfig{
+		{{Name: "", URL: server.URL}},
+		{{Name: "a b", URL: server.URL}},
+		{{Name: "a", URL: "ftp://host"}},
+		{{Name: "a", URL: server.URL}, {Name: "a", URL: server.URL}},
+	} {
+		if err := validateMCPServers(servers); err == nil {
+			t.Errorf("expected servers %+v to be invalid", servers)
+		}
+	}
+	if err := validateMCPServers([]mcpServerConfig{{Name: "prometheus", URL: server.URL}}); err != nil {
+		t.Errorf("expected valid servers, got %v", err)
+	}
+}
+
+func TestInvestigateWithTools(t *testing.T) {
+	mcpServer, _ := newMCPTestServer(t, "")
+	var generateRequests []string
+	gemini := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		generateRequests = append(generateRequests, string(body))
+		var part map[string]interface{}
+		switch {
+		case !strings.Contains(string(body), `"tools"`):
+			part = map[string]interface{}{"text": `{"text":"checked","promote":true,"confidence":90,"severity":"none","rootCause":"","remediation":""}`}
+		case !strings.Contains(string(body), "functionResponse"):
+			part = map[string]interface{}{"functionCall": map[string]interface{}{"id": "call-1", "name": "test_echo", "args": map[string]interface{}{"text": "no errors"}}}
+		default:
+			part = map[string]interface{}{"text": "The metrics look fine."}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"candidates":    []interface{}{map[string]interface{}{"content": map[string]interface{}{"role": "model", "parts": []interface{}{part}}}},
+			"usageMetadata": map[string]interface{}{"promptTokenCount": 10, "candidatesTokenCount": 5},
+		})
+	}))
+	t.Cleanup(gemini.Close)
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: gemini.URL},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	params := AIAnalysisParams{ModelName: "gemini-2.0-flash", MCPServers: []mcpServerConfig{{Name: "test", URL: mcpServer.URL}}}
+	contents := []*genai.Content{genai.NewContentFromText("analyze", genai.RoleUser)}
+	investigated, toolCalls, promptTokens, outputTokens, err := investigateWithTools(context.Background(), client, params, contents)
+	if err != nil {
+		t.Fatalf("investigation failed: %v", err)
+	}
+	if toolCalls != 1 || promptTokens != 20 || outputTokens != 10 {
+		t.Errorf("expected 1 tool call and the tokens of 2 requests, got %d calls, %d and %d tokens", toolCalls, promptTokens, outputTokens)
+	}
+	if len(generateRequests) != 2 || !strings.Contains(generateRequests[1], `"output":"no errors"`) || !strings.Contains(generateRequests[1], `"id":"call-1"`) {
+		t.Errorf("expected the tool output in the second request, got %v", generateRequests)
+	}
+	// Prompt, investigation instructions, call, response, findings and final instructions
+	if len(investigated) != 6 || investigated[len(investigated)-1].Parts[0].Text != mcpFinalPrompt {
+		t.Errorf("expected the conversation to end with the final instructions, got %d contents", len(investigated))
+	}
+
+	// Calls over the limit are not made
+	generateRequests = nil
+	params.MaxToolCalls = 1
+	gemini.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		generateRequests = append(generateRequests, "")
+		json.NewEncoder(w).Encode(map[string]interface{}{"candidates": []interface{}{map[string]interface{}{"content": map[string]interface{}{
+			"role": "model", "parts": []interface{}{map[string]interface{}{"functionCall": map[string]interface{}{"name": "test_echo"}}},
+		}}}})
+	})
+	if _, toolCalls, _, _, err = investigateWithTools(context.Background(), client, params, contents); err != nil || toolCalls != 1 || len(generateRequests) != 2 {
+		t.Errorf("expected the investigation to stop at the limit, got %d calls, %d requests, error %v", toolCalls, len(generateRequests), err)
+	}
+}
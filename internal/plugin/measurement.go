@@ -0,0 +1,818 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"github.com/argoproj/argo-rollouts/utils/evaluate"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genai"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// measurementSettings are the values parsed from a validated plugin configuration
+type measurementSettings struct {
+	analysisMode       string
+	timeout            time.Duration
+	initialDelay       time.Duration
+	cacheTTL           time.Duration
+	trafficWaitTimeout time.Duration
+	agentTimeout       time.Duration
+	baseline           cohort
+	candidates         []cohort
+	preset             string
+	safetySettings     []*genai.SafetySetting
+}
+
+// validatePluginConfig checks the plugin configuration before any logs are fetched or the model is
+// called, so a misconfigured metric fails fast instead of after the expensive steps. Named agents
+// are resolved to their agentUrl.
+func validatePluginConfig(cfg *aiConfig) (measurementSettings, error) {
+	settings := measurementSettings{analysisMode: cfg.AnalysisMode, trafficWaitTimeout: defaultTrafficWaitTimeout}
+	if settings.analysisMode == "" {
+		settings.analysisMode = AnalysisModeDefault
+	}
+	agentMode := settings.analysisMode == AnalysisModeAgent
+
+	var err error
+	if cfg.Timeout != "" {
+		if settings.timeout, err = time.ParseDuration(cfg.Timeout); err != nil {
+			return settings, fmt.Errorf("invalid timeout %q: %v", cfg.Timeout, err)
+		}
+	}
+	if cfg.InitialDelay != "" {
+		if settings.initialDelay, err = time.ParseDuration(cfg.InitialDelay); err != nil {
+			return settings, fmt.Errorf("invalid initialDelay %q: %v", cfg.InitialDelay, err)
+		}
+	}
+	if cfg.CacheTTL != "" {
+		if settings.cacheTTL, err = time.ParseDuration(cfg.CacheTTL); err != nil {
+			return settings, fmt.Errorf("invalid cacheTTL %q: %v", cfg.CacheTTL, err)
+		}
+	}
+	if len(cfg.Cohorts) > 0 {
+		if settings.baseline, settings.candidates, err = splitCohorts(cfg.Cohorts); err != nil {
+			return settings, err
+		}
+	}
+	if err := validateModelRouting(cfg.ModelRouting); err != nil {
+		return settings, err
+	}
+	if cfg.MinRequests > 0 {
+		if _, err := countRequests("", cfg.TrafficMarker); err != nil {
+			return settings, err
+		}
+		if cfg.TrafficWaitTimeout != "" {
+			if settings.trafficWaitTimeout, err = time.ParseDuration(cfg.TrafficWaitTimeout); err != nil {
+				return settings, fmt.Errorf("invalid trafficWaitTimeout %q: %v", cfg.TrafficWaitTimeout, err)
+			}
+		}
+	}
+	if cfg.Temperature != nil && (*cfg.Temperature < 0 || *cfg.Temperature > 2) {
+		return settings, fmt.Errorf("temperature %v is not between 0 and 2", *cfg.Temperature)
+	}
+	if cfg.Samples < 0 || cfg.Samples > maxSamples {
+		return settings, fmt.Errorf("samples %d is not between 1 and %d", cfg.Samples, maxSamples)
+	}
+	if cfg.Samples > 1 && agentMode {
+		return settings, fmt.Errorf("samples are not supported in agent mode")
+	}
+	if cfg.AgentName != "" {
+		if cfg.AgentURL, err = namedAgentURL(cfg.Agents, cfg.AgentName); err != nil {
+			return settings, err
+		}
+	}
+	if err := validateAgentEndpoint(cfg.AgentURL, cfg.AgentProtocol, cfg.AgentPath, cfg.AgentHealthPath); err != nil {
+		return settings, err
+	}
+	if cfg.AgentTimeout != "" {
+		if settings.agentTimeout, err = time.ParseDuration(cfg.AgentTimeout); err != nil || settings.agentTimeout <= 0 {
+			return settings, fmt.Errorf("invalid agentTimeout %q, expected a positive duration", cfg.AgentTimeout)
+		}
+	}
+	if err := validateAgentCompression(cfg.AgentCompression); err != nil {
+		return settings, err
+	}
+	if err := validateAgentFallback(cfg.AgentFallback); err != nil {
+		return settings, err
+	}
+	if err := validateBudget(cfg.Budget); err != nil {
+		return settings, err
+	}
+	if settings.preset, err = resolvePreset(cfg.Preset); err != nil {
+		return settings, err
+	}
+	if settings.safetySettings, err = parseSafetySettings(cfg.SafetySettings); err != nil {
+		return settings, err
+	}
+	if len(cfg.OutputFields) > 0 && agentMode {
+		return settings, fmt.Errorf("outputFields are not supported in agent mode")
+	}
+	if err := validateOutputFields(cfg.OutputFields); err != nil {
+		return settings, err
+	}
+	if len(cfg.MCPServers) > 0 && agentMode {
+		return settings, fmt.Errorf("mcpServers are not supported in agent mode")
+	}
+	if cfg.MaxToolCalls < 0 {
+		return settings, fmt.Errorf("maxToolCalls %d must not be negative", cfg.MaxToolCalls)
+	}
+	if err := validateMCPServers(cfg.MCPServers); err != nil {
+		return settings, err
+	}
+	if _, _, err := measurementValue(cfg.MeasurementValue, AIAnalysisResult{}); err != nil {
+		return settings, err
+	}
+	if _, _, err := severityPhase(cfg.SeverityPolicy, AIAnalysisResult{}); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// measurementRun is the state of a measurement passed between the fetch, analyze, evaluate and
+// report steps of run. Each step returns true with the measurement when it finished it early.
+type measurementRun struct {
+	analysisRun   *v1alpha1.AnalysisRun
+	metric        v1alpha1.Metric
+	cfg           aiConfig
+	settings      measurementSettings
+	startTime     metav1.Time
+	agentJobID    string
+	correlation   string
+	measurement   v1alpha1.Measurement
+	modelName     string
+	systemPrompt  string
+	promptVersion string
+
+	// Set by fetchLogs
+	kubeClient       *kubernetes.Clientset
+	podClient        *kubernetes.Clientset
+	stableSelector   string
+	canarySelector   string
+	stableLogs       string
+	canaryLogs       string
+	logsContext      string
+	samples          []podLogSample
+	observedRequests int
+	logsOmitted      string
+
+	// Set by analyze
+	params       AIAnalysisParams
+	analysisJSON string
+	result       AIAnalysisResult
+	outputValues map[string]interface{}
+	cached       bool
+	skipped      bool
+
+	// Set by evaluate
+	phase v1alpha1.AnalysisPhase
+}
+
+// fetchLogs reads the stable and canary logs, waiting for canary traffic when required and
+// replacing logs that are mostly noise with the pod status and events
+func (r *measurementRun) fetchLogs(ctx context.Context) (v1alpha1.Measurement, bool) {
+	cfg := &r.cfg
+	r.stableSelector, r.canarySelector = resolvePodSelectors(ctx, r.analysisRun, *cfg)
+	logOpts := podLogOptions{Container: cfg.Container, LimitBytes: cfg.MaxLogBytes}
+	stableLogOpts := logOpts
+	if len(r.settings.candidates) > 0 {
+		r.stableSelector, r.canarySelector = r.settings.baseline.Selector, r.settings.candidates[0].Selector
+		stableLogOpts = r.settings.baseline.logOptions(logOpts)
+		cfg.ExtraPrompt += cohortPromptNote(r.settings.baseline, r.settings.candidates)
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"stableSelector": r.stableSelector,
+		"canarySelector": r.canarySelector,
+		"model":          r.modelName,
+	}).Info("Fetching pod logs for analysis")
+
+	// Get Kubernetes client
+	var err error
+	r.kubeClient, err = acquireKubeClient()
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to acquire Kubernetes client")
+		return markMeasurementError(r.measurement, err), true
+	}
+	// The pods may run in another cluster, reports and caches stay in the controller cluster
+	r.podClient = r.kubeClient
+	if cfg.ClusterSecretRef != nil {
+		r.podClient, err = clusterClient(ctx, cfg.ClusterSecretRef)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to create client of the pods cluster")
+			return markMeasurementError(r.measurement, err), true
+		}
+	}
+
+	// Fetch logs, once per AnalysisRun when several metrics share them
+	ns := r.analysisRun.Namespace
+	fetchLogs := readFirstPodLogs
+	if cfg.ShareLogs && r.analysisRun.UID != "" {
+		fetchLogs = func(ctx context.Context, client *kubernetes.Clientset, namespace, labelSelector string, opts podLogOptions) (string, podLogSample, error) {
+			return readSharedPodLogs(ctx, client, string(r.analysisRun.UID), namespace, labelSelector, opts)
+		}
+	}
+	fetchLogs = tracedLogsFetcher(fetchLogs)
+	stableLogs, stableSample, err := fetchLogs(ctx, r.podClient, ns, r.stableSelector, stableLogOpts)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to fetch stable pod logs")
+		return markMeasurementError(r.measurement, err), true
+	}
+	stableSample.Role = "stable"
+	r.samples = []podLogSample{stableSample}
+
+	var canaryLogs string
+	if len(r.settings.candidates) > 0 {
+		var cohortSamples []podLogSample
+		canaryLogs, cohortSamples, err = fetchCohortLogs(ctx, fetchLogs, r.podClient, ns, r.settings.candidates, logOpts)
+		r.samples = append(r.samples, cohortSamples...)
+	} else {
+		var canarySample podLogSample
+		canaryLogs, canarySample, err = fetchLogs(ctx, r.podClient, ns, r.canarySelector, logOpts)
+		canarySample.Role = "canary"
+		r.samples = append(r.samples, canarySample)
+	}
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.WithContext(ctx).WithError(err).Warn("Canary pods not found, marking as successful")
+			m := r.measurement
+			m.Value = "1"
+			m.Phase = v1alpha1.AnalysisPhaseSuccessful
+			finishedTime := metav1.Now()
+			m.FinishedAt = &finishedTime
+			return m, true
+		}
+		log.WithContext(ctx).WithError(err).Error("Failed to fetch canary pod logs")
+		return markMeasurementError(r.measurement, err), true
+	}
+
+	log.WithContext(ctx).WithFields(log.Fields{
+		"stableLogsLength": len(stableLogs),
+		"canaryLogsLength": len(canaryLogs),
+	}).Info("Successfully fetched pod logs")
+
+	// Wait for the canary to handle real traffic so the verdict is not based on startup output only
+	r.observedRequests = -1
+	if cfg.MinRequests > 0 {
+		// The traffic marker was validated with the configuration
+		r.observedRequests, _ = countRequests(canaryLogs, cfg.TrafficMarker)
+		if r.observedRequests < cfg.MinRequests {
+			if time.Since(r.startTime.Time) < r.settings.trafficWaitTimeout {
+				log.WithContext(ctx).WithFields(log.Fields{
+					"observedRequests": r.observedRequests,
+					"minRequests":      cfg.MinRequests,
+				}).Info("Waiting for canary traffic before analyzing")
+				return markMeasurementWaitingForTraffic(r.measurement, r.observedRequests), true
+			}
+			log.WithContext(ctx).WithFields(log.Fields{
+				"observedRequests": r.observedRequests,
+				"minRequests":      cfg.MinRequests,
+			}).Warn("Timed out waiting for canary traffic, analyzing available logs")
+			cfg.ExtraPrompt += fmt.Sprintf("\nThe canary handled only %d requests (%d expected) while waiting for traffic, "+
+				"so its logs may mostly show startup output.", r.observedRequests, cfg.MinRequests)
+		}
+	}
+
+	// Logs that are mostly binary or base64 content waste tokens and confuse the model,
+	// analyze pod status and events instead
+	noiseThreshold := defaultNoiseThreshold
+	if cfg.NoiseThreshold != nil {
+		noiseThreshold = *cfg.NoiseThreshold
+	}
+	stableNoise, canaryNoise := logNoiseRatio(stableLogs), logNoiseRatio(canaryLogs)
+	if noiseThreshold < 1 && stableNoise > noiseThreshold && canaryNoise > noiseThreshold {
+		r.logsOmitted = fmt.Sprintf("stable and canary logs are %.0f%% and %.0f%% binary or base64 content", stableNoise*100, canaryNoise*100)
+		log.WithContext(ctx).WithField("reason", r.logsOmitted).Warn("Logs are mostly noise, analyzing pod status and events only")
+
+		stableStatus, statusErr := readPodStatusContext(ctx, r.podClient, ns, r.stableSelector)
+		if statusErr != nil {
+			log.WithContext(ctx).WithError(statusErr).Error("Failed to fetch stable pod status")
+			return markMeasurementError(r.measurement, statusErr), true
+		}
+		canaryStatus, statusErr := readPodStatusContext(ctx, r.podClient, ns, r.canarySelector)
+		if statusErr != nil {
+			log.WithContext(ctx).WithError(statusErr).Error("Failed to fetch canary pod status")
+			return markMeasurementError(r.measurement, statusErr), true
+		}
+		note := "NOTE: the logs were omitted because " + r.logsOmitted + ". " +
+			"Base the analysis on the pod status and Kubernetes events below only.\n"
+		stableLogs = note + stableStatus
+		canaryLogs = note + canaryStatus
+	}
+
+	r.stableLogs, r.canaryLogs = stableLogs, canaryLogs
+	r.logsContext = "--- STABLE LOGS ---\n" + stableLogs + "\n\n--- CANARY LOGS ---\n" + canaryLogs
+	return r.measurement, false
+}
+
+// analyze asks the model or the agent for a verdict on the logs, unless the logs are identical or
+// a cached analysis of the same logs exists, and records the analysis in the measurement metadata
+func (r *measurementRun) analyze(ctx context.Context) (v1alpha1.Measurement, bool) {
+	cfg := &r.cfg
+	analysisMode := r.settings.analysisMode
+
+	// Get namespace and pod name for agent mode, derived from the AnalysisRun when not configured
+	namespace := cfg.Namespace
+	podName := cfg.PodName
+	if analysisMode == AnalysisModeAgent {
+		canaryPod := ""
+		if len(r.samples) > 1 {
+			canaryPod = r.samples[1].Pod
+		}
+		namespace, podName = resolveAgentTarget(r.analysisRun, *cfg, canaryPod)
+		if namespace == "" || podName == "" {
+			err := fmt.Errorf("agent mode could not resolve the canary pod, configure namespace and podName")
+			log.WithContext(ctx).WithError(err).Error("Invalid agent mode configuration")
+			return markMeasurementError(r.measurement, err), true
+		}
+		if cfg.Namespace == "" || cfg.PodName == "" {
+			log.WithContext(ctx).WithFields(log.Fields{
+				"namespace": namespace,
+				"podName":   podName,
+			}).Info("Resolved agent mode pod from the AnalysisRun")
+		}
+	}
+
+	// If podName doesn't contain a dash, it might be a pod template hash
+	// Try to find a pod with that hash as a label
+	if analysisMode == AnalysisModeAgent && !strings.Contains(podName, "-") {
+		log.WithContext(ctx).WithFields(log.Fields{
+			"namespace":    namespace,
+			"templateHash": podName,
+		}).Debug("podName appears to be a template hash, looking for matching pod")
+
+		// Get Kubernetes client
+		k8sClient, err := getKubeClient()
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to create Kubernetes client")
+			return markMeasurementError(r.measurement, fmt.Errorf("failed to create k8s client: %w", err)), true
+		}
+
+		// Try to find a pod with this hash
+		pods, err := k8sClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("rollouts-pod-template-hash=%s", podName),
+			Limit:         1,
+		})
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to list pods by template hash")
+			return markMeasurementError(r.measurement, fmt.Errorf("failed to find pod with template hash %s: %w", podName, err)), true
+		}
+		if len(pods.Items) == 0 {
+			err := fmt.Errorf("no pods found with template hash %s", podName)
+			log.WithContext(ctx).WithError(err).Error("No pods found for template hash")
+			return markMeasurementError(r.measurement, err), true
+		}
+
+		// Use the first pod found
+		resolvedPodName := pods.Items[0].Name
+		log.WithContext(ctx).WithFields(log.Fields{
+			"templateHash":    podName,
+			"resolvedPodName": resolvedPodName,
+		}).Info("Resolved pod template hash to pod name")
+		podName = resolvedPodName
+	}
+
+	// Analyze with AI (mode-aware)
+	log.WithContext(ctx).WithFields(log.Fields{
+		"model": r.modelName,
+		"mode":  analysisMode,
+	}).Info("Starting AI analysis")
+	r.params = AIAnalysisParams{
+		ModelName:        r.modelName,
+		LogsContext:      r.logsContext,
+		ExtraPrompt:      cfg.ExtraPrompt,
+		SystemPrompt:     r.systemPrompt,
+		Preset:           r.settings.preset,
+		SafetySettings:   r.settings.safetySettings,
+		OutputFields:     cfg.OutputFields,
+		Temperature:      cfg.Temperature,
+		Seed:             cfg.Seed,
+		Samples:          cfg.Samples,
+		History:          buildMeasurementHistory(r.analysisRun, r.metric, cfg.MaxHistory),
+		AgentURL:         cfg.AgentURL,
+		AgentPath:        cfg.AgentPath,
+		AgentTimeout:     r.settings.agentTimeout,
+		AgentHealthPath:  cfg.AgentHealthPath,
+		AgentProtocol:    cfg.AgentProtocol,
+		AgentCompression: cfg.AgentCompression,
+		AgentFallback:    cfg.AgentFallback,
+		AgentAsync:       cfg.AgentAsync,
+		AgentJobID:       r.agentJobID,
+		MCPServers:       cfg.MCPServers,
+		MaxToolCalls:     cfg.MaxToolCalls,
+	}
+	if cfg.ExamplesConfigMap != "" && analysisMode == AnalysisModeDefault {
+		examples, err := readPromptExamples(ctx, r.analysisRun.Namespace, cfg.ExamplesConfigMap)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to read prompt examples")
+			return markMeasurementError(r.measurement, err), true
+		}
+		r.params.Examples = formatPromptExamples(examples)
+	}
+	var sampleVotes string
+	if cfg.SkipIdenticalLogs {
+		if identical, note := compareNormalizedLogs(r.stableLogs, r.canaryLogs); identical {
+			log.WithContext(ctx).Info("Canary logs show no significant difference from stable logs, skipping AI analysis")
+			r.result = AIAnalysisResult{Text: note, Promote: true, Confidence: 100, Severity: SeverityNone}
+			rawJSON, _ := json.Marshal(r.result)
+			r.analysisJSON, r.skipped = string(rawJSON), true
+		} else {
+			log.WithContext(ctx).WithField("reason", note).Debug("Canary logs differ from stable logs, running AI analysis")
+		}
+	}
+	ns := r.analysisRun.Namespace
+	cacheTTL := r.settings.cacheTTL
+	cacheKey := analysisCacheKey(analysisMode, r.params, namespace, podName)
+	if !r.skipped && cacheTTL > 0 {
+		if entry, ok := getCachedAnalysis(ctx, r.kubeClient, ns, cfg.CacheConfigMap, cacheKey); ok {
+			log.WithContext(ctx).WithField("expiresAt", entry.ExpiresAt).Info("Using cached AI analysis for unchanged logs")
+			r.analysisJSON, r.result, r.cached = entry.RawJSON, entry.Result, true
+		}
+	}
+	if !r.skipped && !r.cached {
+		var credErr error
+		if analysisMode == AnalysisModeAgent {
+			r.params.AgentToken, credErr = agentTokenFor(ctx, *cfg)
+			if cfg.Credentials != nil {
+				r.params.AgentTLSSecretRef = cfg.Credentials.AgentTLSSecretRef
+			}
+			if r.agentJobID == "" {
+				// Give the agent the context default mode prompts have
+				data := newPromptTemplateData(ctx, r.analysisRun, r.metric, *cfg, true)
+				r.params.AgentRollout = A2ARolloutContext{
+					RolloutName:    data.RolloutName,
+					Revision:       data.Revision,
+					CanaryImage:    data.CanaryImage,
+					StableImage:    data.StableImage,
+					ExtraPrompt:    r.params.ExtraPrompt,
+					Model:          cfg.Model,
+					NoPullRequests: cfg.AllowAgentPRs != nil && !*cfg.AllowAgentPRs,
+				}
+			}
+		}
+		// The model analyzes in default mode and when falling back from agent mode
+		useModel := analysisMode != AnalysisModeAgent || cfg.AgentFallback == AgentFallbackDefault
+		if credErr == nil && useModel && cfg.Credentials != nil && (cfg.Credentials.GoogleAPIKeySecretRef != nil || cfg.Credentials.cloudSecret()) {
+			r.params.APIKey, credErr = googleAPIKeyFor(ctx, *cfg)
+		}
+		if credErr == nil && analysisMode == AnalysisModeDefault {
+			r.params.MCPServers, credErr = mcpServersWithTokens(ctx, r.params.MCPServers)
+		}
+		if credErr != nil {
+			log.WithContext(ctx).WithError(credErr).Error("Failed to read analysis credentials")
+			return markMeasurementError(r.measurement, credErr), true
+		}
+		var aiErr error
+		if r.params.Samples > 1 {
+			r.analysisJSON, r.result, sampleVotes, aiErr = analyzeWithSamples(ctx, r.params)
+		} else {
+			r.analysisJSON, r.result, aiErr = analyzeWithMode(ctx, analysisMode, r.params, namespace, podName)
+		}
+		if jobID, pending := agentJobPendingID(aiErr); pending {
+			return markMeasurementAgentJobPending(r.measurement, jobID), true
+		}
+		if aiErr != nil {
+			log.WithContext(ctx).WithError(aiErr).Error("AI analysis failed")
+			return markMeasurementInvalidResponse(r.measurement, r.analysisJSON, aiErr), true
+		}
+		// A default promote: false, confidence: 0 result would look like a legitimate rejection
+		if invalidErr := validateAnalysisResult(r.analysisJSON, r.result); invalidErr != nil {
+			log.WithContext(ctx).WithError(invalidErr).Error("Invalid AI analysis")
+			return markMeasurementInvalidResponse(r.measurement, r.analysisJSON, invalidErr), true
+		}
+		// Fallback analyses are not cached so the agent analyzes again once it recovers
+		if cacheTTL > 0 && !r.result.AgentFallback {
+			entry := cachedAnalysis{RawJSON: r.analysisJSON, Result: r.result, ExpiresAt: time.Now().Add(cacheTTL)}
+			if cacheErr := putCachedAnalysis(ctx, r.kubeClient, ns, cfg.CacheConfigMap, cacheKey, entry); cacheErr != nil {
+				log.WithContext(ctx).WithError(cacheErr).Warn("Failed to cache AI analysis")
+			}
+		}
+	}
+
+	result := r.result
+	log.WithContext(ctx).WithFields(log.Fields{
+		"promote":        result.Promote,
+		"confidence":     result.Confidence,
+		"analysisLength": len(result.Text),
+	}).Info("AI analysis completed")
+
+	if r.skipped {
+		// The model was not asked, use the zero values so conditions on the fields still evaluate
+		r.outputValues = outputFieldZeroValues(cfg.OutputFields)
+	} else {
+		var err error
+		if r.outputValues, err = parseOutputFields(r.analysisJSON, cfg.OutputFields); err != nil {
+			log.WithContext(ctx).WithError(err).Error("Invalid output fields in the AI analysis")
+			return markMeasurementError(r.measurement, err), true
+		}
+	}
+
+	// Store analysis in metadata
+	metadata := r.measurement.Metadata
+	metadata["analysis"] = result.Text
+	metadata["analysisJSON"] = r.analysisJSON
+	if r.cached {
+		metadata["cached"] = "true"
+	}
+	if r.skipped {
+		metadata["skippedAI"] = "true"
+	}
+	if sampleVotes != "" {
+		metadata["samplePromoteVotes"] = sampleVotes
+	}
+	if analysisMode == AnalysisModeDefault && !r.skipped {
+		// Trace decision changes to prompt changes across plugin upgrades and configuration edits
+		metadata["promptVersion"] = r.promptVersion
+		metadata["promptHash"] = promptHash(r.params)
+		// Record what is needed to re-run the decision and compare it
+		metadata["model"] = r.modelName
+		if cfg.Temperature != nil {
+			metadata["temperature"] = fmt.Sprintf("%g", *cfg.Temperature)
+		}
+		if cfg.Seed != nil {
+			metadata["seed"] = fmt.Sprintf("%d", *cfg.Seed)
+		}
+	}
+	if r.logsOmitted != "" {
+		metadata["logsOmitted"] = r.logsOmitted
+	}
+	if result.LogsTrimmed {
+		metadata["logsTrimmed"] = "true"
+	}
+	if result.AgentFallback {
+		metadata["agentFallback"] = "true"
+	}
+	if result.ToolCalls > 0 {
+		metadata["toolCalls"] = fmt.Sprintf("%d", result.ToolCalls)
+	}
+	if r.agentJobID != "" {
+		metadata["agentJobId"] = r.agentJobID
+	}
+	if analysisMode == AnalysisModeAgent && cfg.AgentName != "" {
+		metadata["agentName"] = cfg.AgentName
+	}
+	metadata["sampledPods"] = sampledPodsMetadata(r.samples)
+	if r.observedRequests >= 0 {
+		metadata["observedRequests"] = fmt.Sprintf("%d", r.observedRequests)
+	}
+	metadata["confidence"] = fmt.Sprintf("%d", result.Confidence)
+	metadata["promote"] = fmt.Sprintf("%t", result.Promote)
+	metadata["score"] = fmt.Sprintf("%d", signedScore(result))
+	metadata["severity"] = effectiveSeverity(result)
+	metadata["severityScore"] = fmt.Sprintf("%d", severityScore(result))
+	if result.RootCause != "" {
+		metadata["rootCause"] = result.RootCause
+	}
+	if result.Remediation != "" {
+		metadata["remediation"] = result.Remediation
+	}
+	// Automated remediation is subject to the pull request policy of the metric
+	if result.PRLink != "" {
+		metadata["agentPrLink"] = result.PRLink
+		if cfg.AllowAgentPRs != nil && !*cfg.AllowAgentPRs {
+			err := fmt.Errorf("agent opened pull request %s but allowAgentPRs is false", result.PRLink)
+			log.WithContext(ctx).WithError(err).Error("Agent pull request rejected")
+			return markMeasurementError(r.measurement, err), true
+		}
+		if cfg.RequireApprovalLabel != "" {
+			labelErr := traced(ctx, "metricai.github.label_pull_request", func(ctx context.Context) error {
+				return labelPullRequest(ctx, *cfg, result.PRLink, cfg.RequireApprovalLabel)
+			})
+			if labelErr != nil {
+				log.WithContext(ctx).WithError(labelErr).Warn("Failed to flag agent pull request")
+				markReportError(r.measurement, "agentPrLabelError", labelErr)
+			} else {
+				metadata["agentPrApprovalLabel"] = cfg.RequireApprovalLabel
+			}
+		}
+	}
+	for key, value := range outputFieldsMetadata(r.outputValues) {
+		metadata[key] = value
+	}
+	return r.measurement, false
+}
+
+// evaluate decides the measurement value and phase from the analysis, the majority of recent
+// verdicts, the severity policy and the metric conditions
+func (r *measurementRun) evaluate(ctx context.Context) (v1alpha1.Measurement, bool) {
+	result := r.result
+
+	// Smooth flaky model responses by deciding on the majority of the last N verdicts
+	promote := result.Promote
+	if r.cfg.MajorityOf > 1 {
+		var votes, total int
+		promote, votes, total = majorityVerdict(r.analysisRun, r.metric, r.cfg.MajorityOf, result.Promote)
+		r.measurement.Metadata["majorityPromote"] = fmt.Sprintf("%t", promote)
+		r.measurement.Metadata["majorityVotes"] = fmt.Sprintf("%d/%d", votes, total)
+		if promote != result.Promote {
+			log.WithContext(ctx).WithFields(log.Fields{
+				"promote":      result.Promote,
+				"promoteVotes": votes,
+				"verdicts":     total,
+			}).Info("Latest AI verdict overridden by the majority of recent verdicts")
+		}
+	}
+
+	// The measurement value mode and the severity policy were validated with the configuration
+	value, valueStr, _ := measurementValue(r.cfg.MeasurementValue, result)
+	r.measurement.Value = valueStr
+
+	// successCondition/failureCondition take precedence over the severity policy and the AI promote decision
+	r.phase = v1alpha1.AnalysisPhaseSuccessful
+	if !promote {
+		r.phase = v1alpha1.AnalysisPhaseFailed
+	}
+	if policyPhase, ok, _ := severityPhase(r.cfg.SeverityPolicy, result); ok {
+		r.phase = policyPhase
+	}
+	if r.metric.SuccessCondition != "" || r.metric.FailureCondition != "" {
+		fields := resultFields(result, value)
+		for name, v := range r.outputValues {
+			fields[name] = v
+		}
+		phase, err := evaluate.EvaluateResult(fields, r.metric, *log.WithContext(ctx))
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Error("Failed to evaluate metric conditions")
+			return markMeasurementError(r.measurement, err), true
+		}
+		r.phase = phase
+	}
+	r.measurement.Phase = r.phase
+
+	// Explain flapping decisions by comparing with the phase of the previous measurement
+	canaryTypes := logMessageTypes(r.canaryLogs)
+	var previousTypes map[string]bool
+	if r.analysisRun.UID != "" {
+		previousTypes = swapVerdictContext(string(r.analysisRun.UID), r.metric.Name, canaryTypes)
+	}
+	if explanation := explainVerdictChange(lastCompletedMeasurement(r.analysisRun, r.metric), r.phase, previousTypes, canaryTypes, result); explanation != "" {
+		log.WithContext(ctx).WithField("verdictChange", explanation).Info("Verdict changed since the previous measurement")
+		r.measurement.Metadata["verdictChange"] = explanation
+	}
+	return r.measurement, false
+}
+
+// report publishes the decision: issues and success reports, GitHub checks and statuses, the
+// notification sinks, persisted reports and artifacts and the audit log
+func (r *measurementRun) report(ctx context.Context) v1alpha1.Measurement {
+	cfg := &r.cfg
+	result, phase := r.result, r.phase
+	newMeasurement := r.measurement
+
+	// Report on the canary commit when it is not configured
+	if cfg.CommitSHA == "" && (cfg.CommitStatus || cfg.GitHubChecks || cfg.GitHubTarget == GitHubTargetPR || cfg.GitHubTarget == GitHubTargetPRReview || cfg.ReportOnSuccess) {
+		sha, commitErr := resolveCanaryCommit(ctx, r.podClient, r.analysisRun.Namespace, r.samples, cfg.CommitSHAAnnotation)
+		if commitErr != nil {
+			log.WithContext(ctx).WithError(commitErr).Warn("Failed to resolve the canary commit")
+		} else {
+			cfg.CommitSHA = sha
+			newMeasurement.Metadata["commitSha"] = sha
+		}
+	}
+
+	// Report on the final phase, which conditions and the severity policy may have changed from the promote decision
+	switch phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		// Success: canary is good
+		log.WithContext(ctx).WithField("phase", phase).Info("Canary promotion recommended by AI analysis")
+
+		if cfg.ReportOnSuccess {
+			if reportErr := reportCanarySuccess(ctx, *cfg, result); reportErr != nil {
+				log.WithContext(ctx).WithError(reportErr).Warn("Failed to report canary success")
+				markReportError(newMeasurement, "successReportError", reportErr)
+			}
+		}
+		if cfg.AutoCloseIssues {
+			if closeErr := closeTrackedIssues(ctx, r.analysisRun, *cfg, result); closeErr != nil {
+				log.WithContext(ctx).WithError(closeErr).Warn("Failed to close resolved issues")
+			}
+		}
+	case v1alpha1.AnalysisPhaseFailed:
+		// Failure: canary has issues
+		log.WithContext(ctx).WithField("phase", phase).Info("Canary promotion not recommended")
+
+		// Create GitHub issue on failure, when the metric reports to a repository
+		if cfg.GitHubURL == "" {
+			log.WithContext(ctx).Debug("No githubUrl configured, not reporting the canary failure")
+		} else {
+			var link string
+			issueErr := traced(ctx, "metricai.github.issue", func(ctx context.Context) (err error) {
+				link, err = createCanaryFailureIssue(ctx, r.analysisRun, r.logsContext, result, *cfg, r.modelName)
+				return err
+			})
+			if issueErr != nil {
+				log.WithContext(ctx).WithError(issueErr).Warn("Failed to create GitHub issue")
+				markReportError(newMeasurement, "issueError", issueErr)
+			} else if link != "" {
+				newMeasurement.Metadata["issueUrl"] = link
+			}
+		}
+	default:
+		log.WithContext(ctx).WithField("phase", phase).Info("Canary analysis inconclusive")
+	}
+
+	// Show the decision in the pull request checks
+	if cfg.GitHubChecks {
+		checkErr := traced(ctx, "metricai.github.check_run", func(ctx context.Context) error {
+			return publishCheckRun(ctx, *cfg, r.analysisRun, phase, result)
+		})
+		if checkErr != nil {
+			log.WithContext(ctx).WithError(checkErr).Warn("Failed to publish GitHub check run")
+			markReportError(newMeasurement, "checkRunError", checkErr)
+		}
+	}
+	// Let branch protection rules consume the decision
+	if cfg.CommitStatus {
+		statusErr := traced(ctx, "metricai.github.commit_status", func(ctx context.Context) error {
+			return publishCommitStatus(ctx, *cfg, phase, result)
+		})
+		if statusErr != nil {
+			log.WithContext(ctx).WithError(statusErr).Warn("Failed to publish commit status")
+			markReportError(newMeasurement, "commitStatusError", statusErr)
+		}
+	}
+
+	// Notify the metric's channels with links to the report
+	analysisMode := r.settings.analysisMode
+	rec := newDecisionRecord(r.analysisRun, r.metric, analysisMode, r.modelName, result, newMeasurement)
+	rec.IssueURL = newMeasurement.Metadata["issueUrl"]
+	rec.Fields = r.outputValues
+	rec.PromptHash = newMeasurement.Metadata["promptHash"]
+	rec.TraceID, rec.SpanID = traceIDs(ctx)
+	rec.Temperature, rec.Seed = cfg.Temperature, cfg.Seed
+	rec.DashboardURL = renderDashboardURL(*cfg, newIssueTemplateData(r.analysisRun, "", result, r.modelName))
+	if !r.startTime.IsZero() {
+		rec.DurationSeconds = rec.Time.Sub(r.startTime.Time).Seconds()
+	}
+	notifyDecision(ctx, *cfg, rec, newMeasurement)
+	// Cached and skipped analyses did not call the model
+	if !r.cached && !r.skipped {
+		if costErr := recordDecisionCost(ctx, r.analysisRun, cfg.Budget, rec); costErr != nil {
+			log.WithContext(ctx).WithError(costErr).Warn("Failed to record budget events")
+			markReportError(newMeasurement, "budgetError", costErr)
+		}
+	}
+	if !cfg.DisableEvents {
+		if eventErr := recordDecisionEvents(ctx, r.analysisRun, rec); eventErr != nil {
+			log.WithContext(ctx).WithError(eventErr).Warn("Failed to record decision events")
+			markReportError(newMeasurement, "eventError", eventErr)
+		}
+	}
+	// Keep the complete analysis, which may not fit in the measurement metadata
+	if cfg.PersistReports {
+		if name, key, reportErr := persistReport(ctx, r.kubeClient, r.analysisRun, rec, r.analysisJSON, r.logsContext, result.AgentTranscript); reportErr != nil {
+			log.WithContext(ctx).WithError(reportErr).Warn("Failed to persist analysis report")
+			markReportError(newMeasurement, "reportError", reportErr)
+		} else {
+			newMeasurement.Metadata["reportConfigMap"] = name
+			newMeasurement.Metadata["reportKey"] = key
+		}
+	}
+	if cfg.ArtifactStorage != nil {
+		artifacts := analysisArtifacts{Decision: rec, AnalysisJSON: r.analysisJSON, Logs: r.logsContext, AgentTranscript: result.AgentTranscript}
+		if analysisMode != AnalysisModeAgent && !r.skipped && !r.cached {
+			artifacts.Prompt = analysisPrompt(r.params)
+		}
+		if location, uploadErr := uploadArtifacts(ctx, cfg.ArtifactStorage, artifacts); uploadErr != nil {
+			log.WithContext(ctx).WithError(uploadErr).Warn("Failed to upload analysis artifacts")
+			markReportError(newMeasurement, "artifactsError", uploadErr)
+		} else {
+			newMeasurement.Metadata["artifacts"] = location
+		}
+	}
+	// Keep a queryable history of the decisions across rollouts
+	if cfg.ReportResources {
+		refs := analysisReportReferences{
+			ReportConfigMap: newMeasurement.Metadata["reportConfigMap"],
+			ReportKey:       newMeasurement.Metadata["reportKey"],
+			Artifacts:       newMeasurement.Metadata["artifacts"],
+		}
+		if name, reportErr := createAnalysisReportResource(ctx, r.analysisRun, rec, refs); reportErr != nil {
+			log.WithContext(ctx).WithError(reportErr).Warn("Failed to create AIAnalysisReport")
+			markReportError(newMeasurement, "analysisReportError", reportErr)
+		} else {
+			newMeasurement.Metadata["analysisReport"] = name
+		}
+	}
+
+	// Keep an append-only audit trail of the promotion decisions for change management
+	if auditErr := auditDecision(ctx, rec, r.correlation); auditErr != nil {
+		log.WithContext(ctx).WithError(auditErr).Error("Failed to audit decision")
+		if auditRequired() {
+			return markMeasurementError(newMeasurement, auditErr)
+		}
+		markReportError(newMeasurement, "auditError", auditErr)
+	}
+
+	finishedTime := metav1.Now()
+	newMeasurement.FinishedAt = &finishedTime
+
+	publishDecision(context.Background(), rec)
+	return newMeasurement
+}
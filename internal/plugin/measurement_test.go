@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"k8s.io/client-go/kubernetes"
+)
+
+func TestValidatePluginConfig(t *testing.T) {
+	temperature := float32(3)
+	tests := []struct {
+		name string
+		cfg  aiConfig
+		want string
+	}{
+		{name: "timeout", cfg: aiConfig{Timeout: "soon"}, want: "invalid timeout"},
+		{name: "temperature", cfg: aiConfig{Temperature: &temperature}, want: "temperature 3"},
+		{name: "samples in agent mode", cfg: aiConfig{AnalysisMode: AnalysisModeAgent, Samples: 3}, want: "samples are not supported"},
+		{name: "agent timeout", cfg: aiConfig{AgentTimeout: "-1s"}, want: "invalid agentTimeout"},
+		{name: "traffic marker", cfg: aiConfig{MinRequests: 1, TrafficMarker: "("}, want: "invalid trafficMarker"},
+		{name: "measurement value", cfg: aiConfig{MeasurementValue: "bogus"}, want: "invalid measurementValue"},
+		{name: "severity policy", cfg: aiConfig{SeverityPolicy: map[string]string{"low": "Failed"}}, want: "invalid severityPolicy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := validatePluginConfig(&tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	settings, err := validatePluginConfig(&aiConfig{CacheTTL: "10m", AgentTimeout: "2m"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if settings.analysisMode != AnalysisModeDefault || settings.cacheTTL.Minutes() != 10 || settings.agentTimeout.Minutes() != 2 {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+}
+
+func TestRun_InvalidConfigDoesNotFetchLogs(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+
+	b, _ := json.Marshal(aiConfig{MeasurementValue: "bogus"})
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	oldKC := acquireKubeClient
+	acquireKubeClient = func() (*kubernetes.Clientset, error) { return nil, nil }
+	t.Cleanup(func() { acquireKubeClient = oldKC })
+
+	fetched := false
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(context.Context, *kubernetes.Clientset, string, string, podLogOptions) (string, podLogSample, error) {
+		fetched = true
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	measurement := p.Run(analysisRun, metric)
+	if measurement.Phase != v1alpha1.AnalysisPhaseError || !strings.Contains(measurement.Message, "invalid measurementValue") {
+		t.Fatalf("expected a configuration error, got %s: %s", measurement.Phase, measurement.Message)
+	}
+	if fetched {
+		t.Error("expected the logs not to be fetched for an invalid configuration")
+	}
+}
@@ -0,0 +1,202 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+// Model routing strategies
+const (
+	ModelRoutingStatic   = "static"   // Always use the configured model (default)
+	ModelRoutingAdaptive = "adaptive" // Use the healthiest of the model and its alternateModels
+)
+
+const (
+	// modelStatsWindow is the number of recent calls per model the routing decisions are based on
+	modelStatsWindow = 50
+	// modelStatsMaxAge drops calls older than this from the window, so recovered models are used again
+	modelStatsMaxAge = 15 * time.Minute
+)
+
+// modelCall is the outcome of a single model request
+type modelCall struct {
+	at      time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// modelStats are the recent calls of a model
+type modelStats struct {
+	calls []modelCall
+}
+
+// modelHealth summarizes the recent calls of a model
+type modelHealth struct {
+	Model     string
+	Calls     int
+	ErrorRate float64
+	// MeanLatency of the successful calls, 0 without any
+	MeanLatency time.Duration
+}
+
+// modelRegistry tracks the calls of all models of the plugin process
+var modelRegistry = struct {
+	sync.Mutex
+	stats map[string]*modelStats
+}{stats: make(map[string]*modelStats)}
+
+// Model request and routing metrics, see the Adaptive Model Routing section of the README
+var (
+	modelRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_ai_model_requests_total",
+		Help: "Model requests, including retries.",
+	}, []string{"model", "result"})
+	modelRequestDuration = promauto.NewSummaryVec(prometheus.SummaryOpts{
+		Name: "metric_ai_model_request_duration_seconds",
+		Help: "Duration of model requests.",
+	}, []string{"model"})
+	modelRouted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "metric_ai_model_routed_total",
+		Help: "Measurements routed away from their configured model.",
+	}, []string{"from", "to"})
+	modelErrorRateDesc = prometheus.NewDesc("metric_ai_model_error_rate",
+		"Error rate of the recent requests of the model used for routing.", []string{"model"}, nil)
+	modelLatencyDesc = prometheus.NewDesc("metric_ai_model_latency_seconds",
+		"Mean latency of the recent successful requests of the model used for routing.", []string{"model"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(modelHealthCollector{})
+}
+
+// modelHealthCollector exports the health of the models used for routing, computed at scrape time as
+// calls leave the window
+type modelHealthCollector struct{}
+
+func (modelHealthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- modelErrorRateDesc
+	ch <- modelLatencyDesc
+}
+
+func (modelHealthCollector) Collect(ch chan<- prometheus.Metric) {
+	modelRegistry.Lock()
+	models := make([]string, 0, len(modelRegistry.stats))
+	for model := range modelRegistry.stats {
+		models = append(models, model)
+	}
+	modelRegistry.Unlock()
+
+	now := time.Now()
+	for _, model := range models {
+		h := currentModelHealth(model, now)
+		ch <- prometheus.MustNewConstMetric(modelErrorRateDesc, prometheus.GaugeValue, h.ErrorRate, model)
+		ch <- prometheus.MustNewConstMetric(modelLatencyDesc, prometheus.GaugeValue, h.MeanLatency.Seconds(), model)
+	}
+}
+
+// validateModelRouting checks the modelRouting of a metric
+func validateModelRouting(routing string) error {
+	switch routing {
+	case "", ModelRoutingStatic, ModelRoutingAdaptive:
+		return nil
+	}
+	return fmt.Errorf("invalid modelRouting %q, expected %s or %s", routing, ModelRoutingStatic, ModelRoutingAdaptive)
+}
+
+// recordModelCall records the outcome of a model request
+func recordModelCall(model string, latency time.Duration, err error) {
+	modelRegistry.Lock()
+	defer modelRegistry.Unlock()
+	s, ok := modelRegistry.stats[model]
+	if !ok {
+		s = &modelStats{}
+		modelRegistry.stats[model] = s
+	}
+	s.calls = append(s.calls, modelCall{at: time.Now(), latency: latency, failed: err != nil})
+	if len(s.calls) > modelStatsWindow {
+		s.calls = s.calls[len(s.calls)-modelStatsWindow:]
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	modelRequests.WithLabelValues(model, result).Inc()
+	modelRequestDuration.WithLabelValues(model).Observe(latency.Seconds())
+}
+
+// currentModelHealth returns the health of a model over the recent calls in the window
+func currentModelHealth(model string, now time.Time) modelHealth {
+	modelRegistry.Lock()
+	defer modelRegistry.Unlock()
+	h := modelHealth{Model: model}
+	s, ok := modelRegistry.stats[model]
+	if !ok {
+		return h
+	}
+	var failed, succeeded int
+	var latency time.Duration
+	for _, c := range s.calls {
+		if now.Sub(c.at) > modelStatsMaxAge {
+			continue
+		}
+		h.Calls++
+		if c.failed {
+			failed++
+			continue
+		}
+		succeeded++
+		latency += c.latency
+	}
+	if h.Calls > 0 {
+		h.ErrorRate = float64(failed) / float64(h.Calls)
+	}
+	if succeeded > 0 {
+		h.MeanLatency = latency / time.Duration(succeeded)
+	}
+	return h
+}
+
+// healthierModel reports whether model a is healthier than b: fewer errors first, then faster.
+// Models without successful recent calls have an unknown latency and are only preferred on fewer errors.
+func healthierModel(a, b modelHealth) bool {
+	if a.ErrorRate != b.ErrorRate {
+		return a.ErrorRate < b.ErrorRate
+	}
+	if a.MeanLatency == 0 || b.MeanLatency == 0 {
+		return false
+	}
+	return a.MeanLatency < b.MeanLatency
+}
+
+// routeModel returns the healthiest of the configured model and its alternates, keeping the configured
+// order on ties so the preferred model is used while it is as healthy as the others
+func routeModel(ctx context.Context, model string, alternates []string) string {
+	now := time.Now()
+	best := currentModelHealth(model, now)
+	for _, alternate := range alternates {
+		if h := currentModelHealth(alternate, now); healthierModel(h, best) {
+			best = h
+		}
+	}
+	if best.Model == model {
+		return model
+	}
+
+	modelRouted.WithLabelValues(model, best.Model).Inc()
+	configured := currentModelHealth(model, now)
+	log.WithContext(ctx).WithFields(log.Fields{
+		"model":               best.Model,
+		"configuredModel":     model,
+		"errorRate":           best.ErrorRate,
+		"latency":             best.MeanLatency.String(),
+		"configuredErrorRate": configured.ErrorRate,
+		"configuredLatency":   configured.MeanLatency.String(),
+	}).Info("Routing analysis to the healthiest model")
+	return best.Model
+}
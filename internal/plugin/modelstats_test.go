@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveModelRouting(t *testing.T) {
+	ctx := context.Background()
+	primary, alternate := "test-routing-primary", "test-routing-alternate"
+	// Without recent calls the configured model is kept
+	if got := routeModel(ctx, primary, []string{alternate}); got != primary {
+		t.Errorf("expected %s without stats, got %s", primary, got)
+	}
+
+	recordModelCall(primary, 2*time.Second, fmt.Errorf("503 UNAVAILABLE"))
+	recordModelCall(primary, time.Second, nil)
+	recordModelCall(alternate, 3*time.Second, nil)
+	if got := routeModel(ctx, primary, []string{alternate}); got != alternate {
+		t.Errorf("expected routing to %s with fewer errors, got %s", alternate, got)
+	}
+	h := currentModelHealth(primary, time.Now())
+	if h.Calls != 2 || h.ErrorRate != 0.5 || h.MeanLatency != time.Second {
+		t.Errorf("unexpected health %+v", h)
+	}
+	// Calls outside the window no longer count
+	if h := currentModelHealth(primary, time.Now().Add(modelStatsMaxAge+time.Minute)); h.Calls != 0 {
+		t.Errorf("expected expired calls to be ignored, got %+v", h)
+	}
+
+	// On equal error rates the faster model wins
+	for i := 0; i < modelStatsWindow; i++ {
+		recordModelCall(primary, time.Second, nil)
+	}
+	if got := routeModel(ctx, primary, []string{alternate}); got != primary {
+		t.Errorf("expected the faster %s, got %s", primary, got)
+	}
+
+	if err := validateModelRouting("fastest"); err == nil {
+		t.Error("expected invalid modelRouting to be rejected")
+	}
+
+	metrics := scrapeMetrics(t)
+	for _, want := range []string{
+		`metric_ai_model_requests_total{model="test-routing-primary",result="error"} 1`,
+		`metric_ai_model_requests_total{model="test-routing-primary",result="success"} 51`,
+		`metric_ai_model_error_rate{model="test-routing-primary"} 0`,
+		`metric_ai_model_latency_seconds{model="test-routing-alternate"} 3`,
+		`metric_ai_model_request_duration_seconds_count{model="test-routing-primary"} 52`,
+		`metric_ai_model_routed_total{from="test-routing-primary",to="test-routing-alternate"} 1`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("expected %q in metrics:\n%s", want, metrics)
+		}
+	}
+}
+
+// scrapeMetrics returns the metrics served on /metrics by the plugin HTTP server
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(newHTTPMux())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
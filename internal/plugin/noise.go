@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultNoiseThreshold is the fraction of binary or base64 content above which logs are considered noise
+const defaultNoiseThreshold = 0.5
+
+// base64TokenPattern matches long base64-looking tokens such as encoded payloads
+var base64TokenPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{40,}={0,2}`)
+
+// logNoiseRatio returns the fraction of the logs that is non-printable or base64-encoded content
+func logNoiseRatio(logs string) float64 {
+	if len(logs) == 0 {
+		return 0
+	}
+	noise := 0
+	for _, loc := range base64TokenPattern.FindAllStringIndex(logs, -1) {
+		noise += loc[1] - loc[0]
+	}
+	for i := 0; i < len(logs); {
+		r, size := utf8.DecodeRuneInString(logs[i:])
+		if r == utf8.RuneError || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			noise += size
+		}
+		i += size
+	}
+	ratio := float64(noise) / float64(len(logs))
+	if ratio > 1 {
+		ratio = 1
+	}
+	return ratio
+}
+
+// fetchPodStatusContext summarizes pod phase, container states and Kubernetes events for the pods
+// matching the selector, used instead of logs when the logs are mostly noise
+var fetchPodStatusContext = func(ctx context.Context, client *kubernetes.Clientset, namespace, labelSelector string) (string, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return "", fmt.Errorf("failed to list pods for selector %s in namespace %s: %w", labelSelector, namespace, err)
+	}
+
+	var b strings.Builder
+	for _, pod := range pods.Items {
+		fmt.Fprintf(&b, "Pod %s: phase=%s\n", pod.Name, pod.Status.Phase)
+		for _, cs := range pod.Status.ContainerStatuses {
+			fmt.Fprintf(&b, "  container %s: ready=%t restarts=%d", cs.Name, cs.Ready, cs.RestartCount)
+			if cs.State.Waiting != nil {
+				fmt.Fprintf(&b, " waiting=%s", cs.State.Waiting.Reason)
+			}
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				fmt.Fprintf(&b, " lastTerminated=%s exitCode=%d", t.Reason, t.ExitCode)
+			}
+			b.WriteString("\n")
+		}
+
+		events, err := client.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: "involvedObject.name=" + pod.Name,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to list events for pod %s in namespace %s: %w", pod.Name, namespace, err)
+		}
+		for _, e := range events.Items {
+			if e.Type == corev1.EventTypeNormal && e.Count <= 1 {
+				continue
+			}
+			fmt.Fprintf(&b, "  event %s %s (x%d): %s\n", e.Type, e.Reason, e.Count, e.Message)
+		}
+	}
+	return b.String(), nil
+}
+
+var readPodStatusContext = fetchPodStatusContext
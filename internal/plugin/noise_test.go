@@ -0,0 +1,19 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogNoiseRatio(t *testing.T) {
+	if r := logNoiseRatio("2024-10-01 INFO request served in 12ms\n"); r != 0 {
+		t.Errorf("expected no noise in plain text logs, got %.2f", r)
+	}
+	encoded := "payload=" + strings.Repeat("QUJDREVGR0hJSktMTU5PUFFSU1RVVldYWVo", 10) + "==\n"
+	if r := logNoiseRatio(encoded); r < 0.9 {
+		t.Errorf("expected base64 logs to be mostly noise, got %.2f", r)
+	}
+	if r := logNoiseRatio(string([]byte{0x00, 0x01, 0xff, 0xfe, 'o', 'k'})); r < 0.5 {
+		t.Errorf("expected binary logs to be mostly noise, got %.2f", r)
+	}
+}
@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// defaultOpsgenieAPIURL is the Opsgenie API of the US instance, EU accounts use https://api.eu.opsgenie.com
+const defaultOpsgenieAPIURL = "https://api.opsgenie.com"
+
+// opsgenieConfig creates Opsgenie alerts when the canary is rejected
+type opsgenieConfig struct {
+	// Secret key in the AnalysisRun namespace with the API integration key
+	// (default: opsgenie_api_key of the plugin secret)
+	APIKeySecretRef *secretKeyRef `json:"apiKeySecretRef,omitempty"`
+	// Opsgenie API URL (default: https://api.opsgenie.com)
+	APIURL string `json:"apiUrl,omitempty"`
+	// Team the alert is routed to
+	Team string `json:"team,omitempty"`
+	// Additional alert tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// opsgenieAlert is an Opsgenie create alert request
+type opsgenieAlert struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Responders  []opsgenieResponder `json:"responders,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Details     map[string]string   `json:"details,omitempty"`
+	Entity      string              `json:"entity,omitempty"`
+	Source      string              `json:"source,omitempty"`
+	Priority    string              `json:"priority"`
+}
+
+// opsgenieResponder is a team, user, escalation or schedule notified of an alert
+type opsgenieResponder struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// notifyOpsgenie creates an Opsgenie alert when the AI rejects the canary
+func notifyOpsgenie(ctx context.Context, cfg *opsgenieConfig, rec decisionRecord) error {
+	if rec.Promote {
+		return nil
+	}
+	apiKey, err := readSecretRefOrDefault(ctx, cfg.APIKeySecretRef, "opsgenie_api_key")
+	if err != nil {
+		return fmt.Errorf("failed to get Opsgenie API key from secret: %v", err)
+	}
+	apiURL := cfg.APIURL
+	if apiURL == "" {
+		apiURL = defaultOpsgenieAPIURL
+	}
+	headers := map[string]string{"Authorization": "GenieKey " + apiKey}
+	if err := postJSON(ctx, strings.TrimSuffix(apiURL, "/")+"/v2/alerts", headers, newOpsgenieAlert(cfg, rec)); err != nil {
+		return fmt.Errorf("failed to create Opsgenie alert: %v", err)
+	}
+	return nil
+}
+
+// opsgeniePriority maps the severity and confidence of a rejection to an alert priority,
+// lowering critical and major rejections the model is unsure about by one level
+func opsgeniePriority(severity string, confidence int) string {
+	switch severity {
+	case SeverityCritical:
+		if confidence >= 80 {
+			return "P1"
+		}
+		return "P2"
+	case SeverityMajor:
+		if confidence >= 80 {
+			return "P2"
+		}
+		return "P3"
+	case SeverityMinor:
+		return "P4"
+	default:
+		return "P5"
+	}
+}
+
+// newOpsgenieAlert builds the alert of a rejected canary. Measurements of the same AnalysisRun
+// metric share an alias so repeated rejections are deduplicated into one alert.
+func newOpsgenieAlert(cfg *opsgenieConfig, rec decisionRecord) opsgenieAlert {
+	target := rec.AnalysisRun
+	if rec.Rollout != "" {
+		target = rec.Rollout
+	}
+	description := rec.Analysis
+	if rec.RootCause != "" {
+		description = fmt.Sprintf("Root cause: %s\n\n%s", rec.RootCause, description)
+	}
+	if rec.Remediation != "" {
+		description += "\n\nRemediation: " + rec.Remediation
+	}
+	details := map[string]string{
+		"analysisRun": rec.AnalysisRun,
+		"metric":      rec.Metric,
+		"confidence":  fmt.Sprintf("%d", rec.Confidence),
+		"severity":    rec.Severity,
+	}
+	if rec.IssueURL != "" {
+		details["issueUrl"] = rec.IssueURL
+	}
+	if rec.DashboardURL != "" {
+		details["dashboardUrl"] = rec.DashboardURL
+	}
+	alert := opsgenieAlert{
+		// Messages are limited to 130 characters
+		Message: truncate(fmt.Sprintf("Canary of %s/%s rejected by AI analysis (confidence %d%%)", rec.Namespace, target, rec.Confidence), 127),
+		Alias:   fmt.Sprintf("metric-ai/%s/%s/%s", rec.Namespace, rec.AnalysisRun, rec.Metric),
+		// Descriptions are limited to 15000 characters
+		Description: truncate(description, 14997),
+		Tags:        append([]string{"argo-rollouts", "canary-analysis"}, cfg.Tags...),
+		Details:     details,
+		Entity:      fmt.Sprintf("%s/%s", rec.Namespace, target),
+		Source:      eventSourceComponent,
+		Priority:    opsgeniePriority(rec.Severity, rec.Confidence),
+	}
+	if cfg.Team != "" {
+		alert.Responders = []opsgenieResponder{{Type: "team", Name: cfg.Team}}
+	}
+	return alert
+}
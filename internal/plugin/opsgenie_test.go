@@ -0,0 +1,37 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewOpsgenieAlert(t *testing.T) {
+	for _, tc := range []struct {
+		severity   string
+		confidence int
+		want       string
+	}{
+		{SeverityCritical, 95, "P1"},
+		{SeverityCritical, 60, "P2"},
+		{SeverityMajor, 80, "P2"},
+		{SeverityMajor, 79, "P3"},
+		{SeverityMinor, 99, "P4"},
+		{SeverityNone, 99, "P5"},
+	} {
+		if got := opsgeniePriority(tc.severity, tc.confidence); got != tc.want {
+			t.Errorf("expected %s for %s with confidence %d, got %s", tc.want, tc.severity, tc.confidence, got)
+		}
+	}
+
+	rec := decisionRecord{AnalysisRun: "checkout-abc-1", Namespace: "shop", Rollout: "checkout", Metric: "ai", Confidence: 90, Severity: SeverityMajor, RootCause: "database timeouts", Analysis: "error rate increased"}
+	alert := newOpsgenieAlert(&opsgenieConfig{Team: "checkout", Tags: []string{"prod"}}, rec)
+	if alert.Priority != "P2" || alert.Alias != "metric-ai/shop/checkout-abc-1/ai" || alert.Entity != "shop/checkout" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	if len(alert.Responders) != 1 || alert.Responders[0].Name != "checkout" || alert.Tags[len(alert.Tags)-1] != "prod" {
+		t.Errorf("unexpected routing %+v %v", alert.Responders, alert.Tags)
+	}
+	if !strings.HasPrefix(alert.Description, "Root cause: database timeouts") || len(alert.Message) > 130 {
+		t.Errorf("unexpected alert content %+v", alert)
+	}
+}
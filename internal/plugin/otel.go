@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// Standard OpenTelemetry exporter environment variables
+const (
+	envOTLPEndpoint     = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envOTLPLogsEndpoint = "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"
+	envOTLPHeaders      = "OTEL_EXPORTER_OTLP_HEADERS"
+	envOTelLogsExporter = "OTEL_LOGS_EXPORTER"
+	envOTelServiceName  = "OTEL_SERVICE_NAME"
+)
+
+// otelScopeName is the instrumentation scope of the exported telemetry
+const otelScopeName = "github.com/argoproj-labs/rollouts-plugin-metric-ai"
+
+// OTLP log severity numbers
+const (
+	otelSeverityInfo  = 9
+	otelSeverityWarn  = 13
+	otelSeverityError = 17
+)
+
+// otlpLogsEndpoint returns the OTLP/HTTP logs endpoint, or "" when log export is disabled
+func otlpLogsEndpoint() string {
+	if os.Getenv(envOTelLogsExporter) == "none" {
+		return ""
+	}
+	if endpoint := os.Getenv(envOTLPLogsEndpoint); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv(envOTLPEndpoint); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/logs"
+	}
+	return ""
+}
+
+// otlpHeaders parses OTEL_EXPORTER_OTLP_HEADERS ("key1=value1,key2=value2")
+func otlpHeaders() map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(envOTLPHeaders), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers
+}
+
+// otelServiceName returns the service.name resource attribute
+func otelServiceName() string {
+	if name := os.Getenv(envOTelServiceName); name != "" {
+		return name
+	}
+	return "rollouts-plugin-metric-ai"
+}
+
+// otlpAttribute builds an OTLP JSON key/value attribute
+func otlpAttribute(key string, value interface{}) map[string]interface{} {
+	var v map[string]interface{}
+	switch val := value.(type) {
+	case bool:
+		v = map[string]interface{}{"boolValue": val}
+	case int:
+		// int64 values are encoded as strings in OTLP JSON
+		v = map[string]interface{}{"intValue": strconv.Itoa(val)}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(val)}
+	}
+	return map[string]interface{}{"key": key, "value": v}
+}
+
+// exportDecisionLog emits the decision as an OpenTelemetry log record to the collector
+// using OTLP/HTTP with JSON encoding
+func exportDecisionLog(ctx context.Context, rec decisionRecord) error {
+	endpoint := otlpLogsEndpoint()
+	if endpoint == "" {
+		return nil
+	}
+
+	severityNumber, severityText := otelSeverityInfo, "INFO"
+	switch rec.Phase {
+	case v1alpha1.AnalysisPhaseFailed:
+		severityNumber, severityText = otelSeverityWarn, "WARN"
+	case v1alpha1.AnalysisPhaseError:
+		severityNumber, severityText = otelSeverityError, "ERROR"
+	}
+
+	attributes := []map[string]interface{}{
+		otlpAttribute("event.name", "metricai.decision"),
+		otlpAttribute("k8s.namespace.name", rec.Namespace),
+		otlpAttribute("argo.analysisrun.name", rec.AnalysisRun),
+		otlpAttribute("argo.analysisrun.uid", rec.AnalysisRunUID),
+		otlpAttribute("argo.metric.name", rec.Metric),
+		otlpAttribute("metricai.mode", rec.Mode),
+		otlpAttribute("metricai.model", rec.Model),
+		otlpAttribute("metricai.phase", string(rec.Phase)),
+		otlpAttribute("metricai.value", rec.Value),
+		otlpAttribute("metricai.promote", rec.Promote),
+		otlpAttribute("metricai.confidence", rec.Confidence),
+		otlpAttribute("metricai.severity", rec.Severity),
+	}
+	if rec.Rollout != "" {
+		attributes = append(attributes, otlpAttribute("argo.rollout.name", rec.Rollout))
+	}
+
+	logRecord := map[string]interface{}{
+		"timeUnixNano":         strconv.FormatInt(rec.Time.UnixNano(), 10),
+		"observedTimeUnixNano": strconv.FormatInt(rec.Time.UnixNano(), 10),
+		"severityNumber":       severityNumber,
+		"severityText":         severityText,
+		"body":                 map[string]interface{}{"stringValue": rec.Analysis},
+		"attributes":           attributes,
+	}
+	if rec.TraceID != "" && rec.SpanID != "" {
+		logRecord["traceId"] = rec.TraceID
+		logRecord["spanId"] = rec.SpanID
+	}
+
+	payload := map[string]interface{}{
+		"resourceLogs": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": []map[string]interface{}{otlpAttribute("service.name", otelServiceName())},
+			},
+			"scopeLogs": []map[string]interface{}{{
+				"scope":      map[string]interface{}{"name": otelScopeName},
+				"logRecords": []map[string]interface{}{logRecord},
+			}},
+		}},
+	}
+	return postJSON(ctx, endpoint, otlpHeaders(), payload)
+}
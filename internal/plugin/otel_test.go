@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// otlpAnyValue, otlpKeyValue and otlpLogsRequest follow the OTLP/HTTP JSON encoding of
+// ExportLogsServiceRequest, in which 64-bit integers are strings and IDs are hex encoded
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []struct {
+				TimeUnixNano         string         `json:"timeUnixNano"`
+				ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+				SeverityNumber       int            `json:"severityNumber"`
+				SeverityText         string         `json:"severityText"`
+				Body                 otlpAnyValue   `json:"body"`
+				Attributes           []otlpKeyValue `json:"attributes"`
+				TraceID              string         `json:"traceId"`
+				SpanID               string         `json:"spanId"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+func TestExportDecisionLog(t *testing.T) {
+	var body []byte
+	var path, contentType, auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType, auth = r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+	t.Setenv(envOTLPEndpoint, collector.URL+"/")
+	t.Setenv(envOTLPHeaders, "Authorization=Bearer secret")
+	t.Setenv(envOTelServiceName, "rollouts")
+
+	rec := decisionRecord{
+		Time:        time.Unix(1700000000, 5),
+		Namespace:   "shop",
+		AnalysisRun: "checkout-abc-1",
+		Rollout:     "checkout",
+		Metric:      "ai",
+		Phase:       v1alpha1.AnalysisPhaseFailed,
+		Confidence:  85,
+		Severity:    SeverityMajor,
+		Analysis:    "canary errors",
+		TraceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:      "00f067aa0ba902b7",
+	}
+	if err := exportDecisionLog(context.Background(), rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "/v1/logs" || contentType != "application/json" || auth != "Bearer secret" {
+		t.Fatalf("unexpected request to %s with content type %q and authorization %q", path, contentType, auth)
+	}
+
+	// Fields that are not part of the OTLP schema, or of the wrong JSON type, fail the decoding
+	var payload otlpLogsRequest
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		t.Fatalf("payload does not match the OTLP logs schema: %v\n%s", err, body)
+	}
+	if len(payload.ResourceLogs) != 1 || len(payload.ResourceLogs[0].ScopeLogs) != 1 || len(payload.ResourceLogs[0].ScopeLogs[0].LogRecords) != 1 {
+		t.Fatalf("expected a single log record, got %s", body)
+	}
+	resource := payload.ResourceLogs[0].Resource.Attributes
+	if len(resource) != 1 || resource[0].Key != "service.name" || resource[0].Value.StringValue == nil || *resource[0].Value.StringValue != "rollouts" {
+		t.Errorf("unexpected resource attributes %s", body)
+	}
+	if scope := payload.ResourceLogs[0].ScopeLogs[0].Scope.Name; scope != otelScopeName {
+		t.Errorf("unexpected scope %q", scope)
+	}
+
+	record := payload.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if record.TimeUnixNano != "1700000000000000005" || record.ObservedTimeUnixNano != record.TimeUnixNano {
+		t.Errorf("expected timestamps as decimal strings, got %q and %q", record.TimeUnixNano, record.ObservedTimeUnixNano)
+	}
+	if record.SeverityNumber != otelSeverityWarn || record.SeverityText != "WARN" {
+		t.Errorf("expected a WARN record for a failed decision, got %d %q", record.SeverityNumber, record.SeverityText)
+	}
+	if record.Body.StringValue == nil || *record.Body.StringValue != "canary errors" {
+		t.Errorf("unexpected body %s", body)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(record.TraceID) || !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(record.SpanID) {
+		t.Errorf("expected hex trace and span IDs, got %q and %q", record.TraceID, record.SpanID)
+	}
+	attributes := make(map[string]otlpAnyValue)
+	for _, kv := range record.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	if v := attributes["event.name"].StringValue; v == nil || *v != "metricai.decision" {
+		t.Errorf("unexpected event.name attribute %s", body)
+	}
+	if v := attributes["metricai.confidence"].IntValue; v == nil || *v != "85" {
+		t.Errorf("expected the confidence as an intValue string, got %s", body)
+	}
+	if v := attributes["metricai.promote"].BoolValue; v == nil || *v {
+		t.Errorf("expected promote as a boolValue, got %s", body)
+	}
+	if v := attributes["argo.rollout.name"].StringValue; v == nil || *v != "checkout" {
+		t.Errorf("unexpected argo.rollout.name attribute %s", body)
+	}
+
+	t.Setenv(envOTelLogsExporter, "none")
+	body = nil
+	if err := exportDecisionLog(context.Background(), rec); err != nil || body != nil {
+		t.Errorf("expected no export with OTEL_LOGS_EXPORTER=none, got %s (error %v)", body, err)
+	}
+}
+
+func TestRun_DecisionLogFailureKeepsMeasurement(t *testing.T) {
+	exported := false
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exported = true
+		http.Error(w, "collector unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+	t.Setenv(envOTLPLogsEndpoint, collector.URL+"/v1/logs")
+
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+
+	b, _ := json.Marshal(aiConfig{Model: "gemini-1.5-pro-latest", DisableEvents: true})
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	old := analyzeLogsWithAI
+	analyzeLogsWithAI = func(_ context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		return `{"text":"ok","promote":true,"confidence":90,"severity":"none"}`, AIAnalysisResult{Text: "ok", Promote: true, Confidence: 90, Severity: SeverityNone}, nil
+	}
+	t.Cleanup(func() { analyzeLogsWithAI = old })
+
+	oldKC := acquireKubeClient
+	acquireKubeClient = func() (*kubernetes.Clientset, error) { return nil, nil }
+	t.Cleanup(func() { acquireKubeClient = oldKC })
+
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(context.Context, *kubernetes.Clientset, string, string, podLogOptions) (string, podLogSample, error) {
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	measurement := p.Run(analysisRun, metric)
+	if !exported {
+		t.Fatal("expected the decision to be exported to the collector")
+	}
+	if measurement.Phase != v1alpha1.AnalysisPhaseSuccessful || measurement.Value != "0.90" || measurement.Message != "" {
+		t.Fatalf("expected the measurement to be unaffected by the collector failure, got %s %q: %s", measurement.Phase, measurement.Value, measurement.Message)
+	}
+}
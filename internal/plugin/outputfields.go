@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"google.golang.org/genai"
+)
+
+// Output field types
+const (
+	OutputFieldString  = "string"
+	OutputFieldNumber  = "number"
+	OutputFieldBoolean = "boolean"
+	// OutputFieldArray is a list of strings
+	OutputFieldArray = "array"
+)
+
+// outputFieldMetadataPrefix prefixes the measurement metadata keys of output fields
+const outputFieldMetadataPrefix = "output."
+
+// outputFieldNamePattern matches names that can be used in successCondition expressions
+var outputFieldNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// outputField is an extra field the model must return with the analysis, e.g. affectedEndpoints
+type outputField struct {
+	Name string `json:"name"`
+	// Type is string, number, boolean or array (of strings), string by default
+	Type string `json:"type,omitempty"`
+	// Description tells the model what to return in the field
+	Description string `json:"description"`
+}
+
+// validateOutputFields checks the outputFields of a metric
+func validateOutputFields(fields []outputField) error {
+	names := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if !outputFieldNamePattern.MatchString(field.Name) {
+			return fmt.Errorf("invalid outputFields name %q, it must start with a letter and contain only letters, digits and underscores", field.Name)
+		}
+		if analysisResponseSchema.Properties[field.Name] != nil {
+			return fmt.Errorf("outputFields %s is a built-in field of the analysis", field.Name)
+		}
+		if _, ok := resultFields(AIAnalysisResult{}, 0)[field.Name]; ok {
+			return fmt.Errorf("outputFields %s is a built-in field of the result", field.Name)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("duplicate outputFields %s", field.Name)
+		}
+		names[field.Name] = true
+		switch field.Type {
+		case "", OutputFieldString, OutputFieldNumber, OutputFieldBoolean, OutputFieldArray:
+		default:
+			return fmt.Errorf("invalid outputFields %s type %q, expected string, number, boolean or array", field.Name, field.Type)
+		}
+		if field.Description == "" {
+			return fmt.Errorf("outputFields %s requires a description", field.Name)
+		}
+	}
+	return nil
+}
+
+// responseSchema returns the response schema of the analysis with the output fields of a metric
+func responseSchema(fields []outputField) *genai.Schema {
+	if len(fields) == 0 {
+		return analysisResponseSchema
+	}
+	schema := *analysisResponseSchema
+	schema.Properties = make(map[string]*genai.Schema, len(analysisResponseSchema.Properties)+len(fields))
+	for name, property := range analysisResponseSchema.Properties {
+		schema.Properties[name] = property
+	}
+	schema.Required = append([]string(nil), analysisResponseSchema.Required...)
+	schema.PropertyOrdering = append([]string(nil), analysisResponseSchema.PropertyOrdering...)
+	for _, field := range fields {
+		property := &genai.Schema{Type: genai.TypeString, Description: field.Description}
+		switch field.Type {
+		case OutputFieldNumber:
+			property.Type = genai.TypeNumber
+		case OutputFieldBoolean:
+			property.Type = genai.TypeBoolean
+		case OutputFieldArray:
+			property.Type = genai.TypeArray
+			property.Items = &genai.Schema{Type: genai.TypeString}
+		}
+		schema.Properties[field.Name] = property
+		schema.Required = append(schema.Required, field.Name)
+		schema.PropertyOrdering = append(schema.PropertyOrdering, field.Name)
+	}
+	return &schema
+}
+
+// parseOutputFields reads the output fields from the raw analysis JSON, checking that every field
+// is present with the declared type. Numbers are float64 and arrays []string, as used by conditions.
+func parseOutputFields(rawJSON string, fields []outputField) (map[string]interface{}, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(rawJSON), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse output fields: %v", err)
+	}
+	values := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		raw, ok := response[field.Name]
+		if !ok || string(raw) == "null" {
+			return nil, fmt.Errorf("analysis has no output field %s", field.Name)
+		}
+		var err error
+		switch field.Type {
+		case OutputFieldNumber:
+			var v float64
+			err = json.Unmarshal(raw, &v)
+			values[field.Name] = v
+		case OutputFieldBoolean:
+			var v bool
+			err = json.Unmarshal(raw, &v)
+			values[field.Name] = v
+		case OutputFieldArray:
+			var v []string
+			err = json.Unmarshal(raw, &v)
+			values[field.Name] = v
+		default:
+			var v string
+			err = json.Unmarshal(raw, &v)
+			values[field.Name] = v
+		}
+		if err != nil {
+			return nil, fmt.Errorf("output field %s is not of type %s: %s", field.Name, outputFieldType(field), raw)
+		}
+	}
+	return values, nil
+}
+
+// outputFieldZeroValues returns the zero values of the output fields, for analyses without the model
+func outputFieldZeroValues(fields []outputField) map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		switch field.Type {
+		case OutputFieldNumber:
+			values[field.Name] = 0.0
+		case OutputFieldBoolean:
+			values[field.Name] = false
+		case OutputFieldArray:
+			values[field.Name] = []string{}
+		default:
+			values[field.Name] = ""
+		}
+	}
+	return values
+}
+
+// outputFieldType returns the type of an output field, string when not set
+func outputFieldType(field outputField) string {
+	if field.Type == "" {
+		return OutputFieldString
+	}
+	return field.Type
+}
+
+// outputFieldsMetadata converts output field values to measurement metadata, arrays as JSON
+func outputFieldsMetadata(values map[string]interface{}) map[string]string {
+	metadata := make(map[string]string, len(values))
+	for name, value := range values {
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			s = strconv.FormatBool(v)
+		default:
+			b, _ := json.Marshal(v)
+			s = string(b)
+		}
+		metadata[outputFieldMetadataPrefix+name] = s
+	}
+	return metadata
+}
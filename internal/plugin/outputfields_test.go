@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/argoproj/argo-rollouts/utils/evaluate"
+)
+
+func TestOutputFields(t *testing.T) {
+	fields := []outputField{
+		{Name: "affectedEndpoints", Type: OutputFieldArray, Description: "Endpoints with new errors in the canary"},
+		{Name: "errorRateIncrease", Type: OutputFieldNumber, Description: "Increase of the error rate in percentage points"},
+		{Name: "suggestedRollbackStep", Description: "Canary step to roll back to"},
+	}
+	if err := validateOutputFields(fields); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, invalid := range [][]outputField{
+		{{Name: "severity", Description: "Severity"}},
+		{{Name: "score", Description: "Score"}},
+		{{Name: "affected-endpoints", Description: "Endpoints"}},
+		{{Name: "endpoints", Type: "object", Description: "Endpoints"}},
+		{{Name: "endpoints"}},
+		{{Name: "endpoints", Description: "Endpoints"}, {Name: "endpoints", Description: "Endpoints"}},
+	} {
+		if err := validateOutputFields(invalid); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+
+	schema := responseSchema(fields)
+	if schema.Properties["affectedEndpoints"].Items == nil || !slices.Contains(schema.Required, "errorRateIncrease") {
+		t.Errorf("expected the output fields in the response schema, got %+v", schema)
+	}
+	if analysisResponseSchema.Properties["affectedEndpoints"] != nil || slices.Contains(analysisResponseSchema.Required, "errorRateIncrease") {
+		t.Error("expected the built-in response schema to be unchanged")
+	}
+
+	values, err := parseOutputFields(`{"text":"ok","promote":false,"affectedEndpoints":["/checkout","/cart"],"errorRateIncrease":2.5,"suggestedRollbackStep":"2"}`, fields)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	metadata := outputFieldsMetadata(values)
+	if metadata["output.affectedEndpoints"] != `["/checkout","/cart"]` || metadata["output.errorRateIncrease"] != "2.5" || metadata["output.suggestedRollbackStep"] != "2" {
+		t.Errorf("unexpected metadata: %v", metadata)
+	}
+	result := resultFields(AIAnalysisResult{Promote: true, Confidence: 90}, 0.9)
+	for name, v := range values {
+		result[name] = v
+	}
+	if ok, err := evaluate.EvalCondition(result, "result.promote == true && result.errorRateIncrease < 1"); err != nil || ok {
+		t.Errorf("expected the condition on an output field to fail, got %v, error %v", ok, err)
+	}
+
+	if _, err := parseOutputFields(`{"affectedEndpoints":[],"errorRateIncrease":"high","suggestedRollbackStep":"2"}`, fields); err == nil {
+		t.Error("expected an error for a field of the wrong type")
+	}
+	if _, err := parseOutputFields(`{"affectedEndpoints":[],"errorRateIncrease":1}`, fields); err == nil {
+		t.Error("expected an error for a missing field")
+	}
+}
@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+var pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// defaultPagerDutyMinConfidence is the confidence of a rejection paging on-call by default
+const defaultPagerDutyMinConfidence = 80
+
+// pagerDutyConfig triggers PagerDuty alerts for serious regressions caught by the analysis
+type pagerDutyConfig struct {
+	// Secret key in the AnalysisRun namespace with the Events API v2 integration key
+	// (default: pagerduty_routing_key of the plugin secret)
+	RoutingKeySecretRef *secretKeyRef `json:"routingKeySecretRef,omitempty"`
+	// Minimum confidence of a rejection that triggers an alert (default: 80)
+	MinConfidence int `json:"minConfidence,omitempty"`
+}
+
+// pagerDutyEvent is an Events API v2 trigger event
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key,omitempty"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links,omitempty"`
+}
+
+// pagerDutyPayload describes the alert
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	Group         string            `json:"group,omitempty"`
+	Class         string            `json:"class,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+// pagerDutyLink is a link shown on the incident
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// pagerDutySeverities maps analysis severities to PagerDuty event severities
+var pagerDutySeverities = map[string]string{
+	SeverityCritical: "critical",
+	SeverityMajor:    "error",
+	SeverityMinor:    "warning",
+	SeverityNone:     "info",
+}
+
+// notifyPagerDuty triggers a PagerDuty alert when the AI rejects the canary with at least minConfidence
+func notifyPagerDuty(ctx context.Context, cfg *pagerDutyConfig, rec decisionRecord) error {
+	minConfidence := cfg.MinConfidence
+	if minConfidence <= 0 {
+		minConfidence = defaultPagerDutyMinConfidence
+	}
+	if rec.Promote || rec.Confidence < minConfidence {
+		return nil
+	}
+	routingKey, err := readSecretRefOrDefault(ctx, cfg.RoutingKeySecretRef, "pagerduty_routing_key")
+	if err != nil {
+		return fmt.Errorf("failed to get PagerDuty routing key from secret: %v", err)
+	}
+	if err := postJSON(ctx, pagerDutyEventsURL, nil, newPagerDutyEvent(routingKey, rec)); err != nil {
+		return fmt.Errorf("failed to trigger PagerDuty alert: %v", err)
+	}
+	return nil
+}
+
+// newPagerDutyEvent builds the trigger event of a rejected canary. Measurements of the same
+// AnalysisRun metric share a dedup key so repeated rejections update a single alert.
+func newPagerDutyEvent(routingKey string, rec decisionRecord) pagerDutyEvent {
+	target := rec.AnalysisRun
+	if rec.Rollout != "" {
+		target = rec.Rollout
+	}
+	summary := fmt.Sprintf("Canary of %s/%s rejected by AI analysis (confidence %d%%)", rec.Namespace, target, rec.Confidence)
+	if rec.RootCause != "" {
+		summary += ": " + rec.RootCause
+	}
+	severity, ok := pagerDutySeverities[rec.Severity]
+	if !ok {
+		severity = "error"
+	}
+	details := map[string]string{
+		"analysisRun": rec.AnalysisRun,
+		"metric":      rec.Metric,
+		"confidence":  fmt.Sprintf("%d", rec.Confidence),
+		"severity":    rec.Severity,
+		"analysis":    truncate(rec.Analysis, 4000),
+	}
+	if rec.RootCause != "" {
+		details["rootCause"] = rec.RootCause
+	}
+	if rec.Remediation != "" {
+		details["remediation"] = rec.Remediation
+	}
+	var links []pagerDutyLink
+	if rec.IssueURL != "" {
+		links = append(links, pagerDutyLink{Href: rec.IssueURL, Text: "Issue"})
+	}
+	if rec.DashboardURL != "" {
+		links = append(links, pagerDutyLink{Href: rec.DashboardURL, Text: "Argo Rollouts dashboard"})
+	}
+	return pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    fmt.Sprintf("metric-ai/%s/%s/%s", rec.Namespace, rec.AnalysisRun, rec.Metric),
+		Payload: pagerDutyPayload{
+			// Summaries are limited to 1024 characters
+			Summary:       truncate(summary, 1021),
+			Source:        fmt.Sprintf("%s/%s", rec.Namespace, target),
+			Severity:      severity,
+			Component:     rec.Rollout,
+			Group:         rec.Namespace,
+			Class:         "canary-analysis",
+			CustomDetails: details,
+		},
+		Links: links,
+	}
+}
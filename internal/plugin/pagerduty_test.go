@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewPagerDutyEvent(t *testing.T) {
+	rec := decisionRecord{
+		AnalysisRun: "checkout-abc-1",
+		Namespace:   "shop",
+		Rollout:     "checkout",
+		Metric:      "ai",
+		Confidence:  95,
+		Severity:    SeverityMajor,
+		RootCause:   strings.Repeat("x", 2000),
+		IssueURL:    "https://github.com/acme/checkout/issues/7",
+	}
+	event := newPagerDutyEvent("routing-key", rec)
+	if event.EventAction != "trigger" || event.RoutingKey != "routing-key" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event.DedupKey != "metric-ai/shop/checkout-abc-1/ai" {
+		t.Errorf("unexpected dedup key %s", event.DedupKey)
+	}
+	if len(event.Payload.Summary) > 1024 || !strings.HasPrefix(event.Payload.Summary, "Canary of shop/checkout rejected") {
+		t.Errorf("unexpected summary %s", event.Payload.Summary)
+	}
+	if event.Payload.Severity != "error" || event.Payload.Source != "shop/checkout" {
+		t.Errorf("unexpected payload %+v", event.Payload)
+	}
+	if len(event.Links) != 1 || event.Links[0].Href != rec.IssueURL {
+		t.Errorf("unexpected links %+v", event.Links)
+	}
+
+	// Promotions and low-confidence rejections do not page
+	for _, r := range []decisionRecord{{Promote: true, Confidence: 99}, {Confidence: 79}} {
+		if err := notifyPagerDuty(context.Background(), &pagerDutyConfig{}, r); err != nil {
+			t.Errorf("expected no alert for %+v, got %v", r, err)
+		}
+	}
+}
@@ -5,11 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/rpc"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	rolloutsclientset "github.com/argoproj/argo-rollouts/pkg/client/clientset/versioned"
 	"github.com/argoproj/argo-rollouts/utils/plugin/types"
 	pluginTypes "github.com/argoproj/argo-rollouts/utils/plugin/types"
 	goPlugin "github.com/hashicorp/go-plugin"
@@ -44,51 +44,15 @@ var (
 	githubToken        string
 )
 
-// loadConfigFromFiles reads configuration from mounted secret files
-func loadConfigFromFiles() error {
-	secretsDir := "/etc/secrets"
-
-	// Read Google API Key
-	apiKeyFile := filepath.Join(secretsDir, "google_api_key")
-	if data, err := os.ReadFile(apiKeyFile); err != nil {
-		return fmt.Errorf("failed to read Google API key from %s: %v", apiKeyFile, err)
-	} else {
-		googleAPIKey = strings.TrimSpace(string(data))
-		if googleAPIKey == "" {
-			return fmt.Errorf("google API key is empty in %s", apiKeyFile)
-		}
-	}
-
-	// Read Google Cloud Project (optional)
-	projectFile := filepath.Join(secretsDir, "google_cloud_project")
-	if data, err := os.ReadFile(projectFile); err != nil {
-		log.Warnf("Google Cloud Project not found in %s: %v", projectFile, err)
-	} else {
-		googleCloudProject = strings.TrimSpace(string(data))
-	}
-
-	// Read GitHub Token
-	tokenFile := filepath.Join(secretsDir, "github_token")
-	if data, err := os.ReadFile(tokenFile); err != nil {
-		return fmt.Errorf("failed to read GitHub token from %s: %v", tokenFile, err)
-	} else {
-		githubToken = strings.TrimSpace(string(data))
-		if githubToken == "" {
-			return fmt.Errorf("github token is empty in %s", tokenFile)
-		}
-	}
-
-	log.Info("Successfully loaded configuration from mounted files")
-	return nil
-}
-
-// validateConfig validates that all required configuration is present
+// validateConfig validates the configuration loaded at startup. No key is required: metrics may use
+// their own credentials, and a missing key is reported by the measurements that need it.
 func validateConfig() error {
 	if googleAPIKey == "" {
-		return fmt.Errorf("google API key is required but not configured")
+		log.Info("No Google API key configured, default mode analyses require credentials.googleApiKeySecretRef")
 	}
+	// The GitHub token is validated lazily, when a metric with a githubUrl reports to GitHub
 	if githubToken == "" {
-		return fmt.Errorf("github token is required but not configured")
+		log.Info("No GitHub token configured, GitHub reporting is disabled for metrics without githubTokenSecretRef")
 	}
 	return nil
 }
@@ -101,28 +65,244 @@ type RpcPlugin struct {
 type aiConfig struct {
 	// optional explicit model
 	Model string `json:"model,omitempty"`
+	// optional: models to route to with modelRouting adaptive, in order of preference after model
+	AlternateModels []string `json:"alternateModels,omitempty"`
+	// optional: static (default) always uses model, adaptive uses the healthiest of model and alternateModels
+	ModelRouting string `json:"modelRouting,omitempty"`
+	// optional: sampling temperature (0-2) and seed of the model, for reproducible decisions
+	Temperature *float32 `json:"temperature,omitempty"`
+	Seed        *int32   `json:"seed,omitempty"`
+	// optional: independent analyses per measurement (up to 9) decided by majority, for self-consistency
+	Samples int `json:"samples,omitempty"`
 	// optional: namespace label selectors for stable/canary pods
 	StableLabel string `json:"stableLabel,omitempty"`
 	CanaryLabel string `json:"canaryLabel,omitempty"`
+	// optional: blue-green aliases for the stable (active) and canary (preview) label selectors
+	ActiveLabel  string `json:"activeLabel,omitempty"`
+	PreviewLabel string `json:"previewLabel,omitempty"`
 	// GitHub base branch
 	BaseBranch string `json:"baseBranch,omitempty"`
-	// GitHub repository URL
+	// GitHub repository URL (or GitLab project URL with gitProvider gitlab)
 	GitHubURL string `json:"githubUrl,omitempty"`
+	// Secret key in the AnalysisRun namespace with the GitHub token (default: github_token of the plugin secret)
+	GitHubTokenSecretRef *secretKeyRef `json:"githubTokenSecretRef,omitempty"`
+	// Per-metric credentials in Secrets of the AnalysisRun namespace
+	Credentials *credentialsConfig `json:"credentials,omitempty"`
+	// GitHub API base URL, e.g. https://ghe.example.com/api/v3 (default: derived from githubUrl)
+	GitHubAPIURL string `json:"githubApiUrl,omitempty"`
+	// Git provider failures are reported to: "github" (default), "gitlab", "bitbucket" or "gitea" (also Forgejo)
+	GitProvider string `json:"gitProvider,omitempty"`
+	// Bitbucket username authenticating with an app password, a bearer token is used when empty
+	BitbucketUsername string `json:"bitbucketUsername,omitempty"`
+	// Where failures are reported: "issue" (default), "pr" (comment) or "pr-review" (request changes)
+	GitHubTarget string `json:"githubTarget,omitempty"`
+	// Pull request to report on, looked up from commitSha when empty
+	PRNumber json.Number `json:"prNumber,omitempty"`
+	// Commit SHA of the canary, used to find its pull request
+	CommitSHA string `json:"commitSha,omitempty"`
+	// Labels, assignees and project of created issues
+	GitHubIssue githubIssueConfig `json:"githubIssue,omitempty"`
+	// Templates for the failure issue title and body, replacing the AI generated content, e.g.
+	// "[[ .Rollout ]] canary failed in [[ .Namespace ]]"
+	IssueTitleTemplate string `json:"issueTitleTemplate,omitempty"`
+	IssueBodyTemplate  string `json:"issueBodyTemplate,omitempty"`
+	// ConfigMap in the AnalysisRun namespace with "title" and "body" issue templates
+	IssueTemplateConfigMap string `json:"issueTemplateConfigMap,omitempty"`
+	// Publish every verdict as a GitHub check run on commitSha
+	GitHubChecks bool `json:"githubChecks,omitempty"`
+	// Check run name (default: argo-rollouts/metric-ai)
+	GitHubCheckName string `json:"githubCheckName,omitempty"`
+	// Also comment a short promotion summary on the canary pull request when the analysis passes
+	ReportOnSuccess bool `json:"reportOnSuccess,omitempty"`
+	// Upload the redacted logs as a secret gist linked from the issue instead of truncating them
+	LogsGist bool `json:"logsGist,omitempty"`
+	// Additional regular expressions redacted from uploaded logs
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+	// Set a commit status with the verdict on the canary commit
+	CommitStatus bool `json:"commitStatus,omitempty"`
+	// Commit status context (default: ai-canary-analysis)
+	CommitStatusContext string `json:"commitStatusContext,omitempty"`
+	// Canary pod annotation holding the commit SHA when commitSha is not set, the image tag is used otherwise
+	CommitSHAAnnotation string `json:"commitShaAnnotation,omitempty"`
+	// Go template of the Argo Rollouts dashboard URL linked from issues, e.g.
+	// https://rollouts.example.com/rollouts/rollout/[[ .Namespace ]]/[[ .Rollout ]]
+	DashboardURL string `json:"dashboardUrl,omitempty"`
+	// Open a draft pull request against baseBranch when the remediation is a change of fixManifestPath
+	FixPullRequest bool `json:"fixPullRequest,omitempty"`
+	// Repository path of the manifest fixes are suggested for, e.g. deploy/rollout.yaml
+	FixManifestPath string `json:"fixManifestPath,omitempty"`
+	// Close the issues created for a rollout revision once an analysis of the revision passes
+	AutoCloseIssues bool `json:"autoCloseIssues,omitempty"`
+	// ConfigMap tracking the created issues (default: metric-ai-issues)
+	IssueTrackingConfigMap string `json:"issueTrackingConfigMap,omitempty"`
+	// Post failed (and optionally passed) analyses to Slack
+	Slack *slackConfig `json:"slack,omitempty"`
+	// Post failed (and optionally passed) analyses to Discord
+	Discord *discordConfig `json:"discord,omitempty"`
+	// Page on-call through PagerDuty when the canary is rejected with high confidence
+	PagerDuty *pagerDutyConfig `json:"pagerDuty,omitempty"`
+	// Create Opsgenie alerts when the canary is rejected
+	Opsgenie *opsgenieConfig `json:"opsgenie,omitempty"`
+	// Annotate Grafana dashboards with every decision
+	Grafana *grafanaConfig `json:"grafana,omitempty"`
+	// Push decision gauges to a Prometheus Pushgateway
+	Pushgateway *pushgatewayConfig `json:"pushgateway,omitempty"`
+	// POST every decision as JSON to these endpoints
+	Webhooks []webhookConfig `json:"webhooks,omitempty"`
+	// Publish every decision as a CloudEvent to an HTTP sink
+	CloudEvents *cloudEventsConfig `json:"cloudEvents,omitempty"`
+	// Email the analysis report of failed analyses through SMTP
+	Email *emailConfig `json:"email,omitempty"`
+	// Estimate the spend of the analyses and warn when the namespace crosses its monthly budget
+	Budget *budgetConfig `json:"budget,omitempty"`
+	// Do not record the decisions as events of the AnalysisRun and Rollout
+	DisableEvents bool `json:"disableEvents,omitempty"`
+	// Write the complete analysis of each measurement to a ConfigMap named after the AnalysisRun
+	PersistReports bool `json:"persistReports,omitempty"`
+	// Upload the prompt, logs and decision of each measurement to an S3 or GCS bucket
+	ArtifactStorage *artifactStorageConfig `json:"artifactStorage,omitempty"`
+	// Write an AIAnalysisReport resource per measurement, requires the AIAnalysisReport CRD
+	ReportResources bool `json:"reportResources,omitempty"`
 	// Analysis mode: "default" or "agent"
 	AnalysisMode string `json:"analysisMode,omitempty"`
+	// Kubernetes Agent base URL for agent mode (default: K8S_AGENT_URL)
+	AgentURL string `json:"agentUrl,omitempty"`
+	// Base URLs of specialized agents by name, e.g. db-expert, usually set in the defaults ConfigMap
+	Agents map[string]string `json:"agents,omitempty"`
+	// Name of the agent of agents analyzing the metric, taking precedence over agentUrl
+	AgentName string `json:"agentName,omitempty"`
+	// Agent protocol: "legacy" (default) for the /a2a/analyze endpoint of kubernetes-agent, "a2a" for the Agent2Agent protocol, or "grpc"
+	AgentProtocol string `json:"agentProtocol,omitempty"`
+	// Path of the legacy agent analysis endpoint (default: /a2a/analyze)
+	AgentPath string `json:"agentPath,omitempty"`
+	// Compression of agent requests: "gzip", streamed with chunked transfer encoding, or "none" (default)
+	AgentCompression string `json:"agentCompression,omitempty"`
+	// Maximum duration of an agent analysis, e.g. 2m, including the health check and retries (default 5m)
+	AgentTimeout string `json:"agentTimeout,omitempty"`
+	// Agent path that must answer with a 2xx status before analyzing, e.g. /healthz (default: any answer of /)
+	AgentHealthPath string `json:"agentHealthPath,omitempty"`
+	// What agent mode does when the agent fails: "fail" (default) or "default" to analyze with the model
+	AgentFallback string `json:"agentFallback,omitempty"`
+	// Submit the analysis as an agent job polled by Resume instead of waiting for the agent response
+	AgentAsync bool `json:"agentAsync,omitempty"`
+	// Whether analyses of agents that opened a pull request with a fix are accepted (default: true)
+	AllowAgentPRs *bool `json:"allowAgentPRs,omitempty"`
+	// Label added to the pull requests opened by the agent, e.g. needs-approval, flagging them for human review
+	RequireApprovalLabel string `json:"requireApprovalLabel,omitempty"`
 	// Namespace for agent mode
 	Namespace string `json:"namespace,omitempty"`
 	// Pod name for agent mode
 	PodName string `json:"podName,omitempty"`
+	// optional: pod template hashes for stable/canary pods, discovered from the Rollout status if unset
+	StablePodHash string `json:"stablePodHash,omitempty"`
+	CanaryPodHash string `json:"canaryPodHash,omitempty"`
 	// Extra prompt text to append to the AI analysis
 	ExtraPrompt string `json:"extraPrompt,omitempty"`
+	// Instructions replacing the built-in analysis instructions, the JSON response format is still enforced
+	SystemPrompt string `json:"systemPrompt,omitempty"`
+	// Version of the built-in analysis instructions, e.g. 1.0.0 (default: the latest)
+	PromptVersion string `json:"promptVersion,omitempty"`
+	// Preset instructions for the stack of the service: jvm, nginx, postgres or golang-service
+	Preset string `json:"preset,omitempty"`
+	// ConfigMap in the AnalysisRun namespace with few-shot examples (logs and expected decision) added to the prompt
+	ExamplesConfigMap string `json:"examplesConfigMap,omitempty"`
+	// Gemini safety filter thresholds by category (hateSpeech, dangerousContent, harassment, sexuallyExplicit,
+	// civicIntegrity or all), e.g. dangerousContent: BLOCK_ONLY_HIGH
+	SafetySettings map[string]string `json:"safetySettings,omitempty"`
+	// Extra fields the model must return, copied to the measurement metadata and available to conditions
+	OutputFields []outputField `json:"outputFields,omitempty"`
+	// MCP servers whose tools the model can call to investigate the canary in default mode
+	MCPServers []mcpServerConfig `json:"mcpServers,omitempty"`
+	// Maximum MCP tool calls per analysis (default 10)
+	MaxToolCalls int `json:"maxToolCalls,omitempty"`
+	// Number of previous measurements passed to the model for trend analysis (default 5, -1 disables)
+	MaxHistory int `json:"maxHistory,omitempty"`
+	// Maintenance windows during which analyses return Inconclusive or are deferred
+	MaintenanceWindows []maintenanceWindow `json:"maintenanceWindows,omitempty"`
+	// Phase by severity, e.g. minor: Inconclusive and critical: Failed, overriding the promote decision
+	SeverityPolicy map[string]string `json:"severityPolicy,omitempty"`
+	// Measurement value: "confidence" (default), "score" (signed confidence) or "severity" (0-3)
+	MeasurementValue string `json:"measurementValue,omitempty"`
+	// Cache AI decisions for unchanged logs for this long, e.g. "10m" (disabled by default)
+	CacheTTL string `json:"cacheTTL,omitempty"`
+	// optional ConfigMap in the AnalysisRun namespace persisting cached decisions across plugin restarts
+	CacheConfigMap string `json:"cacheConfigMap,omitempty"`
+	// Promote without calling the AI when the canary logs show no new message types and no errors
+	SkipIdenticalLogs bool `json:"skipIdenticalLogs,omitempty"`
+	// Fraction (0-1) of binary or base64 content above which logs are replaced by pod status and events (default 0.5, 1 disables)
+	NoiseThreshold *float64 `json:"noiseThreshold,omitempty"`
+	// Number of handled requests required in the canary logs before analyzing (disabled by default)
+	MinRequests int `json:"minRequests,omitempty"`
+	// optional regular expression matching canary request log lines (default: common access log heuristic)
+	TrafficMarker string `json:"trafficMarker,omitempty"`
+	// How long to wait for minRequests before analyzing anyway (default 5m)
+	TrafficWaitTimeout string `json:"trafficWaitTimeout,omitempty"`
+	// Wait this long after the AnalysisRun started before the first log fetch, e.g. 2m (default: none)
+	InitialDelay string `json:"initialDelay,omitempty"`
+	// Secret in the AnalysisRun namespace with a kubeconfig or Argo CD cluster secret of the cluster
+	// running the pods (default: the controller cluster)
+	ClusterSecretRef *clusterSecretRef `json:"clusterSecretRef,omitempty"`
+	// Container to read logs from (default: the pod's default container)
+	Container string `json:"container,omitempty"`
+	// Maximum bytes of logs read per pod (default: unlimited)
+	MaxLogBytes int64 `json:"maxLogBytes,omitempty"`
+	// Experiment cohorts compared against the baseline cohort in one analysis, replacing the stable/canary selectors
+	Cohorts []cohort `json:"cohorts,omitempty"`
+	// Decide on the majority of the last N AI verdicts instead of the latest one (default: disabled)
+	MajorityOf int `json:"majorityOf,omitempty"`
+	// Maximum duration of a measurement, e.g. 4m, covering log fetching, retries and AI calls (default: none)
+	Timeout string `json:"timeout,omitempty"`
+	// Fetch pod logs once and reuse them across the metrics of the same AnalysisRun
+	ShareLogs bool `json:"shareLogs,omitempty"`
+}
+
+// secretRefs returns the configured per-metric secret references
+func (c *aiConfig) secretRefs() []*secretKeyRef {
+	refs := []*secretKeyRef{c.GitHubTokenSecretRef}
+	if c.Credentials != nil {
+		refs = append(refs, c.Credentials.GoogleAPIKeySecretRef, c.Credentials.GitHubTokenSecretRef, c.Credentials.AgentTokenSecretRef)
+	}
+	if c.Slack != nil {
+		refs = append(refs, c.Slack.WebhookSecretRef, c.Slack.TokenSecretRef)
+	}
+	if c.Discord != nil {
+		refs = append(refs, c.Discord.WebhookSecretRef)
+	}
+	if c.PagerDuty != nil {
+		refs = append(refs, c.PagerDuty.RoutingKeySecretRef)
+	}
+	if c.Opsgenie != nil {
+		refs = append(refs, c.Opsgenie.APIKeySecretRef)
+	}
+	if c.Grafana != nil {
+		refs = append(refs, c.Grafana.TokenSecretRef)
+	}
+	if c.ArtifactStorage != nil {
+		refs = append(refs, c.ArtifactStorage.AccessKeyIDSecretRef, c.ArtifactStorage.SecretAccessKeySecretRef)
+	}
+	for i := range c.Webhooks {
+		refs = append(refs, c.Webhooks[i].SigningKeySecretRef)
+	}
+	if c.Email != nil {
+		refs = append(refs, c.Email.PasswordSecretRef)
+	}
+	for i := range c.MCPServers {
+		refs = append(refs, c.MCPServers[i].TokenSecretRef)
+	}
+	var configured []*secretKeyRef
+	for _, ref := range refs {
+		if ref != nil {
+			configured = append(configured, ref)
+		}
+	}
+	return configured
 }
 
 func (g *RpcPlugin) InitPlugin() types.RpcError {
 	log.Info("Initializing AI metric plugin")
 
 	// Initialize configuration at startup
-	if err := loadConfigFromFiles(); err != nil {
+	if err := loadConfig(context.Background()); err != nil {
 		log.WithError(err).Fatal("Failed to load configuration")
 	}
 
@@ -130,188 +310,190 @@ func (g *RpcPlugin) InitPlugin() types.RpcError {
 		log.WithError(err).Fatal("Configuration validation failed")
 	}
 
+	if err := configureOutboundTransport(); err != nil {
+		log.WithError(err).Fatal("Failed to configure outbound requests")
+	}
+	if _, err := newAuditSink(); err != nil {
+		log.WithError(err).Fatal("Invalid audit log configuration")
+	}
+
+	// Log the correlation ID of the measurement of log entries with a context
+	log.AddHook(correlationHook{})
+
+	// Create provider clients once and reuse them for every measurement
+	prewarmClients()
+
+	// Serve the health endpoints for the probes of the controller
+	serveHTTP()
+	servePprof()
+
 	log.Info("AI metric plugin initialized successfully")
 	return types.RpcError{}
 }
 
 // Run starts a new measurement
 func (p *RpcPlugin) Run(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric) v1alpha1.Measurement {
-	startTime := metav1.Now()
+	return p.run(analysisRun, metric, metav1.Now(), "")
+}
+
+// parsePluginConfig parses the metric plugin configuration over the cluster-wide and namespace
+// defaults. The controller resolves the {{args.*}} placeholders of the metric before calling the plugin.
+func parsePluginConfig(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, cfg *aiConfig) error {
+	if err := applyDefaults(ctx, analysisRun.Namespace, cfg); err != nil {
+		return err
+	}
+	pluginCfg, ok := metric.Provider.Plugin["argoproj-labs/metric-ai"]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(pluginCfg, cfg)
+}
+
+// run performs a measurement started at startTime, which is earlier than now for deferred measurements.
+// agentJobID is the agent job of a resumed asynchronous agent analysis.
+func (p *RpcPlugin) run(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, startTime metav1.Time, agentJobID string) (measurement v1alpha1.Measurement) {
+	// Correlate the logs and outbound requests of the measurement, including those of the agent
+	correlation := measurementCorrelationID(analysisRun, metric.Name, startTime)
 	newMeasurement := v1alpha1.Measurement{
 		StartedAt: &startTime,
+		Metadata:  map[string]string{"correlationId": correlation},
 	}
 
-	log.WithFields(log.Fields{
-		"analysisRun": analysisRun.Name,
-		"namespace":   analysisRun.Namespace,
-		"metric":      metric.Name,
-	}).Info("Running AI metric analysis")
+	// Every log entry of the measurement identifies it, so the controller logs can be filtered per rollout
+	ctx := withLogFields(withCorrelationID(context.Background(), correlation), measurementLogFields(analysisRun, metric.Name, startTime, correlation))
+
+	log.WithContext(ctx).Info("Running AI metric analysis")
 
-	// Parse plugin configuration
+	// Pick up rotated credentials of the plugin secret
+	reloadConfig(ctx)
+
+	// Parse plugin configuration over the cluster-wide and namespace defaults
 	var cfg aiConfig
-	if pluginCfg, ok := metric.Provider.Plugin["argoproj-labs/metric-ai"]; ok {
-		if err := json.Unmarshal(pluginCfg, &cfg); err != nil {
-			log.WithError(err).Error("Failed to parse plugin configuration")
-			return markMeasurementError(newMeasurement, err)
-		}
+	if err := parsePluginConfig(ctx, analysisRun, metric, &cfg); err != nil {
+		log.WithContext(ctx).WithError(err).Error("Failed to parse plugin configuration")
+		return markMeasurementError(newMeasurement, err)
 	}
-
-	// Set defaults
-	stableSelector := cfg.StableLabel
-	if stableSelector == "" {
-		stableSelector = "role=stable"
+	if cfg.ClusterSecretRef != nil {
+		cfg.ClusterSecretRef.namespace = analysisRun.Namespace
 	}
-	canarySelector := cfg.CanaryLabel
-	if canarySelector == "" {
-		canarySelector = "role=canary"
+	if cfg.Credentials != nil {
+		cfg.Credentials.namespace = analysisRun.Namespace
+		if cfg.Credentials.AgentTLSSecretRef != nil {
+			cfg.Credentials.AgentTLSSecretRef.namespace = analysisRun.Namespace
+		}
+		if cfg.Credentials.GitHubTokenSecretRef != nil {
+			cfg.GitHubTokenSecretRef = cfg.Credentials.GitHubTokenSecretRef
+		}
 	}
-	modelName := cfg.Model
-	if modelName == "" {
-		modelName = "gemini-2.0-flash"
+	// Per-metric secrets are only read from the AnalysisRun namespace
+	for _, ref := range cfg.secretRefs() {
+		ref.namespace = analysisRun.Namespace
 	}
 
-	log.WithFields(log.Fields{
-		"stableSelector": stableSelector,
-		"canarySelector": canarySelector,
-		"model":          modelName,
-	}).Info("Fetching pod logs for analysis")
+	// Trace the measurement when an OTLP traces endpoint is configured, exported once it finishes
+	ctx, span := startMeasurementTrace(ctx, analysisRun, metric.Name, agentJobID)
+	defer func() { finishMeasurementTrace(span, measurement) }()
 
-	// Get Kubernetes client
-	kubeClient, err := acquireKubeClient()
+	// Reject an invalid configuration before fetching any logs or calling the model
+	settings, err := validatePluginConfig(&cfg)
 	if err != nil {
-		log.WithError(err).Error("Failed to acquire Kubernetes client")
+		log.WithContext(ctx).WithError(err).Error("Invalid plugin configuration")
 		return markMeasurementError(newMeasurement, err)
 	}
 
-	// Fetch logs
-	ns := analysisRun.Namespace
-	stableLogs, err := readFirstPodLogs(context.Background(), kubeClient, ns, stableSelector)
-	if err != nil {
-		log.WithError(err).Error("Failed to fetch stable pod logs")
-		return markMeasurementError(newMeasurement, err)
+	// Bound the whole measurement (log fetching, retries, AI calls, issue creation) so it can never
+	// outlive the controller's plugin RPC timeout and leave the measurement hanging
+	if settings.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.timeout)
+		defer cancel()
 	}
 
-	canaryLogs, err := readFirstPodLogs(context.Background(), kubeClient, ns, canarySelector)
+	// Suppress analysis during maintenance windows
+	window, windowEnd, err := activeMaintenanceWindow(cfg.MaintenanceWindows, time.Now())
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.WithError(err).Warn("Canary pods not found, marking as successful")
-			newMeasurement.Value = "1"
-			newMeasurement.Phase = v1alpha1.AnalysisPhaseSuccessful
-			finishedTime := metav1.Now()
-			newMeasurement.FinishedAt = &finishedTime
-			return newMeasurement
-		}
-		log.WithError(err).Error("Failed to fetch canary pod logs")
+		log.WithContext(ctx).WithError(err).Error("Invalid maintenance window configuration")
 		return markMeasurementError(newMeasurement, err)
 	}
-
-	log.WithFields(log.Fields{
-		"stableLogsLength": len(stableLogs),
-		"canaryLogsLength": len(canaryLogs),
-	}).Info("Successfully fetched pod logs")
-
-	logsContext := "--- STABLE LOGS ---\n" + stableLogs + "\n\n--- CANARY LOGS ---\n" + canaryLogs
-
-	// Get analysis mode (default or agent)
-	analysisMode := cfg.AnalysisMode
-	if analysisMode == "" {
-		analysisMode = AnalysisModeDefault
+	if window != nil {
+		return markMeasurementMaintenance(newMeasurement, window, windowEnd)
 	}
 
-	// Get namespace and pod name for agent mode
-	namespace := cfg.Namespace
-	podName := cfg.PodName
-	if analysisMode == AnalysisModeAgent && (namespace == "" || podName == "") {
-		err := fmt.Errorf("agent mode requires namespace and podName to be configured")
-		log.WithError(err).Error("Invalid agent mode configuration")
-		return markMeasurementError(newMeasurement, err)
-	}
-
-	// If podName doesn't contain a dash, it might be a pod template hash
-	// Try to find a pod with that hash as a label
-	if analysisMode == AnalysisModeAgent && !strings.Contains(podName, "-") {
-		log.WithFields(log.Fields{
-			"namespace":   namespace,
-			"templateHash": podName,
-		}).Debug("podName appears to be a template hash, looking for matching pod")
-
-		// Get Kubernetes client
-		k8sClient, err := getKubeClient()
-		if err != nil {
-			log.WithError(err).Error("Failed to create Kubernetes client")
-			return markMeasurementError(newMeasurement, fmt.Errorf("failed to create k8s client: %w", err))
+	// Let the canary warm up (JVM startup, cache priming) before judging its logs
+	if settings.initialDelay > 0 {
+		analysisStart := analysisRun.CreationTimestamp.Time
+		if analysisStart.IsZero() {
+			analysisStart = startTime.Time
 		}
+		if readyAt := analysisStart.Add(settings.initialDelay); time.Now().Before(readyAt) {
+			log.WithContext(ctx).WithField("resumeAt", readyAt).Info("Delaying analysis until the canary has warmed up")
+			return markMeasurementDelayed(newMeasurement, readyAt)
+		}
+	}
 
-		// Try to find a pod with this hash
-		pods, err := k8sClient.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("rollouts-pod-template-hash=%s", podName),
-			Limit:         1,
-		})
-		if err != nil {
-			log.WithError(err).Error("Failed to list pods by template hash")
-			return markMeasurementError(newMeasurement, fmt.Errorf("failed to find pod with template hash %s: %w", podName, err))
+	// Render the variables of the prompts, e.g. [[ .RolloutName ]] or [[ .Args.service ]]
+	if isPromptTemplate(cfg.ExtraPrompt) || isPromptTemplate(cfg.SystemPrompt) {
+		withImages := strings.Contains(cfg.ExtraPrompt+cfg.SystemPrompt, "Image")
+		data := newPromptTemplateData(ctx, analysisRun, metric, cfg, withImages)
+		if cfg.ExtraPrompt, err = renderPromptTemplate("extraPrompt", cfg.ExtraPrompt, data); err != nil {
+			log.WithContext(ctx).WithError(err).Error("Invalid extra prompt template")
+			return markMeasurementError(newMeasurement, err)
 		}
-		if len(pods.Items) == 0 {
-			err := fmt.Errorf("no pods found with template hash %s", podName)
-			log.WithError(err).Error("No pods found for template hash")
+		if cfg.SystemPrompt, err = renderPromptTemplate("systemPrompt", cfg.SystemPrompt, data); err != nil {
+			log.WithContext(ctx).WithError(err).Error("Invalid system prompt template")
 			return markMeasurementError(newMeasurement, err)
 		}
-
-		// Use the first pod found
-		resolvedPodName := pods.Items[0].Name
-		log.WithFields(log.Fields{
-			"templateHash":    podName,
-			"resolvedPodName": resolvedPodName,
-		}).Info("Resolved pod template hash to pod name")
-		podName = resolvedPodName
 	}
-
-	// Analyze with AI (mode-aware)
-	log.WithFields(log.Fields{
-		"model": modelName,
-		"mode":  analysisMode,
-	}).Info("Starting AI analysis")
-	analysisJSON, result, aiErr := analyzeWithMode(analysisMode, modelName, logsContext, namespace, podName, cfg.ExtraPrompt)
-	if aiErr != nil {
-		log.WithError(aiErr).Error("AI analysis failed")
-		return markMeasurementError(newMeasurement, aiErr)
+	systemPrompt, promptVersion, err := resolveSystemPrompt(cfg.SystemPrompt, cfg.PromptVersion)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Error("Invalid prompt configuration")
+		return markMeasurementError(newMeasurement, err)
 	}
 
-	log.WithFields(log.Fields{
-		"promote":        result.Promote,
-		"confidence":     result.Confidence,
-		"analysisLength": len(result.Text),
-	}).Info("AI analysis completed")
-
-	// Store analysis in metadata
-	if newMeasurement.Metadata == nil {
-		newMeasurement.Metadata = make(map[string]string)
-	}
-	newMeasurement.Metadata["analysis"] = result.Text
-	newMeasurement.Metadata["analysisJSON"] = analysisJSON
-	newMeasurement.Metadata["confidence"] = fmt.Sprintf("%d", result.Confidence)
-
-	if result.Promote {
-		// Success: canary is good
-		// Use confidence as a decimal value (0.0 to 1.0)
-		newMeasurement.Value = fmt.Sprintf("%.2f", float64(result.Confidence)/100.0)
-		newMeasurement.Phase = v1alpha1.AnalysisPhaseSuccessful
-		log.Info("Canary promotion recommended by AI analysis")
-	} else {
-		// Failure: canary has issues
-		newMeasurement.Value = "0"
-		newMeasurement.Phase = v1alpha1.AnalysisPhaseFailed
-		log.Info("Canary promotion not recommended, attempting to create GitHub issue")
-
-		// Create GitHub issue on failure
-		if issueErr := createCanaryFailureIssue(logsContext, result.Text, cfg.BaseBranch, cfg.GitHubURL, modelName); issueErr != nil {
-			log.WithError(issueErr).Warn("Failed to create GitHub issue")
+	modelName := cfg.Model
+	if modelName == "" {
+		modelName = "gemini-2.0-flash"
+	}
+	if cfg.ModelRouting == ModelRoutingAdaptive {
+		// Avoid a degraded model by routing to the alternate with the fewest recent errors and lowest latency
+		if routed := routeModel(ctx, modelName, cfg.AlternateModels); routed != modelName {
+			newMeasurement.Metadata["modelRoutedFrom"] = modelName
+			modelName = routed
 		}
 	}
 
-	finishedTime := metav1.Now()
-	newMeasurement.FinishedAt = &finishedTime
-	return newMeasurement
+	r := &measurementRun{
+		analysisRun:   analysisRun,
+		metric:        metric,
+		cfg:           cfg,
+		settings:      settings,
+		startTime:     startTime,
+		agentJobID:    agentJobID,
+		correlation:   correlation,
+		measurement:   newMeasurement,
+		modelName:     modelName,
+		systemPrompt:  systemPrompt,
+		promptVersion: promptVersion,
+	}
+	if m, done := r.fetchLogs(ctx); done {
+		return m
+	}
+	if m, done := r.analyze(ctx); done {
+		return m
+	}
+	if m, done := r.evaluate(ctx); done {
+		return m
+	}
+	return r.report(ctx)
+}
+
+// markReportError records a failed report in the measurement metadata, with the time GitHub allows
+// requests again when it was rate limited, so failures are visible on the AnalysisRun
+func markReportError(m v1alpha1.Measurement, key string, err error) {
+	m.Metadata[key] = err.Error()
+	if reset, ok := githubRateLimitReset(err, time.Now()); ok {
+		m.Metadata["githubRateLimitReset"] = reset.UTC().Format(time.RFC3339)
+	}
 }
 
 // markMeasurementError marks a measurement as errored
@@ -323,8 +505,115 @@ func markMeasurementError(m v1alpha1.Measurement, err error) v1alpha1.Measuremen
 	return m
 }
 
+// markMeasurementInvalidResponse fails a measurement on an unusable AI response, keeping the raw
+// response (if any) in the metadata for troubleshooting
+func markMeasurementInvalidResponse(m v1alpha1.Measurement, rawResponse string, err error) v1alpha1.Measurement {
+	if rawResponse != "" {
+		if m.Metadata == nil {
+			m.Metadata = make(map[string]string)
+		}
+		m.Metadata["rawResponse"] = truncate(rawResponse, maxRawResponseLength)
+	}
+	return markMeasurementError(m, err)
+}
+
+// markMeasurementMaintenance suppresses a measurement during a maintenance window
+func markMeasurementMaintenance(m v1alpha1.Measurement, window *maintenanceWindow, windowEnd time.Time) v1alpha1.Measurement {
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]string)
+	}
+	m.Metadata["maintenanceWindow"] = window.Schedule
+	m.Metadata["maintenanceWindowEnd"] = windowEnd.UTC().Format(time.RFC3339)
+
+	log.WithFields(log.Fields{
+		"schedule":  window.Schedule,
+		"windowEnd": windowEnd,
+		"action":    window.Action,
+	}).Info("Analysis suppressed by maintenance window")
+
+	if window.Action == MaintenanceActionDefer {
+		// Keep the measurement running, Resume analyzes once the window is over
+		resumeAt := metav1.NewTime(windowEnd)
+		m.Phase = v1alpha1.AnalysisPhaseRunning
+		m.ResumeAt = &resumeAt
+		m.Metadata["deferred"] = "true"
+		return m
+	}
+
+	m.Phase = v1alpha1.AnalysisPhaseInconclusive
+	m.Message = fmt.Sprintf("analysis suppressed by maintenance window %q until %s", window.Schedule, windowEnd.UTC().Format(time.RFC3339))
+	finishedTime := metav1.Now()
+	m.FinishedAt = &finishedTime
+	return m
+}
+
+// markMeasurementDelayed keeps a measurement running until the initial delay has elapsed
+func markMeasurementDelayed(m v1alpha1.Measurement, readyAt time.Time) v1alpha1.Measurement {
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]string)
+	}
+	resumeAt := metav1.NewTime(readyAt)
+	m.Phase = v1alpha1.AnalysisPhaseRunning
+	m.ResumeAt = &resumeAt
+	m.Metadata["deferred"] = "true"
+	m.Metadata["initialDelayUntil"] = readyAt.UTC().Format(time.RFC3339)
+	return m
+}
+
+// markMeasurementWaitingForTraffic keeps a measurement running until the canary handles enough requests
+func markMeasurementWaitingForTraffic(m v1alpha1.Measurement, observedRequests int) v1alpha1.Measurement {
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]string)
+	}
+	resumeAt := metav1.NewTime(time.Now().Add(defaultTrafficPollInterval))
+	m.Phase = v1alpha1.AnalysisPhaseRunning
+	m.ResumeAt = &resumeAt
+	m.Metadata["deferred"] = "true"
+	m.Metadata["observedRequests"] = fmt.Sprintf("%d", observedRequests)
+	return m
+}
+
+// markMeasurementAgentJobPending keeps the measurement running until Resume finds the agent job done
+func markMeasurementAgentJobPending(m v1alpha1.Measurement, jobID string) v1alpha1.Measurement {
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]string)
+	}
+	resumeAt := metav1.NewTime(time.Now().Add(agentJobPollInterval))
+	m.Phase = v1alpha1.AnalysisPhaseRunning
+	m.ResumeAt = &resumeAt
+	m.Metadata["agentJobId"] = jobID
+	return m
+}
+
 // Resume checks if an external measurement is finished
 func (p *RpcPlugin) Resume(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, measurement v1alpha1.Measurement) v1alpha1.Measurement {
+	// Deferred measurements (maintenance windows, waiting for canary traffic) are analyzed once ResumeAt is reached
+	if measurement.Metadata["deferred"] == "true" {
+		if measurement.ResumeAt != nil && time.Now().Before(measurement.ResumeAt.Time) {
+			return measurement
+		}
+		startTime := metav1.Now()
+		if measurement.StartedAt != nil {
+			startTime = *measurement.StartedAt
+		}
+		return p.run(analysisRun, metric, startTime, "")
+	}
+	// Asynchronous agent analyses are polled until the job is done
+	if jobID := measurement.Metadata["agentJobId"]; jobID != "" {
+		if measurement.ResumeAt != nil && time.Now().Before(measurement.ResumeAt.Time) {
+			return measurement
+		}
+		startTime := metav1.Now()
+		if measurement.StartedAt != nil {
+			startTime = *measurement.StartedAt
+		}
+		if time.Since(startTime.Time) > agentJobTimeout {
+			err := fmt.Errorf("agent job %s not done after %s", jobID, agentJobTimeout)
+			log.WithError(err).Error("Kubernetes Agent job timed out")
+			return markMeasurementError(measurement, err)
+		}
+		return p.run(analysisRun, metric, startTime, jobID)
+	}
 	// Gemini analysis is synchronous, so just return the measurement
 	return measurement
 }
@@ -344,7 +633,24 @@ func (p *RpcPlugin) GarbageCollect(analysisRun *v1alpha1.AnalysisRun, metric v1a
 		"analysisRun": analysisRun.Name,
 		"metric":      metric.Name,
 		"limit":       limit,
-	}).Debug("GarbageCollect called (no-op for Gemini plugin)")
+	}).Debug("GarbageCollect called")
+
+	// Prune the persisted reports of measurements Argo Rollouts no longer keeps
+	var cfg aiConfig
+	if err := parsePluginConfig(context.Background(), analysisRun, metric, &cfg); err != nil {
+		return pluginTypes.RpcError{ErrorString: fmt.Sprintf("failed to parse plugin config: %v", err)}
+	}
+	if !cfg.PersistReports || limit < 0 {
+		return pluginTypes.RpcError{}
+	}
+	client, err := acquireKubeClient()
+	if err == nil {
+		err = pruneReports(context.Background(), client, analysisRun, metric.Name, limit)
+	}
+	if err != nil {
+		log.WithError(err).Warn("Failed to prune analysis reports")
+		return pluginTypes.RpcError{ErrorString: err.Error()}
+	}
 	return pluginTypes.RpcError{}
 }
 
@@ -359,6 +665,8 @@ func (p *RpcPlugin) GetMetadata(metric v1alpha1.Metric) map[string]string {
 	metadata["provider"] = ProviderType
 
 	var cfg aiConfig
+	// The namespace is unknown, only the cluster-wide defaults apply
+	_ = applyDefaults(context.Background(), "", &cfg)
 	if pluginCfg, ok := metric.Provider.Plugin["argoproj-labs/metric-ai"]; ok {
 		if err := json.Unmarshal(pluginCfg, &cfg); err == nil {
 			if cfg.Model != "" {
@@ -370,6 +678,16 @@ func (p *RpcPlugin) GetMetadata(metric v1alpha1.Metric) map[string]string {
 			if cfg.CanaryLabel != "" {
 				metadata["canaryLabel"] = cfg.CanaryLabel
 			}
+			if cfg.ActiveLabel != "" {
+				metadata["activeLabel"] = cfg.ActiveLabel
+			}
+			if cfg.PreviewLabel != "" {
+				metadata["previewLabel"] = cfg.PreviewLabel
+			}
+			if cfg.MeasurementValue == MeasurementValueSeverity {
+				metadata["suggestedSuccessCondition"] = suggestedSeveritySuccessCondition
+				metadata["suggestedFailureCondition"] = suggestedSeverityFailureCondition
+			}
 		}
 	}
 
@@ -380,23 +698,36 @@ func (p *RpcPlugin) GetMetadata(metric v1alpha1.Metric) map[string]string {
 // Kubernetes helpers
 // ------------------------------
 
-var getKubeClient = func() (*kubernetes.Clientset, error) {
+// getRestConfig returns the in-cluster config, falling back to KUBECONFIG
+func getRestConfig() (*rest.Config, error) {
 	// Try in-cluster first
 	if cfg, err := rest.InClusterConfig(); err == nil {
-		return kubernetes.NewForConfig(cfg)
+		return cfg, nil
 	}
 	// Fallback to KUBECONFIG
 	kubeconfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
 		clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{},
 	)
-	restCfg, err := kubeconfig.ClientConfig()
+	return kubeconfig.ClientConfig()
+}
+
+var getKubeClient = func() (*kubernetes.Clientset, error) {
+	restCfg, err := getRestConfig()
 	if err != nil {
 		return nil, err
 	}
 	return kubernetes.NewForConfig(restCfg)
 }
 
-var fetchFirstPodLogs = func(ctx context.Context, client *kubernetes.Clientset, namespace, labelSelector string) (string, error) {
+var getRolloutsClient = func() (rolloutsclientset.Interface, error) {
+	restCfg, err := getRestConfig()
+	if err != nil {
+		return nil, err
+	}
+	return rolloutsclientset.NewForConfig(restCfg)
+}
+
+var fetchFirstPodLogs = func(ctx context.Context, client *kubernetes.Clientset, namespace, labelSelector string, opts podLogOptions) (string, podLogSample, error) {
 	log := log.WithFields(log.Fields{
 		"namespace":     namespace,
 		"labelSelector": labelSelector,
@@ -404,21 +735,31 @@ var fetchFirstPodLogs = func(ctx context.Context, client *kubernetes.Clientset,
 	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 	if err != nil {
 		log.Error("Failed to list pods", err)
-		return "", fmt.Errorf("failed to list pods for selector %s in namespace %s: %w", labelSelector, namespace, err)
+		return "", podLogSample{}, fmt.Errorf("failed to list pods for selector %s in namespace %s: %w", labelSelector, namespace, err)
 	}
 	if len(pods.Items) == 0 {
 		log.Error("No pods found for selector")
-		return "", errors.NewNotFound(schema.GroupResource{Group: "", Resource: "pods"}, labelSelector)
+		return "", podLogSample{}, errors.NewNotFound(schema.GroupResource{Group: "", Resource: "pods"}, labelSelector)
 	}
 	pod := pods.Items[0]
-	podLogOpts := &corev1.PodLogOptions{}
+	podLogOpts := &corev1.PodLogOptions{Container: opts.Container}
 	req := client.CoreV1().Pods(namespace).GetLogs(pod.Name, podLogOpts)
 	bytes, err := req.DoRaw(ctx)
 	if err != nil {
 		log.WithField("podName", pod.Name).Error("Failed to fetch logs for pod", err)
-		return "", fmt.Errorf("failed to fetch logs for pod %s in namespace %s: %w", pod.Name, namespace, err)
+		return "", podLogSample{}, fmt.Errorf("failed to fetch logs for pod %s in namespace %s: %w", pod.Name, namespace, err)
+	}
+	logs, truncated := tailBytes(string(bytes), opts.LimitBytes)
+	sample := podLogSample{
+		Pod:       pod.Name,
+		Container: opts.Container,
+		Bytes:     len(logs),
+		Truncated: truncated,
+	}
+	if sample.Container == "" && len(pod.Spec.Containers) == 1 {
+		sample.Container = pod.Spec.Containers[0].Name
 	}
-	return string(bytes), nil
+	return logs, sample, nil
 }
 
 // indirection to allow test override without touching exported names
@@ -3,9 +3,13 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	analysisutil "github.com/argoproj/argo-rollouts/utils/analysis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -29,8 +33,8 @@ func TestRun_ParsesConfigAndReturnsResult(t *testing.T) {
 
 	// Override AI call to avoid external dependency
 	old := analyzeLogsWithAI
-	analyzeLogsWithAI = func(params AIAnalysisParams) (string, AIAnalysisResult, error) {
-		return `{"text":"ok","promote":true,"confidence":100}`, AIAnalysisResult{Text: "ok", Promote: true, Confidence: 100}, nil
+	analyzeLogsWithAI = func(_ context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		return `{"text":"ok","promote":true,"confidence":100,"severity":"none"}`, AIAnalysisResult{Text: "ok", Promote: true, Confidence: 100, Severity: SeverityNone}, nil
 	}
 	t.Cleanup(func() { analyzeLogsWithAI = old })
 
@@ -40,8 +44,8 @@ func TestRun_ParsesConfigAndReturnsResult(t *testing.T) {
 	t.Cleanup(func() { acquireKubeClient = oldKC })
 
 	oldLogs := readFirstPodLogs
-	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string) (string, error) {
-		return "dummy", nil
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string, _ podLogOptions) (string, podLogSample, error) {
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
 	}
 	t.Cleanup(func() { readFirstPodLogs = oldLogs })
 
@@ -56,6 +60,9 @@ func TestRun_ParsesConfigAndReturnsResult(t *testing.T) {
 	if measurement.Metadata["confidence"] != "100" {
 		t.Fatalf("expected confidence '100', got '%s'", measurement.Metadata["confidence"])
 	}
+	if !strings.Contains(measurement.Metadata["sampledPods"], `"role":"canary","pod":"pod-1"`) {
+		t.Fatalf("expected sampled pods in metadata, got '%s'", measurement.Metadata["sampledPods"])
+	}
 }
 
 func TestRun_FailureCreatesIssue(t *testing.T) {
@@ -81,8 +88,8 @@ func TestRun_FailureCreatesIssue(t *testing.T) {
 
 	// Override AI call to return failure
 	old := analyzeLogsWithAI
-	analyzeLogsWithAI = func(params AIAnalysisParams) (string, AIAnalysisResult, error) {
-		return `{"text":"canary is bad","promote":false,"confidence":90}`, AIAnalysisResult{Text: "canary is bad", Promote: false, Confidence: 90}, nil
+	analyzeLogsWithAI = func(_ context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		return `{"text":"canary is bad","promote":false,"confidence":90,"severity":"major"}`, AIAnalysisResult{Text: "canary is bad", Promote: false, Confidence: 90, Severity: SeverityMajor}, nil
 	}
 	t.Cleanup(func() { analyzeLogsWithAI = old })
 
@@ -92,8 +99,8 @@ func TestRun_FailureCreatesIssue(t *testing.T) {
 	t.Cleanup(func() { acquireKubeClient = oldKC })
 
 	oldLogs := readFirstPodLogs
-	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string) (string, error) {
-		return "dummy", nil
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string, _ podLogOptions) (string, podLogSample, error) {
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
 	}
 	t.Cleanup(func() { readFirstPodLogs = oldLogs })
 
@@ -106,6 +113,150 @@ func TestRun_FailureCreatesIssue(t *testing.T) {
 	}
 }
 
+func TestRun_SeverityPolicyFailureCreatesIssue(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+
+	cfg := aiConfig{
+		Model:           "gemini-1.5-pro-latest",
+		GitHubURL:       "https://github.com/owner/repo",
+		ReportOnSuccess: true,
+		SeverityPolicy:  map[string]string{SeverityCritical: string(v1alpha1.AnalysisPhaseFailed)},
+	}
+	b, _ := json.Marshal(cfg)
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	// The model recommends promoting, but the critical severity fails the measurement
+	old := analyzeLogsWithAI
+	analyzeLogsWithAI = func(_ context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		return `{"text":"data loss","promote":true,"confidence":90,"severity":"critical"}`,
+			AIAnalysisResult{Text: "data loss", Promote: true, Confidence: 90, Severity: SeverityCritical}, nil
+	}
+	t.Cleanup(func() { analyzeLogsWithAI = old })
+
+	oldKC := acquireKubeClient
+	acquireKubeClient = func() (*kubernetes.Clientset, error) { return nil, nil }
+	t.Cleanup(func() { acquireKubeClient = oldKC })
+
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string, _ podLogOptions) (string, podLogSample, error) {
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	measurement := p.Run(analysisRun, metric)
+	if measurement.Phase != v1alpha1.AnalysisPhaseFailed {
+		t.Fatalf("expected failed, got %s with message: %s", measurement.Phase, measurement.Message)
+	}
+	// Without a GitHub token the issue fails to be created, which shows the failure path was taken
+	if measurement.Metadata["issueError"] == "" {
+		t.Errorf("expected an issue for the failed measurement, got metadata %v", measurement.Metadata)
+	}
+	if _, ok := measurement.Metadata["successReportError"]; ok {
+		t.Errorf("expected no success report for the failed measurement, got metadata %v", measurement.Metadata)
+	}
+}
+
+func TestRun_InvalidResponseIsError(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+
+	b, _ := json.Marshal(aiConfig{Model: "gemini-1.5-pro-latest"})
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	// The zero-value result of a response without a verdict must not look like a rejection
+	old := analyzeLogsWithAI
+	analyzeLogsWithAI = func(_ context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		return `{"text":"","promote":null}`, AIAnalysisResult{}, nil
+	}
+	t.Cleanup(func() { analyzeLogsWithAI = old })
+
+	oldKC := acquireKubeClient
+	acquireKubeClient = func() (*kubernetes.Clientset, error) { return nil, nil }
+	t.Cleanup(func() { acquireKubeClient = oldKC })
+
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string, _ podLogOptions) (string, podLogSample, error) {
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	measurement := p.Run(analysisRun, metric)
+	if measurement.Phase != v1alpha1.AnalysisPhaseError {
+		t.Fatalf("expected error, got %s", measurement.Phase)
+	}
+	if measurement.Metadata["rawResponse"] != `{"text":"","promote":null}` {
+		t.Errorf("expected the raw response in the metadata, got %q", measurement.Metadata["rawResponse"])
+	}
+}
+
+func TestRun_RecordsReproducibility(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+
+	temperature, seed := float32(0.2), int32(42)
+	b, _ := json.Marshal(aiConfig{Model: "gemini-1.5-pro-latest", Temperature: &temperature, Seed: &seed})
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	var got AIAnalysisParams
+	old := analyzeLogsWithAI
+	analyzeLogsWithAI = func(_ context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		got = params
+		return `{"text":"ok","promote":true,"confidence":90,"severity":"none"}`, AIAnalysisResult{Text: "ok", Promote: true, Confidence: 90, Severity: SeverityNone}, nil
+	}
+	t.Cleanup(func() { analyzeLogsWithAI = old })
+
+	oldKC := acquireKubeClient
+	acquireKubeClient = func() (*kubernetes.Clientset, error) { return nil, nil }
+	t.Cleanup(func() { acquireKubeClient = oldKC })
+
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string, _ podLogOptions) (string, podLogSample, error) {
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	measurement := p.Run(analysisRun, metric)
+	if measurement.Phase != v1alpha1.AnalysisPhaseSuccessful {
+		t.Fatalf("expected successful, got %s: %s", measurement.Phase, measurement.Message)
+	}
+	if got.Temperature == nil || *got.Temperature != temperature || got.Seed == nil || *got.Seed != seed {
+		t.Errorf("expected the temperature and seed to be passed to the model, got %v %v", got.Temperature, got.Seed)
+	}
+	for key, want := range map[string]string{"model": "gemini-1.5-pro-latest", "temperature": "0.2", "seed": "42", "promptHash": promptHash(got)} {
+		if measurement.Metadata[key] != want {
+			t.Errorf("expected metadata %s %q, got %q", key, want, measurement.Metadata[key])
+		}
+	}
+}
+
 func TestGetMetadata(t *testing.T) {
 	p := &RpcPlugin{}
 
@@ -141,3 +292,152 @@ func TestType(t *testing.T) {
 		t.Fatalf("expected type %s, got %s", ProviderType, p.Type())
 	}
 }
+
+func TestResolveMetricArgsInConfig(t *testing.T) {
+	// The controller resolves {{args.*}} in the whole metric, plugin configuration included, before Run
+	service := "checkout"
+	ns := "shop"
+	args := []v1alpha1.Argument{
+		{Name: "service-name", Value: &service},
+		{Name: "namespace", Value: &ns},
+	}
+	metric := v1alpha1.Metric{Name: "ai", Provider: v1alpha1.MetricProvider{Plugin: map[string]json.RawMessage{
+		"argoproj-labs/metric-ai": json.RawMessage(`{
+			"githubUrl": "https://github.com/acme/{{args.service-name}}",
+			"stableLabel": "app={{ args.service-name }},role=stable",
+			"namespace": "{{args.namespace}}",
+			"maintenanceWindows": [{"schedule": "0 2 * * *", "duration": "1h", "timeZone": "{{args.namespace}}"}]
+		}`),
+	}}}
+	resolved, err := analysisutil.ResolveMetricArgs(metric, args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var cfg aiConfig
+	if err := json.Unmarshal(resolved.Provider.Plugin["argoproj-labs/metric-ai"], &cfg); err != nil {
+		t.Fatalf("failed to parse resolved configuration: %v", err)
+	}
+	if cfg.GitHubURL != "https://github.com/acme/checkout" || cfg.StableLabel != "app=checkout,role=stable" || cfg.Namespace != "shop" {
+		t.Fatalf("unexpected resolved configuration %+v", cfg)
+	}
+	if len(cfg.MaintenanceWindows) != 1 || cfg.MaintenanceWindows[0].TimeZone != "shop" {
+		t.Fatalf("expected nested placeholders to be resolved, got %+v", cfg.MaintenanceWindows)
+	}
+
+	// Unknown arguments fail the AnalysisRun before the plugin is called
+	metric.Provider.Plugin["argoproj-labs/metric-ai"] = json.RawMessage(`{"extraPrompt": "depends on {{args.missing}}"}`)
+	if _, err := analysisutil.ResolveMetricArgs(metric, args); err == nil {
+		t.Fatal("expected an error for an unknown argument")
+	}
+}
+
+func TestRun_InitialDelayDefersMeasurement(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+	analysisRun.CreationTimestamp = metav1.Now()
+
+	b, _ := json.Marshal(aiConfig{Model: "gemini-2.0-flash", InitialDelay: "1h"})
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	measurement := p.Run(analysisRun, metric)
+	if measurement.Phase != v1alpha1.AnalysisPhaseRunning {
+		t.Fatalf("expected running, got %s with message: %s", measurement.Phase, measurement.Message)
+	}
+	if measurement.Metadata["deferred"] != "true" || measurement.ResumeAt == nil {
+		t.Fatalf("expected a deferred measurement, got %+v", measurement)
+	}
+	if measurement.ResumeAt.Time.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("expected resume after the initial delay, got %v", measurement.ResumeAt.Time)
+	}
+}
+
+func TestRun_TimeoutSetsContextDeadline(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "test-analysis"
+	analysisRun.Namespace = "default"
+
+	b, _ := json.Marshal(aiConfig{Model: "gemini-2.0-flash", Timeout: "2m", MaxHistory: -1})
+	metric := v1alpha1.Metric{
+		Name: "ai-test",
+		Provider: v1alpha1.MetricProvider{
+			Plugin: map[string]json.RawMessage{
+				"argoproj-labs/metric-ai": b,
+			},
+		},
+	}
+
+	var deadline time.Time
+	old := analyzeLogsWithAI
+	analyzeLogsWithAI = func(ctx context.Context, params AIAnalysisParams) (string, AIAnalysisResult, error) {
+		deadline, _ = ctx.Deadline()
+		return `{"text":"ok","promote":true,"confidence":90,"severity":"none"}`, AIAnalysisResult{Text: "ok", Promote: true, Confidence: 90, Severity: SeverityNone}, nil
+	}
+	t.Cleanup(func() { analyzeLogsWithAI = old })
+
+	oldKC := acquireKubeClient
+	acquireKubeClient = func() (*kubernetes.Clientset, error) { return nil, nil }
+	t.Cleanup(func() { acquireKubeClient = oldKC })
+
+	oldLogs := readFirstPodLogs
+	readFirstPodLogs = func(ctx context.Context, _ *kubernetes.Clientset, _ string, _ string, _ podLogOptions) (string, podLogSample, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected log fetching to run with a deadline")
+		}
+		return "dummy", podLogSample{Pod: "pod-1", Bytes: 5}, nil
+	}
+	t.Cleanup(func() { readFirstPodLogs = oldLogs })
+
+	measurement := p.Run(analysisRun, metric)
+	if measurement.Phase != v1alpha1.AnalysisPhaseSuccessful {
+		t.Fatalf("expected successful, got %s with message: %s", measurement.Phase, measurement.Message)
+	}
+	if deadline.IsZero() || time.Until(deadline) > 2*time.Minute {
+		t.Errorf("expected the AI call to run with a 2m deadline, got %v", deadline)
+	}
+}
+
+func TestValidateConfigWithoutKeys(t *testing.T) {
+	oldAPIKey, oldToken := googleAPIKey, githubToken
+	t.Cleanup(func() { googleAPIKey, githubToken = oldAPIKey, oldToken })
+
+	googleAPIKey, githubToken = "key", ""
+	if err := validateConfig(); err != nil {
+		t.Errorf("expected the GitHub token to be optional, got %v", err)
+	}
+	// Metrics may use credentials.googleApiKeySecretRef instead
+	googleAPIKey = ""
+	if err := validateConfig(); err != nil {
+		t.Errorf("expected the Google API key to be optional, got %v", err)
+	}
+}
+
+func TestSecretRefsNamespace(t *testing.T) {
+	var cfg aiConfig
+	raw := `{"slack":{"webhookSecretRef":{"name":"slack","key":"url"}},"pagerDuty":{"routingKeySecretRef":{"name":"pd","key":"key"}}}`
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	refs := cfg.secretRefs()
+	if len(refs) != 2 || refs[0] != cfg.Slack.WebhookSecretRef || refs[1] != cfg.PagerDuty.RoutingKeySecretRef {
+		t.Errorf("unexpected secret references %+v", refs)
+	}
+}
+
+func TestGarbageCollectWithoutReports(t *testing.T) {
+	p := &RpcPlugin{}
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "checkout-abc-1"
+	if err := p.GarbageCollect(analysisRun, v1alpha1.Metric{Name: "ai"}, 10); err.ErrorString != "" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
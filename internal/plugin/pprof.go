@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// envPprofAddr is the listen address of the net/http/pprof endpoints, e.g. localhost:6060. Profiles
+// expose the memory of the plugin, including logs and keys, so they are disabled by default.
+const envPprofAddr = "METRIC_AI_PPROF_ADDR"
+
+// newPprofMux returns the handler of the profiling endpoints under /debug/pprof/
+func newPprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// servePprof starts the profiling server in the background when METRIC_AI_PPROF_ADDR is set, to debug
+// the memory growth of measurements holding large logs
+func servePprof() {
+	addr := os.Getenv(envPprofAddr)
+	if addr == "" {
+		return
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			log.WithField("addr", addr).Warn("Profiling endpoints are reachable from outside the pod, use localhost and kubectl port-forward")
+		}
+	}
+	// No write timeout, CPU profiles and execution traces are streamed for the requested seconds
+	server := &http.Server{Addr: addr, Handler: newPprofMux(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.WithField("addr", addr).Info("Serving pprof endpoints")
+		if err := server.ListenAndServe(); err != nil {
+			log.WithError(err).Error("pprof server failed")
+		}
+	}()
+}
@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPprofEndpoints(t *testing.T) {
+	server := httptest.NewServer(newPprofMux())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/debug/pprof/heap?debug=1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "heap profile") {
+		t.Errorf("unexpected heap profile response %d: %.100s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// promptPresets are instructions about the error patterns that matter for common stacks, added to
+// the analysis prompt with the preset field
+var promptPresets = map[string]string{
+	"jvm": "The service runs on the JVM. Treat OutOfMemoryError, StackOverflowError, increasing or long " +
+		"garbage collection pauses (e.g. \"GC overhead limit exceeded\", Full GC), thread pool exhaustion " +
+		"(RejectedExecutionException), deadlocks and ClassNotFoundException or NoSuchMethodError (dependency " +
+		"conflicts) as serious regressions. New exception types or stack traces in the canary matter more than " +
+		"their count. WARN logs of frameworks at startup (Spring, Hibernate) and JIT or class loading messages " +
+		"are usually noise.",
+	"nginx": "The service is nginx. Compare the share of 5xx status codes in the access logs, especially 502 " +
+		"and 504 (upstream failures and timeouts), and error log entries such as \"upstream timed out\", " +
+		"\"no live upstreams\", \"connect() failed\" and \"worker_connections are not enough\". Increasing " +
+		"request times are a regression. 4xx status codes caused by clients (404 of scanners, 499 of closed " +
+		"connections) are usually noise unless their share changes significantly.",
+	"postgres": "The service is PostgreSQL or a heavy PostgreSQL client. Treat deadlocks, \"too many " +
+		"connections\" or connection pool exhaustion, \"canceling statement due to statement timeout\", " +
+		"serialization failures, replication lag, checkpoints occurring too frequently and new slow query " +
+		"log entries as regressions. Errors of missing relations or columns point to schema migrations out of " +
+		"sync with the canary. Routine autovacuum and checkpoint completion messages are noise.",
+	"golang-service": "The service is written in Go. Treat panics (\"panic:\", \"runtime error\", nil pointer " +
+		"dereferences), \"fatal error: concurrent map writes\", data races, OOM kills, goroutine leaks and " +
+		"\"context deadline exceeded\" or \"context canceled\" errors growing in the canary as serious " +
+		"regressions. Structured log levels (level=error) and new error messages matter more than " +
+		"informational logs.",
+}
+
+// resolvePreset returns the instructions of a preset, or an empty string when none is set
+func resolvePreset(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	instructions, ok := promptPresets[strings.ToLower(name)]
+	if !ok {
+		presets := make([]string, 0, len(promptPresets))
+		for preset := range promptPresets {
+			presets = append(presets, preset)
+		}
+		sort.Strings(presets)
+		return "", fmt.Errorf("unknown preset %q, available presets: %s", name, strings.Join(presets, ", "))
+	}
+	return instructions, nil
+}
@@ -0,0 +1,27 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPromptPresets(t *testing.T) {
+	for _, name := range []string{"jvm", "nginx", "postgres", "golang-service", "JVM"} {
+		if preset, err := resolvePreset(name); err != nil || preset == "" {
+			t.Errorf("expected instructions for preset %s, got error %v", name, err)
+		}
+	}
+	if preset, err := resolvePreset(""); err != nil || preset != "" {
+		t.Errorf("expected no instructions without a preset, got %q, error %v", preset, err)
+	}
+	if _, err := resolvePreset("cobol"); err == nil || !strings.Contains(err.Error(), "golang-service, jvm, nginx, postgres") {
+		t.Errorf("expected an error listing the available presets, got %v", err)
+	}
+
+	preset, _ := resolvePreset("jvm")
+	prompt := analysisPrompt(AIAnalysisParams{Preset: preset, ExtraPrompt: "Payments service", LogsContext: "logs"})
+	presetAt, extraAt := strings.Index(prompt, "OutOfMemoryError"), strings.Index(prompt, "Additional context: Payments service")
+	if presetAt < len(defaultSystemPrompt) || extraAt < presetAt {
+		t.Errorf("expected the preset after the instructions and before the extra prompt, got:\n%s", prompt)
+	}
+}
@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// promptTemplateData holds the variables available to prompt templates
+type promptTemplateData struct {
+	RolloutName string
+	AnalysisRun string
+	Namespace   string
+	Metric      string
+	Revision    string
+	// CanaryImage and StableImage are the images of the analyzed container (default: the first one)
+	CanaryImage string
+	StableImage string
+	// Args are the AnalysisRun arguments with a value
+	Args map[string]string
+}
+
+// lookupRolloutImages returns the images of a container of the Rollout pod template and of its stable
+// ReplicaSet, the canary image for both when no update is in progress
+var lookupRolloutImages = func(ctx context.Context, namespace, name, container string) (string, string, error) {
+	client, err := getRolloutsClient()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create rollouts client: %w", err)
+	}
+	ro, err := client.ArgoprojV1alpha1().Rollouts(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get rollout %s/%s: %w", namespace, name, err)
+	}
+	canaryImage := containerImage(ro.Spec.Template.Spec.Containers, container)
+	if ro.Status.StableRS == "" || ro.Status.StableRS == ro.Status.CurrentPodHash {
+		return canaryImage, canaryImage, nil
+	}
+
+	kubeClient, err := acquireKubeClient()
+	if err != nil {
+		return "", "", err
+	}
+	if kubeClient == nil {
+		return canaryImage, "", nil
+	}
+	// Argo Rollouts names ReplicaSets after the Rollout and the pod template hash
+	rs, err := kubeClient.AppsV1().ReplicaSets(namespace).Get(ctx, name+"-"+ro.Status.StableRS, metav1.GetOptions{})
+	if err != nil {
+		return canaryImage, "", fmt.Errorf("failed to get stable replicaset of rollout %s/%s: %w", namespace, name, err)
+	}
+	return canaryImage, containerImage(rs.Spec.Template.Spec.Containers, container), nil
+}
+
+// containerImage returns the image of the named container, or of the first container when no name is given
+func containerImage(containers []corev1.Container, name string) string {
+	for _, c := range containers {
+		if name == "" || c.Name == name {
+			return c.Image
+		}
+	}
+	return ""
+}
+
+// newPromptTemplateData collects the prompt template variables of a measurement. Images are only
+// looked up when needed, as they require reading the Rollout.
+func newPromptTemplateData(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric, cfg aiConfig, withImages bool) promptTemplateData {
+	data := promptTemplateData{
+		RolloutName: rolloutNameFromAnalysisRun(analysisRun),
+		AnalysisRun: analysisRun.Name,
+		Namespace:   analysisRun.Namespace,
+		Metric:      metric.Name,
+		Revision:    rolloutRevision(analysisRun),
+		Args:        make(map[string]string),
+	}
+	for _, arg := range analysisRun.Spec.Args {
+		if arg.Value != nil {
+			data.Args[arg.Name] = *arg.Value
+		}
+	}
+	if withImages && data.RolloutName != "" {
+		var err error
+		data.CanaryImage, data.StableImage, err = lookupRolloutImages(ctx, data.Namespace, data.RolloutName, cfg.Container)
+		if err != nil {
+			log.WithContext(ctx).WithError(err).Warn("Failed to look up rollout images for the prompt")
+		}
+	}
+	return data
+}
+
+// isPromptTemplate reports whether a prompt uses template actions
+func isPromptTemplate(text string) bool {
+	return strings.Contains(text, templateLeftDelim)
+}
+
+// renderPromptTemplate renders a prompt template, e.g. "Ignore errors of [[ .Args.dependency ]]".
+// Unknown arguments are an error rather than rendering "<no value>" into the prompt.
+func renderPromptTemplate(name, text string, data promptTemplateData) (string, error) {
+	tmpl, err := template.New(name).Delims(templateLeftDelim, templateRightDelim).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %v", name, err)
+	}
+	return buf.String(), nil
+}
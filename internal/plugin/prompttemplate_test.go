@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	analysisutil "github.com/argoproj/argo-rollouts/utils/analysis"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderPromptTemplate(t *testing.T) {
+	oldLookup := lookupRolloutImages
+	var lookups int
+	lookupRolloutImages = func(ctx context.Context, namespace, name, container string) (string, string, error) {
+		lookups++
+		if namespace != "shop" || name != "checkout" || container != "app" {
+			t.Errorf("unexpected lookup of %s/%s container %q", namespace, name, container)
+		}
+		return "registry/checkout:2.0", "registry/checkout:1.9", nil
+	}
+	t.Cleanup(func() { lookupRolloutImages = oldLookup })
+
+	tier := "gold"
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name = "checkout-abc-1"
+	analysisRun.Namespace = "shop"
+	analysisRun.OwnerReferences = []metav1.OwnerReference{{Kind: "Rollout", Name: "checkout"}}
+	analysisRun.Spec.Args = []v1alpha1.Argument{{Name: "tier", Value: &tier}, {Name: "unset"}}
+	metric := v1alpha1.Metric{Name: "ai"}
+
+	data := newPromptTemplateData(context.Background(), analysisRun, metric, aiConfig{Container: "app"}, false)
+	if lookups != 0 || data.CanaryImage != "" {
+		t.Errorf("expected images not to be looked up, got %d lookups", lookups)
+	}
+	data = newPromptTemplateData(context.Background(), analysisRun, metric, aiConfig{Container: "app"}, true)
+
+	// The prompt reaches the plugin through the argument resolution of the controller
+	metric.Provider.Plugin = map[string]json.RawMessage{
+		"argoproj-labs/metric-ai": json.RawMessage(`{"extraPrompt": "[[ .RolloutName ]] in [[ .Namespace ]] ([[ .Args.tier ]]): [[ .StableImage ]] -> [[ .CanaryImage ]], owned by {{args.tier}}"}`),
+	}
+	resolved, err := analysisutil.ResolveMetricArgs(metric, analysisRun.Spec.Args[:1])
+	if err != nil {
+		t.Fatalf("unexpected error resolving the metric: %v", err)
+	}
+	var cfg aiConfig
+	if err := json.Unmarshal(resolved.Provider.Plugin["argoproj-labs/metric-ai"], &cfg); err != nil {
+		t.Fatalf("failed to parse resolved configuration: %v", err)
+	}
+	if !isPromptTemplate(cfg.ExtraPrompt) {
+		t.Fatalf("expected %q to be a template", cfg.ExtraPrompt)
+	}
+	prompt, err := renderPromptTemplate("extraPrompt", cfg.ExtraPrompt, data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "checkout in shop (gold): registry/checkout:1.9 -> registry/checkout:2.0, owned by gold"; prompt != want {
+		t.Errorf("expected %q, got %q", want, prompt)
+	}
+
+	// Go template delimiters are taken for arguments by the controller
+	metric.Provider.Plugin["argoproj-labs/metric-ai"] = json.RawMessage(`{"extraPrompt": "{{ .RolloutName }} canary"}`)
+	if _, err := analysisutil.ResolveMetricArgs(metric, analysisRun.Spec.Args[:1]); err == nil {
+		t.Error("expected the controller to fail on {{ .RolloutName }}")
+	}
+
+	if _, err := renderPromptTemplate("extraPrompt", "[[ .Args.unset ]]", data); err == nil {
+		t.Error("expected an error for an argument without value")
+	}
+	if _, err := renderPromptTemplate("extraPrompt", "[[ .Rollout", data); err == nil {
+		t.Error("expected an error for an invalid template")
+	}
+	if isPromptTemplate("Ignore {args} and [ERROR] lines in logs") {
+		t.Error("expected plain text not to be a template")
+	}
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinPromptVersion is the semantic version of the built-in analysis instructions. When changing
+// them, bump the version and keep the previous instructions in builtinPrompts.
+const builtinPromptVersion = "1.0.0"
+
+// customPromptVersion is recorded as the prompt version of metrics with a systemPrompt
+const customPromptVersion = "custom"
+
+// builtinPrompts are the built-in analysis instructions by version, so metrics can pin the
+// instructions they were validated with across plugin upgrades
+var builtinPrompts = map[string]string{
+	"1.0.0": defaultSystemPrompt,
+}
+
+// resolveSystemPrompt returns the analysis instructions of a metric and their version: the
+// systemPrompt, or else the built-in instructions of the pinned or the latest version
+func resolveSystemPrompt(systemPrompt, pinnedVersion string) (string, string, error) {
+	if systemPrompt != "" {
+		if pinnedVersion != "" {
+			return "", "", fmt.Errorf("promptVersion cannot be set with systemPrompt")
+		}
+		return systemPrompt, customPromptVersion, nil
+	}
+	if pinnedVersion == "" {
+		return builtinPrompts[builtinPromptVersion], builtinPromptVersion, nil
+	}
+	prompt, ok := builtinPrompts[strings.TrimPrefix(pinnedVersion, "v")]
+	if !ok {
+		versions := make([]string, 0, len(builtinPrompts))
+		for version := range builtinPrompts {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+		return "", "", fmt.Errorf("unknown promptVersion %q, available versions: %s", pinnedVersion, strings.Join(versions, ", "))
+	}
+	return prompt, strings.TrimPrefix(pinnedVersion, "v"), nil
+}
+
+// promptHash identifies the instructions of a prompt (system prompt, preset, examples and extra prompt),
+// leaving out the logs and history that change with every measurement
+func promptHash(params AIAnalysisParams) string {
+	h := sha256.New()
+	for _, s := range []string{params.SystemPrompt, params.Preset, params.Examples, params.ExtraPrompt} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
@@ -0,0 +1,39 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveSystemPrompt(t *testing.T) {
+	prompt, version, err := resolveSystemPrompt("", "")
+	if err != nil || version != builtinPromptVersion || prompt != builtinPrompts[builtinPromptVersion] {
+		t.Errorf("expected the latest built-in prompt, got version %q, error %v", version, err)
+	}
+	if _, version, err = resolveSystemPrompt("", "v1.0.0"); err != nil || version != "1.0.0" {
+		t.Errorf("expected the pinned version, got %q, error %v", version, err)
+	}
+	if _, _, err = resolveSystemPrompt("", "0.1.0"); err == nil || !strings.Contains(err.Error(), "available versions: 1.0.0") {
+		t.Errorf("expected an error listing the available versions, got %v", err)
+	}
+	if prompt, version, err = resolveSystemPrompt("Reject latency regressions.", ""); err != nil || version != customPromptVersion || prompt != "Reject latency regressions." {
+		t.Errorf("expected the custom prompt, got version %q, error %v", version, err)
+	}
+	if _, _, err = resolveSystemPrompt("Reject latency regressions.", "1.0.0"); err == nil {
+		t.Error("expected an error pinning a version with a custom prompt")
+	}
+
+	params := AIAnalysisParams{SystemPrompt: defaultSystemPrompt, ExtraPrompt: "Payments", LogsContext: "logs", History: "history"}
+	hash := promptHash(params)
+	if len(hash) != 12 {
+		t.Errorf("expected a short hash, got %q", hash)
+	}
+	params.LogsContext, params.History = "other logs", ""
+	if promptHash(params) != hash {
+		t.Error("expected the hash not to depend on the logs and history")
+	}
+	params.ExtraPrompt = "Checkout"
+	if promptHash(params) == hash {
+		t.Error("expected the hash to change with the extra prompt")
+	}
+}
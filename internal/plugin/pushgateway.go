@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// pushgatewayConfig pushes decision gauges to a Prometheus Pushgateway, so alerting and SLO
+// dashboards can consume the gate behavior without scraping the plugin
+type pushgatewayConfig struct {
+	// Pushgateway URL, e.g. http://pushgateway.monitoring:9091
+	URL string `json:"url"`
+	// Job label of the pushed metrics (default: metric-ai)
+	Job string `json:"job,omitempty"`
+}
+
+// pushgatewayGroupingKey returns the grouping key path of a decision. Decisions of the same rollout
+// and metric replace each other, so groups do not accumulate with every AnalysisRun.
+func pushgatewayGroupingKey(job string, rec decisionRecord) string {
+	target := rec.Rollout
+	if target == "" {
+		target = rec.AnalysisRun
+	}
+	var b strings.Builder
+	for _, label := range [][2]string{{"job", job}, {"namespace", rec.Namespace}, {"rollout", target}, {"metric", rec.Metric}} {
+		// Values that are empty or contain a slash use the base64 encoding of the Pushgateway API
+		if label[1] == "" || strings.Contains(label[1], "/") {
+			fmt.Fprintf(&b, "/%s@base64/%s", label[0], base64.RawURLEncoding.EncodeToString([]byte(label[1])))
+			if label[1] == "" {
+				b.WriteString("=")
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "/%s/%s", label[0], url.PathEscape(label[1]))
+	}
+	return b.String()
+}
+
+// prometheusLabelEscaper escapes label values in the Prometheus text format
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// pushgatewayMetrics renders the gauges of a decision in the Prometheus text format
+func pushgatewayMetrics(rec decisionRecord) string {
+	var labels []string
+	for _, label := range [][2]string{{"analysisrun", rec.AnalysisRun}, {"revision", rec.Revision}, {"phase", string(rec.Phase)}, {"severity", rec.Severity}, {"model", rec.Model}} {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, label[0], prometheusLabelEscaper.Replace(label[1])))
+	}
+	labelSet := strings.Join(labels, ",")
+	promote := 0
+	if rec.Promote {
+		promote = 1
+	}
+	var b strings.Builder
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		fmt.Fprintf(&b, "%s{%s} %v\n", name, labelSet, value)
+	}
+	gauge("metric_ai_promote", "Whether the AI analysis recommended promoting the canary (1) or not (0).", promote)
+	gauge("metric_ai_confidence", "Confidence of the AI analysis decision in percent.", rec.Confidence)
+	gauge("metric_ai_analysis_duration_seconds", "Duration of the measurement up to the decision.", rec.DurationSeconds)
+	fmt.Fprintf(&b, "# HELP metric_ai_tokens Model tokens used by the AI analysis.\n# TYPE metric_ai_tokens gauge\n")
+	fmt.Fprintf(&b, "metric_ai_tokens{%s,type=\"prompt\"} %d\n", labelSet, rec.PromptTokens)
+	fmt.Fprintf(&b, "metric_ai_tokens{%s,type=\"output\"} %d\n", labelSet, rec.OutputTokens)
+	gauge("metric_ai_decision_timestamp_seconds", "Unix time of the AI analysis decision.", rec.Time.Unix())
+	return b.String()
+}
+
+// pushDecisionMetrics replaces the gauges of the rollout and metric in the Pushgateway
+func pushDecisionMetrics(ctx context.Context, cfg *pushgatewayConfig, rec decisionRecord) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("pushgateway requires a url")
+	}
+	job := cfg.Job
+	if job == "" {
+		job = "metric-ai"
+	}
+	endpoint := strings.TrimSuffix(cfg.URL, "/") + "/metrics" + pushgatewayGroupingKey(job, rec)
+	headers := map[string]string{"Content-Type": "text/plain; version=0.0.4"}
+	if err := postJSONBody(ctx, endpoint, headers, []byte(pushgatewayMetrics(rec))); err != nil {
+		return fmt.Errorf("failed to push metrics: %v", err)
+	}
+	return nil
+}
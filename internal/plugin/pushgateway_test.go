@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestPushDecisionMetrics(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	rec := decisionRecord{
+		Time:            time.Unix(1700000000, 0),
+		AnalysisRun:     "checkout-abc-1",
+		Namespace:       "shop",
+		Metric:          "ai",
+		Phase:           v1alpha1.AnalysisPhaseSuccessful,
+		Promote:         true,
+		Confidence:      85,
+		PromptTokens:    1200,
+		OutputTokens:    150,
+		DurationSeconds: 12.5,
+	}
+	if err := pushDecisionMetrics(context.Background(), &pushgatewayConfig{URL: server.URL}, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "/metrics/job/metric-ai/namespace/shop/rollout/checkout-abc-1/metric/ai" {
+		t.Errorf("unexpected grouping key %s", path)
+	}
+	for _, line := range []string{
+		`metric_ai_promote{analysisrun="checkout-abc-1",revision="",phase="Successful",severity="",model=""} 1`,
+		`metric_ai_confidence{analysisrun="checkout-abc-1",revision="",phase="Successful",severity="",model=""} 85`,
+		`metric_ai_analysis_duration_seconds{analysisrun="checkout-abc-1",revision="",phase="Successful",severity="",model=""} 12.5`,
+		`metric_ai_tokens{analysisrun="checkout-abc-1",revision="",phase="Successful",severity="",model="",type="prompt"} 1200`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %s in\n%s", line, body)
+		}
+	}
+
+	if key := pushgatewayGroupingKey("metric-ai", decisionRecord{Namespace: "shop", Rollout: "checkout", Metric: "a/b"}); key != "/job/metric-ai/namespace/shop/rollout/checkout/metric@base64/YS9i" {
+		t.Errorf("unexpected grouping key %s", key)
+	}
+}
@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// reportConfigMapPrefix prefixes the name of the AnalysisRun report ConfigMaps
+const reportConfigMapPrefix = "metric-ai-report-"
+
+// reportLogsLength bounds the log excerpt of a single report
+const reportLogsLength = 100000
+
+// reportConfigMapSize keeps report ConfigMaps below the 1MiB object size limit, dropping the oldest reports
+const reportConfigMapSize = 900 * 1024
+
+// analysisReport is the complete analysis of a measurement, too large for the measurement metadata
+type analysisReport struct {
+	Decision     decisionRecord `json:"decision"`
+	AnalysisJSON string         `json:"analysisJson"`
+	Logs         string         `json:"logs,omitempty"`
+	// AgentTranscript is the interaction with the Kubernetes Agent in agent mode
+	AgentTranscript *agentTranscript `json:"agentTranscript,omitempty"`
+}
+
+// reportConfigMapName returns the name of the report ConfigMap of an AnalysisRun, hashing names
+// that would exceed the object name limit
+func reportConfigMapName(analysisRun string) string {
+	name := reportConfigMapPrefix + analysisRun
+	if len(name) <= 253 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(analysisRun))
+	return reportConfigMapPrefix + analysisRun[:200] + "-" + hex.EncodeToString(sum[:8])
+}
+
+// reportKeyPrefix returns the prefix of the report keys of a metric
+func reportKeyPrefix(metric string) string {
+	return invalidConfigMapKeyChars.ReplaceAllString(metric, "_") + "."
+}
+
+// reportKey returns the key of a report, ordered by the decision time
+func reportKey(rec decisionRecord) string {
+	return fmt.Sprintf("%s%d", reportKeyPrefix(rec.Metric), rec.Time.UnixNano())
+}
+
+// persistReport writes the complete analysis to the report ConfigMap of the AnalysisRun, owned by
+// the AnalysisRun so it is deleted with it, and returns the ConfigMap name and the report key
+func persistReport(ctx context.Context, client *kubernetes.Clientset, analysisRun *v1alpha1.AnalysisRun, rec decisionRecord, analysisJSON, logs string, transcript *agentTranscript) (string, string, error) {
+	if client == nil {
+		return "", "", fmt.Errorf("no Kubernetes client to persist the report")
+	}
+	data, err := json.Marshal(analysisReport{Decision: rec, AnalysisJSON: analysisJSON, Logs: truncate(logs, reportLogsLength), AgentTranscript: transcript})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal report: %v", err)
+	}
+	name, key := reportConfigMapName(analysisRun.Name), reportKey(rec)
+
+	cms := client.CoreV1().ConfigMaps(analysisRun.Namespace)
+	cm, err := cms.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: analysisRun.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "rollouts-plugin-metric-ai"},
+			},
+			Data: map[string]string{key: string(data)},
+		}
+		if analysisRun.UID != "" {
+			cm.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       "AnalysisRun",
+				Name:       analysisRun.Name,
+				UID:        analysisRun.UID,
+			}}
+		}
+		if _, err := cms.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return "", "", fmt.Errorf("failed to create report ConfigMap %s: %v", name, err)
+		}
+		return name, key, nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get report ConfigMap %s: %v", name, err)
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[key] = string(data)
+	dropOldestReports(cm.Data, key, reportConfigMapSize)
+	if _, err := cms.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return "", "", fmt.Errorf("failed to update report ConfigMap %s: %v", name, err)
+	}
+	return name, key, nil
+}
+
+// dropOldestReports deletes the oldest reports other than keep until the reports fit in size bytes
+func dropOldestReports(data map[string]string, keep string, size int) {
+	total := 0
+	for k, v := range data {
+		total += len(k) + len(v)
+	}
+	for _, k := range sortedReportKeys(data, "") {
+		if total <= size {
+			return
+		}
+		if k == keep {
+			continue
+		}
+		total -= len(k) + len(data[k])
+		delete(data, k)
+	}
+}
+
+// sortedReportKeys returns the report keys of the metric key prefix, or all report keys when
+// the prefix is empty, from oldest to newest
+func sortedReportKeys(data map[string]string, prefix string) []string {
+	times := make(map[string]int64)
+	var keys []string
+	for k := range data {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+		if prefix == "" {
+			rest = rest[strings.LastIndex(rest, ".")+1:]
+		}
+		t, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			continue
+		}
+		times[k] = t
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return times[keys[i]] < times[keys[j]] })
+	return keys
+}
+
+// pruneReports keeps the latest limit reports of the metric in the report ConfigMap of the AnalysisRun
+func pruneReports(ctx context.Context, client *kubernetes.Clientset, analysisRun *v1alpha1.AnalysisRun, metric string, limit int) error {
+	if client == nil {
+		return fmt.Errorf("no Kubernetes client to prune reports")
+	}
+	name := reportConfigMapName(analysisRun.Name)
+	cms := client.CoreV1().ConfigMaps(analysisRun.Namespace)
+	cm, err := cms.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get report ConfigMap %s: %v", name, err)
+	}
+	keys := sortedReportKeys(cm.Data, reportKeyPrefix(metric))
+	if len(keys) <= limit {
+		return nil
+	}
+	for _, k := range keys[:len(keys)-limit] {
+		delete(cm.Data, k)
+	}
+	if _, err := cms.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update report ConfigMap %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportKeys(t *testing.T) {
+	rec := decisionRecord{Metric: "ai/checkout", Time: time.Unix(0, 1700000000000000000)}
+	if got := reportKey(rec); got != "ai_checkout.1700000000000000000" {
+		t.Errorf("unexpected report key %s", got)
+	}
+	data := map[string]string{
+		"ai.300":       "c",
+		"ai.100":       "a",
+		"ai.200":       "b",
+		"ai.canary.50": "other metric",
+	}
+	if got := sortedReportKeys(data, "ai."); strings.Join(got, ",") != "ai.100,ai.200,ai.300" {
+		t.Errorf("unexpected sorted keys %v", got)
+	}
+
+	// The oldest reports of all metrics are dropped first, never the new one
+	dropOldestReports(data, "ai.100", len("ai.100a")+len("ai.300c"))
+	if len(data) != 2 || data["ai.100"] == "" || data["ai.300"] == "" {
+		t.Errorf("unexpected reports after dropping %v", data)
+	}
+
+	if name := reportConfigMapName(strings.Repeat("a", 250)); len(name) > 253 || !strings.HasPrefix(name, reportConfigMapPrefix) {
+		t.Errorf("unexpected report ConfigMap name %s", name)
+	}
+}
@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// analysisReportGVR is the AIAnalysisReport custom resource, see config/crd/aianalysisreports.yaml
+var analysisReportGVR = schema.GroupVersionResource{Group: "metricai.argoproj-labs.io", Version: "v1alpha1", Resource: "aianalysisreports"}
+
+// Labels of AIAnalysisReports, to filter the history with kubectl get -l
+const (
+	analysisReportRolloutLabel     = "metricai.argoproj-labs.io/rollout"
+	analysisReportAnalysisRunLabel = "metricai.argoproj-labs.io/analysisrun"
+	analysisReportMetricLabel      = "metricai.argoproj-labs.io/metric"
+)
+
+var getDynamicClient = func() (dynamic.Interface, error) {
+	restCfg, err := getRestConfig()
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(restCfg)
+}
+
+// analysisReportReferences link an AIAnalysisReport to the other records of the measurement
+type analysisReportReferences struct {
+	ReportConfigMap string
+	ReportKey       string
+	Artifacts       string
+}
+
+// labelValue truncates a value to a valid label value
+func labelValue(s string) string {
+	s = invalidConfigMapKeyChars.ReplaceAllString(s, "_")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-._")
+}
+
+// newAnalysisReportResource builds the AIAnalysisReport of a decision. Reports are owned by the
+// Rollout, so the history outlives the AnalysisRuns and is deleted with the Rollout.
+func newAnalysisReportResource(analysisRun *v1alpha1.AnalysisRun, rec decisionRecord, refs analysisReportReferences) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"analysisRun": rec.AnalysisRun,
+		"metric":      rec.Metric,
+		"mode":        rec.Mode,
+		"time":        rec.Time.Format(time.RFC3339),
+		"phase":       string(rec.Phase),
+		"promote":     rec.Promote,
+		"confidence":  int64(rec.Confidence),
+	}
+	for key, value := range map[string]string{
+		"rollout":         rec.Rollout,
+		"revision":        rec.Revision,
+		"model":           rec.Model,
+		"severity":        rec.Severity,
+		"analysis":        rec.Analysis,
+		"rootCause":       rec.RootCause,
+		"remediation":     rec.Remediation,
+		"issueUrl":        rec.IssueURL,
+		"dashboardUrl":    rec.DashboardURL,
+		"reportConfigMap": refs.ReportConfigMap,
+		"reportKey":       refs.ReportKey,
+		"artifacts":       refs.Artifacts,
+	} {
+		if value != "" {
+			spec[key] = value
+		}
+	}
+
+	labels := map[string]interface{}{
+		"app.kubernetes.io/managed-by": "rollouts-plugin-metric-ai",
+		analysisReportAnalysisRunLabel: labelValue(rec.AnalysisRun),
+		analysisReportMetricLabel:      labelValue(rec.Metric),
+	}
+	if rec.Rollout != "" {
+		labels[analysisReportRolloutLabel] = labelValue(rec.Rollout)
+	}
+	metadata := map[string]interface{}{
+		// The API server appends a random suffix
+		"generateName": analysisRun.Name + "-",
+		"namespace":    analysisRun.Namespace,
+		"labels":       labels,
+	}
+	for _, ref := range analysisRun.OwnerReferences {
+		if ref.Kind == "Rollout" {
+			metadata["ownerReferences"] = []interface{}{map[string]interface{}{
+				"apiVersion": ref.APIVersion,
+				"kind":       ref.Kind,
+				"name":       ref.Name,
+				"uid":        string(ref.UID),
+			}}
+		}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": analysisReportGVR.GroupVersion().String(),
+		"kind":       "AIAnalysisReport",
+		"metadata":   metadata,
+		"spec":       spec,
+	}}
+}
+
+// createAnalysisReportResource writes the AIAnalysisReport of a decision and returns its name
+func createAnalysisReportResource(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, rec decisionRecord, refs analysisReportReferences) (string, error) {
+	client, err := getDynamicClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+	created, err := client.Resource(analysisReportGVR).Namespace(analysisRun.Namespace).
+		Create(ctx, newAnalysisReportResource(analysisRun, rec, refs), metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create AIAnalysisReport: %v", err)
+	}
+	return created.GetName(), nil
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewAnalysisReportResource(t *testing.T) {
+	analysisRun := &v1alpha1.AnalysisRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "checkout-abc-1",
+			Namespace: "shop",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "argoproj.io/v1alpha1", Kind: "Rollout", Name: "checkout", UID: "rollout-uid"},
+			},
+		},
+	}
+	rec := decisionRecord{
+		Time:        time.Unix(1700000000, 0).UTC(),
+		AnalysisRun: "checkout-abc-1",
+		Namespace:   "shop",
+		Rollout:     "checkout",
+		Metric:      "ai/logs",
+		Phase:       v1alpha1.AnalysisPhaseFailed,
+		Confidence:  88,
+		RootCause:   "database timeouts",
+	}
+	report := newAnalysisReportResource(analysisRun, rec, analysisReportReferences{Artifacts: "s3://evidence/shop/"})
+
+	if report.GetKind() != "AIAnalysisReport" || report.GetAPIVersion() != "metricai.argoproj-labs.io/v1alpha1" {
+		t.Errorf("unexpected type %s %s", report.GetAPIVersion(), report.GetKind())
+	}
+	if report.GetGenerateName() != "checkout-abc-1-" || report.GetNamespace() != "shop" {
+		t.Errorf("unexpected metadata %s/%s", report.GetNamespace(), report.GetGenerateName())
+	}
+	if owners := report.GetOwnerReferences(); len(owners) != 1 || owners[0].Name != "checkout" || owners[0].UID != "rollout-uid" {
+		t.Errorf("expected the Rollout as owner, got %+v", owners)
+	}
+	if labels := report.GetLabels(); labels[analysisReportRolloutLabel] != "checkout" || labels[analysisReportMetricLabel] != "ai_logs" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+	spec := report.Object["spec"].(map[string]interface{})
+	if spec["confidence"] != int64(88) || spec["promote"] != false || spec["time"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("unexpected spec %v", spec)
+	}
+	if spec["artifacts"] != "s3://evidence/shop/" || spec["rootCause"] != "database timeouts" {
+		t.Errorf("expected references in spec %v", spec)
+	}
+	if _, ok := spec["issueUrl"]; ok {
+		t.Errorf("expected no empty fields in spec %v", spec)
+	}
+}
@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// safetyCategories maps the safetySettings keys to Gemini harm categories
+var safetyCategories = map[string]genai.HarmCategory{
+	"hateSpeech":       genai.HarmCategoryHateSpeech,
+	"dangerousContent": genai.HarmCategoryDangerousContent,
+	"harassment":       genai.HarmCategoryHarassment,
+	"sexuallyExplicit": genai.HarmCategorySexuallyExplicit,
+	"civicIntegrity":   genai.HarmCategoryCivicIntegrity,
+}
+
+// safetyCategoryAll sets the threshold of every category not set explicitly
+const safetyCategoryAll = "all"
+
+// parseSafetySettings converts the safetySettings of a metric, thresholds by category such as
+// dangerousContent: BLOCK_ONLY_HIGH, to Gemini safety settings sorted by category
+func parseSafetySettings(settings map[string]string) ([]*genai.SafetySetting, error) {
+	if len(settings) == 0 {
+		return nil, nil
+	}
+	thresholds := make(map[genai.HarmCategory]genai.HarmBlockThreshold)
+	if value, ok := settings[safetyCategoryAll]; ok {
+		threshold, err := parseHarmBlockThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid safetySettings %s: %v", safetyCategoryAll, err)
+		}
+		for _, category := range safetyCategories {
+			thresholds[category] = threshold
+		}
+	}
+	for key, value := range settings {
+		if key == safetyCategoryAll {
+			continue
+		}
+		category, ok := safetyCategories[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown safetySettings category %q, expected one of %s", key, strings.Join(safetyCategoryNames(), ", "))
+		}
+		threshold, err := parseHarmBlockThreshold(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid safetySettings %s: %v", key, err)
+		}
+		thresholds[category] = threshold
+	}
+
+	safetySettings := make([]*genai.SafetySetting, 0, len(thresholds))
+	for category, threshold := range thresholds {
+		safetySettings = append(safetySettings, &genai.SafetySetting{Category: category, Threshold: threshold})
+	}
+	sort.Slice(safetySettings, func(i, j int) bool { return safetySettings[i].Category < safetySettings[j].Category })
+	return safetySettings, nil
+}
+
+// parseHarmBlockThreshold parses a Gemini block threshold, e.g. BLOCK_ONLY_HIGH or block_none
+func parseHarmBlockThreshold(value string) (genai.HarmBlockThreshold, error) {
+	threshold := genai.HarmBlockThreshold(strings.ToUpper(strings.TrimSpace(value)))
+	switch threshold {
+	case genai.HarmBlockThresholdBlockLowAndAbove, genai.HarmBlockThresholdBlockMediumAndAbove,
+		genai.HarmBlockThresholdBlockOnlyHigh, genai.HarmBlockThresholdBlockNone, genai.HarmBlockThresholdOff:
+		return threshold, nil
+	}
+	return "", fmt.Errorf("unknown threshold %q, expected BLOCK_LOW_AND_ABOVE, BLOCK_MEDIUM_AND_ABOVE, BLOCK_ONLY_HIGH, BLOCK_NONE or OFF", value)
+}
+
+// safetyCategoryNames returns the safetySettings keys in alphabetical order
+func safetyCategoryNames() []string {
+	names := []string{safetyCategoryAll}
+	for name := range safetyCategories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// blockedResponseError explains why Gemini returned no analysis because of its safety filters, or
+// returns nil when the response was not blocked. Production logs with attack payloads (e.g. SQL
+// injection attempts) commonly trip the filters.
+func blockedResponseError(resp *genai.GenerateContentResponse) error {
+	if resp == nil {
+		return nil
+	}
+	if feedback := resp.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+		reason := string(feedback.BlockReason)
+		if feedback.BlockReasonMessage != "" {
+			reason += ": " + feedback.BlockReasonMessage
+		}
+		return fmt.Errorf("gemini blocked the prompt (%s%s), set safetySettings to lower the thresholds", reason, blockedCategories(feedback.SafetyRatings))
+	}
+	for _, cand := range resp.Candidates {
+		switch cand.FinishReason {
+		case genai.FinishReasonSafety, genai.FinishReasonBlocklist, genai.FinishReasonProhibitedContent, genai.FinishReasonSPII:
+			if cand.Content != nil && len(cand.Content.Parts) > 0 {
+				continue
+			}
+			return fmt.Errorf("gemini blocked the response (%s%s), set safetySettings to lower the thresholds", cand.FinishReason, blockedCategories(cand.SafetyRatings))
+		}
+	}
+	return nil
+}
+
+// blockedCategories lists the harm categories that blocked a prompt or response
+func blockedCategories(ratings []*genai.SafetyRating) string {
+	var categories []string
+	for _, rating := range ratings {
+		if rating != nil && rating.Blocked {
+			categories = append(categories, fmt.Sprintf("%s %s", rating.Category, rating.Probability))
+		}
+	}
+	if len(categories) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(categories, ", ")
+}
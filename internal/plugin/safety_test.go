@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestSafetySettings(t *testing.T) {
+	settings, err := parseSafetySettings(map[string]string{"all": "block_only_high", "dangerousContent": "BLOCK_NONE"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(settings) != len(safetyCategories) {
+		t.Fatalf("expected a setting for every category, got %d", len(settings))
+	}
+	for _, setting := range settings {
+		expected := genai.HarmBlockThresholdBlockOnlyHigh
+		if setting.Category == genai.HarmCategoryDangerousContent {
+			expected = genai.HarmBlockThresholdBlockNone
+		}
+		if setting.Threshold != expected {
+			t.Errorf("expected %s for %s, got %s", expected, setting.Category, setting.Threshold)
+		}
+	}
+	if _, err := parseSafetySettings(map[string]string{"violence": "BLOCK_NONE"}); err == nil {
+		t.Error("expected an error for an unknown category")
+	}
+	if _, err := parseSafetySettings(map[string]string{"harassment": "BLOCK_SOME"}); err == nil {
+		t.Error("expected an error for an unknown threshold")
+	}
+
+	// Blocked prompts and responses explain the reason instead of returning an empty analysis
+	err = blockedResponseError(&genai.GenerateContentResponse{PromptFeedback: &genai.GenerateContentResponsePromptFeedback{
+		BlockReason:   genai.BlockedReasonSafety,
+		SafetyRatings: []*genai.SafetyRating{{Category: genai.HarmCategoryDangerousContent, Probability: genai.HarmProbabilityHigh, Blocked: true}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "HARM_CATEGORY_DANGEROUS_CONTENT HIGH") || !strings.Contains(err.Error(), "safetySettings") {
+		t.Errorf("expected a blocked prompt error naming the category, got %v", err)
+	}
+	resp := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}}}
+	if err := blockedResponseError(resp); err == nil || !strings.Contains(err.Error(), "blocked the response (SAFETY") {
+		t.Errorf("expected a blocked response error, got %v", err)
+	}
+	if concatCandidates(resp) != "" {
+		t.Error("expected no text of a blocked candidate")
+	}
+	resp = &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonStop, Content: &genai.Content{Parts: []*genai.Part{{Text: "{}"}}}}}}
+	if err := blockedResponseError(resp); err != nil {
+		t.Errorf("expected no error for a complete response, got %v", err)
+	}
+}
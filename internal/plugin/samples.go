@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSamples bounds the model calls of a measurement with self-consistency sampling
+const maxSamples = 9
+
+// analysisSample is one of the independent analyses of a measurement
+type analysisSample struct {
+	rawJSON string
+	result  AIAnalysisResult
+}
+
+// analyzeWithSamples runs params.Samples independent analyses of the same logs and aggregates them,
+// reducing the variance of a single model response on borderline canaries. Failed or invalid samples
+// are left out, the measurement only fails when none is usable. It returns the aggregated analysis
+// and the promote votes out of the usable samples, e.g. "3/5".
+func analyzeWithSamples(ctx context.Context, params AIAnalysisParams) (string, AIAnalysisResult, string, error) {
+	var samples []analysisSample
+	var lastErr error
+	for i := 0; i < params.Samples; i++ {
+		sampleParams := params
+		if params.Seed != nil {
+			// The same seed would return the same answer
+			seed := *params.Seed + int32(i)
+			sampleParams.Seed = &seed
+		}
+		rawJSON, result, err := analyzeLogsWithAI(ctx, sampleParams)
+		if err == nil {
+			err = validateAnalysisResult(rawJSON, result)
+		}
+		if err != nil {
+			log.WithContext(ctx).WithError(err).WithField("sample", i+1).Warn("Leaving out failed analysis sample")
+			lastErr = err
+			continue
+		}
+		samples = append(samples, analysisSample{rawJSON: rawJSON, result: result})
+	}
+	if len(samples) == 0 {
+		return "", AIAnalysisResult{}, "", fmt.Errorf("all %d analysis samples failed, last error: %v", params.Samples, lastErr)
+	}
+	rawJSON, result, votes, err := aggregateSamples(samples)
+	if err != nil {
+		return "", AIAnalysisResult{}, "", err
+	}
+	return rawJSON, result, fmt.Sprintf("%d/%d", votes, len(samples)), nil
+}
+
+// aggregateSamples decides on the majority of the samples, ties rejecting the canary, with the average
+// confidence of all samples. The text, severity, root cause and remediation are those of the most
+// confident sample of the majority. It returns the aggregated analysis and the number of promote votes.
+func aggregateSamples(samples []analysisSample) (string, AIAnalysisResult, int, error) {
+	votes, confidence, promptTokens, outputTokens, toolCalls := 0, 0, 0, 0, 0
+	for _, sample := range samples {
+		if sample.result.Promote {
+			votes++
+		}
+		confidence += sample.result.Confidence
+		promptTokens += sample.result.PromptTokens
+		outputTokens += sample.result.OutputTokens
+		toolCalls += sample.result.ToolCalls
+	}
+	promote := votes*2 > len(samples)
+
+	var chosen *analysisSample
+	for i := range samples {
+		if samples[i].result.Promote == promote && (chosen == nil || samples[i].result.Confidence > chosen.result.Confidence) {
+			chosen = &samples[i]
+		}
+	}
+	result := chosen.result
+	result.Promote = promote
+	result.Confidence = (confidence + len(samples)/2) / len(samples)
+	result.PromptTokens, result.OutputTokens = promptTokens, outputTokens
+	result.ToolCalls = toolCalls
+
+	// Keep the fields of the chosen sample, such as output fields, with the aggregated decision
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(chosen.rawJSON), &fields); err != nil {
+		return "", AIAnalysisResult{}, 0, fmt.Errorf("invalid analysis sample: %v", err)
+	}
+	fields["promote"] = result.Promote
+	fields["confidence"] = result.Confidence
+	rawJSON, err := json.Marshal(fields)
+	if err != nil {
+		return "", AIAnalysisResult{}, 0, err
+	}
+	return string(rawJSON), result, votes, nil
+}
@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAggregateSamples(t *testing.T) {
+	samples := []analysisSample{
+		{rawJSON: `{"text":"Minor warnings","promote":true,"confidence":60,"severity":"minor","impact":"low"}`, result: AIAnalysisResult{Text: "Minor warnings", Promote: true, Confidence: 60, Severity: "minor", PromptTokens: 100, OutputTokens: 10}},
+		{rawJSON: `{"text":"Error rate increased","promote":false,"confidence":80,"severity":"major","impact":"high"}`, result: AIAnalysisResult{Text: "Error rate increased", Promote: false, Confidence: 80, Severity: "major", PromptTokens: 100, OutputTokens: 10}},
+		{rawJSON: `{"text":"No regressions","promote":true,"confidence":90,"severity":"none","impact":"none"}`, result: AIAnalysisResult{Text: "No regressions", Promote: true, Confidence: 90, Severity: "none", PromptTokens: 100, OutputTokens: 10}},
+	}
+	rawJSON, result, votes, err := aggregateSamples(samples)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Promote || votes != 2 || result.Confidence != 77 {
+		t.Errorf("expected promote by 2 votes with average confidence 77, got %+v with %d votes", result, votes)
+	}
+	if result.Text != "No regressions" || result.PromptTokens != 300 || result.OutputTokens != 30 {
+		t.Errorf("expected the most confident majority sample with the tokens of all samples, got %+v", result)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(rawJSON), &fields); err != nil || fields["impact"] != "none" || fields["confidence"] != 77.0 {
+		t.Errorf("expected the fields of the chosen sample with the aggregated confidence, got %s", rawJSON)
+	}
+
+	// Ties reject the canary
+	_, result, votes, err = aggregateSamples(samples[:2])
+	if err != nil || result.Promote || votes != 1 || result.Text != "Error rate increased" {
+		t.Errorf("expected a tie to reject the canary, got %+v with %d votes, error %v", result, votes, err)
+	}
+}
@@ -0,0 +1,116 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// Measurement value modes
+const (
+	MeasurementValueConfidence = "confidence" // Confidence as 0.00-1.00 when promoting, 0 otherwise
+	MeasurementValueScore      = "score"      // Confidence when promoting, negative confidence otherwise
+	MeasurementValueSeverity   = "severity"   // Numeric severity, 0 (none) to 3 (critical)
+)
+
+// Severity levels reported by the AI analysis
+const (
+	SeverityNone     = "none"
+	SeverityMinor    = "minor"
+	SeverityMajor    = "major"
+	SeverityCritical = "critical"
+)
+
+// severityScores maps severity levels to the numeric measurement value
+var severityScores = map[string]int{
+	SeverityNone:     0,
+	SeverityMinor:    1,
+	SeverityMajor:    2,
+	SeverityCritical: 3,
+}
+
+// Suggested conditions for severity values: critical findings fail, anything above minor is not a success
+const (
+	suggestedSeveritySuccessCondition = "result.value <= 1"
+	suggestedSeverityFailureCondition = "result.value >= 3"
+)
+
+// effectiveSeverity returns the normalized severity of a result, which validateAnalysisResult
+// already checked is one of the known severities
+func effectiveSeverity(result AIAnalysisResult) string {
+	return strings.ToLower(strings.TrimSpace(result.Severity))
+}
+
+// agentSeverity derives the severity of an agent analysis from its decision, as the agent does
+// not classify its findings
+func agentSeverity(promote bool) string {
+	if promote {
+		return SeverityNone
+	}
+	return SeverityMajor
+}
+
+// severityScore returns the numeric severity of the result
+func severityScore(result AIAnalysisResult) int {
+	return severityScores[effectiveSeverity(result)]
+}
+
+// severityPhase returns the phase a severityPolicy assigns to the severity of the result, e.g.
+// minor: Inconclusive, and false when the policy does not cover the severity
+func severityPhase(policy map[string]string, result AIAnalysisResult) (v1alpha1.AnalysisPhase, bool, error) {
+	for severity, phase := range policy {
+		if _, ok := severityScores[severity]; !ok {
+			return "", false, fmt.Errorf("invalid severityPolicy severity %q, expected none, minor, major or critical", severity)
+		}
+		switch v1alpha1.AnalysisPhase(phase) {
+		case v1alpha1.AnalysisPhaseSuccessful, v1alpha1.AnalysisPhaseInconclusive, v1alpha1.AnalysisPhaseFailed:
+		default:
+			return "", false, fmt.Errorf("invalid severityPolicy phase %q for %s, expected Successful, Inconclusive or Failed", phase, severity)
+		}
+	}
+	phase, ok := policy[effectiveSeverity(result)]
+	return v1alpha1.AnalysisPhase(phase), ok, nil
+}
+
+// signedScore returns the confidence when the AI recommends promotion and the negative confidence otherwise
+func signedScore(result AIAnalysisResult) int {
+	if result.Promote {
+		return result.Confidence
+	}
+	return -result.Confidence
+}
+
+// measurementValue computes the measurement value for the configured mode
+func measurementValue(mode string, result AIAnalysisResult) (float64, string, error) {
+	switch mode {
+	case "", MeasurementValueConfidence:
+		if !result.Promote {
+			return 0, "0", nil
+		}
+		// Use confidence as a decimal value (0.0 to 1.0)
+		v := float64(result.Confidence) / 100.0
+		return v, fmt.Sprintf("%.2f", v), nil
+	case MeasurementValueScore:
+		score := signedScore(result)
+		return float64(score), fmt.Sprintf("%d", score), nil
+	case MeasurementValueSeverity:
+		score := severityScore(result)
+		return float64(score), fmt.Sprintf("%d", score), nil
+	default:
+		return 0, "", fmt.Errorf("invalid measurementValue %q", mode)
+	}
+}
+
+// resultFields returns the structured result available to successCondition and failureCondition
+// expressions, e.g. `result.promote == true && result.confidence > 80`
+func resultFields(result AIAnalysisResult, value float64) map[string]interface{} {
+	return map[string]interface{}{
+		"value":         value,
+		"promote":       result.Promote,
+		"confidence":    result.Confidence,
+		"score":         signedScore(result),
+		"severity":      effectiveSeverity(result),
+		"severityScore": severityScore(result),
+	}
+}
@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestMeasurementValue(t *testing.T) {
+	tests := []struct {
+		mode   string
+		result AIAnalysisResult
+		want   string
+	}{
+		{mode: "", result: AIAnalysisResult{Promote: true, Confidence: 85}, want: "0.85"},
+		{mode: MeasurementValueConfidence, result: AIAnalysisResult{Promote: false, Confidence: 85}, want: "0"},
+		{mode: MeasurementValueScore, result: AIAnalysisResult{Promote: true, Confidence: 85}, want: "85"},
+		{mode: MeasurementValueScore, result: AIAnalysisResult{Promote: false, Confidence: 85}, want: "-85"},
+	}
+	for _, tt := range tests {
+		_, got, err := measurementValue(tt.mode, tt.result)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("expected value %q for mode %q, got %q", tt.want, tt.mode, got)
+		}
+	}
+	if _, _, err := measurementValue("bogus", AIAnalysisResult{}); err == nil {
+		t.Fatal("expected error for invalid mode")
+	}
+}
+
+func TestSeverityScore(t *testing.T) {
+	tests := []struct {
+		result AIAnalysisResult
+		want   int
+	}{
+		{result: AIAnalysisResult{Promote: true, Severity: "minor"}, want: 1},
+		{result: AIAnalysisResult{Promote: false, Severity: "Critical"}, want: 3},
+		{result: AIAnalysisResult{Promote: true, Severity: " none"}, want: 0},
+		{result: AIAnalysisResult{Promote: false, Severity: "major"}, want: 2},
+	}
+	for _, tt := range tests {
+		if got := severityScore(tt.result); got != tt.want {
+			t.Errorf("expected severity score %d for %+v, got %d", tt.want, tt.result, got)
+		}
+	}
+}
+
+func TestSeverityPhase(t *testing.T) {
+	policy := map[string]string{"minor": "Inconclusive", "critical": "Failed"}
+	tests := []struct {
+		result AIAnalysisResult
+		phase  v1alpha1.AnalysisPhase
+		ok     bool
+	}{
+		{result: AIAnalysisResult{Promote: true, Severity: "minor"}, phase: v1alpha1.AnalysisPhaseInconclusive, ok: true},
+		{result: AIAnalysisResult{Promote: true, Severity: "critical"}, phase: v1alpha1.AnalysisPhaseFailed, ok: true},
+		{result: AIAnalysisResult{Promote: false, Severity: "major"}},
+		{result: AIAnalysisResult{Promote: true}},
+	}
+	for _, tt := range tests {
+		phase, ok, err := severityPhase(policy, tt.result)
+		if err != nil || ok != tt.ok || (ok && phase != tt.phase) {
+			t.Errorf("expected phase %q (%t) for %+v, got %q (%t), error %v", tt.phase, tt.ok, tt.result, phase, ok, err)
+		}
+	}
+	for _, invalid := range []map[string]string{{"low": "Failed"}, {"minor": "Error"}} {
+		if _, _, err := severityPhase(invalid, AIAnalysisResult{}); err == nil {
+			t.Errorf("expected an error for policy %v", invalid)
+		}
+	}
+}
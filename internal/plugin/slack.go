@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// slackPostMessageURL is the Slack Web API method posting messages with a bot token
+var slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// slackConfig sends the analysis decisions to a Slack channel
+type slackConfig struct {
+	// Secret key in the AnalysisRun namespace with an incoming webhook URL
+	WebhookSecretRef *secretKeyRef `json:"webhookSecretRef,omitempty"`
+	// Secret key in the AnalysisRun namespace with a bot token, used when no webhook is configured
+	// (default: slack_token of the plugin secret)
+	TokenSecretRef *secretKeyRef `json:"tokenSecretRef,omitempty"`
+	// Channel posted to, required with a bot token
+	Channel string `json:"channel,omitempty"`
+	// Also notify when the analysis passes
+	OnSuccess bool `json:"onSuccess,omitempty"`
+}
+
+// slackMessage is a chat.postMessage or incoming webhook payload
+type slackMessage struct {
+	Channel string       `json:"channel,omitempty"`
+	Text    string       `json:"text"`
+	Blocks  []slackBlock `json:"blocks,omitempty"`
+}
+
+// slackBlock is a Block Kit section or context block
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+// slackText is a Block Kit mrkdwn text object
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// slackPostMessageResponse is the envelope of Slack Web API responses, which fail with status 200
+type slackPostMessageResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// notifySlack posts the decision to Slack, on success only when onSuccess is enabled
+func notifySlack(ctx context.Context, cfg *slackConfig, rec decisionRecord) error {
+	if rec.Phase == v1alpha1.AnalysisPhaseSuccessful && !cfg.OnSuccess {
+		return nil
+	}
+	msg := newSlackMessage(rec)
+	if cfg.WebhookSecretRef != nil {
+		webhookURL, err := readSecretKeyRef(ctx, cfg.WebhookSecretRef)
+		if err != nil {
+			return fmt.Errorf("failed to get Slack webhook URL from secret: %v", err)
+		}
+		// Incoming webhooks post to the channel they were created for
+		return postJSON(ctx, webhookURL, nil, msg)
+	}
+
+	if cfg.Channel == "" {
+		return fmt.Errorf("slack channel is required with a bot token")
+	}
+	token, err := readSecretRefOrDefault(ctx, cfg.TokenSecretRef, "slack_token")
+	if err != nil {
+		return fmt.Errorf("failed to get Slack token from secret: %v", err)
+	}
+	msg.Channel = cfg.Channel
+	var resp slackPostMessageResponse
+	auth := func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	if err := gitAPIRequest(ctx, http.MethodPost, slackPostMessageURL, auth, msg, &resp); err != nil {
+		return fmt.Errorf("failed to post Slack message: %v", err)
+	}
+	if !resp.OK {
+		return fmt.Errorf("failed to post Slack message to %s: %s", cfg.Channel, resp.Error)
+	}
+	return nil
+}
+
+// newSlackMessage formats the decision with the verdict, confidence, root cause and links
+func newSlackMessage(rec decisionRecord) slackMessage {
+	target := rec.AnalysisRun
+	if rec.Rollout != "" {
+		target = rec.Rollout
+	}
+	verdict := ":x: Canary analysis failed"
+	switch rec.Phase {
+	case v1alpha1.AnalysisPhaseSuccessful:
+		verdict = ":white_check_mark: Canary analysis passed"
+	case v1alpha1.AnalysisPhaseInconclusive:
+		verdict = ":grey_question: Canary analysis inconclusive"
+	}
+	title := fmt.Sprintf("%s for %s/%s", verdict, rec.Namespace, target)
+
+	blocks := []slackBlock{
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*" + title + "*"}},
+		{Type: "section", Fields: []slackText{
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Confidence*\n%d%%", rec.Confidence)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Severity*\n%s", rec.Severity)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Metric*\n%s", rec.Metric)},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*AnalysisRun*\n%s", rec.AnalysisRun)},
+		}},
+	}
+	if rec.RootCause != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*Root cause*\n" + truncate(rec.RootCause, 2000)}})
+	} else if rec.Analysis != "" {
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncate(rec.Analysis, 2000)}})
+	}
+	var links []string
+	if rec.IssueURL != "" {
+		links = append(links, fmt.Sprintf("<%s|Issue>", rec.IssueURL))
+	}
+	if rec.DashboardURL != "" {
+		links = append(links, fmt.Sprintf("<%s|Dashboard>", rec.DashboardURL))
+	}
+	if len(links) > 0 {
+		blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: strings.Join(links, " | ")}}})
+	}
+	return slackMessage{
+		Text:   fmt.Sprintf("%s (confidence %d%%)", title, rec.Confidence),
+		Blocks: blocks,
+	}
+}
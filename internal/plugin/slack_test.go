@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestNewSlackMessage(t *testing.T) {
+	rec := decisionRecord{
+		AnalysisRun:  "checkout-abc-1",
+		Namespace:    "shop",
+		Rollout:      "checkout",
+		Metric:       "ai",
+		Phase:        v1alpha1.AnalysisPhaseFailed,
+		Confidence:   92,
+		Severity:     SeverityCritical,
+		RootCause:    "nil pointer dereference in the payment handler",
+		IssueURL:     "https://github.com/acme/checkout/issues/7",
+		DashboardURL: "https://rollouts.example.com/rollouts/rollout/shop/checkout",
+	}
+	msg := newSlackMessage(rec)
+	if !strings.Contains(msg.Text, "failed for shop/checkout") || !strings.Contains(msg.Text, "92%") {
+		t.Errorf("unexpected fallback text: %s", msg.Text)
+	}
+	// Slack decodes the escaped < and > of encoding/json, compare the unescaped message
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(msg)
+	raw := buf.String()
+	for _, want := range []string{"nil pointer dereference", "<https://github.com/acme/checkout/issues/7|Issue>", "|Dashboard>"} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected message to contain %q, got %s", want, raw)
+		}
+	}
+
+	// Passed analyses are only posted with onSuccess
+	rec.Phase = v1alpha1.AnalysisPhaseSuccessful
+	if err := notifySlack(context.Background(), &slackConfig{}, rec); err != nil {
+		t.Errorf("expected passed analysis not to be posted, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Defaults for waiting on canary traffic before analyzing
+const (
+	defaultTrafficWaitTimeout  = 5 * time.Minute
+	defaultTrafficPollInterval = 15 * time.Second
+)
+
+// defaultRequestPattern matches common access log lines when no trafficMarker is configured
+var defaultRequestPattern = regexp.MustCompile(`\b(?:GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS) +/|\bHTTP/[0-9.]+"? +[1-5][0-9]{2}\b|\bstatus[=:]"? *[1-5][0-9]{2}\b`)
+
+// countRequests counts the log lines showing handled requests, using the marker regular
+// expression or, if empty, the common access log heuristic
+func countRequests(logs, marker string) (int, error) {
+	pattern := defaultRequestPattern
+	if marker != "" {
+		var err error
+		if pattern, err = regexp.Compile(marker); err != nil {
+			return 0, fmt.Errorf("invalid trafficMarker %q: %v", marker, err)
+		}
+	}
+	count := 0
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if pattern.MatchString(scanner.Text()) {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,29 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestCountRequests(t *testing.T) {
+	logs := "starting server on :8080\n" +
+		`10.0.0.1 - - [01/Jan/2024:00:00:00 +0000] "GET /api/items HTTP/1.1" 200 512` + "\n" +
+		`level=info msg="request handled" status=500` + "\n" +
+		"POST /api/orders took 12ms\n"
+	count, err := countRequests(logs, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 requests with the default heuristic, got %d", count)
+	}
+	count, err = countRequests(logs, `msg="request handled"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 request with a marker, got %d", count)
+	}
+	if _, err := countRequests(logs, "("); err == nil {
+		t.Error("expected an error for an invalid marker")
+	}
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genai"
+)
+
+// promptTokenMargin is the share of the model input token limit used for the prompt, leaving room
+// for the difference between the counted and the sent prompt (e.g. the trimming note)
+const promptTokenMargin = 0.9
+
+// modelTokenLimits caches the input token limit of the models
+var modelTokenLimits = struct {
+	sync.Mutex
+	limits map[string]int
+}{limits: make(map[string]int)}
+
+// countPromptTokens counts the tokens of a prompt for a model
+var countPromptTokens = func(ctx context.Context, client *genai.Client, model, prompt string) (int, error) {
+	resp, err := client.Models.CountTokens(ctx, model, []*genai.Content{genai.NewContentFromText(prompt, genai.RoleUser)}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.TotalTokens), nil
+}
+
+// modelInputTokenLimit returns the input token limit (context window) of a model
+var modelInputTokenLimit = func(ctx context.Context, client *genai.Client, model string) (int, error) {
+	modelTokenLimits.Lock()
+	limit, ok := modelTokenLimits.limits[model]
+	modelTokenLimits.Unlock()
+	if ok {
+		return limit, nil
+	}
+	m, err := client.Models.Get(ctx, model, nil)
+	if err != nil {
+		return 0, err
+	}
+	limit = int(m.InputTokenLimit)
+	modelTokenLimits.Lock()
+	modelTokenLimits.limits[model] = limit
+	modelTokenLimits.Unlock()
+	return limit, nil
+}
+
+// fitPromptToModel counts the tokens of the analysis prompt before sending it and trims the oldest
+// log lines when it does not fit in the model input token limit, instead of failing the request.
+// Token counting errors are logged and the prompt is sent as is. It returns the parameters to use
+// and whether the logs were trimmed.
+func fitPromptToModel(ctx context.Context, client *genai.Client, params AIAnalysisParams) (AIAnalysisParams, bool, error) {
+	limit, err := modelInputTokenLimit(ctx, client, params.ModelName)
+	if err != nil || limit <= 0 {
+		log.WithContext(ctx).WithError(err).WithField("model", params.ModelName).Debug("Unknown input token limit of the model, not counting prompt tokens")
+		return params, false, nil
+	}
+	prompt := analysisPrompt(params)
+	tokens, err := countPromptTokens(ctx, client, params.ModelName, prompt)
+	if err != nil {
+		log.WithContext(ctx).WithError(err).Warn("Failed to count prompt tokens, sending the prompt as is")
+		return params, false, nil
+	}
+	budget := int(float64(limit) * promptTokenMargin)
+	if tokens <= budget {
+		return params, false, nil
+	}
+
+	// Trim the logs by the share of tokens over the budget, estimating the tokens of the logs by
+	// their share of the prompt characters. The instructions are kept.
+	logsTokens := int(float64(tokens) * float64(len(params.LogsContext)) / float64(len(prompt)))
+	excess := tokens - budget
+	if logsTokens <= excess {
+		return params, false, fmt.Errorf("prompt of %d tokens exceeds the input limit of %d tokens of model %s without the logs", tokens, limit, params.ModelName)
+	}
+	trimmed := params
+	trimmed.LogsContext = trimLogsContext(params.LogsContext, float64(logsTokens-excess)/float64(logsTokens))
+	log.WithContext(ctx).WithFields(log.Fields{
+		"model":  params.ModelName,
+		"tokens": tokens,
+		"limit":  limit,
+	}).Warn("Prompt exceeds the model input token limit, trimming the oldest log lines")
+
+	tokens, err = countPromptTokens(ctx, client, params.ModelName, analysisPrompt(trimmed))
+	if err == nil && tokens > limit {
+		return params, false, fmt.Errorf("prompt of %d tokens exceeds the input limit of %d tokens of model %s after trimming the logs", tokens, limit, params.ModelName)
+	}
+	return trimmed, true, nil
+}
+
+// trimLogsContext keeps the most recent share of the stable and canary logs, starting at a line
+func trimLogsContext(logsContext string, share float64) string {
+	const stableMarker, canaryMarker = "--- STABLE LOGS ---\n", "\n\n--- CANARY LOGS ---\n"
+	stableIdx, canaryIdx := strings.Index(logsContext, stableMarker), strings.Index(logsContext, canaryMarker)
+	if stableIdx != 0 || canaryIdx == -1 {
+		return trimLogs(logsContext, share)
+	}
+	stable := logsContext[len(stableMarker):canaryIdx]
+	canary := logsContext[canaryIdx+len(canaryMarker):]
+	return stableMarker + trimLogs(stable, share) + canaryMarker + trimLogs(canary, share)
+}
+
+// trimLogs keeps the most recent share of the logs, starting at a line, noting the trimmed lines
+func trimLogs(logs string, share float64) string {
+	keep := int(float64(len(logs)) * share)
+	if keep >= len(logs) {
+		return logs
+	}
+	start := len(logs) - keep
+	if i := strings.IndexByte(logs[start:], '\n'); i >= 0 {
+		start += i + 1
+	} else {
+		start = len(logs)
+	}
+	return fmt.Sprintf("[%d older log lines trimmed to fit the model context window]\n", strings.Count(logs[:start], "\n")) + logs[start:]
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestFitPromptToModel(t *testing.T) {
+	oldLimit, oldCount := modelInputTokenLimit, countPromptTokens
+	t.Cleanup(func() { modelInputTokenLimit, countPromptTokens = oldLimit, oldCount })
+	// One token per character
+	modelInputTokenLimit = func(context.Context, *genai.Client, string) (int, error) { return 20000, nil }
+	countPromptTokens = func(_ context.Context, _ *genai.Client, _ string, prompt string) (int, error) {
+		return len(prompt), nil
+	}
+
+	params := AIAnalysisParams{ModelName: "gemini-2.0-flash", LogsContext: "--- STABLE LOGS ---\nok\n\n--- CANARY LOGS ---\nok"}
+	fitted, trimmed, err := fitPromptToModel(context.Background(), nil, params)
+	if err != nil || trimmed || fitted.LogsContext != params.LogsContext {
+		t.Fatalf("expected a prompt within the limit to be unchanged, got trimmed %t, error %v", trimmed, err)
+	}
+
+	var stable, canary strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&stable, "stable line %04d\n", i)
+		fmt.Fprintf(&canary, "canary line %04d\n", i)
+	}
+	params.LogsContext = "--- STABLE LOGS ---\n" + stable.String() + "\n\n--- CANARY LOGS ---\n" + canary.String()
+	fitted, trimmed, err = fitPromptToModel(context.Background(), nil, params)
+	if err != nil || !trimmed {
+		t.Fatalf("expected the logs to be trimmed, got trimmed %t, error %v", trimmed, err)
+	}
+	if n := len(analysisPrompt(fitted)); n > 20000 {
+		t.Errorf("expected the trimmed prompt within the limit, got %d tokens", n)
+	}
+	for _, want := range []string{"--- STABLE LOGS ---\n[", "stable line 0999", "--- CANARY LOGS ---\n[", "canary line 0999", "older log lines trimmed"} {
+		if !strings.Contains(fitted.LogsContext, want) {
+			t.Errorf("expected the trimmed logs to contain %q", want)
+		}
+	}
+	if strings.Contains(fitted.LogsContext, "canary line 0000") {
+		t.Error("expected the oldest canary lines to be trimmed")
+	}
+
+	// Instructions alone over the limit cannot be fixed by trimming
+	modelInputTokenLimit = func(context.Context, *genai.Client, string) (int, error) { return 100, nil }
+	if _, _, err := fitPromptToModel(context.Background(), nil, params); err == nil {
+		t.Error("expected an error when the instructions exceed the limit")
+	}
+}
@@ -0,0 +1,319 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Standard OpenTelemetry trace exporter environment variables
+const (
+	envOTLPTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	envOTelTracesExporter = "OTEL_TRACES_EXPORTER"
+)
+
+// traceparentHeader propagates the span of outbound requests (W3C Trace Context)
+const traceparentHeader = "traceparent"
+
+// traceExportTimeout bounds the export of a measurement trace, which is independent of the
+// measurement timeout so traces of timed out measurements are kept
+const traceExportTimeout = 10 * time.Second
+
+// OTLP span kinds and status codes
+const (
+	otelSpanKindInternal = 1
+	otelSpanKindClient   = 3
+	otelStatusOK         = 1
+	otelStatusError      = 2
+)
+
+// otlpTracesEndpoint returns the OTLP/HTTP traces endpoint, or "" when tracing is disabled
+func otlpTracesEndpoint() string {
+	if os.Getenv(envOTelTracesExporter) == "none" {
+		return ""
+	}
+	if endpoint := os.Getenv(envOTLPTracesEndpoint); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv(envOTLPEndpoint); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// measurementTrace collects the spans of a measurement, exported together when it finishes
+type measurementTrace struct {
+	traceID string
+
+	mu    sync.Mutex
+	spans []*traceSpan
+}
+
+// traceSpan is an operation of a measurement. A nil span, of untraced measurements, is a no-op.
+type traceSpan struct {
+	trace      *measurementTrace
+	spanID     string
+	parentID   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes []map[string]interface{}
+	err        string
+}
+
+type traceSpanKey struct{}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// Not expected, ids only need to be unique enough to tell traces apart
+		return fmt.Sprintf("%0*x", 2*n, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// startMeasurementTrace starts the root span of a measurement when an OTLP traces endpoint is configured,
+// attributed with the rollout and AnalysisRun so slow measurements can be found in the tracing backend
+func startMeasurementTrace(ctx context.Context, analysisRun *v1alpha1.AnalysisRun, metric, agentJobID string) (context.Context, *traceSpan) {
+	if otlpTracesEndpoint() == "" {
+		return ctx, nil
+	}
+	attributes := []map[string]interface{}{
+		otlpAttribute("k8s.namespace.name", analysisRun.Namespace),
+		otlpAttribute("argo.analysisrun.name", analysisRun.Name),
+		otlpAttribute("argo.analysisrun.uid", string(analysisRun.UID)),
+		otlpAttribute("argo.metric.name", metric),
+	}
+	if rollout := rolloutNameFromAnalysisRun(analysisRun); rollout != "" {
+		attributes = append(attributes, otlpAttribute("argo.rollout.name", rollout))
+	}
+	if agentJobID != "" {
+		attributes = append(attributes, otlpAttribute("metricai.agent.job_id", agentJobID))
+	}
+	if id := correlationID(ctx); id != "" {
+		attributes = append(attributes, otlpAttribute("metricai.correlation_id", id))
+	}
+	span := &traceSpan{
+		trace:      &measurementTrace{traceID: randomHex(16)},
+		spanID:     randomHex(8),
+		name:       "metricai.measurement",
+		kind:       otelSpanKindInternal,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+	span.trace.spans = append(span.trace.spans, span)
+	return context.WithValue(ctx, traceSpanKey{}, span), span
+}
+
+// currentSpan returns the span of a context, nil when the measurement is not traced
+func currentSpan(ctx context.Context) *traceSpan {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(traceSpanKey{}).(*traceSpan)
+	return span
+}
+
+// startSpan starts a child span of the span of the context, a no-op when the measurement is not traced
+func startSpan(ctx context.Context, name string, attributes ...map[string]interface{}) (context.Context, *traceSpan) {
+	return startSpanKind(ctx, name, otelSpanKindInternal, attributes...)
+}
+
+func startSpanKind(ctx context.Context, name string, kind int, attributes ...map[string]interface{}) (context.Context, *traceSpan) {
+	parent := currentSpan(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &traceSpan{
+		trace:      parent.trace,
+		spanID:     randomHex(8),
+		parentID:   parent.spanID,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: attributes,
+	}
+	parent.trace.mu.Lock()
+	parent.trace.spans = append(parent.trace.spans, span)
+	parent.trace.mu.Unlock()
+	return context.WithValue(ctx, traceSpanKey{}, span), span
+}
+
+// setAttributes adds attributes to the span
+func (s *traceSpan) setAttributes(attributes ...map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// finish ends the span, with an error status when err is set
+func (s *traceSpan) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+}
+
+// traced runs fn in a child span of the span of the context
+func traced(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	ctx, span := startSpan(ctx, name)
+	err := fn(ctx)
+	span.finish(err)
+	return err
+}
+
+// traceparent returns the W3C traceparent header value of the span
+func (s *traceSpan) traceparent() string {
+	return "00-" + s.trace.traceID + "-" + s.spanID + "-01"
+}
+
+// finishMeasurementTrace ends the root span of a measurement with its phase and exports the trace
+func finishMeasurementTrace(span *traceSpan, measurement v1alpha1.Measurement) {
+	if span == nil {
+		return
+	}
+	span.setAttributes(otlpAttribute("metricai.phase", string(measurement.Phase)))
+	if measurement.Value != "" {
+		span.setAttributes(otlpAttribute("metricai.value", measurement.Value))
+	}
+	var err error
+	if measurement.Phase == v1alpha1.AnalysisPhaseError {
+		err = errors.New(measurement.Message)
+	}
+	span.finish(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	if exportErr := exportTrace(ctx, span.trace); exportErr != nil {
+		log.WithError(exportErr).WithField("traceId", span.trace.traceID).Warn("Failed to export measurement trace")
+	}
+}
+
+// exportTrace sends the spans of a measurement to the collector using OTLP/HTTP with JSON encoding.
+// Spans still running, e.g. of abandoned background calls, are not exported.
+func exportTrace(ctx context.Context, trace *measurementTrace) error {
+	endpoint := otlpTracesEndpoint()
+	if endpoint == "" {
+		return nil
+	}
+
+	trace.mu.Lock()
+	spans := make([]map[string]interface{}, 0, len(trace.spans))
+	for _, s := range trace.spans {
+		if s.end.IsZero() {
+			continue
+		}
+		status := map[string]interface{}{"code": otelStatusOK}
+		if s.err != "" {
+			status = map[string]interface{}{"code": otelStatusError, "message": s.err}
+		}
+		span := map[string]interface{}{
+			"traceId":           trace.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        s.attributes,
+			"status":            status,
+		}
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+		spans = append(spans, span)
+	}
+	trace.mu.Unlock()
+
+	payload := map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": []map[string]interface{}{otlpAttribute("service.name", otelServiceName())},
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]interface{}{"name": otelScopeName},
+				"spans": spans,
+			}},
+		}},
+	}
+	return postJSON(ctx, endpoint, otlpHeaders(), payload)
+}
+
+// traceIDs returns the trace and span IDs of the span of a context, "" when the measurement is not traced
+func traceIDs(ctx context.Context) (string, string) {
+	span := currentSpan(ctx)
+	if span == nil {
+		return "", ""
+	}
+	return span.trace.traceID, span.spanID
+}
+
+// startHTTPSpan starts a client span of an outbound request, used by correlationTransport
+func startHTTPSpan(req *http.Request) (*http.Request, *traceSpan) {
+	ctx, span := startSpanKind(req.Context(), "HTTP "+req.Method, otelSpanKindClient,
+		otlpAttribute("http.request.method", req.Method),
+		otlpAttribute("server.address", req.URL.Hostname()),
+		otlpAttribute("url.path", req.URL.Path),
+	)
+	if span == nil {
+		return req, nil
+	}
+	req = req.Clone(ctx)
+	req.Header.Set(traceparentHeader, span.traceparent())
+	return req, span
+}
+
+// finishHTTPSpan ends the client span of an outbound request, failed by transport and server errors
+func finishHTTPSpan(span *traceSpan, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	if err == nil {
+		span.setAttributes(otlpAttribute("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= 500 {
+			err = errors.New(resp.Status)
+		}
+	}
+	span.finish(err)
+}
+
+// tracedLogsFetcher records a span for each fetch of pod logs
+func tracedLogsFetcher(fetchLogs podLogsFetcher) podLogsFetcher {
+	return func(ctx context.Context, client *kubernetes.Clientset, namespace, labelSelector string, opts podLogOptions) (string, podLogSample, error) {
+		ctx, span := startSpan(ctx, "metricai.logs.fetch",
+			otlpAttribute("k8s.namespace.name", namespace),
+			otlpAttribute("metricai.label_selector", labelSelector),
+		)
+		logs, sample, err := fetchLogs(ctx, client, namespace, labelSelector, opts)
+		span.setAttributes(otlpAttribute("metricai.logs.bytes", len(logs)))
+		if sample.Pod != "" {
+			span.setAttributes(otlpAttribute("k8s.pod.name", sample.Pod))
+		}
+		span.finish(err)
+		return logs, sample, err
+	}
+}
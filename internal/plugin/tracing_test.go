@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestMeasurementTracing(t *testing.T) {
+	var traceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(traceparentHeader)
+	}))
+	defer backend.Close()
+
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Status       struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer collector.Close()
+	t.Setenv(envOTLPEndpoint, collector.URL)
+
+	analysisRun := &v1alpha1.AnalysisRun{}
+	analysisRun.Name, analysisRun.Namespace = "run", "default"
+	ctx, root := startMeasurementTrace(context.Background(), analysisRun, "ai", "")
+	if root == nil {
+		t.Fatal("expected the measurement to be traced")
+	}
+	err := traced(ctx, "metricai.github.issue", func(ctx context.Context) error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL, nil)
+		resp, err := (&http.Client{Transport: &correlationTransport{base: http.DefaultTransport}}).Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return fmt.Errorf("issue not created")
+	})
+	if err == nil {
+		t.Fatal("expected the error of the traced function")
+	}
+	traceID, spanID := traceIDs(ctx)
+	finishMeasurementTrace(root, v1alpha1.Measurement{Phase: v1alpha1.AnalysisPhaseSuccessful, Value: "1"})
+
+	if len(payload.ResourceSpans) != 1 || len(payload.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected trace payload %+v", payload)
+	}
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("expected the measurement, issue and HTTP spans, got %+v", spans)
+	}
+	measurementSpan, issueSpan, httpSpan := spans[0], spans[1], spans[2]
+	if measurementSpan.TraceID != traceID || measurementSpan.SpanID != spanID || measurementSpan.ParentSpanID != "" {
+		t.Errorf("unexpected measurement span %+v", measurementSpan)
+	}
+	if issueSpan.ParentSpanID != measurementSpan.SpanID || issueSpan.Status.Code != otelStatusError {
+		t.Errorf("unexpected issue span %+v", issueSpan)
+	}
+	if httpSpan.Name != "HTTP GET" || httpSpan.ParentSpanID != issueSpan.SpanID || httpSpan.Status.Code != otelStatusOK {
+		t.Errorf("unexpected HTTP span %+v", httpSpan)
+	}
+	if want := "00-" + traceID + "-" + httpSpan.SpanID + "-01"; traceparent != want {
+		t.Errorf("expected traceparent %q, got %q", want, traceparent)
+	}
+
+	t.Setenv(envOTelTracesExporter, "none")
+	if _, span := startMeasurementTrace(context.Background(), analysisRun, "ai", ""); span != nil {
+		t.Error("expected no trace with OTEL_TRACES_EXPORTER=none")
+	}
+}
@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+// verdictContextTTL bounds how long the canary message types of a measurement are kept for comparison
+const verdictContextTTL = 24 * time.Hour
+
+// maxVerdictExamples bounds the number of message types quoted in a verdict change explanation
+const maxVerdictExamples = 3
+
+// verdictContext is the evidence behind the last measurement of a metric
+type verdictContext struct {
+	messageTypes map[string]bool
+	recordedAt   time.Time
+}
+
+// verdictContexts holds the canary message types of the last measurement per AnalysisRun and metric
+var verdictContexts = struct {
+	sync.Mutex
+	entries map[string]verdictContext
+}{entries: make(map[string]verdictContext)}
+
+// swapVerdictContext records the canary message types of the current measurement and returns those
+// of the previous one, or nil if unknown (first measurement or plugin restart)
+func swapVerdictContext(runUID, metricName string, messageTypes map[string]bool) map[string]bool {
+	key := runUID + "/" + metricName
+	now := time.Now()
+
+	verdictContexts.Lock()
+	defer verdictContexts.Unlock()
+	for k, e := range verdictContexts.entries {
+		if now.Sub(e.recordedAt) > verdictContextTTL {
+			delete(verdictContexts.entries, k)
+		}
+	}
+	previous, ok := verdictContexts.entries[key]
+	verdictContexts.entries[key] = verdictContext{messageTypes: messageTypes, recordedAt: now}
+	if !ok {
+		return nil
+	}
+	return previous.messageTypes
+}
+
+// lastCompletedMeasurement returns the latest completed measurement of the metric carrying an AI verdict
+func lastCompletedMeasurement(analysisRun *v1alpha1.AnalysisRun, metric v1alpha1.Metric) *v1alpha1.Measurement {
+	if analysisRun == nil {
+		return nil
+	}
+	for _, mr := range analysisRun.Status.MetricResults {
+		if mr.Name != metric.Name {
+			continue
+		}
+		for i := len(mr.Measurements) - 1; i >= 0; i-- {
+			m := mr.Measurements[i]
+			if m.Phase.Completed() && m.Metadata["promote"] != "" {
+				return &m
+			}
+		}
+	}
+	return nil
+}
+
+// explainVerdictChange describes what changed when the phase of the measurement differs from the previous
+// one, comparing decision details and, when known, the canary message types of both measurements.
+// The phase is the final one, after the majority, the severity policy and the metric conditions.
+// It returns an empty string when the phase did not change.
+func explainVerdictChange(previous *v1alpha1.Measurement, phase v1alpha1.AnalysisPhase, previousTypes, currentTypes map[string]bool, result AIAnalysisResult) string {
+	if previous == nil || previous.Phase == phase {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Verdict changed from %s to %s (confidence %s -> %d, severity %s -> %s).",
+		previous.Phase, phase,
+		previous.Metadata["confidence"], result.Confidence,
+		previous.Metadata["severity"], effectiveSeverity(result))
+
+	if previousTypes != nil {
+		added := messageTypeDiff(currentTypes, previousTypes)
+		removed := messageTypeDiff(previousTypes, currentTypes)
+		switch {
+		case len(added) == 0 && len(removed) == 0:
+			b.WriteString(" The canary logs show the same message types as before, so the model judged the same evidence differently.")
+		default:
+			if len(added) > 0 {
+				fmt.Fprintf(&b, " %d new message types in the canary logs, e.g. %s.", len(added), quoteExamples(added))
+			}
+			if len(removed) > 0 {
+				fmt.Fprintf(&b, " %d message types no longer seen, e.g. %s.", len(removed), quoteExamples(removed))
+			}
+		}
+	}
+
+	if prev := previous.Metadata["rootCause"]; prev != "" && prev != result.RootCause {
+		fmt.Fprintf(&b, " Previous root cause: %s.", truncate(prev, 200))
+	}
+	if result.RootCause != "" && result.RootCause != previous.Metadata["rootCause"] {
+		fmt.Fprintf(&b, " Current root cause: %s.", truncate(result.RootCause, 200))
+	}
+	return b.String()
+}
+
+// messageTypeDiff returns the sorted message types in a that are not in b
+func messageTypeDiff(a, b map[string]bool) []string {
+	var diff []string
+	for t := range a {
+		if !b[t] {
+			diff = append(diff, t)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// quoteExamples quotes the first message types of the list
+func quoteExamples(types []string) string {
+	if len(types) > maxVerdictExamples {
+		types = types[:maxVerdictExamples]
+	}
+	quoted := make([]string, len(types))
+	for i, t := range types {
+		quoted[i] = fmt.Sprintf("%q", truncate(t, 120))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,36 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestExplainVerdictChange(t *testing.T) {
+	previous := &v1alpha1.Measurement{
+		Phase:    v1alpha1.AnalysisPhaseSuccessful,
+		Metadata: map[string]string{"promote": "true", "confidence": "90", "severity": "none"},
+	}
+	previousTypes := logMessageTypes("GET /health 200\n")
+	currentTypes := logMessageTypes("GET /health 200\nERROR connection refused to db-1\n")
+
+	if got := explainVerdictChange(previous, v1alpha1.AnalysisPhaseSuccessful, previousTypes, currentTypes, AIAnalysisResult{Promote: true}); got != "" {
+		t.Errorf("expected no explanation for an unchanged phase, got %q", got)
+	}
+	// A failed verdict overridden by the severity policy or the conditions keeps the phase
+	if got := explainVerdictChange(previous, v1alpha1.AnalysisPhaseSuccessful, previousTypes, currentTypes, AIAnalysisResult{Promote: false}); got != "" {
+		t.Errorf("expected no explanation for an unchanged phase, got %q", got)
+	}
+	got := explainVerdictChange(previous, v1alpha1.AnalysisPhaseFailed, previousTypes, currentTypes, AIAnalysisResult{
+		Promote: false, Confidence: 80, Severity: SeverityMajor, RootCause: "database unreachable",
+	})
+	for _, want := range []string{"from Successful to Failed", "severity none -> major", "1 new message types", "connection refused", "database unreachable"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected explanation to contain %q, got %q", want, got)
+		}
+	}
+	if got := explainVerdictChange(previous, v1alpha1.AnalysisPhaseInconclusive, nil, currentTypes, AIAnalysisResult{Promote: true}); !strings.Contains(got, "from Successful to Inconclusive") {
+		t.Errorf("expected an explanation without previous message types, got %q", got)
+	}
+}
@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 signature of signed webhook bodies
+const webhookSignatureHeader = "X-Metric-AI-Signature-256"
+
+// webhookConfig POSTs every decision to an arbitrary endpoint
+type webhookConfig struct {
+	// Endpoint receiving the decisions
+	URL string `json:"url"`
+	// Additional request headers
+	Headers map[string]string `json:"headers,omitempty"`
+	// Go template with [[ ]] delimiters of the JSON body with the decision record fields (default: the decision record)
+	Template string `json:"template,omitempty"`
+	// Secret key in the AnalysisRun namespace with the key signing the body with HMAC-SHA256
+	SigningKeySecretRef *secretKeyRef `json:"signingKeySecretRef,omitempty"`
+}
+
+// webhookTemplateFuncs are the functions available to webhook templates, "json" encodes a value
+// so strings can be embedded in the body safely
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// sendWebhook POSTs the decision to the webhook endpoint
+func sendWebhook(ctx context.Context, cfg webhookConfig, rec decisionRecord) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("webhook url is required")
+	}
+	body, err := webhookBody(cfg.Template, rec)
+	if err != nil {
+		return err
+	}
+	headers := make(map[string]string, len(cfg.Headers)+1)
+	for k, v := range cfg.Headers {
+		headers[k] = v
+	}
+	if cfg.SigningKeySecretRef != nil {
+		key, err := readSecretKeyRef(ctx, cfg.SigningKeySecretRef)
+		if err != nil {
+			return fmt.Errorf("failed to get webhook signing key from secret: %v", err)
+		}
+		headers[webhookSignatureHeader] = signWebhookBody(key, body)
+	}
+	return postJSONBody(ctx, cfg.URL, headers, body)
+}
+
+// webhookBody renders the webhook template, or encodes the decision record when there is none
+func webhookBody(text string, rec decisionRecord) ([]byte, error) {
+	if text == "" {
+		body, err := json.Marshal(rec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal decision: %v", err)
+		}
+		return body, nil
+	}
+	tmpl, err := template.New("webhook").Delims(templateLeftDelim, templateRightDelim).Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, rec); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %v", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("webhook template did not render valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// signWebhookBody returns the "sha256=<hex>" HMAC-SHA256 signature of a webhook body, the scheme
+// GitHub uses for its webhooks
+func signWebhookBody(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
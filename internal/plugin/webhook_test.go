@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1alpha1 "github.com/argoproj/argo-rollouts/pkg/apis/rollouts/v1alpha1"
+)
+
+func TestSendWebhook(t *testing.T) {
+	var gotBody []byte
+	var gotHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeader = r.Header.Get("X-Team")
+	}))
+	defer server.Close()
+
+	rec := decisionRecord{AnalysisRun: "checkout-abc-1", Namespace: "shop", Phase: v1alpha1.AnalysisPhaseFailed, Confidence: 90, Analysis: `error "rate"`}
+	cfg := webhookConfig{URL: server.URL, Headers: map[string]string{"X-Team": "checkout"}}
+	if err := sendWebhook(context.Background(), cfg, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded decisionRecord
+	if err := json.Unmarshal(gotBody, &decoded); err != nil || decoded.AnalysisRun != rec.AnalysisRun || gotHeader != "checkout" {
+		t.Errorf("unexpected request %s with header %q: %v", gotBody, gotHeader, err)
+	}
+
+	cfg.Template = `{"text": [[ json .Analysis ]], "failed": [[ eq .Phase "Failed" ]]}`
+	if err := sendWebhook(context.Background(), cfg, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(gotBody) != `{"text": "error \"rate\"", "failed": true}` {
+		t.Errorf("unexpected templated body %s", gotBody)
+	}
+	if _, err := webhookBody(`{"text": [[ .Analysis ]]}`, rec); err == nil {
+		t.Error("expected an error for a template rendering invalid JSON")
+	}
+}
+
+func TestSignWebhookBody(t *testing.T) {
+	// Example of the GitHub webhook documentation
+	got := signWebhookBody("It's a Secret to Everybody", []byte("Hello, World!"))
+	if got != "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17" {
+		t.Errorf("unexpected signature %s", got)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 
+	"github.com/argoproj-labs/rollouts-plugin-metric-ai/internal/migrate"
 	"github.com/argoproj-labs/rollouts-plugin-metric-ai/internal/plugin"
 	rolloutsPlugin "github.com/argoproj/argo-rollouts/metricproviders/plugin/rpc"
 	goPlugin "github.com/hashicorp/go-plugin"
@@ -37,10 +41,95 @@ func configureLogLevel() {
 	log.WithField("level", level.String()).Info("Log level configured")
 }
 
+// configureLogFormat sets the log format based on the LOG_FORMAT environment variable
+func configureLogFormat() {
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+	case "json":
+		// Use the keys and timestamp format of the go-plugin host, which parses JSON lines of the
+		// plugin output and logs their other fields as key/value pairs
+		log.SetFormatter(&log.JSONFormatter{
+			TimestampFormat: "2006-01-02T15:04:05.000000Z07:00",
+			FieldMap: log.FieldMap{
+				log.FieldKeyTime:  "@timestamp",
+				log.FieldKeyLevel: "@level",
+				log.FieldKeyMsg:   "@message",
+			},
+		})
+	default:
+		log.Warnf("Invalid log format '%s', using 'text' as default. Valid formats: text, json", format)
+	}
+}
+
+// runMigrate implements the migrate command, converting AnalysisTemplates using Prometheus or Datadog
+// metrics into metric-ai configurations
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	file := fs.String("f", "-", "AnalysisTemplate YAML file to migrate, - for stdin")
+	model := fs.String("model", "gemini-2.0-flash", "Gemini model of the generated metrics")
+	replace := fs.Bool("replace", false, "replace the migrated metrics instead of adding AI metrics next to them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: rollouts-plugin-metric-ai migrate [flags]
+
+Adds a metric-ai metric for every Prometheus or Datadog metric of an AnalysisTemplate. Only the text
+of the queries and conditions is carried over, into the extraPrompt: the queries are not run and the
+AI metric analyzes the pod logs. successCondition and failureCondition are not set on the AI metric,
+a warning lists them.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var in []byte
+	var err error
+	if *file == "-" {
+		in, err = io.ReadAll(os.Stdin)
+	} else {
+		in, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, warnings, err := migrate.Migrate(in, migrate.Options{Model: *model, Replace: *replace})
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
 func main() {
-	// Configure log level first
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	selfCheck := flag.Bool("self-check", false, "check the configuration, Gemini and the Kubernetes Agent, and exit")
+	flag.Parse()
+
+	// Configure log format and level first
+	configureLogFormat()
 	configureLogLevel()
 
+	if *selfCheck {
+		if err := plugin.SelfCheck(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "self-check: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logCtx := *log.WithFields(log.Fields{"plugin": "ai"})
 
 	rpcPluginImp := &plugin.RpcPlugin{